@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/tchenbz/AWTtest_3/internal/validator"
+)
+
+const maxBatchRequests = 50
+
+// batchRequest is one request of a batch. Headers are added to the ones the
+// request inherits from the batch (its Authorization header and an Accept
+// header asking for JSON).
+type batchRequest struct {
+	ID      string            `json:"id"`
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers"`
+	Body    json.RawMessage   `json:"body"`
+}
+
+type batchResponse struct {
+	ID      string            `json:"id,omitempty"`
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    any               `json:"body,omitempty"`
+}
+
+var batchMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// batchHandler runs an array of requests through the API's own routes and
+// returns their responses in the same order. With ?transaction=true the
+// requests share one database transaction: it is committed only when every
+// request succeeds, and the requests after a failed one aren't run.
+func (a *applicationDependencies) batchHandler(w http.ResponseWriter, r *http.Request) {
+	var input []batchRequest
+	err := a.readJSON(w, r, &input)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	transactional, err := strconv.ParseBool(a.getSingleQueryParameter(r.URL.Query(), "transaction", "false"))
+	v.Check(err == nil, "transaction", "must be true or false")
+	v.Check(len(input) > 0, "requests", "must contain at least one request")
+	v.Check(len(input) <= maxBatchRequests, "requests", fmt.Sprintf("must not contain more than %d requests", maxBatchRequests))
+	for i, req := range input {
+		validateBatchRequest(v, fmt.Sprintf("requests[%d]", i), req, transactional)
+	}
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !transactional {
+		responses, _ := a.runBatch(r, input, false)
+		err = a.writeResponse(w, r, http.StatusOK, envelope{"responses": responses}, nil)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// The routes of a are bound to the database, so the requests of a
+	// transaction run through routes of their own, whose models are all
+	// bound to the transaction.
+	tx, err := a.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	defer tx.Rollback()
+
+	app := &applicationDependencies{
+		config:  a.config,
+		logger:  a.logger,
+		db:      a.db,
+		limiter: a.limiter,
+	}
+	app.setModels(tx)
+
+	responses, failed := app.runBatch(r, input, true)
+	if !failed {
+		err = tx.Commit()
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	data := envelope{
+		"responses": responses,
+		"committed": !failed,
+	}
+	err = a.writeResponse(w, r, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func validateBatchRequest(v *validator.Validator, key string, req batchRequest, transactional bool) {
+	v.Check(validator.PermittedValue(req.Method, batchMethods...), key+".method", "must be one of "+strings.Join(batchMethods, ", "))
+	v.Check(strings.HasPrefix(req.Path, "/v1/"), key+".path", "must be an API path starting with /v1/")
+	v.Check(!strings.HasPrefix(req.Path, "/v1/batch"), key+".path", "batches can't be nested")
+	// Imports carry on in the background after their request returns, so
+	// they can't be part of a transaction.
+	imports := strings.HasPrefix(req.Path, "/v1/imports") || strings.HasPrefix(req.Path, "/v1/books/import")
+	v.Check(!transactional || !imports, key+".path", "imports can't run in a transaction")
+}
+
+// runBatch runs the requests one after the other through the routes of a,
+// so that each goes through the same middleware, authentication and rate
+// limiting as a request of its own. It reports whether any of them failed;
+// with stopOnFailure the requests after a failure are answered with 424
+// Failed Dependency instead of being run.
+func (a *applicationDependencies) runBatch(r *http.Request, input []batchRequest, stopOnFailure bool) ([]*batchResponse, bool) {
+	handler := a.handler()
+	responses := make([]*batchResponse, len(input))
+	failed := false
+
+	for i, req := range input {
+		if failed && stopOnFailure {
+			responses[i] = &batchResponse{
+				ID:     req.ID,
+				Status: http.StatusFailedDependency,
+				Body:   envelope{"error": "not run because an earlier request in the transaction failed"},
+			}
+			continue
+		}
+
+		rec := &batchRecorder{header: make(http.Header)}
+		handler.ServeHTTP(rec, newBatchSubRequest(r, req))
+
+		responses[i] = rec.response(req.ID)
+		if responses[i].Status >= 400 {
+			failed = true
+		}
+	}
+
+	return responses, failed
+}
+
+func newBatchSubRequest(r *http.Request, req batchRequest) *http.Request {
+	var body io.Reader = http.NoBody
+	hasBody := len(req.Body) > 0 && string(req.Body) != "null"
+	if hasBody {
+		body = bytes.NewReader(req.Body)
+	}
+
+	// The path has been checked to be an absolute API path, which always
+	// parses as a URL.
+	sub, _ := http.NewRequestWithContext(r.Context(), req.Method, req.Path, body)
+	sub.RemoteAddr = r.RemoteAddr
+	sub.Host = r.Host
+	sub.TLS = r.TLS
+
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		sub.Header.Set("Authorization", auth)
+	}
+	sub.Header.Set("Accept", "application/json")
+	if hasBody {
+		sub.Header.Set("Content-Type", "application/json")
+	}
+	for name, value := range req.Headers {
+		sub.Header.Set(name, value)
+	}
+
+	return sub
+}
+
+// batchRecorder captures the response to a request of a batch.
+type batchRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *batchRecorder) Header() http.Header {
+	return rec.header
+}
+
+func (rec *batchRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+}
+
+func (rec *batchRecorder) Write(b []byte) (int, error) {
+	rec.WriteHeader(http.StatusOK)
+	return rec.body.Write(b)
+}
+
+// response returns the captured response. JSON bodies are embedded as they
+// are; any other body is embedded as a string.
+func (rec *batchRecorder) response(id string) *batchResponse {
+	resp := &batchResponse{
+		ID:      id,
+		Status:  rec.status,
+		Headers: map[string]string{},
+	}
+	if resp.Status == 0 {
+		resp.Status = http.StatusOK
+	}
+
+	for name := range rec.header {
+		resp.Headers[name] = strings.Join(rec.header.Values(name), ", ")
+	}
+
+	body := bytes.TrimSpace(rec.body.Bytes())
+	if len(body) == 0 {
+		return resp
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(rec.header.Get("Content-Type"))
+	if (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")) && json.Valid(body) {
+		resp.Body = json.RawMessage(body)
+	} else {
+		resp.Body = string(body)
+	}
+
+	return resp
+}
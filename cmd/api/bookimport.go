@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tchenbz/AWTtest_3/internal/data"
+	"github.com/tchenbz/AWTtest_3/internal/validator"
+)
+
+// maxImportBytes caps the size of a bulk import body. Imports are streamed,
+// so this is far above the limit readJSON applies to ordinary requests.
+const maxImportBytes = 100 << 20
+
+// bookImportColumns are the CSV columns understood by the bulk import. The
+// authors column holds a ';'-separated list of names.
+var bookImportColumns = []string{
+	"title", "authors", "isbn", "publication_date", "genre", "description",
+	"average_rating", "format", "language", "publisher", "page_count",
+}
+
+// bookImportRecord is one line of an NDJSON import.
+type bookImportRecord struct {
+	Title           string             `json:"title"`
+	Authors         []*data.BookAuthor `json:"authors"`
+	ISBN            string             `json:"isbn"`
+	PublicationDate string             `json:"publication_date"`
+	Genre           string             `json:"genre"`
+	Description     string             `json:"description"`
+	AverageRating   float64            `json:"average_rating"`
+	Format          string             `json:"format"`
+	Language        string             `json:"language"`
+	Publisher       string             `json:"publisher"`
+	PageCount       int                `json:"page_count"`
+}
+
+// importBooksHandler creates or updates books in bulk from a CSV or NDJSON
+// body, matching existing books by ISBN. Rows are written in batches and a
+// bad row is reported without failing the rest of the import. With
+// ?dry_run=true nothing is committed.
+func (a *applicationDependencies) importBooksHandler(w http.ResponseWriter, r *http.Request) {
+	dryRun, err := strconv.ParseBool(a.getSingleQueryParameter(r.URL.Query(), "dry_run", "false"))
+	if err != nil {
+		a.badRequestResponse(w, r, errors.New("dry_run must be a boolean"))
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	var next func() (*data.ImportRow, error)
+	result := &data.ImportResult{DryRun: dryRun, Errors: []*data.ImportRowError{}, Logger: a.logger}
+	body := http.MaxBytesReader(w, r.Body, maxImportBytes)
+
+	switch mediaType {
+	case "text/csv":
+		next, err = csvBookRows(body, result)
+	case "application/x-ndjson", "application/jsonl":
+		next, err = ndjsonBookRows(body, result)
+	default:
+		a.errorResponseJSON(w, r, http.StatusUnsupportedMediaType, "the body must be text/csv or application/x-ndjson")
+		return
+	}
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	a.runImport(w, r, next, dryRun, result)
+}
+
+// runImport feeds the rows returned by next to the book model in batches
+// and responds with the result. next returns io.EOF after the last row and
+// may return a nil row for one it has already recorded on result.
+func (a *applicationDependencies) runImport(w http.ResponseWriter, r *http.Request, next func() (*data.ImportRow, error), dryRun bool, result *data.ImportResult) {
+	// Large imports outlive the server's read and write timeouts, so push
+	// the deadlines back before each batch.
+	rc := http.NewResponseController(w)
+
+	batch := make([]*data.ImportRow, 0, data.ImportBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		deadline := time.Now().Add(time.Minute)
+		rc.SetReadDeadline(deadline)
+		rc.SetWriteDeadline(deadline)
+
+		err := a.bookModel.ImportBatch(batch, dryRun, result)
+		batch = batch[:0]
+		return err
+	}
+
+	for {
+		row, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			var maxBytesError *http.MaxBytesError
+			if errors.As(err, &maxBytesError) {
+				a.errorResponseJSON(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("the body must not be larger than %d bytes", maxBytesError.Limit))
+				return
+			}
+			a.badRequestResponse(w, r, err)
+			return
+		}
+		if row == nil {
+			continue
+		}
+
+		batch = append(batch, row)
+		if len(batch) == data.ImportBatchSize {
+			err = flush()
+			if err != nil {
+				a.serverErrorResponse(w, r, err)
+				return
+			}
+		}
+	}
+
+	err := flush()
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{"import": result}
+	err = a.writeResponse(w, r, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// csvBookRows reads the header row of a CSV import and returns a function
+// yielding one row at a time. Rows that can't be parsed are recorded on
+// result and yielded as nil; io.EOF marks the end of the input.
+func csvBookRows(body io.Reader, result *data.ImportResult) (func() (*data.ImportRow, error), error) {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("the body must contain a CSV header row")
+		}
+		return nil, err
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if !validator.PermittedValue(name, bookImportColumns...) {
+			return nil, fmt.Errorf("unknown CSV column %q", name)
+		}
+		columns[name] = i
+	}
+	if _, ok := columns["title"]; !ok {
+		return nil, errors.New("the CSV header must include a title column")
+	}
+	if _, ok := columns["isbn"]; !ok {
+		return nil, errors.New("the CSV header must include an isbn column")
+	}
+
+	line := 1
+	return func() (*data.ImportRow, error) {
+		record, err := reader.Read()
+		if err != nil {
+			var parseError *csv.ParseError
+			if errors.As(err, &parseError) && !errors.Is(parseError.Err, csv.ErrQuote) {
+				line++
+				result.Reject(line, "", map[string]string{"error": parseError.Err.Error()})
+				return nil, nil
+			}
+			return nil, err
+		}
+		line++
+
+		field := func(name string) string {
+			i, ok := columns[name]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+
+		book := &data.Book{
+			Title:           field("title"),
+			ISBN:            field("isbn"),
+			PublicationDate: field("publication_date"),
+			Genre:           field("genre"),
+			Description:     field("description"),
+			Format:          field("format"),
+			Language:        field("language"),
+			Publisher:       field("publisher"),
+		}
+
+		for _, name := range strings.Split(field("authors"), ";") {
+			if name = strings.TrimSpace(name); name != "" {
+				book.Authors = append(book.Authors, &data.BookAuthor{Name: name, Role: "author"})
+			}
+		}
+
+		errs := map[string]string{}
+		if value := field("average_rating"); value != "" {
+			book.AverageRating, err = strconv.ParseFloat(value, 64)
+			if err != nil {
+				errs["average_rating"] = "must be a number"
+			}
+		}
+		if value := field("page_count"); value != "" {
+			book.PageCount, err = strconv.Atoi(value)
+			if err != nil {
+				errs["page_count"] = "must be an integer"
+			}
+		}
+		if len(errs) > 0 {
+			result.Reject(line, book.ISBN, errs)
+			return nil, nil
+		}
+
+		return &data.ImportRow{Row: line, Book: book}, nil
+	}, nil
+}
+
+// ndjsonBookRows returns a function yielding one book per non-blank line of
+// an NDJSON import, with the same conventions as csvBookRows.
+func ndjsonBookRows(body io.Reader, result *data.ImportResult) (func() (*data.ImportRow, error), error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+
+	line := 0
+	return func() (*data.ImportRow, error) {
+		for scanner.Scan() {
+			line++
+			text := bytes.TrimSpace(scanner.Bytes())
+			if len(text) == 0 {
+				continue
+			}
+
+			var record bookImportRecord
+			dec := json.NewDecoder(bytes.NewReader(text))
+			dec.DisallowUnknownFields()
+			err := dec.Decode(&record)
+			if err != nil {
+				result.Reject(line, "", map[string]string{"error": "line contains invalid JSON: " + err.Error()})
+				return nil, nil
+			}
+
+			book := &data.Book{
+				Title:           record.Title,
+				Authors:         record.Authors,
+				ISBN:            record.ISBN,
+				PublicationDate: record.PublicationDate,
+				Genre:           record.Genre,
+				Description:     record.Description,
+				AverageRating:   record.AverageRating,
+				Format:          record.Format,
+				Language:        record.Language,
+				Publisher:       record.Publisher,
+				PageCount:       record.PageCount,
+			}
+			return &data.ImportRow{Row: line, Book: book}, nil
+		}
+
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}, nil
+}
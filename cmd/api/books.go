@@ -11,16 +11,24 @@ import (
 )
 
 
+type createBookInput struct {
+	Title           string             `json:"title"`
+	Authors         []*data.BookAuthor `json:"authors"`
+	ISBN            string             `json:"isbn"`
+	PublicationDate string             `json:"publication_date"`
+	Genre           string             `json:"genre"`
+	GenreIDs        []int64            `json:"genre_ids"`
+	Description     string             `json:"description"`
+	AverageRating   float64            `json:"average_rating"`
+	WorkID          int64              `json:"work_id"`
+	Format          string             `json:"format"`
+	Language        string             `json:"language"`
+	Publisher       string             `json:"publisher"`
+	PageCount       int                `json:"page_count"`
+}
+
 func (a *applicationDependencies) createBookHandler(w http.ResponseWriter, r *http.Request) {
-	var input struct {
-		Title          string   `json:"title"`
-		Authors        []string `json:"authors"` 
-		ISBN           string   `json:"isbn"`
-		PublicationDate string   `json:"publication_date"`
-		Genre          string   `json:"genre"`
-		Description    string   `json:"description"`
-		AverageRating  float64  `json:"average_rating"` 
-	}
+	var input createBookInput
 
 	// Read and parse the JSON request body
 	err := a.readJSON(w, r, &input)
@@ -38,12 +46,36 @@ func (a *applicationDependencies) createBookHandler(w http.ResponseWriter, r *ht
 		Genre:          input.Genre,
 		Description:    input.Description,
 		AverageRating:  input.AverageRating,
+		WorkID:         input.WorkID,
+		Format:         input.Format,
+		Language:       input.Language,
+		Publisher:      input.Publisher,
+		PageCount:      input.PageCount,
+	}
+	for _, id := range input.GenreIDs {
+		book.Genres = append(book.Genres, &data.BookGenre{ID: id})
+	}
+
+	v := validator.New()
+	data.ValidateBook(v, book)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
 	}
 
 	// Insert the new book into the database
 	err = a.bookModel.Insert(book)  
 	if err != nil {
-		a.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrUnknownAuthor):
+			a.failedValidationResponse(w, r, map[string]string{"authors": err.Error()})
+		case errors.Is(err, data.ErrUnknownGenre):
+			a.failedValidationResponse(w, r, map[string]string{"genre_ids": err.Error()})
+		case errors.Is(err, data.ErrUnknownWork):
+			a.failedValidationResponse(w, r, map[string]string{"work_id": err.Error()})
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
@@ -53,7 +85,7 @@ func (a *applicationDependencies) createBookHandler(w http.ResponseWriter, r *ht
 
 	// Respond with the created book
 	data := envelope{"book": book}
-	err = a.writeJSON(w, http.StatusCreated, data, headers)
+	err = a.writeResponse(w, r, http.StatusCreated, data, headers)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 	}
@@ -66,7 +98,24 @@ func (a *applicationDependencies) displayBookHandler(w http.ResponseWriter, r *h
 		return
 	}
 
-	book, err := a.bookModel.Get(id)  
+	enc, err := a.citationEncoder(r)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	projection := a.readProjection(r.URL.Query(), data.BookFieldSafeList, data.BookIncludeSafeList, v)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	// Citations and JSON-LD are built from the whole book.
+	if enc != nil || a.wantsJSONLD(r) {
+		projection = data.Projection{}
+	}
+
+	book, err := a.bookModel.GetProjected(id, projection)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -77,14 +126,55 @@ func (a *applicationDependencies) displayBookHandler(w http.ResponseWriter, r *h
 		return
 	}
 
-	data := envelope{"book": book}
-	err = a.writeJSON(w, http.StatusOK, data, nil)
+	addVary(w.Header(), "Accept")
+	if enc != nil {
+		err = a.writeCitations(w, enc, fmt.Sprintf("book-%d", book.ID), []*data.Book{book})
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if a.wantsJSONLD(r) {
+		a.writeBookJSONLD(w, r, book)
+		return
+	}
+
+	err = a.bookModel.Include([]*data.Book{book}, projection)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	record, err := project(book, projection)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{"book": record}
+	err = a.writeResponse(w, r, http.StatusOK, data, nil)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 	}
 }
 
 
+type updateBookInput struct {
+	Title           *string            `json:"title"`
+	Authors         []*data.BookAuthor `json:"authors"`
+	ISBN            *string            `json:"isbn"`
+	PublicationDate *string            `json:"publication_date"`
+	Genre           *string            `json:"genre"`
+	GenreIDs        *[]int64           `json:"genre_ids"`
+	Description     *string            `json:"description"`
+	AverageRating   *float64           `json:"average_rating"`
+	WorkID          *int64             `json:"work_id"`
+	Format          *string            `json:"format"`
+	Language        *string            `json:"language"`
+	Publisher       *string            `json:"publisher"`
+	PageCount       *int               `json:"page_count"`
+}
+
 func (a *applicationDependencies) updateBookHandler(w http.ResponseWriter, r *http.Request) {
     id, err := a.readIDParam(r)
     if err != nil {
@@ -104,55 +194,98 @@ func (a *applicationDependencies) updateBookHandler(w http.ResponseWriter, r *ht
         return
     }
 
-    // Decode the incoming JSON request
-    var input struct {
-        Title           *string   `json:"title"`
-        Authors         []string  `json:"authors"`
-        ISBN            *string   `json:"isbn"`
-        PublicationDate *string   `json:"publication_date"`
-        Genre           *string   `json:"genre"`
-        Description     *string   `json:"description"`
-        AverageRating   *float64  `json:"average_rating"`
-    }
-
-    err = a.readJSON(w, r, &input)
+    // A merge patch or JSON patch is applied to the book as it is now;
+    // otherwise the body lists the fields to change.
+    doc := newBookDocument(book)
+    patched, err := readPatch(a, w, r, doc)
     if err != nil {
-        a.badRequestResponse(w, r, err)
+        a.patchErrorResponse(w, r, err)
         return
     }
+    if patched {
+        doc.applyTo(book)
+    } else {
+        // Decode the incoming JSON request
+        var input updateBookInput
+
+        err = a.readJSON(w, r, &input)
+        if err != nil {
+            a.badRequestResponse(w, r, err)
+            return
+        }
 
-    // Update only the fields provided in the request
-    if input.Title != nil {
-        book.Title = *input.Title
-    }
-    if input.Authors != nil {
-        book.Authors = input.Authors
-    }
-    if input.ISBN != nil {
-        book.ISBN = *input.ISBN
-    }
-    if input.PublicationDate != nil {
-        book.PublicationDate = *input.PublicationDate
-    }
-    if input.Genre != nil {
-        book.Genre = *input.Genre
-    }
-    if input.Description != nil {
-        book.Description = *input.Description
+        // Update only the fields provided in the request
+        if input.Title != nil {
+            book.Title = *input.Title
+        }
+        if input.Authors != nil {
+            book.Authors = input.Authors
+        }
+        if input.ISBN != nil {
+            book.ISBN = *input.ISBN
+        }
+        if input.PublicationDate != nil {
+            book.PublicationDate = *input.PublicationDate
+        }
+        if input.Genre != nil {
+            book.Genre = *input.Genre
+        }
+        if input.GenreIDs != nil {
+            book.Genres = nil
+            for _, id := range *input.GenreIDs {
+                book.Genres = append(book.Genres, &data.BookGenre{ID: id})
+            }
+        }
+        if input.Description != nil {
+            book.Description = *input.Description
+        }
+        if input.AverageRating != nil {
+            book.AverageRating = *input.AverageRating
+        }
+        if input.WorkID != nil {
+            book.WorkID = *input.WorkID
+        }
+        if input.Format != nil {
+            book.Format = *input.Format
+        }
+        if input.Language != nil {
+            book.Language = *input.Language
+        }
+        if input.Publisher != nil {
+            book.Publisher = *input.Publisher
+        }
+        if input.PageCount != nil {
+            book.PageCount = *input.PageCount
+        }
     }
-    if input.AverageRating != nil {
-        book.AverageRating = *input.AverageRating
+
+    v := validator.New()
+    data.ValidateBook(v, book)
+    if !v.IsEmpty() {
+        a.failedValidationResponse(w, r, v.Errors)
+        return
     }
 
     // Save the updated book
     err = a.bookModel.Update(book)
     if err != nil {
-        a.serverErrorResponse(w, r, err)
+        switch {
+        case errors.Is(err, data.ErrUnknownAuthor):
+            a.failedValidationResponse(w, r, map[string]string{"authors": err.Error()})
+        case errors.Is(err, data.ErrUnknownGenre):
+            a.failedValidationResponse(w, r, map[string]string{"genre_ids": err.Error()})
+        case errors.Is(err, data.ErrUnknownWork):
+            a.failedValidationResponse(w, r, map[string]string{"work_id": err.Error()})
+        case errors.Is(err, data.ErrRecordNotFound):
+            a.notFoundResponse(w, r)
+        default:
+            a.serverErrorResponse(w, r, err)
+        }
         return
     }
 
     data := envelope{"book": book}
-    err = a.writeJSON(w, http.StatusOK, data, nil)
+    err = a.writeResponse(w, r, http.StatusOK, data, nil)
     if err != nil {
         a.serverErrorResponse(w, r, err)
     }
@@ -178,12 +311,15 @@ func (a *applicationDependencies) deleteBookHandler(w http.ResponseWriter, r *ht
 	}
 
 	data := envelope{"message": "book successfully deleted"}
-	err = a.writeJSON(w, http.StatusOK, data, nil)
+	err = a.writeResponse(w, r, http.StatusOK, data, nil)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 	}
 }
 
+// bookSortSafeList lists the values a list of books can be sorted by.
+var bookSortSafeList = []string{"id", "title", "genre", "-id", "-title", "-genre"}
+
 func (a *applicationDependencies) listBooksHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
 		Title    string
@@ -199,9 +335,20 @@ func (a *applicationDependencies) listBooksHandler(w http.ResponseWriter, r *htt
 	input.Filters.Page = a.getSingleIntegerParameter(query, "page", 1, validator.New())
 	input.Filters.PageSize = a.getSingleIntegerParameter(query, "page_size", 10, validator.New())
 	input.Filters.Sort = a.getSingleQueryParameter(query, "sort", "id")
-	input.Filters.SortSafeList = []string{"id", "title", "author", "genre", "-id", "-title", "-author", "-genre"}
+	input.Filters.SortSafeList = bookSortSafeList
 
 	v := validator.New()
+	input.Filters.Conditions = a.getFilterConditions(query, v)
+	input.Filters.FilterSafeList = map[string]data.FilterType{
+		"id":               data.FilterNumber,
+		"title":            data.FilterText,
+		"isbn":             data.FilterText,
+		"genre":            data.FilterText,
+		"average_rating":   data.FilterNumber,
+		"publication_date": data.FilterDate,
+		"created_at":       data.FilterTimestamp,
+	}
+	input.Filters.Projection = a.readProjection(query, data.BookFieldSafeList, data.BookIncludeSafeList, v)
 	data.ValidateFilters(v, input.Filters)
 	if !v.IsEmpty() {
 		a.failedValidationResponse(w, r, v.Errors)
@@ -214,11 +361,23 @@ func (a *applicationDependencies) listBooksHandler(w http.ResponseWriter, r *htt
 		return
 	}
 
+	err = a.bookModel.Include(books, input.Filters.Projection)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	records, err := projectAll(books, input.Filters.Projection)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
 	data := envelope{
-		"books":    books,
+		"books":    records,
 		"metadata": metadata,
 	}
-	err = a.writeJSON(w, http.StatusOK, data, nil)
+	err = a.writeResponse(w, r, http.StatusOK, data, nil)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 	}
@@ -232,11 +391,18 @@ func (a *applicationDependencies) searchBooksHandler(w http.ResponseWriter, r *h
     genre := query.Get("genre")
 
     // Parse filters (pagination, sorting)
+    v := validator.New()
     filters := data.Filters{
-        Page:     a.getSingleIntegerParameter(query, "page", 1, validator.New()),
-        PageSize: a.getSingleIntegerParameter(query, "page_size", 10, validator.New()),
+        Page:     a.getSingleIntegerParameter(query, "page", 1, v),
+        PageSize: a.getSingleIntegerParameter(query, "page_size", 10, v),
         Sort:     a.getSingleQueryParameter(query, "sort", "id"),
-        SortSafeList: []string{"id", "title", "author", "genre", "-id", "-title", "-author", "-genre"}, // Add sort-safe fields here
+        SortSafeList: bookSortSafeList,
+    }
+
+    data.ValidateFilters(v, filters)
+    if !v.IsEmpty() {
+        a.failedValidationResponse(w, r, v.Errors)
+        return
     }
 
     // Call the SearchBooks method with filters
@@ -251,7 +417,7 @@ func (a *applicationDependencies) searchBooksHandler(w http.ResponseWriter, r *h
         "books":    books,
         "metadata": metadata,
     }
-    err = a.writeJSON(w, http.StatusOK, data, nil)
+    err = a.writeResponse(w, r, http.StatusOK, data, nil)
     if err != nil {
         a.serverErrorResponse(w, r, err)
     }
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/tchenbz/AWTtest_3/internal/citation"
+	"github.com/tchenbz/AWTtest_3/internal/data"
+	"github.com/tchenbz/AWTtest_3/internal/jsonld"
+)
+
+// citationEncoder returns the citation encoder a request asks for with
+// ?format= or, failing that, with its Accept header. It returns nil when the
+// request wants the usual JSON, and an error for a format that isn't known.
+func (a *applicationDependencies) citationEncoder(r *http.Request) (citation.Encoder, error) {
+	if format := r.URL.Query().Get("format"); format != "" {
+		if format == "json" {
+			return nil, nil
+		}
+		enc, ok := citation.Lookup(format)
+		if !ok {
+			return nil, fmt.Errorf("format must be json or one of %s", strings.Join(citation.Formats(), ", "))
+		}
+		return enc, nil
+	}
+
+	for _, mediaType := range a.acceptedMediaTypes(r) {
+		if enc, ok := citation.ForMediaType(mediaType); ok {
+			return enc, nil
+		}
+		if mediaType == "application/json" || mediaType == jsonld.MediaType || mediaType == "application/*" || mediaType == "*/*" {
+			break
+		}
+	}
+	return nil, nil
+}
+
+// writeCitations writes books with enc. name is used, with the format's
+// extension, as the file name offered when the response is saved.
+func (a *applicationDependencies) writeCitations(w http.ResponseWriter, enc citation.Encoder, name string, books []*data.Book) error {
+	var buf bytes.Buffer
+	err := enc.Encode(&buf, books)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", enc.MediaType()+"; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", name+"."+enc.Extension()))
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(buf.Bytes())
+	return err
+}
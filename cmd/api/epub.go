@@ -0,0 +1,179 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/tchenbz/AWTtest_3/internal/data"
+	"github.com/tchenbz/AWTtest_3/internal/epub"
+	"github.com/tchenbz/AWTtest_3/internal/validator"
+)
+
+// maxEPUBBytes caps the size of an uploaded EPUB.
+const maxEPUBBytes = 50 << 20
+
+// importEPUBHandler reads the metadata and cover of an EPUB uploaded as the
+// "file" field of a multipart form. Only JPEG, PNG, GIF and WebP covers are
+// kept. By default it only previews the book it
+// would create, together with existing books that look like duplicates.
+// With ?commit=true it creates the book, refusing with 409 Conflict while
+// there are possible duplicates unless ?force=true is also given. The form
+// fields title, isbn, publication_date, genre and description override what
+// the EPUB says.
+func (a *applicationDependencies) importEPUBHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	commit, err := strconv.ParseBool(a.getSingleQueryParameter(query, "commit", "false"))
+	if err != nil {
+		a.badRequestResponse(w, r, errors.New("commit must be a boolean"))
+		return
+	}
+	force, err := strconv.ParseBool(a.getSingleQueryParameter(query, "force", "false"))
+	if err != nil {
+		a.badRequestResponse(w, r, errors.New("force must be a boolean"))
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxEPUBBytes)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			a.errorResponseJSON(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("the body must not be larger than %d bytes", maxBytesError.Limit))
+			return
+		}
+		a.badRequestResponse(w, r, errors.New("the body must be a multipart form with the EPUB in a file field"))
+		return
+	}
+	defer file.Close()
+
+	metadata, err := epub.Read(file, header.Size)
+	if err != nil {
+		switch {
+		case errors.Is(err, epub.ErrNotEPUB):
+			a.badRequestResponse(w, r, err)
+		default:
+			a.failedValidationResponse(w, r, map[string]string{"file": err.Error()})
+		}
+		return
+	}
+
+	book := metadata.Book()
+	overrides := map[string]*string{
+		"title":            &book.Title,
+		"isbn":             &book.ISBN,
+		"publication_date": &book.PublicationDate,
+		"genre":            &book.Genre,
+		"description":      &book.Description,
+	}
+	for field, value := range overrides {
+		if r.PostForm.Has(field) {
+			*value = r.PostForm.Get(field)
+		}
+	}
+
+	duplicates, err := a.bookModel.FindDuplicates(book)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	var cover *data.Cover
+	var coverInfo any
+	if metadata.Cover != nil {
+		cover = &data.Cover{ContentType: metadata.Cover.ContentType, Image: metadata.Cover.Image}
+		coverInfo = envelope{"content_type": cover.ContentType, "size": len(cover.Image)}
+	}
+
+	v := validator.New()
+	data.ValidateBook(v, book)
+
+	if !commit {
+		data := envelope{
+			"book":       book,
+			"epub":       metadata,
+			"cover":      coverInfo,
+			"duplicates": duplicates,
+			"errors":     v.Errors,
+		}
+		err = a.writeResponse(w, r, http.StatusOK, data, nil)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if len(duplicates) > 0 && !force {
+		data := envelope{
+			"error":      "this book may already exist; resubmit with force=true to create it anyway",
+			"duplicates": duplicates,
+		}
+		err = a.writeResponse(w, r, http.StatusConflict, data, nil)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = a.bookModel.InsertWithCover(book, cover)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrUnknownAuthor):
+			a.failedValidationResponse(w, r, map[string]string{"authors": err.Error()})
+		case errors.Is(err, data.ErrUnknownGenre):
+			a.failedValidationResponse(w, r, map[string]string{"genre_ids": err.Error()})
+		case errors.Is(err, data.ErrUnknownWork):
+			a.failedValidationResponse(w, r, map[string]string{"work_id": err.Error()})
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/books/%d", book.ID))
+
+	data := envelope{"book": book, "cover": coverInfo}
+	err = a.writeResponse(w, r, http.StatusCreated, data, headers)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) displayBookCoverHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	cover, err := a.coverModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Covers stored before their bytes were checked may be anything, so
+	// the browser is told not to sniff them or run what they contain.
+	contentType, ok := data.CoverContentType(cover.Image)
+	if !ok {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	w.Header().Set("Content-Length", strconv.Itoa(len(cover.Image)))
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Write(cover.Image)
+}
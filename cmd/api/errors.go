@@ -1,10 +1,19 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
+
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/tchenbz/AWTtest_3/internal/data"
+	"github.com/tchenbz/AWTtest_3/internal/patch"
+	"github.com/tchenbz/AWTtest_3/internal/render"
 )
 
+var notAcceptableMessage = "the resource cannot be represented in any of the requested media types; use one of " + strings.Join(render.MediaTypes, ", ")
+
 func (a *applicationDependencies)logError(r *http.Request, err error) {
 
 	method := r.Method
@@ -12,9 +21,11 @@ func (a *applicationDependencies)logError(r *http.Request, err error) {
 	a.logger.Error(err.Error(), "method", method, "uri", uri)
 }
 
+// errorResponseJSON writes an error envelope. Errors are always JSON,
+// whatever the request accepts, so that they can't fail to encode.
 func (a *applicationDependencies)errorResponseJSON(w http.ResponseWriter, r *http.Request, status int, message any) {
 	errorData := envelope{"error": message}
-	err := a.writeJSON(w, status, errorData, nil)
+	err := a.writeEncoded(w, render.PrettyJSON, status, errorData, nil)
 	if err != nil {
 		a.logError(r, err)
 		w.WriteHeader(500)
@@ -48,4 +59,48 @@ func (a *applicationDependencies)failedValidationResponse(w http.ResponseWriter,
 func (a *applicationDependencies)rateLimitExceededResponse(w http.ResponseWriter, r *http.Request)  {
 	message := "rate limit exceeded"
 	a.errorResponseJSON(w, r, http.StatusTooManyRequests, message)
-}
\ No newline at end of file
+}
+func (a *applicationDependencies) notAcceptableResponse(w http.ResponseWriter, r *http.Request) {
+	a.errorResponseJSON(w, r, http.StatusNotAcceptable, notAcceptableMessage)
+}
+
+// patchErrorResponse reports a patch document that couldn't be applied: a
+// malformed document is a bad request, a failed test operation conflicts
+// with the current state of the record, and a path that doesn't fit the
+// record or a result the record can't take can't be processed. Anything
+// else went wrong on the server.
+func (a *applicationDependencies) patchErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, patch.ErrTestFailed):
+		a.errorResponseJSON(w, r, http.StatusConflict, err.Error())
+	case errors.Is(err, patch.ErrInvalid):
+		a.badRequestResponse(w, r, err)
+	case errors.Is(err, patch.ErrPath), errors.Is(err, errPatchResult):
+		a.failedValidationResponse(w, r, map[string]string{"patch": err.Error()})
+	default:
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// idempotencyKeyErrorResponse reports an Idempotency-Key that can't be used
+// for the request: one already used for a different request can't be
+// processed, and one whose first request is still running conflicts with
+// it.
+func (a *applicationDependencies) idempotencyKeyErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, data.ErrIdempotencyKeyInProgress):
+		a.errorResponseJSON(w, r, http.StatusConflict, err.Error())
+	default:
+		a.failedValidationResponse(w, r, map[string]string{"idempotency_key": err.Error()})
+	}
+}
+
+// graphqlErrorResponse rejects a GraphQL query before it runs. The errors
+// go in the errors array GraphQL clients look for, not the usual envelope.
+func (a *applicationDependencies) graphqlErrorResponse(w http.ResponseWriter, r *http.Request, errs []gqlerrors.FormattedError) {
+	err := a.writeResponse(w, r, http.StatusBadRequest, envelope{"errors": errs}, nil)
+	if err != nil {
+		a.logError(r, err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
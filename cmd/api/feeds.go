@@ -0,0 +1,282 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tchenbz/AWTtest_3/internal/data"
+	"github.com/tchenbz/AWTtest_3/internal/feed"
+)
+
+// feedSize is the number of most recent items a feed shows.
+const feedSize = 50
+
+// feedFormat returns "atom" or "rss" when the request asks for a feed with
+// ?format= or with its Accept header, and "" otherwise.
+func (a *applicationDependencies) feedFormat(r *http.Request) string {
+	if format := r.URL.Query().Get("format"); format != "" {
+		if format == "atom" || format == "rss" {
+			return format
+		}
+		return ""
+	}
+
+	for _, mediaType := range a.acceptedMediaTypes(r) {
+		switch mediaType {
+		case feed.AtomMediaType:
+			return "atom"
+		case feed.RSSMediaType:
+			return "rss"
+		case "application/json", "application/*", "*/*":
+			return ""
+		}
+	}
+	return ""
+}
+
+// writeFeed writes f as Atom or RSS. The response carries an ETag and a
+// Last-Modified time taken from the feed, and is answered with 304 Not
+// Modified when the client's If-None-Match or If-Modified-Since shows it
+// already has it.
+func (a *applicationDependencies) writeFeed(w http.ResponseWriter, r *http.Request, format string, f *feed.Feed) {
+	var doc any = f
+	contentType := feed.AtomMediaType
+	if format == "rss" {
+		doc = feed.NewRSS(f)
+		contentType = feed.RSSMediaType
+	}
+
+	body, err := xml.MarshalIndent(doc, "", "\t")
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	body = append([]byte(xml.Header), body...)
+	body = append(body, '\n')
+
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	lastModified := time.Time(f.Updated).UTC().Truncate(time.Second)
+
+	addVary(w.Header(), "Accept")
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+	w.Header().Set("Cache-Control", "public, max-age=300")
+
+	if notModified(r, etag, lastModified) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType+"; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// notModified evaluates the request's conditional headers. If-Modified-Since
+// is only consulted when there is no If-None-Match, as RFC 9110 requires.
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if header := r.Header.Get("If-None-Match"); header != "" {
+		for _, candidate := range strings.Split(header, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == etag || candidate == "*" {
+				return true
+			}
+		}
+		return false
+	}
+
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	return err == nil && !lastModified.After(since)
+}
+
+// newFeed returns a feed whose id and self link are the request URL, with an
+// alternate link to the JSON resource at path.
+func (a *applicationDependencies) newFeed(r *http.Request, title, path string, updated time.Time) *feed.Feed {
+	f := feed.NewFeed(a.absoluteURL(r, r.URL.Path), title)
+	f.Updated = feed.Time(updated)
+	f.Authors = []feed.Person{{Name: r.Host}}
+	f.Links = append(f.Links,
+		feed.Link{Rel: "self", Href: a.absoluteURL(r, r.URL.RequestURI())},
+		feed.Link{Rel: "alternate", Href: a.absoluteURL(r, path), Type: "application/json"},
+	)
+	return f
+}
+
+// addReviewEntries adds an entry for each review. titles maps book ids to
+// the titles of the reviewed books.
+func (a *applicationDependencies) addReviewEntries(r *http.Request, f *feed.Feed, reviews []*data.Review, titles map[int64]string) {
+	for _, review := range reviews {
+		path := fmt.Sprintf("/v1/books/%d/reviews/%d", review.BookID, review.ID)
+		entry := &feed.Entry{
+			ID:      a.absoluteURL(r, path),
+			Title:   fmt.Sprintf("%s on %s: %d/5", review.Author, titles[review.BookID], review.Rating),
+			Updated: feed.Time(review.CreatedAt),
+			Authors: []feed.Person{{Name: review.Author}},
+			Content: &feed.Text{Type: "text", Body: review.Content},
+			Links:   []feed.Link{{Rel: "alternate", Href: a.absoluteURL(r, path), Type: "application/json"}},
+		}
+		if review.Author == "" {
+			entry.Authors = nil
+		}
+		f.Entries = append(f.Entries, entry)
+
+		if review.CreatedAt.After(time.Time(f.Updated)) {
+			f.Updated = feed.Time(review.CreatedAt)
+		}
+	}
+}
+
+// recentFilters selects the newest items for a feed.
+func recentFilters() data.Filters {
+	return data.Filters{Page: 1, PageSize: feedSize, Sort: "-id", SortSafeList: []string{"-id"}}
+}
+
+func (a *applicationDependencies) bookReviewsFeedHandler(w http.ResponseWriter, r *http.Request, format string) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	book, err := a.bookModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	reviews, _, err := a.reviewModel.GetAllForBook(book.ID, "", "", 0, recentFilters())
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	f := a.newFeed(r, "Reviews of "+book.Title, fmt.Sprintf("/v1/books/%d/reviews", book.ID), book.CreatedAt)
+	a.addReviewEntries(r, f, reviews, map[int64]string{book.ID: book.Title})
+	a.writeFeed(w, r, format, f)
+}
+
+func (a *applicationDependencies) userReviewsFeedHandler(w http.ResponseWriter, r *http.Request, format string) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	user, err := a.userModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	reviews, _, err := a.reviewModel.GetAllByUser(user.ID, recentFilters())
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	bookIDs := []int64{}
+	for _, review := range reviews {
+		bookIDs = append(bookIDs, review.BookID)
+	}
+	books, err := a.bookModel.GetMany(bookIDs)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	titles := map[int64]string{}
+	for _, book := range books {
+		titles[book.ID] = book.Title
+	}
+
+	f := a.newFeed(r, "Reviews by "+user.Username, fmt.Sprintf("/v1/users/%d/reviews", user.ID), user.CreatedAt)
+	a.addReviewEntries(r, f, reviews, titles)
+	a.writeFeed(w, r, format, f)
+}
+
+// readingListFeedHandler writes a feed of the books most recently added to
+// a reading list.
+func (a *applicationDependencies) readingListFeedHandler(w http.ResponseWriter, r *http.Request, format string) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	readingList, err := a.readingListModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	entries, err := a.readingListModel.RecentBooks(readingList.ID, feedSize)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	bookIDs := make([]int64, len(entries))
+	for i, entry := range entries {
+		bookIDs[i] = entry.BookID
+	}
+	books, err := a.bookModel.GetMany(bookIDs)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	byID := map[int64]*data.Book{}
+	for _, book := range books {
+		byID[book.ID] = book
+	}
+
+	f := a.newFeed(r, readingList.Name, fmt.Sprintf("/v1/readinglists/%d", readingList.ID), readingList.CreatedAt)
+	f.Subtitle = readingList.Description
+
+	for _, added := range entries {
+		book, ok := byID[added.BookID]
+		if !ok {
+			continue
+		}
+		path := fmt.Sprintf("/v1/books/%d", book.ID)
+		entry := &feed.Entry{
+			ID:      a.absoluteURL(r, fmt.Sprintf("/v1/readinglists/%d/books/%d", readingList.ID, book.ID)),
+			Title:   fmt.Sprintf("%s added to %s", book.Title, readingList.Name),
+			Updated: feed.Time(added.AddedAt),
+			Links:   []feed.Link{{Rel: "alternate", Href: a.absoluteURL(r, path), Type: "application/json"}},
+		}
+		for _, name := range book.AuthorNames("author") {
+			entry.Authors = append(entry.Authors, feed.Person{Name: name})
+		}
+		if book.Description != "" {
+			entry.Summary = &feed.Text{Type: "text", Body: book.Description}
+		}
+		f.Entries = append(f.Entries, entry)
+
+		if added.AddedAt.After(time.Time(f.Updated)) {
+			f.Updated = feed.Time(added.AddedAt)
+		}
+	}
+
+	a.writeFeed(w, r, format, f)
+}
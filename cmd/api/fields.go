@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"strings"
+
+	"github.com/tchenbz/AWTtest_3/internal/data"
+	"github.com/tchenbz/AWTtest_3/internal/validator"
+)
+
+// readProjection reads the comma-separated ?fields= and ?include= parameters
+// and checks them against the safe lists of the resource.
+func (a *applicationDependencies) readProjection(queryParameters url.Values, fieldSafeList, includeSafeList []string, v *validator.Validator) data.Projection {
+	p := data.Projection{
+		Fields:  commaSeparated(queryParameters["fields"]),
+		Include: commaSeparated(queryParameters["include"]),
+	}
+	data.ValidateProjection(v, p, fieldSafeList, includeSafeList)
+	return p
+}
+
+func commaSeparated(values []string) []string {
+	var list []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			item = strings.TrimSpace(item)
+			if item != "" && !validator.PermittedValue(item, list...) {
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
+
+// projected is a record cut down to a sparse fieldset. It encodes its keys
+// in the order they were asked for.
+type projected struct {
+	keys   []string
+	values map[string]json.RawMessage
+}
+
+func (p projected) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	first := true
+	for _, key := range p.keys {
+		value, ok := p.values[key]
+		if !ok {
+			continue
+		}
+		if !first {
+			buf.WriteByte(',')
+		}
+		first = false
+		name, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// project cuts a record down to the fields and includes in p. Records are
+// returned as they are when p doesn't limit the fields.
+func project[T any](record T, p data.Projection) (any, error) {
+	keys := p.Keys()
+	if keys == nil {
+		return record, nil
+	}
+
+	js, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[string]json.RawMessage{}
+	err = json.Unmarshal(js, &values)
+	if err != nil {
+		return nil, err
+	}
+
+	return projected{keys: keys, values: values}, nil
+}
+
+// projectAll cuts every record down to the fields and includes in p.
+func projectAll[T any](records []T, p data.Projection) (any, error) {
+	if p.Keys() == nil {
+		return records, nil
+	}
+
+	all := make([]any, len(records))
+	for i, record := range records {
+		v, err := project(record, p)
+		if err != nil {
+			return nil, err
+		}
+		all[i] = v
+	}
+	return all, nil
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/tchenbz/AWTtest_3/internal/data"
+	"github.com/tchenbz/AWTtest_3/internal/validator"
+)
+
+type createGenreInput struct {
+	Name     string `json:"name"`
+	ParentID *int64 `json:"parent_id"`
+}
+
+func (a *applicationDependencies) createGenreHandler(w http.ResponseWriter, r *http.Request) {
+	var input createGenreInput
+
+	err := a.readJSON(w, r, &input)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	genre := &data.Genre{
+		Name:     input.Name,
+		ParentID: input.ParentID,
+	}
+
+	v := validator.New()
+	data.ValidateGenre(v, genre)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.genreModel.Insert(genre)
+	if err != nil {
+		a.genreWriteErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/genres/%d", genre.ID))
+
+	data := envelope{"genre": genre}
+	err = a.writeResponse(w, r, http.StatusCreated, data, headers)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) displayGenreHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	genre, err := a.genreModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	ancestors, err := a.genreModel.Ancestors(id)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Nest the whole tree and pick this genre out of it so that its children
+	// (and theirs) are included in the response.
+	genres, err := a.genreModel.GetAll()
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	data.BuildGenreTree(genres)
+	for _, g := range genres {
+		if g.ID == genre.ID {
+			genre = g
+		}
+	}
+
+	data := envelope{"genre": genre, "ancestors": ancestors}
+	err = a.writeResponse(w, r, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+type updateGenreInput struct {
+	Name     *string `json:"name"`
+	ParentID **int64 `json:"parent_id"`
+}
+
+func (a *applicationDependencies) updateGenreHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	genre, err := a.genreModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// parent_id is a pointer to a pointer so that an explicit null (move the
+	// genre to the top level) can be told apart from the field being absent.
+	var input updateGenreInput
+
+	err = a.readJSON(w, r, &input)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		genre.Name = *input.Name
+	}
+	if input.ParentID != nil {
+		genre.ParentID = *input.ParentID
+	}
+
+	v := validator.New()
+	data.ValidateGenre(v, genre)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.genreModel.Update(genre)
+	if err != nil {
+		a.genreWriteErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{"genre": genre}
+	err = a.writeResponse(w, r, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) deleteGenreHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	err = a.genreModel.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{"message": "genre successfully deleted"}
+	err = a.writeResponse(w, r, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) listGenresHandler(w http.ResponseWriter, r *http.Request) {
+	genres, err := a.genreModel.GetAll()
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{"genres": data.BuildGenreTree(genres)}
+	err = a.writeResponse(w, r, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) listGenreBooksHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	_, err = a.genreModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	query := r.URL.Query()
+	filters := data.Filters{
+		Page:         a.getSingleIntegerParameter(query, "page", 1, validator.New()),
+		PageSize:     a.getSingleIntegerParameter(query, "page_size", 10, validator.New()),
+		Sort:         a.getSingleQueryParameter(query, "sort", "title"),
+		SortSafeList: []string{"id", "title", "publication_date", "average_rating", "-id", "-title", "-publication_date", "-average_rating"},
+	}
+
+	v := validator.New()
+	data.ValidateFilters(v, filters)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	books, metadata, err := a.bookModel.GetAllByGenre(id, filters)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"books":    books,
+		"metadata": metadata,
+	}
+	err = a.writeResponse(w, r, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) genreWriteErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, data.ErrDuplicateGenre):
+		a.failedValidationResponse(w, r, map[string]string{"name": err.Error()})
+	case errors.Is(err, data.ErrUnknownGenre):
+		a.failedValidationResponse(w, r, map[string]string{"parent_id": "parent genre does not exist"})
+	case errors.Is(err, data.ErrGenreCycle):
+		a.failedValidationResponse(w, r, map[string]string{"parent_id": err.Error()})
+	case errors.Is(err, data.ErrRecordNotFound):
+		a.notFoundResponse(w, r)
+	default:
+		a.serverErrorResponse(w, r, err)
+	}
+}
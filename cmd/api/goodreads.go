@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/tchenbz/AWTtest_3/internal/data"
+)
+
+// maxGoodreadsBytes caps the size of a Goodreads export. Even very large
+// libraries export to a few megabytes.
+const maxGoodreadsBytes = 32 << 20
+
+// importGoodreadsHandler accepts a Goodreads library export, either as the
+// "file" field of a multipart form or as a text/csv body, and imports it in
+// the background for the authenticated user. It responds straight away with
+// the job that tracks the import.
+func (a *applicationDependencies) importGoodreadsHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := a.userModel.Get(a.contextGetUserID(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxGoodreadsBytes)
+
+	var body io.Reader
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "multipart/form-data":
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			a.badRequestResponse(w, r, errors.New("the form must include the export as a file field"))
+			return
+		}
+		defer file.Close()
+		body = file
+	case "text/csv":
+		body = r.Body
+	default:
+		a.errorResponseJSON(w, r, http.StatusUnsupportedMediaType, "the body must be text/csv or multipart/form-data")
+		return
+	}
+
+	entries, err := parseGoodreadsExport(body)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			a.errorResponseJSON(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("the body must not be larger than %d bytes", maxBytesError.Limit))
+			return
+		}
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	job := &data.ImportJob{
+		UserID:    user.ID,
+		Source:    "goodreads",
+		TotalRows: len(entries),
+	}
+
+	err = a.importJobModel.Insert(job)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// The background goroutine owns job from here on; respond with a copy.
+	response := *job
+
+	a.background(func() {
+		job.Status = data.ImportRunning
+		err := a.importJobModel.Update(job)
+		if err == nil {
+			err = a.importJobModel.ImportGoodreads(job, user, entries)
+		}
+		if err != nil {
+			a.logger.Error("goodreads import failed", "job_id", job.ID, "error", err.Error())
+		}
+
+		err = a.importJobModel.Finish(job, err)
+		if err != nil {
+			a.logger.Error(err.Error(), "job_id", job.ID)
+		}
+	})
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/imports/%d", job.ID))
+
+	data := envelope{"import_job": &response}
+	err = a.writeResponse(w, r, http.StatusAccepted, data, headers)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// parseGoodreadsExport reads the CSV produced by Goodreads' "Export Library".
+// Columns are looked up by name so reordered or extra columns don't matter.
+func parseGoodreadsExport(body io.Reader) ([]*data.GoodreadsEntry, error) {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("the export is empty")
+		}
+		return nil, err
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))] = i
+	}
+	for _, name := range []string{"Title", "Author"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("the export is missing the %q column", name)
+		}
+	}
+
+	entries := []*data.GoodreadsEntry{}
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		field := func(name string) string {
+			i, ok := columns[name]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			// Goodreads wraps ISBNs in ="..." so spreadsheets keep
+			// leading zeros.
+			value := strings.TrimSpace(record[i])
+			if strings.HasPrefix(value, "=") {
+				value = strings.Trim(value[1:], `"`)
+			}
+			return value
+		}
+		number := func(name string) int {
+			n, _ := strconv.Atoi(field(name))
+			return n
+		}
+
+		entry := &data.GoodreadsEntry{
+			Row:            line,
+			Title:          field("Title"),
+			ISBN:           field("ISBN"),
+			ISBN13:         field("ISBN13"),
+			Rating:         number("My Rating"),
+			Review:         strings.TrimSpace(strings.NewReplacer("<br/>", "\n", "<br />", "\n", "<br>", "\n").Replace(field("My Review"))),
+			Publisher:      field("Publisher"),
+			Binding:        field("Binding"),
+			PageCount:      number("Number of Pages"),
+			Year:           number("Year Published"),
+			ExclusiveShelf: field("Exclusive Shelf"),
+		}
+		if entry.Year == 0 {
+			entry.Year = number("Original Publication Year")
+		}
+
+		authors := append([]string{field("Author")}, strings.Split(field("Additional Authors"), ",")...)
+		for _, name := range authors {
+			if name = strings.TrimSpace(name); name != "" {
+				entry.Authors = append(entry.Authors, name)
+			}
+		}
+		for _, shelf := range strings.Split(field("Bookshelves"), ",") {
+			if shelf = strings.TrimSpace(shelf); shelf != "" {
+				entry.Shelves = append(entry.Shelves, shelf)
+			}
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"github.com/tchenbz/AWTtest_3/internal/validator"
+)
+
+// graphqlDefaultListSize is how many items a list field without a first or
+// pageSize argument is assumed to return when scoring a query's complexity.
+const graphqlDefaultListSize = 10
+
+type graphqlInput struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+	Extensions    map[string]any `json:"extensions"`
+}
+
+// graphqlContextKey is the context key of the graphqlContext of a request.
+type graphqlContextKey struct{}
+
+// graphqlContext is what resolvers need from the request they run in: the
+// application, whose models may be bound to a batch's transaction, and the
+// request's loaders.
+type graphqlContext struct {
+	app     *applicationDependencies
+	loaders *graphqlLoaders
+}
+
+func graphqlFromContext(ctx context.Context) *graphqlContext {
+	gc, ok := ctx.Value(graphqlContextKey{}).(*graphqlContext)
+	if !ok {
+		panic("missing graphql value in request context")
+	}
+	return gc
+}
+
+// graphqlError is an error a resolver reports to the client as it is. Any
+// other error a resolver returns is logged and reported as a server error.
+type graphqlError struct {
+	message    string
+	extensions map[string]any
+}
+
+func (e *graphqlError) Error() string {
+	return e.message
+}
+
+func (e *graphqlError) Extensions() map[string]any {
+	return e.extensions
+}
+
+func graphqlUnauthenticated(message string) error {
+	return &graphqlError{message: message, extensions: map[string]any{"code": "UNAUTHENTICATED"}}
+}
+
+// graphqlValidationError reports the arguments a validator found invalid, the
+// same way the REST routes report them.
+func graphqlValidationError(v *validator.Validator) error {
+	return &graphqlError{
+		message:    "invalid arguments",
+		extensions: map[string]any{"code": "FAILED_VALIDATION", "fields": v.Errors},
+	}
+}
+
+// graphqlHandler runs a GraphQL query. Queries that don't parse, fail
+// validation or exceed the depth and complexity limits are rejected with a
+// 400 before anything is resolved. A token in the Authorization header is
+// checked like on the REST routes and identifies the viewer.
+func (a *applicationDependencies) graphqlHandler(w http.ResponseWriter, r *http.Request) {
+	var input graphqlInput
+	err := a.readJSON(w, r, &input)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(strings.TrimSpace(input.Query) != "", "query", "must be provided")
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	schema, err := graphqlSchema()
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	document, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{Body: []byte(input.Query)})})
+	if err != nil {
+		a.graphqlErrorResponse(w, r, gqlerrors.FormatErrors(err))
+		return
+	}
+
+	validation := graphql.ValidateDocument(&schema, document, nil)
+	if !validation.IsValid {
+		a.graphqlErrorResponse(w, r, validation.Errors)
+		return
+	}
+
+	errs := a.checkQueryLimits(&schema, document, input.OperationName, input.Variables)
+	if len(errs) > 0 {
+		a.graphqlErrorResponse(w, r, errs)
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), graphqlContextKey{}, &graphqlContext{app: a, loaders: a.newGraphQLLoaders()})
+	result := graphql.Execute(graphql.ExecuteParams{
+		Schema:        schema,
+		AST:           document,
+		OperationName: input.OperationName,
+		Args:          input.Variables,
+		Context:       ctx,
+	})
+
+	response := envelope{"data": result.Data}
+	if len(result.Errors) > 0 {
+		response["errors"] = a.resolverErrors(r, result.Errors)
+	}
+
+	err = a.writeResponse(w, r, http.StatusOK, response, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// resolverErrors logs the errors resolvers returned that aren't meant for
+// the client and replaces their message, so that database errors don't
+// leak into responses.
+func (a *applicationDependencies) resolverErrors(r *http.Request, errs []gqlerrors.FormattedError) []gqlerrors.FormattedError {
+	for i, e := range errs {
+		switch cause := graphqlCause(e).(type) {
+		case *graphqlError:
+			errs[i].Message = cause.message
+			errs[i].Extensions = cause.extensions
+		case gqlerrors.FormattedError, *gqlerrors.Error:
+			// The executor's own errors, such as a variable of the wrong
+			// type, are meant for the client.
+		default:
+			a.logError(r, cause)
+			errs[i].Message = "the server encountered a problem and could not process your request"
+		}
+	}
+	return errs
+}
+
+// graphqlCause unwraps the layers the executor wraps resolver errors in.
+func graphqlCause(err error) error {
+	for {
+		switch e := err.(type) {
+		case gqlerrors.FormattedError:
+			if e.OriginalError() == nil {
+				return err
+			}
+			err = e.OriginalError()
+		case *gqlerrors.Error:
+			if e.OriginalError == nil {
+				return err
+			}
+			err = e.OriginalError
+		default:
+			return err
+		}
+	}
+}
+
+// checkQueryLimits measures the operation the request runs and reports it
+// if it nests deeper or asks for more than the configured limits allow.
+// Introspection fields don't count towards either.
+func (a *applicationDependencies) checkQueryLimits(schema *graphql.Schema, document *ast.Document, operationName string, variables map[string]any) []gqlerrors.FormattedError {
+	qc := queryCost{schema: schema, fragments: map[string]*ast.FragmentDefinition{}, variables: variables}
+
+	var operation *ast.OperationDefinition
+	for _, definition := range document.Definitions {
+		switch definition := definition.(type) {
+		case *ast.FragmentDefinition:
+			qc.fragments[definition.Name.Value] = definition
+		case *ast.OperationDefinition:
+			if operationName == "" || (definition.Name != nil && definition.Name.Value == operationName) {
+				operation = definition
+			}
+		}
+	}
+	if operation == nil {
+		// Execute reports the missing operation.
+		return nil
+	}
+
+	depth, complexity := qc.selectionSet(schema.QueryType(), operation.SelectionSet, 0)
+
+	var errs []gqlerrors.FormattedError
+	if depth > a.config.graphql.maxDepth {
+		errs = append(errs, gqlerrors.NewFormattedError(fmt.Sprintf("the query is nested %d levels deep, more than the limit of %d", depth, a.config.graphql.maxDepth)))
+	}
+	if complexity > a.config.graphql.maxComplexity {
+		errs = append(errs, gqlerrors.NewFormattedError(fmt.Sprintf("the query has a complexity of %d, more than the limit of %d", complexity, a.config.graphql.maxComplexity)))
+	}
+	return errs
+}
+
+// queryCost scores a GraphQL operation. Every field costs one, and the
+// fields selected inside a list cost as many times over as the list is
+// long: the list's first argument, the pageSize of the page it is on, or
+// graphqlDefaultListSize.
+type queryCost struct {
+	schema    *graphql.Schema
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]any
+}
+
+// selectionSet returns how deep the selections nest and what they cost.
+// pageSize is the pageSize argument of the field they were selected on.
+func (qc *queryCost) selectionSet(parent graphql.Type, set *ast.SelectionSet, pageSize int) (depth, complexity int) {
+	if set == nil {
+		return 0, 0
+	}
+
+	for _, selection := range set.Selections {
+		var d, c int
+		switch selection := selection.(type) {
+		case *ast.Field:
+			d, c = qc.field(parent, selection, pageSize)
+		case *ast.InlineFragment:
+			typ := parent
+			if selection.TypeCondition != nil {
+				typ = qc.schema.Type(selection.TypeCondition.Name.Value)
+			}
+			d, c = qc.selectionSet(typ, selection.SelectionSet, pageSize)
+		case *ast.FragmentSpread:
+			// Validation has already ruled out unknown fragments and
+			// fragment cycles.
+			fragment := qc.fragments[selection.Name.Value]
+			d, c = qc.selectionSet(qc.schema.Type(fragment.TypeCondition.Name.Value), fragment.SelectionSet, pageSize)
+		}
+		depth = max(depth, d)
+		complexity += c
+	}
+	return depth, complexity
+}
+
+func (qc *queryCost) field(parent graphql.Type, field *ast.Field, pageSize int) (depth, complexity int) {
+	if strings.HasPrefix(field.Name.Value, "__") {
+		return 0, 0
+	}
+
+	object, ok := parent.(*graphql.Object)
+	if !ok {
+		return 1, 1
+	}
+	definition, ok := object.Fields()[field.Name.Value]
+	if !ok {
+		return 1, 1
+	}
+
+	// List arguments below one are rejected by the resolvers, but they
+	// still count as one here: a negative size would otherwise take the
+	// cost of the rest of the query off the total.
+	size := graphqlDefaultListSize
+	if first, ok := qc.intArgument(definition, field, "first"); ok {
+		size = max(first, 1)
+	} else if pageSize > 0 {
+		size = pageSize
+	}
+	childPageSize, ok := qc.intArgument(definition, field, "pageSize")
+	if ok {
+		childPageSize = max(childPageSize, 1)
+	}
+
+	typ := definition.Type
+	if nonNull, ok := typ.(*graphql.NonNull); ok {
+		typ = nonNull.OfType
+	}
+	_, isList := typ.(*graphql.List)
+
+	named, _ := graphql.GetNamed(definition.Type).(graphql.Type)
+	depth, complexity = qc.selectionSet(named, field.SelectionSet, childPageSize)
+	if isList {
+		complexity *= size
+	}
+	return depth + 1, complexity + 1
+}
+
+// intArgument returns the value of an integer argument of a field: the one
+// given in the query, literally or as a variable, or else its default.
+func (qc *queryCost) intArgument(definition *graphql.FieldDefinition, field *ast.Field, name string) (int, bool) {
+	for _, argument := range field.Arguments {
+		if argument.Name.Value != name {
+			continue
+		}
+		switch value := argument.Value.(type) {
+		case *ast.IntValue:
+			n, err := strconv.Atoi(value.Value)
+			return n, err == nil
+		case *ast.Variable:
+			switch n := qc.variables[value.Name.Value].(type) {
+			case float64:
+				return int(n), true
+			case int:
+				return n, true
+			}
+		}
+	}
+
+	for _, argument := range definition.Args {
+		if argument.Name() == name {
+			n, ok := argument.DefaultValue.(int)
+			return n, ok
+		}
+	}
+	return 0, false
+}
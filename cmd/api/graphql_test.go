@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+)
+
+// TestQueryLimitsNegativeListSizes checks that negative list arguments
+// can't take the cost of the rest of a query off its total.
+func TestQueryLimitsNegativeListSizes(t *testing.T) {
+	schema, err := graphqlSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := &applicationDependencies{}
+	a.config.graphql.maxDepth = 8
+	a.config.graphql.maxComplexity = 2000
+
+	expensive := `b: books(pageSize: 100) { books { reviews(first: 100) { content } } }`
+	queries := []string{
+		`{ a: books(pageSize: -100000) { books { title } } ` + expensive + ` }`,
+		`{ a: books { books { reviews(first: -100000) { content } } } ` + expensive + ` }`,
+		`{ a: books(pageSize: -100000) { books { reviews(first: -100000) { content } } } ` + expensive + ` }`,
+	}
+
+	for _, query := range queries {
+		document, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{Body: []byte(query)})})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if validation := graphql.ValidateDocument(&schema, document, nil); !validation.IsValid {
+			t.Fatalf("%s: %v", query, validation.Errors)
+		}
+
+		errs := a.checkQueryLimits(&schema, document, "", nil)
+		if len(errs) == 0 {
+			t.Errorf("%s: passed the complexity limit of %d", query, a.config.graphql.maxComplexity)
+		}
+	}
+}
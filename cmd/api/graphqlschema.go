@@ -0,0 +1,412 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/graphql-go/graphql"
+	"github.com/tchenbz/AWTtest_3/internal/data"
+	"github.com/tchenbz/AWTtest_3/internal/validator"
+)
+
+// graphqlSchema is the schema of /v1/graphql. Its types mirror the models
+// in internal/data; the fields that load related records go through the
+// request's loaders, so that a list of books and their reviews costs one
+// query per level rather than one per book.
+var graphqlSchema = sync.OnceValues(newGraphQLSchema)
+
+func newGraphQLSchema() (graphql.Schema, error) {
+	nonNull := graphql.NewNonNull
+	listOf := func(t graphql.Type) graphql.Output {
+		return nonNull(graphql.NewList(nonNull(t)))
+	}
+
+	metadataType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Metadata",
+		Description: "Where a page sits in a paginated list.",
+		Fields: graphql.Fields{
+			"currentPage":  &graphql.Field{Type: nonNull(graphql.Int)},
+			"pageSize":     &graphql.Field{Type: nonNull(graphql.Int)},
+			"firstPage":    &graphql.Field{Type: nonNull(graphql.Int)},
+			"lastPage":     &graphql.Field{Type: nonNull(graphql.Int)},
+			"totalRecords": &graphql.Field{Type: nonNull(graphql.Int)},
+		},
+	})
+
+	bookAuthorType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "BookAuthor",
+		Fields: graphql.Fields{
+			"id":   &graphql.Field{Type: nonNull(graphql.ID)},
+			"name": &graphql.Field{Type: nonNull(graphql.String)},
+			"role": &graphql.Field{Type: nonNull(graphql.String)},
+		},
+	})
+
+	bookGenreType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "BookGenre",
+		Fields: graphql.Fields{
+			"id":       &graphql.Field{Type: nonNull(graphql.ID)},
+			"name":     &graphql.Field{Type: nonNull(graphql.String)},
+			"parentId": &graphql.Field{Type: graphql.ID},
+		},
+	})
+
+	bookSeriesType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "BookSeries",
+		Fields: graphql.Fields{
+			"id":       &graphql.Field{Type: nonNull(graphql.ID)},
+			"name":     &graphql.Field{Type: nonNull(graphql.String)},
+			"position": &graphql.Field{Type: nonNull(graphql.Float)},
+		},
+	})
+
+	reviewOrderValues := graphql.EnumValueConfigMap{}
+	for _, order := range data.ReviewOrders {
+		reviewOrderValues[strings.ToUpper(order)] = &graphql.EnumValueConfig{Value: order}
+	}
+	reviewOrderType := graphql.NewEnum(graphql.EnumConfig{
+		Name:        "ReviewOrder",
+		Description: "How a book's reviews are ranked.",
+		Values:      reviewOrderValues,
+	})
+
+	bookType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Book",
+		Fields: graphql.Fields{
+			"id":              &graphql.Field{Type: nonNull(graphql.ID)},
+			"title":           &graphql.Field{Type: nonNull(graphql.String)},
+			"authors":         &graphql.Field{Type: listOf(bookAuthorType)},
+			"isbn":            &graphql.Field{Type: nonNull(graphql.String)},
+			"publicationDate": &graphql.Field{Type: nonNull(graphql.String)},
+			"genre":           &graphql.Field{Type: nonNull(graphql.String)},
+			"genres":          &graphql.Field{Type: listOf(bookGenreType)},
+			"tags":            &graphql.Field{Type: listOf(graphql.String)},
+			"series":          &graphql.Field{Type: listOf(bookSeriesType)},
+			"description":     &graphql.Field{Type: nonNull(graphql.String)},
+			"averageRating":   &graphql.Field{Type: nonNull(graphql.Float)},
+			"workId": &graphql.Field{
+				Type: graphql.ID,
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					if book := p.Source.(*data.Book); book.WorkID != 0 {
+						return book.WorkID, nil
+					}
+					return nil, nil
+				},
+			},
+			"format":    &graphql.Field{Type: nonNull(graphql.String)},
+			"language":  &graphql.Field{Type: nonNull(graphql.String)},
+			"publisher": &graphql.Field{Type: nonNull(graphql.String)},
+			"pageCount": &graphql.Field{Type: nonNull(graphql.Int)},
+			"version":   &graphql.Field{Type: nonNull(graphql.Int)},
+			"readingListsCount": &graphql.Field{
+				Type:        nonNull(graphql.Int),
+				Description: "How many reading lists the book is on.",
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					book := p.Source.(*data.Book)
+					return graphqlFromContext(p.Context).loaders.bookReadingLists.Load(book.ID), nil
+				},
+			},
+		},
+	})
+
+	reviewType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Review",
+		Fields: graphql.Fields{
+			"id":           &graphql.Field{Type: nonNull(graphql.ID)},
+			"bookId":       &graphql.Field{Type: nonNull(graphql.ID)},
+			"content":      &graphql.Field{Type: nonNull(graphql.String)},
+			"author":       &graphql.Field{Type: nonNull(graphql.String)},
+			"rating":       &graphql.Field{Type: nonNull(graphql.Int)},
+			"helpfulCount": &graphql.Field{Type: nonNull(graphql.Int)},
+			"createdAt":    &graphql.Field{Type: nonNull(graphql.DateTime)},
+			"version":      &graphql.Field{Type: nonNull(graphql.Int)},
+			"book": &graphql.Field{
+				Type: bookType,
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					review := p.Source.(*data.Review)
+					return graphqlFromContext(p.Context).loaders.books.Load(review.BookID), nil
+				},
+			},
+		},
+	})
+
+	bookType.AddFieldConfig("reviews", &graphql.Field{
+		Type:        listOf(reviewType),
+		Description: "The book's top reviews.",
+		Args: graphql.FieldConfigArgument{
+			"first": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 5},
+			"order": &graphql.ArgumentConfig{Type: reviewOrderType, DefaultValue: "helpful"},
+		},
+		Resolve: func(p graphql.ResolveParams) (any, error) {
+			book := p.Source.(*data.Book)
+			first, _ := p.Args["first"].(int)
+			order, _ := p.Args["order"].(string)
+
+			v := validator.New()
+			validateFirst(v, first)
+			if !v.IsEmpty() {
+				return nil, graphqlValidationError(v)
+			}
+
+			key := bookReviewsKey{bookID: book.ID, first: first, order: order}
+			return graphqlFromContext(p.Context).loaders.bookReviews.Load(key), nil
+		},
+	})
+
+	userType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "User",
+		Fields: graphql.Fields{
+			"id":       &graphql.Field{Type: nonNull(graphql.ID)},
+			"username": &graphql.Field{Type: nonNull(graphql.String)},
+			"email": &graphql.Field{
+				Type:        graphql.String,
+				Description: "Only shown to the user themselves.",
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					user := p.Source.(*data.User)
+					if viewerID, ok := contextLookupUserID(p.Context); ok && viewerID == user.ID {
+						return user.Email, nil
+					}
+					return nil, nil
+				},
+			},
+			"emailVerified": &graphql.Field{Type: nonNull(graphql.Boolean)},
+			"createdAt":     &graphql.Field{Type: nonNull(graphql.DateTime)},
+			"version":       &graphql.Field{Type: nonNull(graphql.Int)},
+			"reviews": &graphql.Field{
+				Type:        listOf(reviewType),
+				Description: "The reviews the user wrote, newest first.",
+				Args: graphql.FieldConfigArgument{
+					"first": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 10},
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					user := p.Source.(*data.User)
+					first, _ := p.Args["first"].(int)
+
+					v := validator.New()
+					validateFirst(v, first)
+					if !v.IsEmpty() {
+						return nil, graphqlValidationError(v)
+					}
+
+					load := graphqlFromContext(p.Context).loaders.userReviews.Load(user.ID)
+					return func() (any, error) {
+						value, err := load()
+						if err != nil {
+							return nil, err
+						}
+						reviews := value.([]*data.Review)
+						return reviews[:min(first, len(reviews))], nil
+					}, nil
+				},
+			},
+		},
+	})
+
+	readingListType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "ReadingList",
+		Fields: graphql.Fields{
+			"id":          &graphql.Field{Type: nonNull(graphql.ID)},
+			"name":        &graphql.Field{Type: nonNull(graphql.String)},
+			"description": &graphql.Field{Type: nonNull(graphql.String)},
+			"status":      &graphql.Field{Type: nonNull(graphql.String)},
+			"createdAt":   &graphql.Field{Type: nonNull(graphql.DateTime)},
+			"version":     &graphql.Field{Type: nonNull(graphql.Int)},
+			"createdBy": &graphql.Field{
+				Type: userType,
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					readingList := p.Source.(*data.ReadingList)
+					return graphqlFromContext(p.Context).loaders.users.Load(readingList.CreatedBy), nil
+				},
+			},
+			"books": &graphql.Field{
+				Type:        listOf(bookType),
+				Description: "The books on the list.",
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					readingList := p.Source.(*data.ReadingList)
+					return graphqlFromContext(p.Context).loaders.books.LoadMany(readingList.Books), nil
+				},
+			},
+		},
+	})
+
+	userType.AddFieldConfig("readingLists", &graphql.Field{
+		Type:        listOf(readingListType),
+		Description: "The reading lists the user created.",
+		Resolve: func(p graphql.ResolveParams) (any, error) {
+			user := p.Source.(*data.User)
+			return graphqlFromContext(p.Context).loaders.userReadingLists.Load(user.ID), nil
+		},
+	})
+
+	pageArgs := func(args graphql.FieldConfigArgument) graphql.FieldConfigArgument {
+		args["page"] = &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 1}
+		args["pageSize"] = &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 10}
+		args["sort"] = &graphql.ArgumentConfig{Type: graphql.String, DefaultValue: "id"}
+		return args
+	}
+	pageOf := func(name, field string, itemType graphql.Type) *graphql.Object {
+		return graphql.NewObject(graphql.ObjectConfig{
+			Name: name,
+			Fields: graphql.Fields{
+				field:      &graphql.Field{Type: listOf(itemType)},
+				"metadata": &graphql.Field{Type: nonNull(metadataType)},
+			},
+		})
+	}
+
+	queryType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"book": &graphql.Field{
+				Type: bookType,
+				Args: graphql.FieldConfigArgument{"id": &graphql.ArgumentConfig{Type: nonNull(graphql.ID)}},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					id, ok := idArgument(p, "id")
+					if !ok {
+						return nil, nil
+					}
+					return graphqlFromContext(p.Context).loaders.books.Load(id), nil
+				},
+			},
+			"books": &graphql.Field{
+				Type: pageOf("BookPage", "books", bookType),
+				Args: pageArgs(graphql.FieldConfigArgument{
+					"title":  &graphql.ArgumentConfig{Type: graphql.String, DefaultValue: ""},
+					"author": &graphql.ArgumentConfig{Type: graphql.String, DefaultValue: ""},
+					"genre":  &graphql.ArgumentConfig{Type: graphql.String, DefaultValue: ""},
+				}),
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					filters, err := pageFilters(p, bookSortSafeList)
+					if err != nil {
+						return nil, err
+					}
+
+					title, _ := p.Args["title"].(string)
+					author, _ := p.Args["author"].(string)
+					genre, _ := p.Args["genre"].(string)
+					books, metadata, err := graphqlFromContext(p.Context).app.bookModel.GetAll(title, author, genre, filters)
+					if err != nil {
+						return nil, err
+					}
+					return map[string]any{"books": books, "metadata": metadata}, nil
+				},
+			},
+			"review": &graphql.Field{
+				Type: reviewType,
+				Args: graphql.FieldConfigArgument{
+					"bookId": &graphql.ArgumentConfig{Type: nonNull(graphql.ID)},
+					"id":     &graphql.ArgumentConfig{Type: nonNull(graphql.ID)},
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					bookID, ok := idArgument(p, "bookId")
+					id, ok2 := idArgument(p, "id")
+					if !ok || !ok2 {
+						return nil, nil
+					}
+					return nullIfNotFound(graphqlFromContext(p.Context).app.reviewModel.Get(bookID, id))
+				},
+			},
+			"readingList": &graphql.Field{
+				Type: readingListType,
+				Args: graphql.FieldConfigArgument{"id": &graphql.ArgumentConfig{Type: nonNull(graphql.ID)}},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					id, ok := idArgument(p, "id")
+					if !ok {
+						return nil, nil
+					}
+					return nullIfNotFound(graphqlFromContext(p.Context).app.readingListModel.Get(id))
+				},
+			},
+			"readingLists": &graphql.Field{
+				Type: pageOf("ReadingListPage", "readingLists", readingListType),
+				Args: pageArgs(graphql.FieldConfigArgument{
+					"name":   &graphql.ArgumentConfig{Type: graphql.String, DefaultValue: ""},
+					"status": &graphql.ArgumentConfig{Type: graphql.String, DefaultValue: ""},
+				}),
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					filters, err := pageFilters(p, readingListSortSafeList)
+					if err != nil {
+						return nil, err
+					}
+
+					name, _ := p.Args["name"].(string)
+					status, _ := p.Args["status"].(string)
+					readingLists, metadata, err := graphqlFromContext(p.Context).app.readingListModel.GetAll(name, status, filters)
+					if err != nil {
+						return nil, err
+					}
+					return map[string]any{"readingLists": readingLists, "metadata": metadata}, nil
+				},
+			},
+			"user": &graphql.Field{
+				Type: userType,
+				Args: graphql.FieldConfigArgument{"id": &graphql.ArgumentConfig{Type: nonNull(graphql.ID)}},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					id, ok := idArgument(p, "id")
+					if !ok {
+						return nil, nil
+					}
+					return graphqlFromContext(p.Context).loaders.users.Load(id), nil
+				},
+			},
+			"viewer": &graphql.Field{
+				Type:        userType,
+				Description: "The user the request's token was issued to.",
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					id, ok := contextLookupUserID(p.Context)
+					if !ok {
+						return nil, graphqlUnauthenticated("viewer needs an authorization token")
+					}
+					return graphqlFromContext(p.Context).loaders.users.Load(id), nil
+				},
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: queryType})
+}
+
+// idArgument reads an ID argument. Ids that aren't positive integers can't
+// match a record, so resolvers answer them with null.
+func idArgument(p graphql.ResolveParams, name string) (int64, bool) {
+	s, _ := p.Args[name].(string)
+	id, err := strconv.ParseInt(s, 10, 64)
+	return id, err == nil && id > 0
+}
+
+// pageFilters reads the page, pageSize and sort arguments of a list field.
+func pageFilters(p graphql.ResolveParams, sortSafeList []string) (data.Filters, error) {
+	filters := data.Filters{SortSafeList: sortSafeList}
+	filters.Page, _ = p.Args["page"].(int)
+	filters.PageSize, _ = p.Args["pageSize"].(int)
+	filters.Sort, _ = p.Args["sort"].(string)
+
+	v := validator.New()
+	data.ValidateFilters(v, filters)
+	if message, ok := v.Errors["page_size"]; ok {
+		delete(v.Errors, "page_size")
+		v.AddError("pageSize", message)
+	}
+	if !v.IsEmpty() {
+		return data.Filters{}, graphqlValidationError(v)
+	}
+	return filters, nil
+}
+
+func validateFirst(v *validator.Validator, first int) {
+	v.Check(first > 0, "first", "must be greater than zero")
+	v.Check(first <= 100, "first", "must be a maximum of 100")
+}
+
+// nullIfNotFound turns a missing record into a null field.
+func nullIfNotFound[T any](record *T, err error) (any, error) {
+	if errors.Is(err, data.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
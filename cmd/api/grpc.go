@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+
+	"github.com/tchenbz/AWTtest_3/internal/data"
+	"github.com/tchenbz/AWTtest_3/internal/validator"
+	catalogv1 "github.com/tchenbz/AWTtest_3/pkg/catalog/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// grpcServer returns the gRPC server for the catalog services and the
+// health service registered on it. Every service reports as serving until
+// the health service is shut down.
+func (a *applicationDependencies) grpcServer() (*grpc.Server, *health.Server) {
+	srv := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(a.grpcRecoverPanic, a.grpcRateLimit),
+		grpc.ChainStreamInterceptor(a.grpcRecoverStreamPanic, a.grpcRateLimitStream),
+		// The same cap readJSON puts on request bodies.
+		grpc.MaxRecvMsgSize(256_000),
+	)
+
+	catalogv1.RegisterBookServiceServer(srv, &bookServer{app: a})
+	catalogv1.RegisterReviewServiceServer(srv, &reviewServer{app: a})
+	catalogv1.RegisterReadingListServiceServer(srv, &readingListServer{app: a})
+
+	healthServer := health.NewServer()
+	for name := range srv.GetServiceInfo() {
+		healthServer.SetServingStatus(name, healthpb.HealthCheckResponse_SERVING)
+	}
+	healthpb.RegisterHealthServer(srv, healthServer)
+
+	return srv, healthServer
+}
+
+// grpcRecoverPanic is the gRPC counterpart of recoverPanic.
+func (a *applicationDependencies) grpcRecoverPanic(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			resp, err = nil, a.grpcServerError(ctx, fmt.Errorf("%s", p))
+		}
+	}()
+	return handler(ctx, req)
+}
+
+func (a *applicationDependencies) grpcRecoverStreamPanic(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = a.grpcServerError(ss.Context(), fmt.Errorf("%s", p))
+		}
+	}()
+	return handler(srv, ss)
+}
+
+// grpcRateLimit is the gRPC counterpart of rateLimit. Calls count against
+// the same per-IP limits as HTTP requests.
+func (a *applicationDependencies) grpcRateLimit(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	err := a.grpcAllow(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (a *applicationDependencies) grpcRateLimitStream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	err := a.grpcAllow(ss.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+// grpcAllow takes a token from the bucket of the calling IP, and returns
+// ResourceExhausted when there is none left.
+func (a *applicationDependencies) grpcAllow(ctx context.Context) error {
+	if !a.config.limiter.enabled {
+		return nil
+	}
+
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return a.grpcServerError(ctx, errors.New("the peer of a call is unknown"))
+	}
+	ip, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return a.grpcServerError(ctx, err)
+	}
+
+	if !a.limiter.allow(ip, a.config.limiter.rps, a.config.limiter.burst) {
+		return status.Error(codes.ResourceExhausted, "rate limit exceeded")
+	}
+	return nil
+}
+
+// grpcServerError logs err and returns the status reported for it, which
+// like serverErrorResponse doesn't reveal the cause.
+func (a *applicationDependencies) grpcServerError(ctx context.Context, err error) error {
+	method, _ := grpc.Method(ctx)
+	a.logger.Error(err.Error(), "rpc", method)
+	return status.Error(codes.Internal, "the server encountered a problem and could not process your request")
+}
+
+func grpcNotFound() error {
+	return status.Error(codes.NotFound, "the requested resource could not be found")
+}
+
+// grpcFailedValidation reports the fields a validator found invalid as the
+// violations of an InvalidArgument status, with the same field names and
+// descriptions the JSON API uses.
+func grpcFailedValidation(errs map[string]string) error {
+	fields := make([]string, 0, len(errs))
+	for field := range errs {
+		fields = append(fields, field)
+	}
+	slices.Sort(fields)
+
+	details := &errdetails.BadRequest{}
+	for _, field := range fields {
+		details.FieldViolations = append(details.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       field,
+			Description: errs[field],
+		})
+	}
+
+	st, err := status.New(codes.InvalidArgument, "invalid arguments").WithDetails(details)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, "invalid arguments")
+	}
+	return st.Err()
+}
+
+// grpcFilters returns the filters selecting page, defaulting like the list
+// routes of the JSON API do.
+func grpcFilters(page *catalogv1.Page, sortSafeList []string) data.Filters {
+	filters := data.Filters{Page: 1, PageSize: 10, Sort: "id", SortSafeList: sortSafeList}
+	if page.GetPage() != 0 {
+		filters.Page = int(page.GetPage())
+	}
+	if page.GetPageSize() != 0 {
+		filters.PageSize = int(page.GetPageSize())
+	}
+	if page.GetSort() != "" {
+		filters.Sort = page.GetSort()
+	}
+	return filters
+}
+
+func metadataToProto(m data.Metadata) *catalogv1.Metadata {
+	return &catalogv1.Metadata{
+		CurrentPage:  int32(m.CurrentPage),
+		PageSize:     int32(m.PageSize),
+		FirstPage:    int32(m.FirstPage),
+		LastPage:     int32(m.LastPage),
+		TotalRecords: int32(m.TotalRecords),
+	}
+}
+
+// applyUpdateMask copies the fields mask names from src to dst, or every
+// field in fields when the mask is empty. Unknown paths are reported to v.
+func applyUpdateMask[T any](v *validator.Validator, mask *fieldmaskpb.FieldMask, fields map[string]func(dst, src T), dst, src T) {
+	if len(mask.GetPaths()) == 0 {
+		for _, apply := range fields {
+			apply(dst, src)
+		}
+		return
+	}
+
+	for _, path := range mask.GetPaths() {
+		apply, ok := fields[path]
+		if !ok {
+			v.AddError("update_mask", fmt.Sprintf("%q is not a field that can be updated", path))
+			continue
+		}
+		apply(dst, src)
+	}
+}
+
+func bookToProto(book *data.Book) *catalogv1.Book {
+	pb := &catalogv1.Book{
+		Id:              book.ID,
+		Title:           book.Title,
+		Isbn:            book.ISBN,
+		PublicationDate: book.PublicationDate,
+		Genre:           book.Genre,
+		Tags:            book.Tags,
+		Description:     book.Description,
+		AverageRating:   book.AverageRating,
+		WorkId:          book.WorkID,
+		Format:          book.Format,
+		Language:        book.Language,
+		Publisher:       book.Publisher,
+		PageCount:       int32(book.PageCount),
+		Version:         book.Version,
+	}
+	for _, author := range book.Authors {
+		pb.Authors = append(pb.Authors, &catalogv1.BookAuthor{Id: author.ID, Name: author.Name, Role: author.Role})
+	}
+	for _, genre := range book.Genres {
+		pb.Genres = append(pb.Genres, &catalogv1.BookGenre{Id: genre.ID, Name: genre.Name, ParentId: genre.ParentID})
+	}
+	for _, series := range book.Series {
+		pb.Series = append(pb.Series, &catalogv1.BookSeries{Id: series.ID, Name: series.Name, Position: series.Position})
+	}
+	return pb
+}
+
+// bookFromProto returns the writable fields of a book sent by a client.
+func bookFromProto(pb *catalogv1.Book) *data.Book {
+	book := &data.Book{
+		Title:           pb.GetTitle(),
+		ISBN:            pb.GetIsbn(),
+		PublicationDate: pb.GetPublicationDate(),
+		Genre:           pb.GetGenre(),
+		Description:     pb.GetDescription(),
+		AverageRating:   pb.GetAverageRating(),
+		WorkID:          pb.GetWorkId(),
+		Format:          pb.GetFormat(),
+		Language:        pb.GetLanguage(),
+		Publisher:       pb.GetPublisher(),
+		PageCount:       int(pb.GetPageCount()),
+	}
+	for _, author := range pb.GetAuthors() {
+		book.Authors = append(book.Authors, &data.BookAuthor{ID: author.GetId(), Name: author.GetName(), Role: author.GetRole()})
+	}
+	for _, genre := range pb.GetGenres() {
+		book.Genres = append(book.Genres, &data.BookGenre{ID: genre.GetId()})
+	}
+	return book
+}
+
+func reviewToProto(review *data.Review) *catalogv1.Review {
+	return &catalogv1.Review{
+		Id:           review.ID,
+		BookId:       review.BookID,
+		Content:      review.Content,
+		Author:       review.Author,
+		Rating:       int32(review.Rating),
+		HelpfulCount: int32(review.HelpfulCount),
+		CreatedAt:    timestamppb.New(review.CreatedAt),
+		Version:      review.Version,
+	}
+}
+
+func readingListToProto(readingList *data.ReadingList) *catalogv1.ReadingList {
+	return &catalogv1.ReadingList{
+		Id:          readingList.ID,
+		Name:        readingList.Name,
+		Description: readingList.Description,
+		CreatedBy:   readingList.CreatedBy,
+		Books:       readingList.Books,
+		Status:      readingList.Status,
+		CreatedAt:   timestamppb.New(readingList.CreatedAt),
+		Version:     readingList.Version,
+	}
+}
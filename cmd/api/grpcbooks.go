@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/tchenbz/AWTtest_3/internal/data"
+	"github.com/tchenbz/AWTtest_3/internal/validator"
+	catalogv1 "github.com/tchenbz/AWTtest_3/pkg/catalog/v1"
+	"google.golang.org/grpc"
+)
+
+// exportBatchSize is how many books ExportBooks reads from the database at
+// a time.
+const exportBatchSize = 100
+
+// bookServer implements catalogv1.BookServiceServer.
+type bookServer struct {
+	catalogv1.UnimplementedBookServiceServer
+	app *applicationDependencies
+}
+
+// bookUpdateFields are the fields of a book an update mask can name.
+var bookUpdateFields = map[string]func(dst, src *data.Book){
+	"title":            func(dst, src *data.Book) { dst.Title = src.Title },
+	"authors":          func(dst, src *data.Book) { dst.Authors = src.Authors },
+	"isbn":             func(dst, src *data.Book) { dst.ISBN = src.ISBN },
+	"publication_date": func(dst, src *data.Book) { dst.PublicationDate = src.PublicationDate },
+	"genre":            func(dst, src *data.Book) { dst.Genre = src.Genre },
+	"genres":           func(dst, src *data.Book) { dst.Genres = src.Genres },
+	"description":      func(dst, src *data.Book) { dst.Description = src.Description },
+	"average_rating":   func(dst, src *data.Book) { dst.AverageRating = src.AverageRating },
+	"work_id":          func(dst, src *data.Book) { dst.WorkID = src.WorkID },
+	"format":           func(dst, src *data.Book) { dst.Format = src.Format },
+	"language":         func(dst, src *data.Book) { dst.Language = src.Language },
+	"publisher":        func(dst, src *data.Book) { dst.Publisher = src.Publisher },
+	"page_count":       func(dst, src *data.Book) { dst.PageCount = src.PageCount },
+}
+
+func (s *bookServer) GetBook(ctx context.Context, req *catalogv1.GetBookRequest) (*catalogv1.Book, error) {
+	book, err := s.app.bookModel.Get(req.GetId())
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return nil, grpcNotFound()
+		default:
+			return nil, s.app.grpcServerError(ctx, err)
+		}
+	}
+	return bookToProto(book), nil
+}
+
+func (s *bookServer) ListBooks(ctx context.Context, req *catalogv1.ListBooksRequest) (*catalogv1.ListBooksResponse, error) {
+	filters := grpcFilters(req.GetPage(), bookSortSafeList)
+
+	v := validator.New()
+	data.ValidateFilters(v, filters)
+	if !v.IsEmpty() {
+		return nil, grpcFailedValidation(v.Errors)
+	}
+
+	books, metadata, err := s.app.bookModel.GetAll(req.GetTitle(), "", req.GetGenre(), filters)
+	if err != nil {
+		return nil, s.app.grpcServerError(ctx, err)
+	}
+
+	resp := &catalogv1.ListBooksResponse{Metadata: metadataToProto(metadata)}
+	for _, book := range books {
+		resp.Books = append(resp.Books, bookToProto(book))
+	}
+	return resp, nil
+}
+
+func (s *bookServer) CreateBook(ctx context.Context, req *catalogv1.CreateBookRequest) (*catalogv1.Book, error) {
+	book := bookFromProto(req.GetBook())
+
+	v := validator.New()
+	data.ValidateBook(v, book)
+	if !v.IsEmpty() {
+		return nil, grpcFailedValidation(v.Errors)
+	}
+
+	err := s.app.bookModel.Insert(book)
+	if err != nil {
+		return nil, s.bookWriteError(ctx, err)
+	}
+	return bookToProto(book), nil
+}
+
+func (s *bookServer) UpdateBook(ctx context.Context, req *catalogv1.UpdateBookRequest) (*catalogv1.Book, error) {
+	book, err := s.app.bookModel.Get(req.GetBook().GetId())
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return nil, grpcNotFound()
+		default:
+			return nil, s.app.grpcServerError(ctx, err)
+		}
+	}
+
+	v := validator.New()
+	applyUpdateMask(v, req.GetUpdateMask(), bookUpdateFields, book, bookFromProto(req.GetBook()))
+	data.ValidateBook(v, book)
+	if !v.IsEmpty() {
+		return nil, grpcFailedValidation(v.Errors)
+	}
+
+	err = s.app.bookModel.Update(book)
+	if err != nil {
+		return nil, s.bookWriteError(ctx, err)
+	}
+	return bookToProto(book), nil
+}
+
+// bookWriteError reports an error saving a book the way createBookHandler
+// and updateBookHandler do.
+func (s *bookServer) bookWriteError(ctx context.Context, err error) error {
+	switch {
+	case errors.Is(err, data.ErrUnknownAuthor):
+		return grpcFailedValidation(map[string]string{"authors": err.Error()})
+	case errors.Is(err, data.ErrUnknownGenre):
+		return grpcFailedValidation(map[string]string{"genres": err.Error()})
+	case errors.Is(err, data.ErrUnknownWork):
+		return grpcFailedValidation(map[string]string{"work_id": err.Error()})
+	case errors.Is(err, data.ErrRecordNotFound):
+		return grpcNotFound()
+	default:
+		return s.app.grpcServerError(ctx, err)
+	}
+}
+
+func (s *bookServer) DeleteBook(ctx context.Context, req *catalogv1.DeleteBookRequest) (*catalogv1.DeleteBookResponse, error) {
+	err := s.app.bookModel.Delete(req.GetId())
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return nil, grpcNotFound()
+		default:
+			return nil, s.app.grpcServerError(ctx, err)
+		}
+	}
+	return &catalogv1.DeleteBookResponse{}, nil
+}
+
+// ExportBooks sends the books a batch at a time, so that an export holds
+// neither the whole catalog in memory nor a query open while the client
+// reads.
+func (s *bookServer) ExportBooks(req *catalogv1.ExportBooksRequest, stream grpc.ServerStreamingServer[catalogv1.Book]) error {
+	var afterID int64
+	for {
+		books, err := s.app.bookModel.GetAfter(afterID, exportBatchSize)
+		if err != nil {
+			return s.app.grpcServerError(stream.Context(), err)
+		}
+
+		for _, book := range books {
+			err := stream.Send(bookToProto(book))
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(books) < exportBatchSize {
+			return nil
+		}
+		afterID = books[len(books)-1].ID
+	}
+}
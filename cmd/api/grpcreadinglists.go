@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/tchenbz/AWTtest_3/internal/data"
+	"github.com/tchenbz/AWTtest_3/internal/validator"
+	catalogv1 "github.com/tchenbz/AWTtest_3/pkg/catalog/v1"
+)
+
+// readingListServer implements catalogv1.ReadingListServiceServer.
+type readingListServer struct {
+	catalogv1.UnimplementedReadingListServiceServer
+	app *applicationDependencies
+}
+
+// readingListUpdateFields are the fields of a reading list an update mask
+// can name.
+var readingListUpdateFields = map[string]func(dst, src *data.ReadingList){
+	"name":        func(dst, src *data.ReadingList) { dst.Name = src.Name },
+	"description": func(dst, src *data.ReadingList) { dst.Description = src.Description },
+	"status":      func(dst, src *data.ReadingList) { dst.Status = src.Status },
+	// A non-nil slice makes Update replace the books, even with none.
+	"books": func(dst, src *data.ReadingList) { dst.Books = append([]int64{}, src.Books...) },
+}
+
+// readingListFromProto returns the writable fields of a reading list sent
+// by a client.
+func readingListFromProto(pb *catalogv1.ReadingList) *data.ReadingList {
+	return &data.ReadingList{
+		Name:        pb.GetName(),
+		Description: pb.GetDescription(),
+		CreatedBy:   pb.GetCreatedBy(),
+		Status:      pb.GetStatus(),
+		Books:       pb.GetBooks(),
+	}
+}
+
+func (s *readingListServer) GetReadingList(ctx context.Context, req *catalogv1.GetReadingListRequest) (*catalogv1.ReadingList, error) {
+	readingList, err := s.app.readingListModel.Get(req.GetId())
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return nil, grpcNotFound()
+		default:
+			return nil, s.app.grpcServerError(ctx, err)
+		}
+	}
+	return readingListToProto(readingList), nil
+}
+
+func (s *readingListServer) ListReadingLists(ctx context.Context, req *catalogv1.ListReadingListsRequest) (*catalogv1.ListReadingListsResponse, error) {
+	filters := grpcFilters(req.GetPage(), readingListSortSafeList)
+
+	v := validator.New()
+	data.ValidateFilters(v, filters)
+	if !v.IsEmpty() {
+		return nil, grpcFailedValidation(v.Errors)
+	}
+
+	readingLists, metadata, err := s.app.readingListModel.GetAll(req.GetName(), req.GetStatus(), filters)
+	if err != nil {
+		return nil, s.app.grpcServerError(ctx, err)
+	}
+
+	resp := &catalogv1.ListReadingListsResponse{Metadata: metadataToProto(metadata)}
+	for _, readingList := range readingLists {
+		resp.ReadingLists = append(resp.ReadingLists, readingListToProto(readingList))
+	}
+	return resp, nil
+}
+
+func (s *readingListServer) CreateReadingList(ctx context.Context, req *catalogv1.CreateReadingListRequest) (*catalogv1.ReadingList, error) {
+	readingList := readingListFromProto(req.GetReadingList())
+	// Like createReadingListHandler, books are added once the list exists.
+	readingList.Books = nil
+
+	v := validator.New()
+	data.ValidateReadingList(v, readingList)
+	if !v.IsEmpty() {
+		return nil, grpcFailedValidation(v.Errors)
+	}
+
+	err := s.app.readingListModel.Insert(readingList)
+	if err != nil {
+		return nil, s.app.grpcServerError(ctx, err)
+	}
+	return readingListToProto(readingList), nil
+}
+
+func (s *readingListServer) UpdateReadingList(ctx context.Context, req *catalogv1.UpdateReadingListRequest) (*catalogv1.ReadingList, error) {
+	readingList, err := s.app.readingListModel.Get(req.GetReadingList().GetId())
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return nil, grpcNotFound()
+		default:
+			return nil, s.app.grpcServerError(ctx, err)
+		}
+	}
+
+	v := validator.New()
+	applyUpdateMask(v, req.GetUpdateMask(), readingListUpdateFields, readingList, readingListFromProto(req.GetReadingList()))
+	data.ValidateReadingList(v, readingList)
+	if !v.IsEmpty() {
+		return nil, grpcFailedValidation(v.Errors)
+	}
+
+	err = s.app.readingListModel.Update(readingList)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrUnknownBook):
+			return nil, grpcFailedValidation(map[string]string{"books": err.Error()})
+		case errors.Is(err, data.ErrRecordNotFound):
+			return nil, grpcNotFound()
+		default:
+			return nil, s.app.grpcServerError(ctx, err)
+		}
+	}
+	return readingListToProto(readingList), nil
+}
+
+func (s *readingListServer) DeleteReadingList(ctx context.Context, req *catalogv1.DeleteReadingListRequest) (*catalogv1.DeleteReadingListResponse, error) {
+	err := s.app.readingListModel.Delete(req.GetId())
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return nil, grpcNotFound()
+		default:
+			return nil, s.app.grpcServerError(ctx, err)
+		}
+	}
+	return &catalogv1.DeleteReadingListResponse{}, nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/tchenbz/AWTtest_3/internal/data"
+	"github.com/tchenbz/AWTtest_3/internal/validator"
+	catalogv1 "github.com/tchenbz/AWTtest_3/pkg/catalog/v1"
+)
+
+// reviewServer implements catalogv1.ReviewServiceServer.
+type reviewServer struct {
+	catalogv1.UnimplementedReviewServiceServer
+	app *applicationDependencies
+}
+
+// reviewUpdateFields are the fields of a review an update mask can name.
+var reviewUpdateFields = map[string]func(dst, src *data.Review){
+	"content":       func(dst, src *data.Review) { dst.Content = src.Content },
+	"author":        func(dst, src *data.Review) { dst.Author = src.Author },
+	"rating":        func(dst, src *data.Review) { dst.Rating = src.Rating },
+	"helpful_count": func(dst, src *data.Review) { dst.HelpfulCount = src.HelpfulCount },
+}
+
+// reviewFromProto returns the writable fields of a review sent by a client.
+func reviewFromProto(pb *catalogv1.Review) *data.Review {
+	return &data.Review{
+		BookID:       pb.GetBookId(),
+		Content:      pb.GetContent(),
+		Author:       pb.GetAuthor(),
+		Rating:       int(pb.GetRating()),
+		HelpfulCount: int(pb.GetHelpfulCount()),
+	}
+}
+
+func (s *reviewServer) GetReview(ctx context.Context, req *catalogv1.GetReviewRequest) (*catalogv1.Review, error) {
+	review, err := s.app.reviewModel.Get(req.GetBookId(), req.GetId())
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return nil, grpcNotFound()
+		default:
+			return nil, s.app.grpcServerError(ctx, err)
+		}
+	}
+	return reviewToProto(review), nil
+}
+
+func (s *reviewServer) ListReviews(ctx context.Context, req *catalogv1.ListReviewsRequest) (*catalogv1.ListReviewsResponse, error) {
+	filters := grpcFilters(req.GetPage(), reviewSortSafeList)
+
+	v := validator.New()
+	data.ValidateFilters(v, filters)
+	if !v.IsEmpty() {
+		return nil, grpcFailedValidation(v.Errors)
+	}
+
+	var reviews []*data.Review
+	var metadata data.Metadata
+	var err error
+	if req.GetBookId() != 0 {
+		reviews, metadata, err = s.app.reviewModel.GetAllForBook(req.GetBookId(), req.GetContent(), req.GetAuthor(), int(req.GetRating()), filters)
+	} else {
+		reviews, metadata, err = s.app.reviewModel.GetAll(req.GetContent(), req.GetAuthor(), int(req.GetRating()), filters)
+	}
+	if err != nil {
+		return nil, s.app.grpcServerError(ctx, err)
+	}
+
+	resp := &catalogv1.ListReviewsResponse{Metadata: metadataToProto(metadata)}
+	for _, review := range reviews {
+		resp.Reviews = append(resp.Reviews, reviewToProto(review))
+	}
+	return resp, nil
+}
+
+func (s *reviewServer) CreateReview(ctx context.Context, req *catalogv1.CreateReviewRequest) (*catalogv1.Review, error) {
+	review := reviewFromProto(req.GetReview())
+
+	v := validator.New()
+	data.ValidateReview(v, review)
+	if !v.IsEmpty() {
+		return nil, grpcFailedValidation(v.Errors)
+	}
+
+	// Reviewing a book that doesn't exist is reported as such rather than
+	// as the foreign key violation the insert would fail with.
+	_, err := s.app.bookModel.Get(review.BookID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return nil, grpcNotFound()
+		default:
+			return nil, s.app.grpcServerError(ctx, err)
+		}
+	}
+
+	err = s.app.reviewModel.Insert(review)
+	if err != nil {
+		return nil, s.app.grpcServerError(ctx, err)
+	}
+	return reviewToProto(review), nil
+}
+
+func (s *reviewServer) UpdateReview(ctx context.Context, req *catalogv1.UpdateReviewRequest) (*catalogv1.Review, error) {
+	review, err := s.app.reviewModel.Get(req.GetReview().GetBookId(), req.GetReview().GetId())
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return nil, grpcNotFound()
+		default:
+			return nil, s.app.grpcServerError(ctx, err)
+		}
+	}
+
+	v := validator.New()
+	applyUpdateMask(v, req.GetUpdateMask(), reviewUpdateFields, review, reviewFromProto(req.GetReview()))
+	data.ValidateReview(v, review)
+	if !v.IsEmpty() {
+		return nil, grpcFailedValidation(v.Errors)
+	}
+
+	err = s.app.reviewModel.Update(review)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return nil, grpcNotFound()
+		default:
+			return nil, s.app.grpcServerError(ctx, err)
+		}
+	}
+	return reviewToProto(review), nil
+}
+
+func (s *reviewServer) DeleteReview(ctx context.Context, req *catalogv1.DeleteReviewRequest) (*catalogv1.DeleteReviewResponse, error) {
+	err := s.app.reviewModel.Delete(req.GetBookId(), req.GetId())
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return nil, grpcNotFound()
+		default:
+			return nil, s.app.grpcServerError(ctx, err)
+		}
+	}
+	return &catalogv1.DeleteReviewResponse{}, nil
+}
@@ -14,7 +14,7 @@ data := envelope {
 	},
 }
 
-err := a.writeJSON(w, http.StatusOK, data, nil)
+err := a.writeResponse(w, r, http.StatusOK, data, nil)
 if err != nil {
 a.serverErrorResponse(w, r, err)
 }
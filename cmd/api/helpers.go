@@ -1,42 +1,106 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"encoding/xml"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/julienschmidt/httprouter"
+	"github.com/tchenbz/AWTtest_3/internal/data"
+	"github.com/tchenbz/AWTtest_3/internal/render"
 	"github.com/tchenbz/AWTtest_3/internal/validator"
 )
 
 type envelope map[string]any
 
-func (a *applicationDependencies)writeJSON(w http.ResponseWriter, status int, data envelope, headers http.Header) error {
-	jsResponse, err := json.MarshalIndent(data, "", "\t")
+// encoderContextKey is the context key negotiateContent stores the
+// negotiated encoder under.
+type encoderContextKey struct{}
+
+// writeResponse writes data in the representation the request's Accept
+// header asks for; see render.Negotiate. The representation is settled by
+// negotiateContent before the handler runs. When none of the acceptable
+// types can be produced, it answers 406 Not Acceptable in JSON instead.
+func (a *applicationDependencies) writeResponse(w http.ResponseWriter, r *http.Request, status int, data envelope, headers http.Header) error {
+	enc, ok := r.Context().Value(encoderContextKey{}).(render.Encoder)
+	if !ok {
+		enc, ok = render.Negotiate(r.Header.Values("Accept"))
+	}
+
+	addVary(w.Header(), "Accept")
+	if !ok {
+		return a.writeEncoded(w, render.PrettyJSON, http.StatusNotAcceptable, envelope{"error": notAcceptableMessage}, nil)
+	}
+	return a.writeEncoded(w, enc, status, data, headers)
+}
+
+// writeEncoded writes data with enc.
+func (a *applicationDependencies) writeEncoded(w http.ResponseWriter, enc render.Encoder, status int, data envelope, headers http.Header) error {
+	var buf bytes.Buffer
+	err := enc.Encode(&buf, data)
 	if err != nil {
 		return err
 	}
 
-	jsResponse = append(jsResponse, '\n')
-
 	for key, value := range headers {
 		w.Header()[key] = value
-		//w.Header().Set(key, value)
 	}
 
-	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Type", enc.ContentType())
 	w.WriteHeader(status)
-	_, err = w.Write(jsResponse)
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// addVary adds field to the Vary header unless it is already listed.
+func addVary(h http.Header, field string) {
+	for _, value := range h.Values("Vary") {
+		for _, existing := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(existing), field) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", field)
+}
+
+// writeXML writes v as an XML document with the given Content-Type.
+func (a *applicationDependencies) writeXML(w http.ResponseWriter, status int, contentType string, v any, headers http.Header) error {
+	xmlResponse, err := xml.MarshalIndent(v, "", "\t")
 	if err != nil {
 		return err
 	}
 
-	return nil
+	xmlResponse = append([]byte(xml.Header), xmlResponse...)
+	xmlResponse = append(xmlResponse, '\n')
+
+	for key, value := range headers {
+		w.Header()[key] = value
+	}
+
+	w.Header().Set("Content-Type", contentType+"; charset=utf-8")
+	w.WriteHeader(status)
+	_, err = w.Write(xmlResponse)
+	return err
+}
+
+// absoluteURL turns a path on this server into an absolute URL, as feeds
+// and catalogs need for their ids and links.
+func (a *applicationDependencies) absoluteURL(r *http.Request, path string) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + path
 }
 
 func (a *applicationDependencies)readJSON(w http.ResponseWriter, r *http.Request, destination any) error {
@@ -125,4 +189,85 @@ func (a *applicationDependencies) getSingleIntegerParameter(queryParameters url.
 	}
 
 	return intValue
-}
\ No newline at end of file
+}
+
+// getFilterConditions collects the filter expressions from the query string.
+// Both filter[field]=value (shorthand for eq) and filter[field][op]=value are
+// accepted; the fields, operators and values are checked later by
+// data.ValidateFilters against the handler's FilterSafeList.
+func (a *applicationDependencies) getFilterConditions(queryParameters url.Values, v *validator.Validator) []data.FilterCondition {
+	keys := []string{}
+	for key := range queryParameters {
+		if strings.HasPrefix(key, "filter[") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	conditions := []data.FilterCondition{}
+	for _, key := range keys {
+		parts := strings.Split(strings.TrimSuffix(strings.TrimPrefix(key, "filter["), "]"), "][")
+		if !strings.HasSuffix(key, "]") || len(parts) > 2 || parts[0] == "" {
+			v.AddError(key, "must be of the form filter[field] or filter[field][operator]")
+			continue
+		}
+		operator := "eq"
+		if len(parts) == 2 {
+			operator = parts[1]
+		}
+		for _, value := range queryParameters[key] {
+			conditions = append(conditions, data.FilterCondition{
+				Field:    parts[0],
+				Operator: operator,
+				Value:    value,
+			})
+		}
+	}
+
+	return conditions
+}
+
+// acceptedMediaTypes returns the media types in the request's Accept header,
+// most preferred first, without their parameters.
+func (a *applicationDependencies) acceptedMediaTypes(r *http.Request) []string {
+	ranges := render.ParseAccept(r.Header.Values("Accept"))
+	mediaTypes := make([]string, len(ranges))
+	for i, mr := range ranges {
+		mediaTypes[i] = mr.Type
+	}
+	return mediaTypes
+}
+
+// contextGetUserID returns the id of the user authenticated by AuthMiddleware.
+func (a *applicationDependencies) contextGetUserID(r *http.Request) int64 {
+	userID, ok := r.Context().Value("user_id").(float64)
+	if !ok {
+		panic("missing user_id value in request context")
+	}
+	return int64(userID)
+}
+
+// contextLookupUserID returns the id of the user authenticated by
+// AuthMiddleware, and whether the request was authenticated at all.
+func contextLookupUserID(ctx context.Context) (int64, bool) {
+	userID, ok := ctx.Value("user_id").(float64)
+	return int64(userID), ok
+}
+
+// background runs fn in a goroutine that is waited for on shutdown, and
+// logs rather than crashes on a panic.
+func (a *applicationDependencies) background(fn func()) {
+	a.wg.Add(1)
+
+	go func() {
+		defer a.wg.Done()
+
+		defer func() {
+			if err := recover(); err != nil {
+				a.logger.Error(fmt.Sprintf("%v", err))
+			}
+		}()
+
+		fn()
+	}()
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/tchenbz/AWTtest_3/internal/data"
+	"github.com/tchenbz/AWTtest_3/internal/validator"
+)
+
+const maxIdempotencyKeyLength = 255
+
+// idempotentHeaders are the response headers stored and replayed along with
+// the body.
+var idempotentHeaders = []string{"Content-Type", "Location"}
+
+// idempotent lets clients retry a create request safely. A request with an
+// Idempotency-Key header reserves the key for its caller and path; its
+// response is stored for 24 hours and replayed, with an Idempotent-Replayed
+// header, to a retry that carries the same key and body. Reusing the key
+// with a different body is an error. Requests without the header run as
+// usual.
+func (a *applicationDependencies) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			next(w, r)
+			return
+		}
+
+		v := validator.New()
+		v.Check(len(key) <= maxIdempotencyKeyLength, "idempotency_key", "must not be more than 255 bytes long")
+		if !v.IsEmpty() {
+			a.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		// The body is read here to fingerprint it, and handed on to the
+		// handler unchanged.
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1_048_576))
+		if err != nil {
+			a.badRequestResponse(w, r, err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		scope := idempotencyScope(r)
+		fingerprint := hashHex([]byte(r.URL.RawQuery), body)
+
+		stored, err := a.idempotencyModel.Reserve(scope, key, fingerprint)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrIdempotencyKeyReused), errors.Is(err, data.ErrIdempotencyKeyInProgress):
+				a.idempotencyKeyErrorResponse(w, r, err)
+			default:
+				a.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		if stored != nil {
+			for name, value := range stored.Headers {
+				w.Header().Set(name, value)
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(stored.Status)
+			w.Write(stored.Body)
+			return
+		}
+
+		// Unless a response is saved for it, the key is given up so that a
+		// retry runs the request again. That includes a handler panicking,
+		// which the deferred release sees on its way out to recoverPanic.
+		saved := false
+		defer func() {
+			if saved {
+				return
+			}
+			err := a.idempotencyModel.Release(scope, key)
+			if err != nil {
+				a.logError(r, err)
+			}
+		}()
+
+		rec := &batchRecorder{header: w.Header()}
+		next(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		// A server error says nothing about whether the request can succeed,
+		// so no response is saved for it.
+		if rec.status < 500 {
+			resp := &data.IdempotentResponse{
+				Status:  rec.status,
+				Headers: map[string]string{},
+				Body:    rec.body.Bytes(),
+			}
+			for _, name := range idempotentHeaders {
+				if value := rec.header.Get(name); value != "" {
+					resp.Headers[name] = value
+				}
+			}
+			err = a.idempotencyModel.Save(scope, key, resp)
+			if err != nil {
+				a.logError(r, err)
+			} else {
+				saved = true
+			}
+		}
+
+		w.WriteHeader(rec.status)
+		w.Write(rec.body.Bytes())
+	}
+}
+
+// idempotencyScope keeps the keys of different callers and endpoints apart.
+// Callers are told apart by their Authorization header, which is hashed
+// rather than stored.
+func idempotencyScope(r *http.Request) string {
+	return r.Method + " " + r.URL.Path + " " + hashHex([]byte(r.Header.Get("Authorization")))
+}
+
+func hashHex(parts ...[]byte) string {
+	h := sha256.New()
+	for _, part := range parts {
+		h.Write(part)
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
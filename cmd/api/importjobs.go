@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/tchenbz/AWTtest_3/internal/data"
+	"github.com/tchenbz/AWTtest_3/internal/validator"
+)
+
+// displayImportJobHandler reports the progress and conflicts of one of the
+// authenticated user's import jobs.
+func (a *applicationDependencies) displayImportJobHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	job, err := a.importJobModel.Get(id, a.contextGetUserID(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{"import_job": job}
+	err = a.writeResponse(w, r, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) listImportJobsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filters := data.Filters{
+		Page:         a.getSingleIntegerParameter(query, "page", 1, validator.New()),
+		PageSize:     a.getSingleIntegerParameter(query, "page_size", 10, validator.New()),
+		Sort:         a.getSingleQueryParameter(query, "sort", "-id"),
+		SortSafeList: []string{"id", "created_at", "-id", "-created_at"},
+		FilterSafeList: map[string]data.FilterType{
+			"source":     data.FilterText,
+			"status":     data.FilterText,
+			"created_at": data.FilterTimestamp,
+		},
+	}
+
+	v := validator.New()
+	filters.Conditions = a.getFilterConditions(query, v)
+	data.ValidateFilters(v, filters)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	jobs, metadata, err := a.importJobModel.GetAllForUser(a.contextGetUserID(r), filters)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"import_jobs": jobs,
+		"metadata":    metadata,
+	}
+	err = a.writeResponse(w, r, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
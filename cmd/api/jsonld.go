@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/tchenbz/AWTtest_3/internal/data"
+	"github.com/tchenbz/AWTtest_3/internal/jsonld"
+)
+
+// wantsJSONLD reports whether the request's Accept header prefers the
+// schema.org JSON-LD representation to plain JSON.
+func (a *applicationDependencies) wantsJSONLD(r *http.Request) bool {
+	for _, mediaType := range a.acceptedMediaTypes(r) {
+		switch mediaType {
+		case jsonld.MediaType:
+			return true
+		case "application/json", "application/*", "*/*":
+			return false
+		}
+	}
+	return false
+}
+
+func (a *applicationDependencies) writeJSONLD(w http.ResponseWriter, status int, v any) error {
+	js, err := json.MarshalIndent(v, "", "\t")
+	if err != nil {
+		return err
+	}
+	js = append(js, '\n')
+
+	w.Header().Set("Content-Type", jsonld.MediaType)
+	w.WriteHeader(status)
+	_, err = w.Write(js)
+	return err
+}
+
+// writeBookJSONLD writes a book as a schema:Book, with the rating of its
+// reviews and its cover.
+func (a *applicationDependencies) writeBookJSONLD(w http.ResponseWriter, r *http.Request, book *data.Book) {
+	count, average, err := a.reviewModel.RatingSummary(book.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	covers, err := a.coverModel.ContentTypes([]int64{book.ID})
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	path := fmt.Sprintf("/v1/books/%d", book.ID)
+	image := ""
+	if _, ok := covers[book.ID]; ok {
+		image = a.absoluteURL(r, path+"/cover")
+	}
+
+	err = a.writeJSONLD(w, http.StatusOK, jsonld.NewBook(book, a.absoluteURL(r, path), image, count, average))
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// writeReviewJSONLD writes a review as a schema:Review of its book.
+func (a *applicationDependencies) writeReviewJSONLD(w http.ResponseWriter, r *http.Request, review *data.Review) {
+	book, err := a.bookModel.Get(review.BookID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	url := a.absoluteURL(r, fmt.Sprintf("/v1/books/%d/reviews/%d", review.BookID, review.ID))
+	bookURL := a.absoluteURL(r, fmt.Sprintf("/v1/books/%d", book.ID))
+
+	err = a.writeJSONLD(w, http.StatusOK, jsonld.NewReview(review, url, book, bookURL))
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
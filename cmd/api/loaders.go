@@ -0,0 +1,173 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/tchenbz/AWTtest_3/internal/data"
+)
+
+// loader batches the keys a GraphQL query asks for into one fetch. Load
+// registers a key and returns a thunk; the executor calls the thunks of a
+// level of the query only after every field on that level has been
+// resolved, so the first thunk called fetches all the keys registered by
+// its siblings together. Results are cached for the rest of the request.
+type loader[K comparable, V any] struct {
+	fetch func(keys []K) (map[K]V, error)
+
+	mu      sync.Mutex
+	pending []K
+	fetched map[K]bool
+	results map[K]V
+	errs    map[K]error
+}
+
+func newLoader[K comparable, V any](fetch func(keys []K) (map[K]V, error)) *loader[K, V] {
+	return &loader[K, V]{
+		fetch:   fetch,
+		fetched: map[K]bool{},
+		results: map[K]V{},
+		errs:    map[K]error{},
+	}
+}
+
+// Load returns a thunk resolving to the value for key. Keys the fetch
+// doesn't return a value for resolve to the zero value.
+func (l *loader[K, V]) Load(key K) func() (any, error) {
+	l.enqueue(key)
+	return func() (any, error) {
+		value, _, err := l.get(key)
+		return value, err
+	}
+}
+
+// LoadMany returns a thunk resolving to the values for keys, in order.
+// Keys without a value are left out.
+func (l *loader[K, V]) LoadMany(keys []K) func() (any, error) {
+	l.enqueue(keys...)
+	return func() (any, error) {
+		values := make([]V, 0, len(keys))
+		for _, key := range keys {
+			value, ok, err := l.get(key)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				values = append(values, value)
+			}
+		}
+		return values, nil
+	}
+}
+
+func (l *loader[K, V]) enqueue(keys ...K) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, key := range keys {
+		if !l.fetched[key] {
+			l.fetched[key] = true
+			l.pending = append(l.pending, key)
+		}
+	}
+}
+
+// get returns the value for key, fetching the pending keys first, and
+// whether the fetch returned one.
+func (l *loader[K, V]) get(key K) (V, bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.pending) > 0 {
+		l.dispatch()
+	}
+	value, ok := l.results[key]
+	return value, ok, l.errs[key]
+}
+
+// dispatch fetches every pending key. The caller holds l.mu.
+func (l *loader[K, V]) dispatch() {
+	keys := l.pending
+	l.pending = nil
+
+	values, err := l.fetch(keys)
+	for _, key := range keys {
+		if err != nil {
+			l.errs[key] = err
+		} else if value, ok := values[key]; ok {
+			l.results[key] = value
+		}
+	}
+}
+
+// bookReviewsKey asks for the top reviews of a book.
+type bookReviewsKey struct {
+	bookID int64
+	first  int
+	order  string
+}
+
+// graphqlLoaders are the loaders of one GraphQL request.
+type graphqlLoaders struct {
+	books            *loader[int64, *data.Book]
+	bookReviews      *loader[bookReviewsKey, []*data.Review]
+	bookReadingLists *loader[int64, int]
+	users            *loader[int64, *data.User]
+	userReadingLists *loader[int64, []*data.ReadingList]
+	userReviews      *loader[int64, []*data.Review]
+}
+
+// newGraphQLLoaders returns loaders backed by the application's models.
+func (a *applicationDependencies) newGraphQLLoaders() *graphqlLoaders {
+	return &graphqlLoaders{
+		books: newLoader(func(ids []int64) (map[int64]*data.Book, error) {
+			books, err := a.bookModel.GetMany(ids)
+			if err != nil {
+				return nil, err
+			}
+			byID := make(map[int64]*data.Book, len(books))
+			for _, book := range books {
+				byID[book.ID] = book
+			}
+			return byID, nil
+		}),
+		bookReviews: newLoader(func(keys []bookReviewsKey) (map[bookReviewsKey][]*data.Review, error) {
+			// Fields asking for a different number or order of reviews
+			// are fetched separately.
+			type group struct {
+				first int
+				order string
+			}
+			groups := map[group][]int64{}
+			for _, key := range keys {
+				g := group{key.first, key.order}
+				groups[g] = append(groups[g], key.bookID)
+			}
+
+			results := make(map[bookReviewsKey][]*data.Review, len(keys))
+			for g, ids := range groups {
+				reviews, err := a.reviewModel.GetTopForBooks(ids, g.first, g.order)
+				if err != nil {
+					return nil, err
+				}
+				for id, r := range reviews {
+					results[bookReviewsKey{id, g.first, g.order}] = r
+				}
+			}
+			return results, nil
+		}),
+		bookReadingLists: newLoader(a.bookModel.ReadingListCounts),
+		users: newLoader(func(ids []int64) (map[int64]*data.User, error) {
+			users, err := a.userModel.GetMany(ids)
+			if err != nil {
+				return nil, err
+			}
+			byID := make(map[int64]*data.User, len(users))
+			for _, user := range users {
+				byID[user.ID] = user
+			}
+			return byID, nil
+		}),
+		userReadingLists: newLoader(a.readingListModel.GetAllForUsers),
+		userReviews:      newLoader(a.reviewModel.GetAllForUsers),
+	}
+}
@@ -6,12 +6,16 @@ import (
 	"flag"
 	"fmt"
 	"log/slog"
+	"net/http"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	_ "github.com/lib/pq"
 	"github.com/tchenbz/AWTtest_3/internal/data"
+	"github.com/tchenbz/AWTtest_3/internal/migrate"
+	"github.com/tchenbz/AWTtest_3/migrations"
 )
 
 const appVersion = "1.0.0"
@@ -20,23 +24,61 @@ type serverConfig struct {
 	port        int
 	environment string
 	db          struct {
-		dsn string
+		dsn     string
+		migrate bool
 	}
 	limiter struct {
         rps float64                    
         burst int                        
         enabled bool                     
     }
-
+	graphql struct {
+		maxDepth      int
+		maxComplexity int
+	}
+	grpc struct {
+		host string
+		port int
+	}
 }
 
 type applicationDependencies struct {
 	config        serverConfig
 	logger        *slog.Logger
+	db            *sql.DB
+	limiter       *rateLimiter
 	bookModel     data.BookModel
+	authorModel   data.AuthorModel
+	genreModel    data.GenreModel
+	tagModel      data.TagModel
+	workModel     data.WorkModel
+	seriesModel   data.SeriesModel
 	readingListModel data.ReadingListModel
 	reviewModel   data.ReviewModel
 	userModel     data.UserModel  
+	importJobModel data.ImportJobModel
+	coverModel    data.CoverModel
+	idempotencyModel data.IdempotencyModel
+	wg            sync.WaitGroup
+	router        http.Handler
+	routerOnce    sync.Once
+}
+
+// setModels points every model at db, which is either the database or a
+// transaction the models all take part in.
+func (a *applicationDependencies) setModels(db data.Queryer) {
+	a.bookModel = data.BookModel{DB: db}
+	a.authorModel = data.AuthorModel{DB: db}
+	a.genreModel = data.GenreModel{DB: db}
+	a.tagModel = data.TagModel{DB: db}
+	a.workModel = data.WorkModel{DB: db}
+	a.seriesModel = data.SeriesModel{DB: db}
+	a.readingListModel = data.ReadingListModel{DB: db}
+	a.reviewModel = data.ReviewModel{DB: db}
+	a.userModel = data.UserModel{DB: db}
+	a.importJobModel = data.ImportJobModel{DB: db}
+	a.coverModel = data.CoverModel{DB: db}
+	a.idempotencyModel = data.IdempotencyModel{DB: db}
 }
 
 
@@ -46,9 +88,16 @@ func main() {
 	flag.IntVar(&settings.port, "port", 4000, "Server port")
 	flag.StringVar(&settings.environment, "env", "development", "Environment (development|staging|production)")
 	flag.StringVar(&settings.db.dsn, "db-dsn", os.Getenv("TEST3_DB_DSN"), "PostgreSQL DSN")
+	flag.BoolVar(&settings.db.migrate, "migrate", false, "Apply pending database migrations before starting")
 	flag.Float64Var(&settings.limiter.rps, "limiter-rps", 2, "Rate Limiter maximum requests per second")
 	flag.IntVar(&settings.limiter.burst, "limiter-burst", 5, "Rate Limiter maximum burst")
 	flag.BoolVar(&settings.limiter.enabled, "limiter-enabled", true, "Enable rate limiter")
+	flag.IntVar(&settings.graphql.maxDepth, "graphql-max-depth", 8, "Maximum nesting depth of a GraphQL query")
+	flag.IntVar(&settings.graphql.maxComplexity, "graphql-max-complexity", 2000, "Maximum complexity of a GraphQL query")
+	// The RPCs don't authenticate their callers, so by default only local
+	// clients can reach them.
+	flag.StringVar(&settings.grpc.host, "grpc-host", "localhost", "gRPC server host; empty to listen on every interface")
+	flag.IntVar(&settings.grpc.port, "grpc-port", 4001, "gRPC server port")
 	flag.Parse()
 
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
@@ -61,15 +110,36 @@ func main() {
 	defer db.Close()
 	logger.Info("database connection pool established")
 
+	migrator, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	// "api migrate up|down|status" manages the schema and exits.
+	if flag.Arg(0) == "migrate" {
+		err = runMigrate(migrator, logger, flag.Args()[1:])
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
+	err = checkSchema(settings, migrator, logger)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
 	// Initialize the application dependencies with the necessary models
 	appInstance := &applicationDependencies{
-		config:    settings,
-		logger:    logger,
-		bookModel: data.BookModel{DB: db},        
-		readingListModel: data.ReadingListModel{DB: db}, 
-		reviewModel: data.ReviewModel{DB: db},    
-		userModel: data.UserModel{DB: db},         
+		config:  settings,
+		logger:  logger,
+		db:      db,
+		limiter: newRateLimiter(),
 	}
+	appInstance.setModels(db)
 
 	err = appInstance.serve()
 	if err != nil {
@@ -9,6 +9,10 @@ import (
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
+	"github.com/tchenbz/AWTtest_3/internal/citation"
+	"github.com/tchenbz/AWTtest_3/internal/feed"
+	"github.com/tchenbz/AWTtest_3/internal/jsonld"
+	"github.com/tchenbz/AWTtest_3/internal/render"
 	"golang.org/x/time/rate"
 )
 
@@ -25,25 +29,54 @@ func (a *applicationDependencies)recoverPanic(next http.Handler)http.Handler {
 	})
 }
 
-func (a *applicationDependencies) rateLimit(next http.Handler) http.Handler {
-    type client struct {
-        limiter  *rate.Limiter
-        lastSeen time.Time
-    }
-    var mu sync.Mutex    
-    var clients = make(map[string]*client)
+// rateLimiter keeps a token bucket per client IP. It lives outside the
+// rateLimit middleware so that every handler chain built by routes(), such
+// as the one a batch runs its requests through, counts against the same
+// limits.
+type rateLimiter struct {
+    mu      sync.Mutex
+    clients map[string]*rateLimitClient
+}
+
+type rateLimitClient struct {
+    limiter  *rate.Limiter
+    lastSeen time.Time
+}
+
+// newRateLimiter returns a rateLimiter that forgets clients it hasn't seen
+// for three minutes.
+func newRateLimiter() *rateLimiter {
+    l := &rateLimiter{clients: make(map[string]*rateLimitClient)}
     go func() {
         for {
             time.Sleep(time.Minute)
-            mu.Lock() 
-            for ip, client := range clients {
+            l.mu.Lock()
+            for ip, client := range l.clients {
                 if time.Since(client.lastSeen) > 3*time.Minute {
-                    delete(clients, ip)
+                    delete(l.clients, ip)
                 }
             }
-            mu.Unlock() 
+            l.mu.Unlock()
         }
     }()
+    return l
+}
+
+func (l *rateLimiter) allow(ip string, rps float64, burst int) bool {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+
+    client, found := l.clients[ip]
+    if !found {
+        client = &rateLimitClient{limiter: rate.NewLimiter(rate.Limit(rps), burst)}
+        l.clients[ip] = client
+    }
+    client.lastSeen = time.Now()
+
+    return client.limiter.Allow()
+}
+
+func (a *applicationDependencies) rateLimit(next http.Handler) http.Handler {
     return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
         if a.config.limiter.enabled {
             ip, _, err := net.SplitHostPort(r.RemoteAddr)
@@ -52,29 +85,64 @@ func (a *applicationDependencies) rateLimit(next http.Handler) http.Handler {
                 return
             }
 
-            mu.Lock() 
-            _, found := clients[ip]
-            if !found {
-                clients[ip] = &client{limiter: rate.NewLimiter(
-                    rate.Limit(a.config.limiter.rps),
-                    a.config.limiter.burst),
-                }
-            }
-            clients[ip].lastSeen = time.Now()
-
-            if !clients[ip].limiter.Allow() {
-                mu.Unlock() 
+            if !a.limiter.allow(ip, a.config.limiter.rps, a.config.limiter.burst) {
                 a.rateLimitExceededResponse(w, r)
                 return
             }
-
-            mu.Unlock()
         } 
         next.ServeHTTP(w, r)
     })
 
 }
 
+// negotiateContent settles the representation writeResponse uses before
+// the handler runs, and turns away requests whose Accept header rules out
+// every representation the API has, so that a request isn't carried out
+// only to be answered 406. Requests other than GET and HEAD are only ever
+// answered by writeResponse; GET handlers that have other representations
+// settle those themselves, and answer 406 if the one asked for isn't
+// available there.
+func (a *applicationDependencies) negotiateContent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if enc, ok := render.Negotiate(r.Header.Values("Accept")); ok {
+			ctx := context.WithValue(r.Context(), encoderContextKey{}, enc)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			for _, mr := range render.ParseAccept(r.Header.Values("Accept")) {
+				if _, ok := citation.ForMediaType(mr.Type); ok {
+					next.ServeHTTP(w, r)
+					return
+				}
+				for _, mediaType := range alternativeMediaTypes {
+					if mr.Matches(mediaType) {
+						next.ServeHTTP(w, r)
+						return
+					}
+				}
+			}
+		}
+
+		a.notAcceptableResponse(w, r)
+	})
+}
+
+// alternativeMediaTypes are the representations some handlers offer besides
+// the ones writeResponse produces.
+var alternativeMediaTypes = []string{
+	feed.AtomMediaType,
+	feed.RSSMediaType,
+	feed.OpenSearchMediaType,
+	jsonld.MediaType,
+	"image/jpeg",
+	"image/png",
+	"image/gif",
+	"image/webp",
+	"image/svg+xml",
+}
+
 // AuthMiddleware is a middleware function that ensures the request is authenticated.
 func (a *applicationDependencies) AuthMiddleware(next http.Handler) http.Handler {
     return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -110,3 +178,17 @@ func (a *applicationDependencies) AuthMiddleware(next http.Handler) http.Handler
         next.ServeHTTP(w, r.WithContext(ctx))
     })
 }
+
+// optionalAuth authenticates requests that carry a token like
+// AuthMiddleware does, rejecting bad tokens, and lets requests without one
+// through anonymously.
+func (a *applicationDependencies) optionalAuth(next http.Handler) http.Handler {
+	authenticated := a.AuthMiddleware(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		authenticated.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/tchenbz/AWTtest_3/internal/migrate"
+)
+
+// runMigrate runs the migrate subcommand: migrate up, migrate down
+// [-steps N | -all] or migrate status.
+func runMigrate(migrator *migrate.Migrator, logger *slog.Logger, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: migrate up|down|status")
+	}
+
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+		logMigrations(logger, "applied migration", applied)
+		logger.Info("database schema is up to date", "version", migrator.Latest())
+
+	case "down":
+		flags := flag.NewFlagSet("migrate down", flag.ExitOnError)
+		steps := flags.Int("steps", 1, "Number of migrations to revert")
+		all := flags.Bool("all", false, "Revert every migration")
+		flags.Parse(args[1:])
+
+		if *all {
+			*steps = len(migrator.Migrations)
+		}
+		if *steps < 1 {
+			return errors.New("-steps must be greater than zero")
+		}
+
+		reverted, err := migrator.Down(ctx, *steps)
+		if err != nil {
+			return err
+		}
+		logMigrations(logger, "reverted migration", reverted)
+
+	case "status":
+		status, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("version %d, dirty %t, expected version %d\n", status.Version, status.Dirty, migrator.Latest())
+		for _, m := range status.Applied {
+			fmt.Printf("  applied  %s\n", m)
+		}
+		for _, m := range status.Pending {
+			fmt.Printf("  pending  %s\n", m)
+		}
+
+	default:
+		return fmt.Errorf("unknown migrate command %q; use up, down or status", args[0])
+	}
+
+	return nil
+}
+
+func logMigrations(logger *slog.Logger, msg string, migrations []*migrate.Migration) {
+	for _, m := range migrations {
+		logger.Info(msg, "version", m.Version, "name", m.Name)
+	}
+}
+
+// checkSchema applies pending migrations when -migrate is set, then refuses
+// to go on unless the database is at the version this binary was built
+// with.
+func checkSchema(settings serverConfig, migrator *migrate.Migrator, logger *slog.Logger) error {
+	if settings.db.migrate {
+		applied, err := migrator.Up(context.Background())
+		if err != nil {
+			return err
+		}
+		logMigrations(logger, "applied migration", applied)
+	}
+
+	// Wait a little for another instance that is migrating.
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	err := migrator.Check(ctx)
+	if errors.Is(err, migrate.ErrVersionMismatch) {
+		return fmt.Errorf("%w; run with -migrate or %s migrate up", err, os.Args[0])
+	}
+	return err
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/tchenbz/AWTtest_3/internal/data"
+	"github.com/tchenbz/AWTtest_3/internal/onix"
+)
+
+// importONIXHandler upserts the products of an ONIX 3.0 message into the
+// catalog and reports the outcome of every product. Products are matched on
+// their record reference and then on ISBN. The body is parsed as it
+// arrives, so batches written before a malformed product stay committed.
+func (a *applicationDependencies) importONIXHandler(w http.ResponseWriter, r *http.Request) {
+	dryRun, err := strconv.ParseBool(a.getSingleQueryParameter(r.URL.Query(), "dry_run", "false"))
+	if err != nil {
+		a.badRequestResponse(w, r, errors.New("dry_run must be a boolean"))
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/xml" && mediaType != "text/xml" {
+		a.errorResponseJSON(w, r, http.StatusUnsupportedMediaType, "the body must be an ONIX message sent as application/xml")
+		return
+	}
+
+	result := &data.ImportResult{DryRun: dryRun, Errors: []*data.ImportRowError{}, Report: true, Logger: a.logger}
+	reader := onix.NewReader(http.MaxBytesReader(w, r.Body, maxImportBytes))
+
+	n := 0
+	next := func() (*data.ImportRow, error) {
+		product, err := reader.Next()
+		if err != nil {
+			return nil, err
+		}
+		n++
+
+		row := product.ImportRow(n)
+		if product.Deleted() {
+			result.Ignore(row, "deletion notices are not applied")
+			return nil, nil
+		}
+		return row, nil
+	}
+
+	a.runImport(w, r, next, dryRun, result)
+}
@@ -0,0 +1,525 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tchenbz/AWTtest_3/internal/data"
+	"github.com/tchenbz/AWTtest_3/internal/feed"
+	"github.com/tchenbz/AWTtest_3/internal/validator"
+)
+
+// The OPDS 1.2 catalog lets e-reader apps browse the books. It is a tree of
+// Atom feeds: navigation feeds list other feeds, and acquisition feeds list
+// books. The catalog describes books but has no files to download, so book
+// entries link to the JSON representation and the cover, not to content.
+
+// opdsPageSize is the number of entries on a page of a catalog feed.
+const opdsPageSize = 25
+
+// opdsFilters reads the page of a catalog feed from ?page=. Catalog feeds
+// have a fixed page size and order.
+func (a *applicationDependencies) opdsFilters(r *http.Request, sort string, v *validator.Validator) data.Filters {
+	filters := data.Filters{
+		Page:         a.getSingleIntegerParameter(r.URL.Query(), "page", 1, v),
+		PageSize:     opdsPageSize,
+		Sort:         sort,
+		SortSafeList: []string{sort},
+	}
+	data.ValidateFilters(v, filters)
+	return filters
+}
+
+// newCatalogFeed returns a catalog feed with the links every feed carries:
+// to itself, to the root of the catalog and to the search description.
+func (a *applicationDependencies) newCatalogFeed(r *http.Request, title, mediaType string) *feed.Feed {
+	f := feed.NewFeed(a.absoluteURL(r, r.URL.Path), title)
+	f.Updated = feed.Time(time.Now())
+	f.Authors = []feed.Person{{Name: r.Host, URI: a.absoluteURL(r, "/v1/opds")}}
+	f.Links = append(f.Links,
+		feed.Link{Rel: "self", Href: a.absoluteURL(r, r.URL.RequestURI()), Type: mediaType},
+		feed.Link{Rel: "start", Href: a.absoluteURL(r, "/v1/opds"), Type: feed.NavigationMediaType, Title: "Catalog"},
+		feed.Link{Rel: "search", Href: a.absoluteURL(r, "/v1/opds/search.xml"), Type: feed.OpenSearchMediaType, Title: "Search"},
+	)
+	return f
+}
+
+// addPageLinks adds the OpenSearch counts and the first, previous, next and
+// last page links to a paginated feed.
+func (a *applicationDependencies) addPageLinks(r *http.Request, f *feed.Feed, mediaType string, metadata data.Metadata) {
+	if metadata.TotalRecords == 0 {
+		return
+	}
+
+	f.TotalResults = metadata.TotalRecords
+	f.ItemsPerPage = metadata.PageSize
+	f.StartIndex = (metadata.CurrentPage-1)*metadata.PageSize + 1
+
+	link := func(rel string, page int) {
+		query := r.URL.Query()
+		query.Set("page", strconv.Itoa(page))
+		href := a.absoluteURL(r, r.URL.Path+"?"+query.Encode())
+		f.Links = append(f.Links, feed.Link{Rel: rel, Href: href, Type: mediaType})
+	}
+
+	link("first", metadata.FirstPage)
+	if metadata.CurrentPage > metadata.FirstPage {
+		link("previous", metadata.CurrentPage-1)
+	}
+	if metadata.CurrentPage < metadata.LastPage {
+		link("next", metadata.CurrentPage+1)
+	}
+	link("last", metadata.LastPage)
+}
+
+// navigationEntry returns an entry of a navigation feed that leads to the
+// feed at href.
+func (a *applicationDependencies) navigationEntry(r *http.Request, id, title, summary, rel, href, mediaType string, updated time.Time) *feed.Entry {
+	entry := &feed.Entry{
+		ID:      a.absoluteURL(r, id),
+		Title:   title,
+		Updated: feed.Time(updated),
+		Links:   []feed.Link{{Rel: rel, Href: a.absoluteURL(r, href), Type: mediaType}},
+	}
+	if summary != "" {
+		entry.Content = &feed.Text{Type: "text", Body: summary}
+	}
+	return entry
+}
+
+// addBookEntries adds an acquisition feed entry for each book, and sets the
+// feed's updated time to that of the newest book.
+func (a *applicationDependencies) addBookEntries(r *http.Request, f *feed.Feed, books []*data.Book) error {
+	ids := make([]int64, len(books))
+	for i, book := range books {
+		ids[i] = book.ID
+	}
+	covers, err := a.coverModel.ContentTypes(ids)
+	if err != nil {
+		return err
+	}
+
+	var newest time.Time
+	for _, book := range books {
+		path := fmt.Sprintf("/v1/books/%d", book.ID)
+		entry := &feed.Entry{
+			ID:        a.absoluteURL(r, path),
+			Title:     book.Title,
+			Updated:   feed.Time(book.CreatedAt),
+			Authors:   []feed.Person{},
+			Issued:    book.PublicationDate,
+			Language:  book.Language,
+			Publisher: book.Publisher,
+			Links: []feed.Link{
+				{Rel: "alternate", Href: a.absoluteURL(r, path), Type: "application/json", Title: "Book details"},
+			},
+		}
+		if book.ISBN != "" {
+			entry.Identifier = "urn:isbn:" + book.ISBN
+		}
+		if book.Description != "" {
+			entry.Summary = &feed.Text{Type: "text", Body: book.Description}
+		}
+
+		for _, author := range book.Authors {
+			if author.Role != "author" {
+				continue
+			}
+			person := feed.Person{Name: author.Name}
+			if author.ID > 0 {
+				person.URI = a.absoluteURL(r, fmt.Sprintf("/v1/opds/authors/%d", author.ID))
+			}
+			entry.Authors = append(entry.Authors, person)
+		}
+
+		for _, genre := range book.Genres {
+			entry.Categories = append(entry.Categories, feed.Category{Term: strconv.FormatInt(genre.ID, 10), Label: genre.Name})
+		}
+		if len(book.Genres) == 0 && book.Genre != "" {
+			entry.Categories = append(entry.Categories, feed.Category{Term: book.Genre, Label: book.Genre})
+		}
+
+		if contentType, ok := covers[book.ID]; ok {
+			cover := a.absoluteURL(r, path+"/cover")
+			entry.Links = append(entry.Links,
+				feed.Link{Rel: feed.RelImage, Href: cover, Type: contentType},
+				feed.Link{Rel: feed.RelThumbnail, Href: cover, Type: contentType},
+			)
+		}
+
+		if book.CreatedAt.After(newest) {
+			newest = book.CreatedAt
+		}
+		f.Entries = append(f.Entries, entry)
+	}
+
+	if !newest.IsZero() {
+		f.Updated = feed.Time(newest)
+	}
+	return nil
+}
+
+// writeBookFeed writes an acquisition feed of a page of books.
+func (a *applicationDependencies) writeBookFeed(w http.ResponseWriter, r *http.Request, title string, books []*data.Book, metadata data.Metadata) {
+	f := a.newCatalogFeed(r, title, feed.AcquisitionMediaType)
+	a.addPageLinks(r, f, feed.AcquisitionMediaType, metadata)
+
+	err := a.addBookEntries(r, f, books)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = a.writeXML(w, http.StatusOK, feed.AcquisitionMediaType, f, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) opdsRootHandler(w http.ResponseWriter, r *http.Request) {
+	f := a.newCatalogFeed(r, "Catalog", feed.NavigationMediaType)
+	now := time.Now()
+
+	f.Entries = append(f.Entries,
+		a.navigationEntry(r, "/v1/opds/new", "New books", "The books most recently added to the catalog.",
+			feed.RelSortNew, "/v1/opds/new", feed.AcquisitionMediaType, now),
+		a.navigationEntry(r, "/v1/opds/genres", "By genre", "Browse the books by genre.",
+			feed.RelSubsection, "/v1/opds/genres", feed.NavigationMediaType, now),
+		a.navigationEntry(r, "/v1/opds/authors", "By author", "Browse the books by author.",
+			feed.RelSubsection, "/v1/opds/authors", feed.NavigationMediaType, now),
+		a.navigationEntry(r, "/v1/opds/readinglists", "Reading lists", "Reading lists kept by readers.",
+			feed.RelSubsection, "/v1/opds/readinglists", feed.NavigationMediaType, now),
+	)
+
+	err := a.writeXML(w, http.StatusOK, feed.NavigationMediaType, f, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) opdsNewBooksHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	filters := a.opdsFilters(r, "-id", v)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	books, metadata, err := a.bookModel.GetAll("", "", "", filters)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	a.writeBookFeed(w, r, "New books", books, metadata)
+}
+
+// opdsGenresHandler lists every genre, titled with its full path such as
+// "Fiction / Fantasy". Each leads to the books in the genre and its
+// descendants.
+func (a *applicationDependencies) opdsGenresHandler(w http.ResponseWriter, r *http.Request) {
+	genres, err := a.genreModel.GetAll()
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	byID := map[int64]*data.Genre{}
+	for _, genre := range genres {
+		byID[genre.ID] = genre
+	}
+	path := func(genre *data.Genre) string {
+		names := []string{genre.Name}
+		for parent := genre.ParentID; parent != nil && len(names) <= len(genres); {
+			ancestor, ok := byID[*parent]
+			if !ok {
+				break
+			}
+			names = append([]string{ancestor.Name}, names...)
+			parent = ancestor.ParentID
+		}
+		return strings.Join(names, " / ")
+	}
+
+	f := a.newCatalogFeed(r, "By genre", feed.NavigationMediaType)
+	for _, genre := range genres {
+		f.Entries = append(f.Entries, a.navigationEntry(r,
+			fmt.Sprintf("/v1/genres/%d", genre.ID), path(genre), "",
+			feed.RelSubsection, fmt.Sprintf("/v1/opds/genres/%d", genre.ID), feed.AcquisitionMediaType, genre.CreatedAt))
+	}
+
+	err = a.writeXML(w, http.StatusOK, feed.NavigationMediaType, f, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) opdsGenreBooksHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	filters := a.opdsFilters(r, "title", v)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	genre, err := a.genreModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	books, metadata, err := a.bookModel.GetAllByGenre(genre.ID, filters)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	a.writeBookFeed(w, r, genre.Name, books, metadata)
+}
+
+func (a *applicationDependencies) opdsAuthorsHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	filters := a.opdsFilters(r, "name", v)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	authors, metadata, err := a.authorModel.GetAll("", filters)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	f := a.newCatalogFeed(r, "By author", feed.NavigationMediaType)
+	a.addPageLinks(r, f, feed.NavigationMediaType, metadata)
+	for _, author := range authors {
+		f.Entries = append(f.Entries, a.navigationEntry(r,
+			fmt.Sprintf("/v1/authors/%d", author.ID), author.Name, author.Bio,
+			feed.RelSubsection, fmt.Sprintf("/v1/opds/authors/%d", author.ID), feed.AcquisitionMediaType, author.CreatedAt))
+	}
+
+	err = a.writeXML(w, http.StatusOK, feed.NavigationMediaType, f, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) opdsAuthorBooksHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	filters := a.opdsFilters(r, "publication_date", v)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	author, err := a.authorModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	books, metadata, err := a.bookModel.GetAllByAuthor(author.ID, filters)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	a.writeBookFeed(w, r, author.Name, books, metadata)
+}
+
+func (a *applicationDependencies) opdsSearchDescriptionHandler(w http.ResponseWriter, r *http.Request) {
+	description := feed.OpenSearchDescription{
+		ShortName:     "Books",
+		Description:   "Search the catalog by title, ISBN or author.",
+		InputEncoding: "UTF-8",
+		URLs: []feed.OpenSearchURL{{
+			Type:     feed.AcquisitionMediaType,
+			Template: a.absoluteURL(r, "/v1/opds/search?q={searchTerms}&page={startPage?}"),
+		}},
+	}
+
+	err := a.writeXML(w, http.StatusOK, feed.OpenSearchMediaType, description, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) opdsSearchHandler(w http.ResponseWriter, r *http.Request) {
+	term := strings.TrimSpace(r.URL.Query().Get("q"))
+
+	v := validator.New()
+	v.Check(term != "", "q", "must be provided")
+	filters := a.opdsFilters(r, "title", v)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	books, metadata, err := a.bookModel.SearchAll(term, filters)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	a.writeBookFeed(w, r, fmt.Sprintf("Search results for %q", term), books, metadata)
+}
+
+// readingListEntries adds a navigation entry for each reading list, leading
+// to the books on the list.
+func (a *applicationDependencies) readingListEntries(r *http.Request, f *feed.Feed, readingLists []*data.ReadingList) {
+	for _, readingList := range readingLists {
+		entry := a.navigationEntry(r,
+			fmt.Sprintf("/v1/readinglists/%d", readingList.ID), readingList.Name, readingList.Description,
+			feed.RelSubsection, fmt.Sprintf("/v1/opds/readinglists/%d", readingList.ID), feed.AcquisitionMediaType, readingList.CreatedAt)
+		entry.Links = append(entry.Links, feed.Link{
+			Rel:   "related",
+			Href:  a.absoluteURL(r, fmt.Sprintf("/v1/opds/users/%d/readinglists", readingList.CreatedBy)),
+			Type:  feed.NavigationMediaType,
+			Title: "More lists by this reader",
+		})
+		f.Entries = append(f.Entries, entry)
+	}
+}
+
+func (a *applicationDependencies) opdsReadingListsHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	filters := a.opdsFilters(r, "-id", v)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	readingLists, metadata, err := a.readingListModel.GetAll("", "", filters)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	f := a.newCatalogFeed(r, "Reading lists", feed.NavigationMediaType)
+	a.addPageLinks(r, f, feed.NavigationMediaType, metadata)
+	a.readingListEntries(r, f, readingLists)
+
+	err = a.writeXML(w, http.StatusOK, feed.NavigationMediaType, f, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) opdsUserReadingListsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	filters := a.opdsFilters(r, "name", v)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := a.userModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	readingLists, metadata, err := a.readingListModel.GetAllByUser(user.ID, filters)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	f := a.newCatalogFeed(r, "Reading lists of "+user.Username, feed.NavigationMediaType)
+	a.addPageLinks(r, f, feed.NavigationMediaType, metadata)
+	a.readingListEntries(r, f, readingLists)
+
+	err = a.writeXML(w, http.StatusOK, feed.NavigationMediaType, f, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) opdsReadingListBooksHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	filters := a.opdsFilters(r, "id", v)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	readingList, err := a.readingListModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// The list holds the ids of all its books, so the page is cut from them
+	// rather than by the query.
+	var metadata data.Metadata
+	page := []int64{}
+	if total := len(readingList.Books); total > 0 {
+		start := min((filters.Page-1)*filters.PageSize, total)
+		end := min(start+filters.PageSize, total)
+		page = readingList.Books[start:end]
+		metadata = data.Metadata{
+			CurrentPage:  filters.Page,
+			PageSize:     filters.PageSize,
+			FirstPage:    1,
+			LastPage:     (total + filters.PageSize - 1) / filters.PageSize,
+			TotalRecords: total,
+		}
+	}
+
+	books, err := a.bookModel.GetMany(page)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	a.writeBookFeed(w, r, readingList.Name, books, metadata)
+}
@@ -0,0 +1,1076 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/tchenbz/AWTtest_3/internal/citation"
+	"github.com/tchenbz/AWTtest_3/internal/data"
+	"github.com/tchenbz/AWTtest_3/internal/epub"
+	"github.com/tchenbz/AWTtest_3/internal/feed"
+	"github.com/tchenbz/AWTtest_3/internal/jsonld"
+	"github.com/tchenbz/AWTtest_3/internal/openapi"
+	"github.com/tchenbz/AWTtest_3/internal/patch"
+	"github.com/tchenbz/AWTtest_3/internal/render"
+)
+
+// openAPIDocument is the API's OpenAPI document, encoded the first time it
+// is asked for.
+var openAPIDocument = sync.OnceValues(func() ([]byte, error) {
+	return json.MarshalIndent(apiDocument(), "", "\t")
+})
+
+func (a *applicationDependencies) openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	doc, err := openAPIDocument()
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Write(doc)
+}
+
+// apiSpec builds the OpenAPI document. Request and response bodies are
+// described by the Go values the handlers decode and write, so their
+// schemas change with the code; each route in routes() must be declared
+// here, which TestOpenAPICoversRoutes checks.
+type apiSpec struct {
+	doc *openapi.Document
+
+	errorSchema      *openapi.Schema
+	validationSchema *openapi.Schema
+}
+
+func apiDocument() *openapi.Document {
+	s := &apiSpec{
+		doc: openapi.New(openapi.Info{
+			Title:       "Books API",
+			Description: "Books, their authors, works, series and genres, and the reviews and reading lists of the people who read them.",
+			Version:     appVersion,
+		}),
+	}
+	s.doc.Components.SecuritySchemes["token"] = &openapi.SecurityScheme{
+		Type:        "apiKey",
+		In:          "header",
+		Name:        "Authorization",
+		Description: "The token returned by POST /v1/login, sent as the whole value of the header.",
+	}
+	s.errorSchema = s.doc.Define("Error", envelope{"error": ""})
+	s.validationSchema = s.doc.Define("ValidationError", envelope{"error": map[string]string{}})
+
+	s.books()
+	s.opds()
+	s.imports()
+	s.works()
+	s.series()
+	s.authors()
+	s.genres()
+	s.reviews()
+	s.readingLists()
+	s.users()
+
+	s.add(http.MethodPost, "/v1/batch", "batch", &openapi.Operation{
+		Summary:     "Run several requests at once",
+		Description: "Runs the requests in order through the API's own routes. With transaction=true they share one database transaction, which is committed only if all of them succeed; the requests after a failed one are answered with 424 Failed Dependency.",
+		Tags:        []string{"batch"},
+		Parameters: []*openapi.Parameter{
+			boolParameter("transaction", "Run the requests in a single transaction."),
+		},
+		RequestBody: s.jsonBody([]*batchRequest{}),
+		Responses: map[string]*openapi.Response{
+			"200": s.reply("The responses to the requests, in the same order. committed is only present for a transaction.", s.batchResult()),
+			"400": s.badRequest(),
+			"422": s.failedValidation(),
+		},
+	})
+	s.add(http.MethodPost, "/v1/graphql", "graphql", &openapi.Operation{
+		Summary:     "Run a GraphQL query",
+		Description: "Runs a query against a schema mirroring the books, reviews, reading lists and users. A token is optional; it identifies the viewer and shows the viewer's own email. Queries nested deeper or more complex than the server's limits are rejected with 400 before they run.",
+		Tags:        []string{"graphql"},
+		Security:    []openapi.SecurityRequirement{{}, {"token": {}}},
+		RequestBody: s.jsonBody(graphqlInput{}),
+		Responses: map[string]*openapi.Response{
+			"200": s.reply("The result of the query. errors lists the fields that couldn't be resolved.", &openapi.Schema{
+				Type: "object",
+				Properties: map[string]*openapi.Schema{
+					"data":   {Type: []string{"object", "null"}},
+					"errors": s.graphqlErrors(),
+				},
+			}),
+			"400": s.reply("The query doesn't parse, fails validation or exceeds the depth or complexity limit.", &openapi.Schema{
+				Type:       "object",
+				Properties: map[string]*openapi.Schema{"errors": s.graphqlErrors()},
+				Required:   []string{"errors"},
+			}),
+			"422": s.failedValidation(),
+		},
+	})
+	s.add(http.MethodGet, "/v1/openapi.json", "openAPI", &openapi.Operation{
+		Summary: "This document",
+		Tags:    []string{"meta"},
+		Responses: map[string]*openapi.Response{
+			"200": {
+				Description: "The OpenAPI document of the API.",
+				Content:     map[string]*openapi.MediaType{"application/json": {Schema: &openapi.Schema{Type: "object"}}},
+			},
+		},
+	})
+
+	// ImportJob adds its progress when it is encoded.
+	s.doc.Component("ImportJob").Properties["progress"] = &openapi.Schema{
+		Type:        "number",
+		Description: "The percentage of rows processed.",
+	}
+
+	return s.doc
+}
+
+// add declares the operation for method on path, adding the responses every
+// route can give: 404 for a path with parameters, 406 when no acceptable
+// representation exists, 429 when the client is rate limited and 500.
+func (s *apiSpec) add(method, path, id string, op *openapi.Operation) {
+	op.OperationID = id
+	defaults := map[string]*openapi.Response{
+		"406": s.failure("None of the acceptable media types can be produced."),
+		"429": s.failure("The client has made too many requests."),
+		"500": s.failure("The server could not process the request."),
+	}
+	if strings.Contains(path, "/:") {
+		defaults["404"] = s.failure("The resource could not be found.")
+	}
+	for status, resp := range defaults {
+		if _, ok := op.Responses[status]; !ok {
+			op.Responses[status] = resp
+		}
+	}
+	s.doc.Add(method, path, op)
+}
+
+// secured marks op as requiring a token. The API answers a missing or
+// invalid token with 422.
+func (s *apiSpec) secured(op *openapi.Operation) *openapi.Operation {
+	op.Security = []openapi.SecurityRequirement{{"token": {}}}
+	if _, ok := op.Responses["422"]; !ok {
+		op.Responses["422"] = s.failedValidation()
+	}
+	return op
+}
+
+// represented returns the content of a response written by writeResponse:
+// the envelope as JSON or MessagePack, or flattened into CSV.
+func represented(schema *openapi.Schema) map[string]*openapi.MediaType {
+	content := map[string]*openapi.MediaType{}
+	for _, mediaType := range render.MediaTypes {
+		if mediaType == "text/csv" {
+			content[mediaType] = &openapi.MediaType{Schema: &openapi.Schema{Type: "string"}}
+			continue
+		}
+		content[mediaType] = &openapi.MediaType{Schema: schema}
+	}
+	return content
+}
+
+func (s *apiSpec) reply(description string, schema *openapi.Schema) *openapi.Response {
+	return &openapi.Response{Description: description, Content: represented(schema)}
+}
+
+// envelope describes a response whose body is body.
+func (s *apiSpec) envelope(description string, body envelope) *openapi.Response {
+	return s.reply(description, s.doc.Schema(body))
+}
+
+// created describes a 201 response whose Location header points at the new
+// resource.
+func (s *apiSpec) created(description string, body envelope) *openapi.Response {
+	resp := s.envelope(description, body)
+	resp.Headers = map[string]*openapi.Header{
+		"Location": {Description: "The URL of the new resource.", Schema: &openapi.Schema{Type: "string"}},
+	}
+	return resp
+}
+
+func (s *apiSpec) message(description string) *openapi.Response {
+	return s.envelope(description, envelope{"message": ""})
+}
+
+func (s *apiSpec) failure(description string) *openapi.Response {
+	return s.reply(description, s.errorSchema)
+}
+
+func (s *apiSpec) badRequest() *openapi.Response {
+	return s.failure("The request is malformed.")
+}
+
+func (s *apiSpec) failedValidation() *openapi.Response {
+	return s.reply("The request failed validation; error maps each invalid field to what is wrong with it.", s.validationSchema)
+}
+
+func (s *apiSpec) jsonBody(v any) *openapi.RequestBody {
+	return &openapi.RequestBody{
+		Required: true,
+		Content:  map[string]*openapi.MediaType{"application/json": {Schema: s.doc.Schema(v)}},
+	}
+}
+
+// patchBody describes the body of an update, which is either the fields to
+// change as JSON or a patch document applied to doc.
+func (s *apiSpec) patchBody(input, doc any) *openapi.RequestBody {
+	body := s.jsonBody(input)
+	body.Description = "The fields to change, or a JSON Merge Patch or JSON Patch applied to the record's editable fields."
+	body.Content[patch.MergePatchMediaType] = &openapi.MediaType{Schema: s.doc.Schema(doc)}
+	body.Content[patch.JSONPatchMediaType] = &openapi.MediaType{Schema: s.doc.Schema([]*patch.Operation{})}
+	return body
+}
+
+// patchResponses are the responses of an update that accepts patch
+// documents, besides 200.
+func (s *apiSpec) patchResponses(ok *openapi.Response) map[string]*openapi.Response {
+	return map[string]*openapi.Response{
+		"200": ok,
+		"400": s.badRequest(),
+		"409": s.failure("A test operation of the JSON Patch failed."),
+		"422": s.failedValidation(),
+	}
+}
+
+// createResponses are the responses of a create whose body is read as
+// JSON, besides 201.
+func (s *apiSpec) createResponses(created *openapi.Response) map[string]*openapi.Response {
+	return map[string]*openapi.Response{
+		"201": created,
+		"400": s.badRequest(),
+		"422": s.failedValidation(),
+	}
+}
+
+// idempotent adds the Idempotency-Key header of a create wrapped in
+// a.idempotent to op.
+func (s *apiSpec) idempotent(op *openapi.Operation) *openapi.Operation {
+	op.Parameters = append(op.Parameters, &openapi.Parameter{
+		Name:        "Idempotency-Key",
+		In:          "header",
+		Description: "A key of the client's choosing that makes retrying the request safe: for 24 hours, a request with the same key and body gets the first response again, with an Idempotent-Replayed header.",
+		Schema:      &openapi.Schema{Type: "string"},
+	})
+	op.Responses["409"] = s.failure("A request with the same idempotency key is still being processed.")
+	op.Responses["422"] = s.failedValidation()
+	return op
+}
+
+func (s *apiSpec) batchResult() *openapi.Schema {
+	schema := s.doc.Schema(envelope{"responses": []*batchResponse{}, "committed": false})
+	schema.Required = []string{"responses"}
+	return schema
+}
+
+// graphqlErrors describes the errors array of a GraphQL response.
+func (s *apiSpec) graphqlErrors() *openapi.Schema {
+	return &openapi.Schema{
+		Type: "array",
+		Items: &openapi.Schema{
+			Type: "object",
+			Properties: map[string]*openapi.Schema{
+				"message":    {Type: "string"},
+				"locations":  {Type: "array", Items: &openapi.Schema{Type: "object"}},
+				"path":       {Type: "array", Items: &openapi.Schema{}},
+				"extensions": {Type: "object"},
+			},
+			Required: []string{"message"},
+		},
+	}
+}
+
+func queryParameter(name, description string, schema *openapi.Schema) *openapi.Parameter {
+	return &openapi.Parameter{Name: name, In: "query", Description: description, Schema: schema}
+}
+
+func stringParameter(name, description string) *openapi.Parameter {
+	return queryParameter(name, description, &openapi.Schema{Type: "string"})
+}
+
+func boolParameter(name, description string) *openapi.Parameter {
+	return queryParameter(name, description, &openapi.Schema{Type: "boolean", Enum: []any{true, false}})
+}
+
+func integerParameter(name, description string) *openapi.Parameter {
+	return queryParameter(name, description, &openapi.Schema{Type: "integer"})
+}
+
+// listParameter describes a comma-separated list of values, such as
+// ?fields=.
+func listParameter(name, description string, values []string) *openapi.Parameter {
+	p := queryParameter(name, description, &openapi.Schema{Type: "array", Items: openapi.Enum(values...)})
+	p.Style = "form"
+	p.Explode = new(bool)
+	return p
+}
+
+// pageParameters describes the pagination and sorting of a list.
+func pageParameters(pageSize int) []*openapi.Parameter {
+	return []*openapi.Parameter{
+		queryParameter("page", "The page to return.", &openapi.Schema{Type: "integer", Minimum: float(1), Maximum: float(500)}),
+		queryParameter("page_size", "The number of records on a page, "+strconv.Itoa(pageSize)+" by default.", &openapi.Schema{Type: "integer", Minimum: float(1), Maximum: float(100)}),
+		stringParameter("sort", "The field to sort by; prefix it with - to sort in descending order."),
+	}
+}
+
+// filterParameters describes pagination, sorting and filter expressions
+// such as filter[average_rating][gte]=4.
+func filterParameters() []*openapi.Parameter {
+	filter := queryParameter("filter", "Filter expressions of the form filter[field][operator]=value.", &openapi.Schema{
+		Type:                 "object",
+		AdditionalProperties: &openapi.Schema{Type: "object", AdditionalProperties: &openapi.Schema{Type: "string"}},
+	})
+	filter.Style = "deepObject"
+	return append(pageParameters(10), filter)
+}
+
+// projectionParameters describes ?fields= and ?include=.
+func projectionParameters(fields, include []string) []*openapi.Parameter {
+	return []*openapi.Parameter{
+		listParameter("fields", "The fields to return; all of them when not given.", fields),
+		listParameter("include", "Related records to embed.", include),
+	}
+}
+
+// citationParameter describes ?format=, which asks for a citation instead
+// of JSON.
+func citationParameter() *openapi.Parameter {
+	return queryParameter("format", "A citation format to return the record in instead of JSON.", openapi.Enum(append([]string{"json"}, citation.Formats()...)...))
+}
+
+// withCitations adds the citation formats to the content of resp.
+func withCitations(resp *openapi.Response) *openapi.Response {
+	for _, format := range citation.Formats() {
+		enc, _ := citation.Lookup(format)
+		resp.Content[enc.MediaType()] = &openapi.MediaType{Schema: &openapi.Schema{Type: "string"}}
+	}
+	return resp
+}
+
+// withJSONLD adds the schema.org JSON-LD representation to the content of
+// resp.
+func withJSONLD(resp *openapi.Response) *openapi.Response {
+	resp.Content[jsonld.MediaType] = &openapi.MediaType{Schema: &openapi.Schema{Type: "object"}}
+	return resp
+}
+
+func float(f float64) *float64 {
+	return &f
+}
+
+func (s *apiSpec) books() {
+	tags := []string{"books"}
+	book := &data.Book{}
+
+	s.add(http.MethodPost, "/v1/books", "createBook", s.idempotent(&openapi.Operation{
+		Summary:     "Create a book",
+		Tags:        tags,
+		RequestBody: s.jsonBody(createBookInput{}),
+		Responses:   s.createResponses(s.created("The new book.", envelope{"book": book})),
+	}))
+	s.add(http.MethodGet, "/v1/books/:id", "displayBook", &openapi.Operation{
+		Summary:    "Show a book",
+		Tags:       tags,
+		Parameters: append(projectionParameters(data.BookFieldSafeList, data.BookIncludeSafeList), citationParameter()),
+		Responses: map[string]*openapi.Response{
+			"200": withJSONLD(withCitations(s.envelope("The book, limited to the requested fields.", envelope{"book": book}))),
+			"400": s.badRequest(),
+			"422": s.failedValidation(),
+		},
+	})
+	s.add(http.MethodPatch, "/v1/books/:id", "updateBook", &openapi.Operation{
+		Summary:     "Update a book",
+		Tags:        tags,
+		RequestBody: s.patchBody(updateBookInput{}, bookDocument{}),
+		Responses:   s.patchResponses(s.envelope("The updated book.", envelope{"book": book})),
+	})
+	s.add(http.MethodDelete, "/v1/books/:id", "deleteBook", &openapi.Operation{
+		Summary:   "Delete a book",
+		Tags:      tags,
+		Responses: map[string]*openapi.Response{"200": s.message("The book was deleted.")},
+	})
+	s.add(http.MethodGet, "/v1/books", "listBooks", &openapi.Operation{
+		Summary: "List books",
+		Tags:    tags,
+		Parameters: append(append([]*openapi.Parameter{
+			stringParameter("title", "Match books whose title contains this text."),
+			stringParameter("author", "Match books by an author whose name contains this text."),
+			stringParameter("genre", "Match books in this genre."),
+		}, filterParameters()...), projectionParameters(data.BookFieldSafeList, data.BookIncludeSafeList)...),
+		Responses: map[string]*openapi.Response{
+			"200": s.envelope("A page of books.", envelope{"books": []*data.Book{}, "metadata": data.Metadata{}}),
+			"422": s.failedValidation(),
+		},
+	})
+	s.add(http.MethodGet, "/v1/search/books", "searchBooks", &openapi.Operation{
+		Summary: "Search books",
+		Tags:    tags,
+		Parameters: append([]*openapi.Parameter{
+			stringParameter("title", "Text to search titles for."),
+			stringParameter("author", "Text to search author names for."),
+			stringParameter("genre", "Text to search genres for."),
+		}, pageParameters(10)...),
+		Responses: map[string]*openapi.Response{
+			"200": s.envelope("A page of matching books.", envelope{"books": []*data.Book{}, "metadata": data.Metadata{}}),
+			"422": s.failedValidation(),
+		},
+	})
+	s.add(http.MethodGet, "/v1/books/:id/cover", "displayBookCover", &openapi.Operation{
+		Summary: "Show a book's cover image",
+		Tags:    tags,
+		Responses: map[string]*openapi.Response{
+			"200": {
+				Description: "The cover image, a JPEG, PNG, GIF or WebP as uploaded.",
+				Content:     map[string]*openapi.MediaType{"image/*": {Schema: &openapi.Schema{Type: "string", Format: "binary"}}},
+			},
+		},
+	})
+
+	s.add(http.MethodPost, "/v1/books/:id/tags", "addBookTag", s.secured(&openapi.Operation{
+		Summary:     "Tag a book",
+		Tags:        []string{"tags"},
+		RequestBody: s.jsonBody(bookTagInput{}),
+		Responses:   s.createResponses(s.envelope("The book with its tags.", envelope{"book": book})),
+	}))
+	s.add(http.MethodDelete, "/v1/books/:id/tags/:tag", "removeBookTag", s.secured(&openapi.Operation{
+		Summary:   "Remove a tag you added to a book",
+		Tags:      []string{"tags"},
+		Responses: map[string]*openapi.Response{"200": s.message("The tag was removed.")},
+	}))
+	s.add(http.MethodGet, "/v1/tags", "listTags", &openapi.Operation{
+		Summary:    "List tags by the number of books they are on",
+		Tags:       []string{"tags"},
+		Parameters: pageParameters(20),
+		Responses: map[string]*openapi.Response{
+			"200": s.envelope("A page of tags.", envelope{"tags": []*data.TagCount{}, "metadata": data.Metadata{}}),
+			"422": s.failedValidation(),
+		},
+	})
+}
+
+func (s *apiSpec) opds() {
+	tags := []string{"opds"}
+	catalog := func(mediaType, description string) map[string]*openapi.Response {
+		return map[string]*openapi.Response{
+			"200": {
+				Description: description,
+				Content:     map[string]*openapi.MediaType{mediaType: {Schema: &openapi.Schema{Type: "string"}}},
+			},
+			"422": s.failedValidation(),
+		}
+	}
+	page := []*openapi.Parameter{integerParameter("page", "The page of the feed to return.")}
+
+	s.add(http.MethodGet, "/v1/opds", "opdsRoot", &openapi.Operation{
+		Summary:   "The root of the OPDS catalog",
+		Tags:      tags,
+		Responses: catalog(feed.NavigationMediaType, "A navigation feed."),
+	})
+	s.add(http.MethodGet, "/v1/opds/new", "opdsNewBooks", &openapi.Operation{
+		Summary:    "The newest books",
+		Tags:       tags,
+		Parameters: page,
+		Responses:  catalog(feed.AcquisitionMediaType, "An acquisition feed."),
+	})
+	s.add(http.MethodGet, "/v1/opds/genres", "opdsGenres", &openapi.Operation{
+		Summary:   "The genres of the catalog",
+		Tags:      tags,
+		Responses: catalog(feed.NavigationMediaType, "A navigation feed."),
+	})
+	s.add(http.MethodGet, "/v1/opds/genres/:id", "opdsGenreBooks", &openapi.Operation{
+		Summary:    "The books in a genre",
+		Tags:       tags,
+		Parameters: page,
+		Responses:  catalog(feed.AcquisitionMediaType, "An acquisition feed."),
+	})
+	s.add(http.MethodGet, "/v1/opds/authors", "opdsAuthors", &openapi.Operation{
+		Summary:    "The authors of the catalog",
+		Tags:       tags,
+		Parameters: page,
+		Responses:  catalog(feed.NavigationMediaType, "A navigation feed."),
+	})
+	s.add(http.MethodGet, "/v1/opds/authors/:id", "opdsAuthorBooks", &openapi.Operation{
+		Summary:    "The books by an author",
+		Tags:       tags,
+		Parameters: page,
+		Responses:  catalog(feed.AcquisitionMediaType, "An acquisition feed."),
+	})
+	s.add(http.MethodGet, "/v1/opds/search.xml", "opdsSearchDescription", &openapi.Operation{
+		Summary:   "The OpenSearch description of the catalog search",
+		Tags:      tags,
+		Responses: catalog(feed.OpenSearchMediaType, "An OpenSearch description document."),
+	})
+	s.add(http.MethodGet, "/v1/opds/search", "opdsSearch", &openapi.Operation{
+		Summary:    "Search the catalog",
+		Tags:       tags,
+		Parameters: append([]*openapi.Parameter{stringParameter("q", "The search terms.")}, page...),
+		Responses:  catalog(feed.AcquisitionMediaType, "An acquisition feed of the matching books."),
+	})
+	s.add(http.MethodGet, "/v1/opds/readinglists", "opdsReadingLists", &openapi.Operation{
+		Summary:    "The reading lists of the catalog",
+		Tags:       tags,
+		Parameters: page,
+		Responses:  catalog(feed.NavigationMediaType, "A navigation feed."),
+	})
+	s.add(http.MethodGet, "/v1/opds/readinglists/:id", "opdsReadingListBooks", &openapi.Operation{
+		Summary:    "The books on a reading list",
+		Tags:       tags,
+		Parameters: page,
+		Responses:  catalog(feed.AcquisitionMediaType, "An acquisition feed."),
+	})
+	s.add(http.MethodGet, "/v1/opds/users/:id/readinglists", "opdsUserReadingLists", &openapi.Operation{
+		Summary:    "The reading lists of a user",
+		Tags:       tags,
+		Parameters: page,
+		Responses:  catalog(feed.NavigationMediaType, "A navigation feed."),
+	})
+}
+
+func (s *apiSpec) imports() {
+	tags := []string{"imports"}
+	dryRun := boolParameter("dry_run", "Roll the import back and report what it would have done.")
+	result := s.envelope("What the import did.", envelope{"import": &data.ImportResult{}})
+	importResponses := map[string]*openapi.Response{
+		"200": result,
+		"400": s.badRequest(),
+		"413": s.failure("The body is too large."),
+		"415": s.failure("The body is not in a supported format."),
+	}
+	text := &openapi.Schema{Type: "string"}
+	file := &openapi.Schema{Type: "string", Format: "binary"}
+
+	importBooks := func() *openapi.Operation {
+		return &openapi.Operation{
+			Summary:     "Import books from CSV or NDJSON",
+			Description: "Creates books, or updates those with the same ISBN. The CSV columns are " + strings.Join(bookImportColumns, ", ") + "; authors are separated by semicolons. Each NDJSON line is one record.",
+			Tags:        tags,
+			Parameters:  []*openapi.Parameter{dryRun},
+			RequestBody: &openapi.RequestBody{
+				Required: true,
+				Content: map[string]*openapi.MediaType{
+					"text/csv":             {Schema: text},
+					"application/x-ndjson": {Schema: s.doc.Schema(bookImportRecord{})},
+				},
+			},
+			Responses: importResponses,
+		}
+	}
+	s.add(http.MethodPost, "/v1/books/import", "importBooks", importBooks())
+	alias := importBooks()
+	alias.Description = "The same import as POST /v1/books/import."
+	s.add(http.MethodPost, "/v1/imports/books", "importBooksAlias", alias)
+	s.add(http.MethodPost, "/v1/imports/onix", "importONIX", &openapi.Operation{
+		Summary:     "Import books from an ONIX message",
+		Tags:        tags,
+		Parameters:  []*openapi.Parameter{dryRun},
+		RequestBody: &openapi.RequestBody{Required: true, Content: map[string]*openapi.MediaType{"application/xml": {Schema: text}}},
+		Responses:   importResponses,
+	})
+
+	cover := openapi.Nullable(s.doc.Schema(envelope{"content_type": "", "size": 0}))
+	preview := s.doc.Schema(envelope{
+		"book":       &data.Book{},
+		"epub":       &epub.Metadata{},
+		"duplicates": []*data.Book{},
+		"errors":     map[string]string{},
+	})
+	preview.Properties["cover"] = cover
+	created := s.doc.Schema(envelope{"book": &data.Book{}})
+	created.Properties["cover"] = cover
+	duplicate := s.doc.Schema(envelope{"error": "", "duplicates": []*data.Book{}})
+
+	s.add(http.MethodPost, "/v1/imports/epub", "importEPUB", &openapi.Operation{
+		Summary:     "Create a book from an EPUB",
+		Description: "Previews the book an EPUB describes, with the existing books that look like duplicates of it. With commit=true the book is created, unless there are possible duplicates and force isn't set.",
+		Tags:        tags,
+		Parameters: []*openapi.Parameter{
+			boolParameter("commit", "Create the book instead of previewing it."),
+			boolParameter("force", "Create the book even if it may already exist."),
+		},
+		RequestBody: &openapi.RequestBody{
+			Required: true,
+			Content: map[string]*openapi.MediaType{
+				"multipart/form-data": {Schema: &openapi.Schema{
+					Type: "object",
+					Properties: map[string]*openapi.Schema{
+						"file":             file,
+						"title":            text,
+						"isbn":             text,
+						"publication_date": text,
+						"genre":            text,
+						"description":      text,
+					},
+					Required: []string{"file"},
+				}},
+			},
+		},
+		Responses: map[string]*openapi.Response{
+			"200": s.reply("The book the EPUB describes, with its validation errors and possible duplicates.", preview),
+			"201": s.reply("The new book.", created),
+			"400": s.badRequest(),
+			"409": s.reply("The book may already exist.", duplicate),
+			"413": s.failure("The body is too large."),
+			"422": s.failedValidation(),
+		},
+	})
+
+	job := &data.ImportJob{}
+	s.add(http.MethodPost, "/v1/imports/goodreads", "importGoodreads", s.secured(&openapi.Operation{
+		Summary:     "Import a Goodreads library export",
+		Description: "Starts importing the export in the background and returns the job tracking it.",
+		Tags:        tags,
+		RequestBody: &openapi.RequestBody{
+			Required: true,
+			Content: map[string]*openapi.MediaType{
+				"text/csv": {Schema: text},
+				"multipart/form-data": {Schema: &openapi.Schema{
+					Type:       "object",
+					Properties: map[string]*openapi.Schema{"file": file},
+					Required:   []string{"file"},
+				}},
+			},
+		},
+		Responses: map[string]*openapi.Response{
+			"202": s.created("The job importing the export.", envelope{"import_job": job}),
+			"400": s.badRequest(),
+			"413": s.failure("The body is too large."),
+			"415": s.failure("The body is not in a supported format."),
+		},
+	}))
+	s.add(http.MethodGet, "/v1/imports", "listImportJobs", s.secured(&openapi.Operation{
+		Summary:    "List your import jobs",
+		Tags:       tags,
+		Parameters: filterParameters(),
+		Responses: map[string]*openapi.Response{
+			"200": s.envelope("A page of import jobs.", envelope{"import_jobs": []*data.ImportJob{}, "metadata": data.Metadata{}}),
+		},
+	}))
+	s.add(http.MethodGet, "/v1/imports/:id", "displayImportJob", s.secured(&openapi.Operation{
+		Summary: "Show one of your import jobs",
+		Tags:    tags,
+		Responses: map[string]*openapi.Response{
+			"200": s.envelope("The import job.", envelope{"import_job": job}),
+		},
+	}))
+}
+
+func (s *apiSpec) works() {
+	tags := []string{"works"}
+	work := &data.Work{}
+
+	s.add(http.MethodPost, "/v1/works", "createWork", &openapi.Operation{
+		Summary:     "Create a work",
+		Tags:        tags,
+		RequestBody: s.jsonBody(createWorkInput{}),
+		Responses:   s.createResponses(s.created("The new work.", envelope{"work": work})),
+	})
+	s.add(http.MethodGet, "/v1/works/:id", "displayWork", &openapi.Operation{
+		Summary:   "Show a work",
+		Tags:      tags,
+		Responses: map[string]*openapi.Response{"200": s.envelope("The work.", envelope{"work": work})},
+	})
+	s.add(http.MethodPatch, "/v1/works/:id", "updateWork", &openapi.Operation{
+		Summary:     "Update a work",
+		Tags:        tags,
+		RequestBody: s.jsonBody(updateWorkInput{}),
+		Responses: map[string]*openapi.Response{
+			"200": s.envelope("The updated work.", envelope{"work": work}),
+			"400": s.badRequest(),
+			"422": s.failedValidation(),
+		},
+	})
+	s.add(http.MethodDelete, "/v1/works/:id", "deleteWork", &openapi.Operation{
+		Summary: "Delete a work",
+		Tags:    tags,
+		Responses: map[string]*openapi.Response{
+			"200": s.message("The work was deleted."),
+			"409": s.failure("The work still has editions."),
+		},
+	})
+	s.add(http.MethodGet, "/v1/works", "listWorks", &openapi.Operation{
+		Summary:    "List works",
+		Tags:       tags,
+		Parameters: append([]*openapi.Parameter{stringParameter("title", "Match works whose title contains this text.")}, filterParameters()...),
+		Responses: map[string]*openapi.Response{
+			"200": s.envelope("A page of works.", envelope{"works": []*data.Work{}, "metadata": data.Metadata{}}),
+			"422": s.failedValidation(),
+		},
+	})
+	s.add(http.MethodGet, "/v1/works/:id/editions", "listWorkEditions", &openapi.Operation{
+		Summary:    "List the editions of a work",
+		Tags:       tags,
+		Parameters: pageParameters(10),
+		Responses: map[string]*openapi.Response{
+			"200": s.envelope("A page of editions.", envelope{"editions": []*data.Book{}, "metadata": data.Metadata{}}),
+			"422": s.failedValidation(),
+		},
+	})
+	s.add(http.MethodPost, "/v1/works/:id/editions", "attachEdition", &openapi.Operation{
+		Summary:     "Make a book an edition of a work",
+		Tags:        tags,
+		RequestBody: s.jsonBody(attachEditionInput{}),
+		Responses: map[string]*openapi.Response{
+			"200": s.envelope("The book.", envelope{"book": &data.Book{}}),
+			"400": s.badRequest(),
+			"422": s.failedValidation(),
+		},
+	})
+	s.add(http.MethodGet, "/v1/works/:id/reviews", "listWorkReviews", &openapi.Operation{
+		Summary:    "List the reviews of all editions of a work",
+		Tags:       tags,
+		Parameters: append(reviewSearchParameters(), filterParameters()...),
+		Responses: map[string]*openapi.Response{
+			"200": s.envelope("The work and a page of its reviews.", envelope{"work": work, "reviews": []*data.Review{}, "metadata": data.Metadata{}}),
+			"422": s.failedValidation(),
+		},
+	})
+}
+
+func (s *apiSpec) series() {
+	tags := []string{"series"}
+	series := &data.Series{}
+
+	s.add(http.MethodPost, "/v1/series", "createSeries", &openapi.Operation{
+		Summary:     "Create a series",
+		Tags:        tags,
+		RequestBody: s.jsonBody(createSeriesInput{}),
+		Responses:   s.createResponses(s.created("The new series.", envelope{"series": series})),
+	})
+	s.add(http.MethodGet, "/v1/series/:id", "displaySeries", &openapi.Operation{
+		Summary:   "Show a series and its volumes",
+		Tags:      tags,
+		Responses: map[string]*openapi.Response{"200": s.envelope("The series.", envelope{"series": series})},
+	})
+	s.add(http.MethodPatch, "/v1/series/:id", "updateSeries", &openapi.Operation{
+		Summary:     "Update a series",
+		Tags:        tags,
+		RequestBody: s.jsonBody(updateSeriesInput{}),
+		Responses: map[string]*openapi.Response{
+			"200": s.envelope("The updated series.", envelope{"series": series}),
+			"400": s.badRequest(),
+			"422": s.failedValidation(),
+		},
+	})
+	s.add(http.MethodDelete, "/v1/series/:id", "deleteSeries", &openapi.Operation{
+		Summary:   "Delete a series",
+		Tags:      tags,
+		Responses: map[string]*openapi.Response{"200": s.message("The series was deleted.")},
+	})
+	s.add(http.MethodGet, "/v1/series", "listSeries", &openapi.Operation{
+		Summary:    "List series",
+		Tags:       tags,
+		Parameters: append([]*openapi.Parameter{stringParameter("name", "Match series whose name contains this text.")}, filterParameters()...),
+		Responses: map[string]*openapi.Response{
+			"200": s.envelope("A page of series.", envelope{"series": []*data.Series{}, "metadata": data.Metadata{}}),
+			"422": s.failedValidation(),
+		},
+	})
+	s.add(http.MethodPut, "/v1/series/:id/books", "setSeriesVolume", &openapi.Operation{
+		Summary:     "Put a book in a series at a position",
+		Tags:        tags,
+		RequestBody: s.jsonBody(seriesVolumeInput{}),
+		Responses: map[string]*openapi.Response{
+			"200": s.envelope("The series with its volumes.", envelope{"series": series}),
+			"400": s.badRequest(),
+			"422": s.failedValidation(),
+		},
+	})
+	s.add(http.MethodDelete, "/v1/series/:id/books/:book_id", "removeSeriesVolume", &openapi.Operation{
+		Summary:   "Take a book out of a series",
+		Tags:      tags,
+		Responses: map[string]*openapi.Response{"200": s.message("The book was removed from the series.")},
+	})
+}
+
+func (s *apiSpec) authors() {
+	tags := []string{"authors"}
+	author := &data.Author{}
+
+	s.add(http.MethodPost, "/v1/authors", "createAuthor", &openapi.Operation{
+		Summary:     "Create an author",
+		Tags:        tags,
+		RequestBody: s.jsonBody(createAuthorInput{}),
+		Responses:   s.createResponses(s.created("The new author.", envelope{"author": author})),
+	})
+	s.add(http.MethodGet, "/v1/authors/:id", "displayAuthor", &openapi.Operation{
+		Summary:   "Show an author",
+		Tags:      tags,
+		Responses: map[string]*openapi.Response{"200": s.envelope("The author.", envelope{"author": author})},
+	})
+	s.add(http.MethodPatch, "/v1/authors/:id", "updateAuthor", &openapi.Operation{
+		Summary:     "Update an author",
+		Tags:        tags,
+		RequestBody: s.jsonBody(updateAuthorInput{}),
+		Responses: map[string]*openapi.Response{
+			"200": s.envelope("The updated author.", envelope{"author": author}),
+			"400": s.badRequest(),
+			"422": s.failedValidation(),
+		},
+	})
+	s.add(http.MethodDelete, "/v1/authors/:id", "deleteAuthor", &openapi.Operation{
+		Summary:   "Delete an author",
+		Tags:      tags,
+		Responses: map[string]*openapi.Response{"200": s.message("The author was deleted.")},
+	})
+	s.add(http.MethodGet, "/v1/authors", "listAuthors", &openapi.Operation{
+		Summary:    "List authors",
+		Tags:       tags,
+		Parameters: append([]*openapi.Parameter{stringParameter("name", "Match authors whose name contains this text.")}, filterParameters()...),
+		Responses: map[string]*openapi.Response{
+			"200": s.envelope("A page of authors.", envelope{"authors": []*data.Author{}, "metadata": data.Metadata{}}),
+			"422": s.failedValidation(),
+		},
+	})
+	s.add(http.MethodGet, "/v1/authors/:id/books", "listAuthorBooks", &openapi.Operation{
+		Summary:    "List the books of an author",
+		Tags:       tags,
+		Parameters: pageParameters(10),
+		Responses: map[string]*openapi.Response{
+			"200": s.envelope("A page of the author's books.", envelope{"books": []*data.Book{}, "metadata": data.Metadata{}}),
+			"422": s.failedValidation(),
+		},
+	})
+}
+
+func (s *apiSpec) genres() {
+	tags := []string{"genres"}
+	genre := &data.Genre{}
+
+	s.add(http.MethodPost, "/v1/genres", "createGenre", &openapi.Operation{
+		Summary:     "Create a genre",
+		Tags:        tags,
+		RequestBody: s.jsonBody(createGenreInput{}),
+		Responses:   s.createResponses(s.created("The new genre.", envelope{"genre": genre})),
+	})
+	s.add(http.MethodGet, "/v1/genres/:id", "displayGenre", &openapi.Operation{
+		Summary: "Show a genre with its subgenres and ancestors",
+		Tags:    tags,
+		Responses: map[string]*openapi.Response{
+			"200": s.envelope("The genre, and its ancestors from the most general down.", envelope{"genre": genre, "ancestors": []*data.Genre{}}),
+		},
+	})
+	s.add(http.MethodPatch, "/v1/genres/:id", "updateGenre", &openapi.Operation{
+		Summary:     "Update a genre",
+		Tags:        tags,
+		RequestBody: s.jsonBody(updateGenreInput{}),
+		Responses: map[string]*openapi.Response{
+			"200": s.envelope("The updated genre.", envelope{"genre": genre}),
+			"400": s.badRequest(),
+			"422": s.failedValidation(),
+		},
+	})
+	s.add(http.MethodDelete, "/v1/genres/:id", "deleteGenre", &openapi.Operation{
+		Summary:   "Delete a genre",
+		Tags:      tags,
+		Responses: map[string]*openapi.Response{"200": s.message("The genre was deleted.")},
+	})
+	s.add(http.MethodGet, "/v1/genres", "listGenres", &openapi.Operation{
+		Summary:   "List the genre tree",
+		Tags:      tags,
+		Responses: map[string]*openapi.Response{"200": s.envelope("The top-level genres with their subgenres.", envelope{"genres": []*data.Genre{}})},
+	})
+	s.add(http.MethodGet, "/v1/genres/:id/books", "listGenreBooks", &openapi.Operation{
+		Summary:    "List the books in a genre or its subgenres",
+		Tags:       tags,
+		Parameters: pageParameters(10),
+		Responses: map[string]*openapi.Response{
+			"200": s.envelope("A page of books.", envelope{"books": []*data.Book{}, "metadata": data.Metadata{}}),
+			"422": s.failedValidation(),
+		},
+	})
+}
+
+// reviewSearchParameters describes the parameters that narrow a list of
+// reviews.
+func reviewSearchParameters() []*openapi.Parameter {
+	return []*openapi.Parameter{
+		stringParameter("content", "Match reviews whose text contains this text."),
+		stringParameter("author", "Match reviews by this reviewer."),
+		integerParameter("rating", "Match reviews with this rating."),
+	}
+}
+
+func (s *apiSpec) reviews() {
+	tags := []string{"reviews"}
+	review := &data.Review{}
+	reviews := envelope{"reviews": []*data.Review{}, "metadata": data.Metadata{}}
+	listParameters := append(append(reviewSearchParameters(), filterParameters()...), projectionParameters(data.ReviewFieldSafeList, data.ReviewIncludeSafeList)...)
+
+	s.add(http.MethodPost, "/v1/books/:id/reviews", "createReview", s.idempotent(&openapi.Operation{
+		Summary:     "Review a book",
+		Tags:        tags,
+		RequestBody: s.jsonBody(createReviewInput{}),
+		Responses:   s.createResponses(s.envelope("The new review.", envelope{"review": review})),
+	}))
+	s.add(http.MethodGet, "/v1/books/:id/reviews/:review_id", "displayReview", &openapi.Operation{
+		Summary:    "Show a review",
+		Tags:       tags,
+		Parameters: projectionParameters(data.ReviewFieldSafeList, data.ReviewIncludeSafeList),
+		Responses: map[string]*openapi.Response{
+			"200": withJSONLD(s.envelope("The review, limited to the requested fields.", envelope{"review": review})),
+			"422": s.failedValidation(),
+		},
+	})
+	s.add(http.MethodPatch, "/v1/books/:id/reviews/:review_id", "updateReview", &openapi.Operation{
+		Summary:     "Update a review",
+		Tags:        tags,
+		RequestBody: s.patchBody(updateReviewInput{}, reviewDocument{}),
+		Responses:   s.patchResponses(s.envelope("The updated review.", envelope{"review": review})),
+	})
+	s.add(http.MethodDelete, "/v1/books/:id/reviews/:review_id", "deleteReview", &openapi.Operation{
+		Summary:   "Delete a review",
+		Tags:      tags,
+		Responses: map[string]*openapi.Response{"200": s.message("The review was deleted.")},
+	})
+	s.add(http.MethodGet, "/v1/reviews", "listReviews", &openapi.Operation{
+		Summary:    "List reviews",
+		Tags:       tags,
+		Parameters: listParameters,
+		Responses: map[string]*openapi.Response{
+			"200": s.envelope("A page of reviews.", reviews),
+			"422": s.failedValidation(),
+		},
+	})
+	s.add(http.MethodGet, "/v1/books/:id/reviews", "listBookReviews", &openapi.Operation{
+		Summary:    "List the reviews of a book",
+		Tags:       tags,
+		Parameters: listParameters,
+		Responses: map[string]*openapi.Response{
+			"200": s.envelope("A page of the book's reviews.", reviews),
+			"422": s.failedValidation(),
+		},
+	})
+}
+
+func (s *apiSpec) readingLists() {
+	tags := []string{"readinglists"}
+	readingList := &data.ReadingList{}
+
+	s.add(http.MethodPost, "/v1/readinglists", "createReadingList", s.idempotent(&openapi.Operation{
+		Summary:     "Create a reading list",
+		Tags:        tags,
+		RequestBody: s.jsonBody(createReadingListInput{}),
+		Responses:   s.createResponses(s.envelope("The new reading list.", envelope{"readinglist": readingList})),
+	}))
+	s.add(http.MethodGet, "/v1/readinglists/:id", "displayReadingList", &openapi.Operation{
+		Summary:    "Show a reading list",
+		Tags:       tags,
+		Parameters: append(projectionParameters(data.ReadingListFieldSafeList, data.ReadingListIncludeSafeList), citationParameter()),
+		Responses: map[string]*openapi.Response{
+			"200": withCitations(s.envelope("The reading list, limited to the requested fields; in a citation format, the books on it.", envelope{"readinglist": readingList})),
+			"400": s.badRequest(),
+			"422": s.failedValidation(),
+		},
+	})
+	s.add(http.MethodPatch, "/v1/readinglists/:id", "updateReadingList", &openapi.Operation{
+		Summary:     "Update a reading list",
+		Tags:        tags,
+		RequestBody: s.patchBody(updateReadingListInput{}, readingListDocument{}),
+		Responses:   s.patchResponses(s.envelope("The updated reading list.", envelope{"readinglist": readingList})),
+	})
+	s.add(http.MethodDelete, "/v1/readinglists/:id", "deleteReadingList", &openapi.Operation{
+		Summary:   "Delete a reading list",
+		Tags:      tags,
+		Responses: map[string]*openapi.Response{"200": s.message("The reading list was deleted.")},
+	})
+	s.add(http.MethodGet, "/v1/readinglists", "listReadingLists", &openapi.Operation{
+		Summary: "List reading lists",
+		Tags:    tags,
+		Parameters: append(append([]*openapi.Parameter{
+			stringParameter("name", "Match reading lists whose name contains this text."),
+			queryParameter("status", "Match reading lists with this status.", openapi.Enum(data.ReadingListStatuses...)),
+		}, filterParameters()...), projectionParameters(data.ReadingListFieldSafeList, data.ReadingListIncludeSafeList)...),
+		Responses: map[string]*openapi.Response{
+			"200": s.envelope("A page of reading lists.", envelope{"readinglists": []*data.ReadingList{}, "metadata": data.Metadata{}}),
+			"422": s.failedValidation(),
+		},
+	})
+	s.add(http.MethodPost, "/v1/readinglists/:id/next-volume", "addNextSeriesVolume", &openapi.Operation{
+		Summary:     "Add the next unread volume of a series",
+		Tags:        tags,
+		RequestBody: s.jsonBody(nextSeriesVolumeInput{}),
+		Responses: map[string]*openapi.Response{
+			"200": s.envelope("The reading list and the volume added to it.", envelope{"readinglist": readingList, "added": &data.SeriesVolume{}}),
+			"400": s.badRequest(),
+			"409": s.failure("Every volume of the series has been read or is on the list."),
+			"422": s.failedValidation(),
+		},
+	})
+}
+
+func (s *apiSpec) users() {
+	tags := []string{"users"}
+	user := &data.User{}
+
+	s.add(http.MethodPost, "/v1/users", "createUser", &openapi.Operation{
+		Summary:     "Register a user",
+		Tags:        tags,
+		RequestBody: s.jsonBody(createUserInput{}),
+		Responses:   s.createResponses(s.created("The new user.", envelope{"user": user})),
+	})
+	s.add(http.MethodPost, "/v1/login", "loginUser", &openapi.Operation{
+		Summary:     "Log in",
+		Tags:        tags,
+		RequestBody: s.jsonBody(loginInput{}),
+		Responses: map[string]*openapi.Response{
+			"200": s.envelope("A token to send in the Authorization header.", envelope{"token": ""}),
+			"400": s.badRequest(),
+			"404": s.failure("The email address and password don't match a user."),
+		},
+	})
+	s.add(http.MethodGet, "/v1/users", "listUsers", s.secured(&openapi.Operation{
+		Summary: "List users",
+		Tags:    tags,
+		Parameters: append(append([]*openapi.Parameter{
+			stringParameter("username", "Match users whose username contains this text."),
+		}, filterParameters()...), projectionParameters(userListFieldSafeList, data.UserIncludeSafeList)...),
+		Responses: map[string]*openapi.Response{
+			"200": s.envelope("A page of users, without their email addresses.", envelope{"users": []*data.User{}, "metadata": data.Metadata{}}),
+			"422": s.failedValidation(),
+		},
+	}))
+	s.add(http.MethodGet, "/v1/users/:id", "getUserProfile", &openapi.Operation{
+		Summary:    "Show a user",
+		Tags:       tags,
+		Parameters: projectionParameters(data.UserFieldSafeList, data.UserIncludeSafeList),
+		Responses: map[string]*openapi.Response{
+			"200": s.envelope("The user, limited to the requested fields.", envelope{"user": user}),
+			"422": s.failedValidation(),
+		},
+	})
+	s.add(http.MethodPatch, "/v1/users/:id", "updateUser", s.secured(&openapi.Operation{
+		Summary:     "Update your account",
+		Tags:        tags,
+		RequestBody: s.patchBody(updateUserInput{}, userDocument{}),
+		Responses: map[string]*openapi.Response{
+			"200": s.envelope("The updated user.", envelope{"user": user}),
+			"400": s.badRequest(),
+			"403": s.failure("The account is not yours."),
+			"409": s.failure("A test operation of the JSON Patch failed."),
+		},
+	}))
+	s.add(http.MethodGet, "/v1/users/:id/lists", "getUserReadingLists", &openapi.Operation{
+		Summary:    "List a user's reading lists",
+		Tags:       tags,
+		Parameters: pageParameters(10),
+		Responses: map[string]*openapi.Response{
+			"200": s.envelope("A page of reading lists.", envelope{"readinglists": []*data.ReadingList{}, "metadata": data.Metadata{}}),
+			"422": s.failedValidation(),
+		},
+	})
+	s.add(http.MethodGet, "/v1/users/:id/reviews", "getUserReviews", &openapi.Operation{
+		Summary:    "List a user's reviews",
+		Tags:       tags,
+		Parameters: pageParameters(10),
+		Responses: map[string]*openapi.Response{
+			"200": s.envelope("A page of reviews.", envelope{"reviews": []*data.Review{}, "metadata": data.Metadata{}}),
+			"422": s.failedValidation(),
+		},
+	})
+}
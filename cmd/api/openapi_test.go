@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type route struct {
+	method, path string
+}
+
+// registeredRoutes returns the routes routes() registers, read from the
+// router.HandlerFunc and router.Handler calls in routes.go and from the
+// "METHOD /path" patterns registered on mux in front of the router.
+func registeredRoutes(t *testing.T) []route {
+	t.Helper()
+
+	file, err := parser.ParseFile(token.NewFileSet(), "routes.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var routes []route
+	ast.Inspect(file, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) < 2 {
+			return true
+		}
+		fun, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok || !slices.Contains([]string{"HandlerFunc", "Handler", "HandleFunc", "Handle"}, fun.Sel.Name) {
+			return true
+		}
+		x, ok := fun.X.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		if x.Name == "mux" {
+			lit, ok := call.Args[0].(*ast.BasicLit)
+			if !ok || lit.Kind != token.STRING {
+				t.Fatalf("routes.go: the pattern of a mux route must be a string literal")
+			}
+			pattern, err := strconv.Unquote(lit.Value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The catch-all pattern hands the rest to the router.
+			if method, path, ok := strings.Cut(pattern, " "); ok {
+				routes = append(routes, route{method, path})
+			}
+			return true
+		}
+		if x.Name != "router" {
+			return true
+		}
+
+		method, ok := call.Args[0].(*ast.SelectorExpr)
+		if !ok || !strings.HasPrefix(method.Sel.Name, "Method") {
+			t.Fatalf("routes.go: the method of a route must be an http.Method constant")
+		}
+		lit, ok := call.Args[1].(*ast.BasicLit)
+		if !ok || lit.Kind != token.STRING {
+			t.Fatalf("routes.go: the path of a route must be a string literal")
+		}
+		path, err := strconv.Unquote(lit.Value)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		routes = append(routes, route{strings.ToUpper(strings.TrimPrefix(method.Sel.Name, "Method")), path})
+		return true
+	})
+
+	if len(routes) == 0 {
+		t.Fatal("routes.go: no routes found")
+	}
+	return routes
+}
+
+func TestOpenAPICoversRoutes(t *testing.T) {
+	doc := apiDocument()
+	routes := registeredRoutes(t)
+
+	for _, r := range routes {
+		if doc.Lookup(r.method, r.path) == nil {
+			t.Errorf("%s %s is routed but missing from the OpenAPI document", r.method, r.path)
+		}
+	}
+
+	operations := 0
+	ids := map[string]string{}
+	for path, item := range doc.Paths {
+		for method, op := range *item {
+			operations++
+			if other, ok := ids[op.OperationID]; ok {
+				t.Errorf("operationId %q is used by both %s and %s %s", op.OperationID, other, strings.ToUpper(method), path)
+			}
+			ids[op.OperationID] = strings.ToUpper(method) + " " + path
+		}
+	}
+	if operations != len(routes) {
+		t.Errorf("the OpenAPI document has %d operations for %d routes", operations, len(routes))
+	}
+}
+
+func TestOpenAPIHandler(t *testing.T) {
+	a := &applicationDependencies{}
+	w := httptest.NewRecorder()
+	a.openAPIHandler(w, httptest.NewRequest(http.MethodGet, "/v1/openapi.json", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d; want %d", w.Code, http.StatusOK)
+	}
+
+	var doc struct {
+		OpenAPI    string                    `json:"openapi"`
+		Paths      map[string]map[string]any `json:"paths"`
+		Components struct {
+			Schemas map[string]any `json:"schemas"`
+		} `json:"components"`
+	}
+	err := json.Unmarshal(w.Body.Bytes(), &doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.OpenAPI != "3.1.0" {
+		t.Errorf("got openapi %q; want 3.1.0", doc.OpenAPI)
+	}
+	for _, name := range []string{"Book", "Metadata", "Error", "ValidationError", "CreateBookInput"} {
+		if _, ok := doc.Components.Schemas[name]; !ok {
+			t.Errorf("schema %s is missing", name)
+		}
+	}
+
+	// Every reference must resolve to a component.
+	for _, ref := range findRefs(w.Body.String()) {
+		name := strings.TrimPrefix(ref, "#/components/schemas/")
+		if _, ok := doc.Components.Schemas[name]; !ok {
+			t.Errorf("dangling reference %s", ref)
+		}
+	}
+}
+
+func findRefs(doc string) []string {
+	var refs []string
+	for _, part := range strings.Split(doc, `"$ref": "`)[1:] {
+		ref, _, _ := strings.Cut(part, `"`)
+		refs = append(refs, ref)
+	}
+	return refs
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/tchenbz/AWTtest_3/internal/data"
+	"github.com/tchenbz/AWTtest_3/internal/patch"
+)
+
+// errPatchResult wraps the error from decoding a patched document, which
+// means the patch itself was fine but left the record in a shape it can't
+// have.
+var errPatchResult = errors.New("the patched document is not valid")
+
+// readPatch applies the JSON Merge Patch or JSON Patch in the request body
+// to doc, which holds the fields of the record a client may change. It
+// reports false, without reading the body, when the request isn't a patch
+// document so that the handler can read its usual JSON body instead.
+func readPatch[T any](a *applicationDependencies, w http.ResponseWriter, r *http.Request, doc *T) (bool, error) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (mediaType != patch.MergePatchMediaType && mediaType != patch.JSONPatchMediaType) {
+		return false, nil
+	}
+
+	maxBytes := 256_000
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, int64(maxBytes)))
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			return true, fmt.Errorf("%w: the body must not be larger than %d bytes", patch.ErrInvalid, maxBytesError.Limit)
+		}
+		return true, err
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return true, fmt.Errorf("%w: the body must not be empty", patch.ErrInvalid)
+	}
+
+	current, err := json.Marshal(doc)
+	if err != nil {
+		return true, err
+	}
+
+	var patched []byte
+	if mediaType == patch.MergePatchMediaType {
+		patched, err = patch.MergePatch(current, body)
+	} else {
+		patched, err = patch.Apply(current, body)
+	}
+	if err != nil {
+		return true, err
+	}
+
+	// Members removed by the patch must end up cleared, so the result is
+	// decoded into a fresh document rather than over the current one.
+	var result T
+	r.Body = io.NopCloser(bytes.NewReader(patched))
+	err = a.readJSON(w, r, &result)
+	if err != nil {
+		return true, fmt.Errorf("%w: %v", errPatchResult, err)
+	}
+
+	*doc = result
+	return true, nil
+}
+
+// bookDocument holds the fields of a book that a patch may change. Genres
+// are edited by id, as in the PATCH body.
+type bookDocument struct {
+	Title           string             `json:"title"`
+	Authors         []*data.BookAuthor `json:"authors"`
+	ISBN            string             `json:"isbn"`
+	PublicationDate string             `json:"publication_date"`
+	Genre           string             `json:"genre"`
+	GenreIDs        []int64            `json:"genre_ids"`
+	Description     string             `json:"description"`
+	AverageRating   float64            `json:"average_rating"`
+	WorkID          int64              `json:"work_id"`
+	Format          string             `json:"format"`
+	Language        string             `json:"language"`
+	Publisher       string             `json:"publisher"`
+	PageCount       int                `json:"page_count"`
+}
+
+func newBookDocument(book *data.Book) *bookDocument {
+	return &bookDocument{
+		Title:           book.Title,
+		Authors:         book.Authors,
+		ISBN:            book.ISBN,
+		PublicationDate: book.PublicationDate,
+		Genre:           book.Genre,
+		GenreIDs:        book.GenreIDs(),
+		Description:     book.Description,
+		AverageRating:   book.AverageRating,
+		WorkID:          book.WorkID,
+		Format:          book.Format,
+		Language:        book.Language,
+		Publisher:       book.Publisher,
+		PageCount:       book.PageCount,
+	}
+}
+
+func (d *bookDocument) applyTo(book *data.Book) {
+	book.Title = d.Title
+	book.Authors = d.Authors
+	if book.Authors == nil {
+		book.Authors = []*data.BookAuthor{}
+	}
+	book.ISBN = d.ISBN
+	book.PublicationDate = d.PublicationDate
+	book.Genre = d.Genre
+	book.Genres = nil
+	for _, id := range d.GenreIDs {
+		book.Genres = append(book.Genres, &data.BookGenre{ID: id})
+	}
+	book.Description = d.Description
+	book.AverageRating = d.AverageRating
+	book.WorkID = d.WorkID
+	book.Format = d.Format
+	book.Language = d.Language
+	book.Publisher = d.Publisher
+	book.PageCount = d.PageCount
+}
+
+// reviewDocument holds the fields of a review that a patch may change.
+type reviewDocument struct {
+	Content      string `json:"content"`
+	Author       string `json:"author"`
+	Rating       int    `json:"rating"`
+	HelpfulCount int    `json:"helpful_count"`
+}
+
+func newReviewDocument(review *data.Review) *reviewDocument {
+	return &reviewDocument{
+		Content:      review.Content,
+		Author:       review.Author,
+		Rating:       review.Rating,
+		HelpfulCount: review.HelpfulCount,
+	}
+}
+
+func (d *reviewDocument) applyTo(review *data.Review) {
+	review.Content = d.Content
+	review.Author = d.Author
+	review.Rating = d.Rating
+	review.HelpfulCount = d.HelpfulCount
+}
+
+// readingListDocument holds the fields of a reading list that a patch may
+// change, including the ids of the books on it.
+type readingListDocument struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Status      string  `json:"status"`
+	Books       []int64 `json:"books"`
+}
+
+func newReadingListDocument(readingList *data.ReadingList) *readingListDocument {
+	return &readingListDocument{
+		Name:        readingList.Name,
+		Description: readingList.Description,
+		Status:      readingList.Status,
+		Books:       readingList.Books,
+	}
+}
+
+func (d *readingListDocument) applyTo(readingList *data.ReadingList) {
+	readingList.Name = d.Name
+	readingList.Description = d.Description
+	readingList.Status = d.Status
+	readingList.Books = d.Books
+	if readingList.Books == nil {
+		readingList.Books = []int64{}
+	}
+}
+
+// userDocument holds the fields of a user that a patch may change. The
+// password is write-only: it starts out absent and, when a patch sets it,
+// is hashed before it is saved.
+type userDocument struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Password string `json:"password,omitempty"`
+}
+
+func newUserDocument(user *data.User) *userDocument {
+	return &userDocument{
+		Username: user.Username,
+		Email:    user.Email,
+	}
+}
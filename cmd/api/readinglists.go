@@ -2,6 +2,7 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
 
@@ -9,13 +10,15 @@ import (
 	"github.com/tchenbz/AWTtest_3/internal/validator"
 )
 
+type createReadingListInput struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	CreatedBy   int64  `json:"created_by"`
+	Status      string `json:"status"`
+}
+
 func (a *applicationDependencies) createReadingListHandler(w http.ResponseWriter, r *http.Request) {
-    var input struct {
-        Name        string `json:"name"`
-        Description string `json:"description"`
-        CreatedBy   int64  `json:"created_by"`
-        Status      string `json:"status"`
-    }
+    var input createReadingListInput
 
     // Parse the request body
     err := a.readJSON(w, r, &input)
@@ -41,7 +44,7 @@ func (a *applicationDependencies) createReadingListHandler(w http.ResponseWriter
 
     // Respond with the newly created reading list
     data := envelope{"readinglist": readingList}
-    err = a.writeJSON(w, http.StatusCreated, data, nil)
+    err = a.writeResponse(w, r, http.StatusCreated, data, nil)
     if err != nil {
         a.serverErrorResponse(w, r, err)
     }
@@ -49,6 +52,11 @@ func (a *applicationDependencies) createReadingListHandler(w http.ResponseWriter
 
 
 func (a *applicationDependencies) displayReadingListHandler(w http.ResponseWriter, r *http.Request) {
+  if format := a.feedFormat(r); format != "" {
+	  a.readingListFeedHandler(w, r, format)
+	  return
+  }
+
   // Extract the ID from the URL parameter
   id, err := a.readIDParam(r)
   if err != nil {
@@ -57,8 +65,25 @@ func (a *applicationDependencies) displayReadingListHandler(w http.ResponseWrite
 	  return
   }
 
+  enc, err := a.citationEncoder(r)
+  if err != nil {
+	  a.badRequestResponse(w, r, err)
+	  return
+  }
+
+  v := validator.New()
+  projection := a.readProjection(r.URL.Query(), data.ReadingListFieldSafeList, data.ReadingListIncludeSafeList, v)
+  if !v.IsEmpty() {
+	  a.failedValidationResponse(w, r, v.Errors)
+	  return
+  }
+  // Citations need the ids of the books on the list.
+  if enc != nil {
+	  projection = data.Projection{}
+  }
+
   // Fetch the reading list from the database
-  readingList, err := a.readingListModel.Get(id)
+  readingList, err := a.readingListModel.GetProjected(id, projection)
   if err != nil {
 	  // Log the error before handling it
 	  log.Printf("Error fetching reading list with ID %d: %v", id, err)
@@ -71,9 +96,37 @@ func (a *applicationDependencies) displayReadingListHandler(w http.ResponseWrite
 	  return
   }
 
+  addVary(w.Header(), "Accept")
+
+  // Cite the books on the list if a citation format was asked for
+  if enc != nil {
+	  books, err := a.bookModel.GetMany(readingList.Books)
+	  if err != nil {
+		  a.serverErrorResponse(w, r, err)
+		  return
+	  }
+	  err = a.writeCitations(w, enc, fmt.Sprintf("readinglist-%d", readingList.ID), books)
+	  if err != nil {
+		  a.serverErrorResponse(w, r, err)
+	  }
+	  return
+  }
+
+  err = a.readingListModel.Include([]*data.ReadingList{readingList}, projection)
+  if err != nil {
+	  a.serverErrorResponse(w, r, err)
+	  return
+  }
+
+  record, err := project(readingList, projection)
+  if err != nil {
+	  a.serverErrorResponse(w, r, err)
+	  return
+  }
+
   // Return the reading list in JSON format
-  data := envelope{"readinglist": readingList}
-  err = a.writeJSON(w, http.StatusOK, data, nil)
+  data := envelope{"readinglist": record}
+  err = a.writeResponse(w, r, http.StatusOK, data, nil)
   if err != nil {
 	  // Log error if response writing fails
 	  log.Printf("Error writing response for reading list ID %d: %v", id, err)
@@ -81,6 +134,13 @@ func (a *applicationDependencies) displayReadingListHandler(w http.ResponseWrite
   }
 }
 
+type updateReadingListInput struct {
+	Name        *string  `json:"name"`
+	Description *string  `json:"description"`
+	Status      *string  `json:"status"`
+	Books       *[]int64 `json:"books"`
+}
+
 func (a *applicationDependencies) updateReadingListHandler(w http.ResponseWriter, r *http.Request) {
 	id, err := a.readIDParam(r)
 	if err != nil {
@@ -99,36 +159,44 @@ func (a *applicationDependencies) updateReadingListHandler(w http.ResponseWriter
 		return
 	}
 
-	var input struct {
-		Name        *string  `json:"name"`
-		Description *string  `json:"description"`
-		Status      *string  `json:"status"`
-		Books       *[]int64 `json:"books"` 
-	}
-
-	// Read the JSON input
-	err = a.readJSON(w, r, &input)
+	// A merge patch or JSON patch is applied to the reading list as it is
+	// now; otherwise the body lists the fields to change.
+	doc := newReadingListDocument(readingList)
+	patched, err := readPatch(a, w, r, doc)
 	if err != nil {
-		a.badRequestResponse(w, r, err)
+		a.patchErrorResponse(w, r, err)
 		return
 	}
+	if patched {
+		doc.applyTo(readingList)
+	} else {
+		var input updateReadingListInput
 
-	// Update the fields that are provided
-	if input.Name != nil {
-		readingList.Name = *input.Name
-	}
-	if input.Description != nil {
-		readingList.Description = *input.Description
-	}
-	if input.Status != nil {
-		readingList.Status = *input.Status
-	}
-	if input.Books != nil {
-		readingList.Books = *input.Books
+		// Read the JSON input
+		err = a.readJSON(w, r, &input)
+		if err != nil {
+			a.badRequestResponse(w, r, err)
+			return
+		}
+
+		// Update the fields that are provided
+		if input.Name != nil {
+			readingList.Name = *input.Name
+		}
+		if input.Description != nil {
+			readingList.Description = *input.Description
+		}
+		if input.Status != nil {
+			readingList.Status = *input.Status
+		}
+		if input.Books != nil {
+			readingList.Books = *input.Books
+		}
 	}
 
 	// Validate the updated reading list
 	v := validator.New()
+	data.ValidateReadingList(v, readingList)
 	if !v.IsEmpty() {
 		a.failedValidationResponse(w, r, v.Errors)
 		return
@@ -137,13 +205,20 @@ func (a *applicationDependencies) updateReadingListHandler(w http.ResponseWriter
 	// Update the reading list in the database
 	err = a.readingListModel.Update(readingList)
 	if err != nil {
-		a.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrUnknownBook):
+			a.failedValidationResponse(w, r, map[string]string{"books": err.Error()})
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
 	// Respond with the updated reading list
 	data := envelope{"readinglist": readingList}
-	err = a.writeJSON(w, http.StatusOK, data, nil)
+	err = a.writeResponse(w, r, http.StatusOK, data, nil)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 	}
@@ -169,12 +244,16 @@ func (a *applicationDependencies) deleteReadingListHandler(w http.ResponseWriter
 
 	// Respond with a success message
 	data := envelope{"message": "reading list successfully deleted"}
-	err = a.writeJSON(w, http.StatusOK, data, nil)
+	err = a.writeResponse(w, r, http.StatusOK, data, nil)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 	}
 }
 
+// readingListSortSafeList lists the values a list of reading lists can be
+// sorted by.
+var readingListSortSafeList = []string{"id", "name", "status", "-id", "-name", "-status"}
+
 func (a *applicationDependencies) listReadingListsHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
 		Name   string
@@ -188,10 +267,19 @@ func (a *applicationDependencies) listReadingListsHandler(w http.ResponseWriter,
 	input.Filters.Page = a.getSingleIntegerParameter(query, "page", 1, validator.New())
 	input.Filters.PageSize = a.getSingleIntegerParameter(query, "page_size", 10, validator.New())
 	input.Filters.Sort = a.getSingleQueryParameter(query, "sort", "id")
-	input.Filters.SortSafeList = []string{"id", "name", "status", "-id", "-name", "-status"}
+	input.Filters.SortSafeList = readingListSortSafeList
+	input.Filters.FilterSafeList = map[string]data.FilterType{
+		"id":         data.FilterNumber,
+		"name":       data.FilterText,
+		"status":     data.FilterText,
+		"created_by": data.FilterNumber,
+		"created_at": data.FilterTimestamp,
+	}
 
 	// Validate the filters
 	v := validator.New()
+	input.Filters.Conditions = a.getFilterConditions(query, v)
+	input.Filters.Projection = a.readProjection(query, data.ReadingListFieldSafeList, data.ReadingListIncludeSafeList, v)
 	data.ValidateFilters(v, input.Filters)
 	if !v.IsEmpty() {
 		a.failedValidationResponse(w, r, v.Errors)
@@ -205,12 +293,93 @@ func (a *applicationDependencies) listReadingListsHandler(w http.ResponseWriter,
 		return
 	}
 
+	err = a.readingListModel.Include(readingLists, input.Filters.Projection)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	records, err := projectAll(readingLists, input.Filters.Projection)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
 	// Respond with the list of reading lists
 	data := envelope{
-		"readinglists": readingLists,
+		"readinglists": records,
 		"metadata":     metadata,
 	}
-	err = a.writeJSON(w, http.StatusOK, data, nil)
+	err = a.writeResponse(w, r, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+type nextSeriesVolumeInput struct {
+	SeriesID int64 `json:"series_id"`
+}
+
+// addNextSeriesVolumeHandler appends the next volume of a series that the
+// list's owner hasn't read yet to the reading list. A volume counts as read
+// when it is on one of the owner's completed reading lists.
+func (a *applicationDependencies) addNextSeriesVolumeHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	var input nextSeriesVolumeInput
+
+	err = a.readJSON(w, r, &input)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	readingList, err := a.readingListModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	_, err = a.seriesModel.Get(input.SeriesID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.failedValidationResponse(w, r, map[string]string{"series_id": "series does not exist"})
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	volume, err := a.seriesModel.NextUnread(input.SeriesID, readingList.CreatedBy, readingList.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.errorResponseJSON(w, r, http.StatusConflict, "there is no unread volume of this series left to add")
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = a.readingListModel.AddBook(readingList.ID, volume.BookID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	readingList.Books = append(readingList.Books, volume.BookID)
+
+	data := envelope{"readinglist": readingList, "added": volume}
+	err = a.writeResponse(w, r, http.StatusOK, data, nil)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 	}
@@ -12,6 +12,12 @@ import (
 	"github.com/tchenbz/AWTtest_3/internal/validator"
 )
 
+type createReviewInput struct {
+	Content string `json:"content"`
+	Author  string `json:"author"`
+	Rating  int    `json:"rating"`
+}
+
 func (a *applicationDependencies) createReviewHandler(w http.ResponseWriter, r *http.Request) {
 	bookID, err := a.readIDParam(r)  
 	if err != nil {
@@ -19,11 +25,7 @@ func (a *applicationDependencies) createReviewHandler(w http.ResponseWriter, r *
 		return
 	}
 
-	var input struct {
-		Content   string `json:"content"`
-		Author    string `json:"author"`
-		Rating    int    `json:"rating"`
-	}
+	var input createReviewInput
 
 	err = a.readJSON(w, r, &input)
 	if err != nil {
@@ -39,6 +41,13 @@ func (a *applicationDependencies) createReviewHandler(w http.ResponseWriter, r *
 		Rating:  input.Rating,
 	}
 
+	v := validator.New()
+	data.ValidateReview(v, review)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
 	log.Printf("Inserting review: %+v", review)
 
 	// Insert the review into the database
@@ -50,7 +59,7 @@ func (a *applicationDependencies) createReviewHandler(w http.ResponseWriter, r *
 
 	// Respond with the created review
 	data := envelope{"review": review}
-	err = a.writeJSON(w, http.StatusCreated, data, nil)
+	err = a.writeResponse(w, r, http.StatusCreated, data, nil)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 	}
@@ -82,8 +91,19 @@ func (a *applicationDependencies) displayReviewHandler(w http.ResponseWriter, r
         return
     }
 
+    v := validator.New()
+    projection := a.readProjection(r.URL.Query(), data.ReviewFieldSafeList, data.ReviewIncludeSafeList, v)
+    if !v.IsEmpty() {
+        a.failedValidationResponse(w, r, v.Errors)
+        return
+    }
+    // JSON-LD is built from the whole review.
+    if a.wantsJSONLD(r) {
+        projection = data.Projection{}
+    }
+
     // Fetch the review from the database using the bookID and reviewID
-    review, err := a.reviewModel.Get(bookIDInt, reviewIDInt)
+    review, err := a.reviewModel.GetProjected(bookIDInt, reviewIDInt, projection)
     if err != nil {
         log.Printf("Error fetching review with book_id %d and review_id %d: %v", bookIDInt, reviewIDInt, err)
         switch {
@@ -95,15 +115,40 @@ func (a *applicationDependencies) displayReviewHandler(w http.ResponseWriter, r
         return
     }
 
+    addVary(w.Header(), "Accept")
+    if a.wantsJSONLD(r) {
+        a.writeReviewJSONLD(w, r, review)
+        return
+    }
+
+    err = a.reviewModel.Include([]*data.Review{review}, projection)
+    if err != nil {
+        a.serverErrorResponse(w, r, err)
+        return
+    }
+
+    record, err := project(review, projection)
+    if err != nil {
+        a.serverErrorResponse(w, r, err)
+        return
+    }
+
     // Return the review in the response
-    data := envelope{"review": review}
-    err = a.writeJSON(w, http.StatusOK, data, nil)
+    data := envelope{"review": record}
+    err = a.writeResponse(w, r, http.StatusOK, data, nil)
     if err != nil {
         a.serverErrorResponse(w, r, err)
     }
 }
 
 
+type updateReviewInput struct {
+	Content      *string `json:"content"`
+	Author       *string `json:"author"`
+	Rating       *int    `json:"rating"`
+	HelpfulCount *int    `json:"helpful_count"`
+}
+
 func (a *applicationDependencies) updateReviewHandler(w http.ResponseWriter, r *http.Request) {
     // Extract both the book_id and review_id from the URL path
     params := httprouter.ParamsFromContext(r.Context())
@@ -137,36 +182,44 @@ func (a *applicationDependencies) updateReviewHandler(w http.ResponseWriter, r *
         return
     }
 
-    // Parse the input JSON for updates
-    var input struct {
-        Content      *string `json:"content"`
-        Author       *string `json:"author"`
-        Rating       *int    `json:"rating"`
-        HelpfulCount *int    `json:"helpful_count"`
-    }
-
-    err = a.readJSON(w, r, &input)
+    // A merge patch or JSON patch is applied to the review as it is now;
+    // otherwise the body lists the fields to change.
+    doc := newReviewDocument(review)
+    patched, err := readPatch(a, w, r, doc)
     if err != nil {
-        a.badRequestResponse(w, r, err)  
+        a.patchErrorResponse(w, r, err)
         return
     }
+    if patched {
+        doc.applyTo(review)
+    } else {
+        // Parse the input JSON for updates
+        var input updateReviewInput
+
+        err = a.readJSON(w, r, &input)
+        if err != nil {
+            a.badRequestResponse(w, r, err)  
+            return
+        }
 
-    // Update the review fields if provided
-    if input.Content != nil {
-        review.Content = *input.Content
-    }
-    if input.Author != nil {
-        review.Author = *input.Author
-    }
-    if input.Rating != nil {
-        review.Rating = *input.Rating
-    }
-    if input.HelpfulCount != nil {
-        review.HelpfulCount = *input.HelpfulCount
+        // Update the review fields if provided
+        if input.Content != nil {
+            review.Content = *input.Content
+        }
+        if input.Author != nil {
+            review.Author = *input.Author
+        }
+        if input.Rating != nil {
+            review.Rating = *input.Rating
+        }
+        if input.HelpfulCount != nil {
+            review.HelpfulCount = *input.HelpfulCount
+        }
     }
 
     // Validate the updated review 
     v := validator.New()
+    data.ValidateReview(v, review)
     if !v.IsEmpty() {
         a.failedValidationResponse(w, r, v.Errors)
         return
@@ -181,7 +234,7 @@ func (a *applicationDependencies) updateReviewHandler(w http.ResponseWriter, r *
 
     // Return the updated review as a response
     data := envelope{"review": review}
-    err = a.writeJSON(w, http.StatusOK, data, nil)
+    err = a.writeResponse(w, r, http.StatusOK, data, nil)
     if err != nil {
         a.serverErrorResponse(w, r, err)
     }
@@ -223,12 +276,15 @@ func (a *applicationDependencies) deleteReviewHandler(w http.ResponseWriter, r *
 
     // Respond with a success message
     data := envelope{"message": "review successfully deleted"}
-    err = a.writeJSON(w, http.StatusOK, data, nil)
+    err = a.writeResponse(w, r, http.StatusOK, data, nil)
     if err != nil {
         a.serverErrorResponse(w, r, err)
     }
 }
 
+// reviewSortSafeList lists the values a list of reviews can be sorted by.
+var reviewSortSafeList = []string{"id", "rating", "helpful_count", "-id", "-rating", "-helpful_count"}
+
 func (a *applicationDependencies) listReviewsHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
 		Content string
@@ -244,9 +300,20 @@ func (a *applicationDependencies) listReviewsHandler(w http.ResponseWriter, r *h
 	input.Filters.Page = a.getSingleIntegerParameter(query, "page", 1, validator.New())
 	input.Filters.PageSize = a.getSingleIntegerParameter(query, "page_size", 10, validator.New())
 	input.Filters.Sort = a.getSingleQueryParameter(query, "sort", "id")
-	input.Filters.SortSafeList = []string{"id", "rating", "helpful_count", "-id", "-rating", "-helpful_count"}
+	input.Filters.SortSafeList = reviewSortSafeList
+	input.Filters.FilterSafeList = map[string]data.FilterType{
+		"id":            data.FilterNumber,
+		"book_id":       data.FilterNumber,
+		"content":       data.FilterText,
+		"author":        data.FilterText,
+		"rating":        data.FilterNumber,
+		"helpful_count": data.FilterNumber,
+		"created_at":    data.FilterTimestamp,
+	}
 
 	v := validator.New()
+	input.Filters.Conditions = a.getFilterConditions(query, v)
+	input.Filters.Projection = a.readProjection(query, data.ReviewFieldSafeList, data.ReviewIncludeSafeList, v)
 	data.ValidateFilters(v, input.Filters)
 	if !v.IsEmpty() {
 		a.failedValidationResponse(w, r, v.Errors)
@@ -259,17 +326,34 @@ func (a *applicationDependencies) listReviewsHandler(w http.ResponseWriter, r *h
 		return
 	}
 
+	err = a.reviewModel.Include(reviews, input.Filters.Projection)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	records, err := projectAll(reviews, input.Filters.Projection)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
 	data := envelope{
-		"reviews":  reviews,
+		"reviews":  records,
 		"metadata": metadata,
 	}
-	err = a.writeJSON(w, http.StatusOK, data, nil)
+	err = a.writeResponse(w, r, http.StatusOK, data, nil)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 	}
 }
 
 func (a *applicationDependencies) listBookReviewsHandler(w http.ResponseWriter, r *http.Request) {
+	if format := a.feedFormat(r); format != "" {
+		a.bookReviewsFeedHandler(w, r, format)
+		return
+	}
+
 	// Extract the book ID from the URL
 	bookID, err := a.readIDParam(r) // This will read the book ID from the URL
 	if err != nil {
@@ -292,10 +376,21 @@ func (a *applicationDependencies) listBookReviewsHandler(w http.ResponseWriter,
 	input.Filters.Page = a.getSingleIntegerParameter(query, "page", 1, validator.New())
 	input.Filters.PageSize = a.getSingleIntegerParameter(query, "page_size", 10, validator.New())
 	input.Filters.Sort = a.getSingleQueryParameter(query, "sort", "id")
-	input.Filters.SortSafeList = []string{"id", "rating", "helpful_count", "-id", "-rating", "-helpful_count"}
+	input.Filters.SortSafeList = reviewSortSafeList
+	input.Filters.FilterSafeList = map[string]data.FilterType{
+		"id":            data.FilterNumber,
+		"book_id":       data.FilterNumber,
+		"content":       data.FilterText,
+		"author":        data.FilterText,
+		"rating":        data.FilterNumber,
+		"helpful_count": data.FilterNumber,
+		"created_at":    data.FilterTimestamp,
+	}
 
 	// Validate the query parameters (pagination, filters)
 	v := validator.New()
+	input.Filters.Conditions = a.getFilterConditions(query, v)
+	input.Filters.Projection = a.readProjection(query, data.ReviewFieldSafeList, data.ReviewIncludeSafeList, v)
 	data.ValidateFilters(v, input.Filters)
 	if !v.IsEmpty() {
 		a.failedValidationResponse(w, r, v.Errors)
@@ -309,12 +404,24 @@ func (a *applicationDependencies) listBookReviewsHandler(w http.ResponseWriter,
 		return
 	}
 
+	err = a.reviewModel.Include(reviews, input.Filters.Projection)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	records, err := projectAll(reviews, input.Filters.Projection)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
 	// Send the reviews in JSON format, along with metadata (pagination info)
 	data := envelope{
-		"reviews":  reviews,
+		"reviews":  records,
 		"metadata": metadata,
 	}
-	err = a.writeJSON(w, http.StatusOK, data, nil)
+	err = a.writeResponse(w, r, http.StatusOK, data, nil)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 	}
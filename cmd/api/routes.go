@@ -5,6 +5,14 @@ import (
 	"github.com/julienschmidt/httprouter"
 )
 
+// handler returns the routes of a, built the first time they are needed.
+func (a *applicationDependencies) handler() http.Handler {
+	a.routerOnce.Do(func() {
+		a.router = a.routes()
+	})
+	return a.router
+}
+
 func (a *applicationDependencies) routes() http.Handler {
 	router := httprouter.New()
 	router.NotFound = http.HandlerFunc(a.notFoundResponse)
@@ -12,15 +20,75 @@ func (a *applicationDependencies) routes() http.Handler {
 
 
 	// Routes for Books
-	router.HandlerFunc(http.MethodPost, "/v1/books", a.createBookHandler)        
+	router.HandlerFunc(http.MethodPost, "/v1/books", a.idempotent(a.createBookHandler))        
 	router.HandlerFunc(http.MethodGet, "/v1/books/:id", a.displayBookHandler)   
 	router.HandlerFunc(http.MethodPatch, "/v1/books/:id", a.updateBookHandler)
 	router.HandlerFunc(http.MethodDelete, "/v1/books/:id", a.deleteBookHandler) 
 	router.HandlerFunc(http.MethodGet, "/v1/books", a.listBooksHandler)   
 	router.HandlerFunc(http.MethodGet, "/v1/search/books", a.searchBooksHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/books/:id/cover", a.displayBookCoverHandler)
+
+	// Routes for the OPDS catalog
+	router.HandlerFunc(http.MethodGet, "/v1/opds", a.opdsRootHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/opds/new", a.opdsNewBooksHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/opds/genres", a.opdsGenresHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/opds/genres/:id", a.opdsGenreBooksHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/opds/authors", a.opdsAuthorsHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/opds/authors/:id", a.opdsAuthorBooksHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/opds/search.xml", a.opdsSearchDescriptionHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/opds/search", a.opdsSearchHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/opds/readinglists", a.opdsReadingListsHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/opds/readinglists/:id", a.opdsReadingListBooksHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/opds/users/:id/readinglists", a.opdsUserReadingListsHandler)
+
+	// Routes for Imports
+	router.HandlerFunc(http.MethodPost, "/v1/imports/books", a.importBooksHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/imports/onix", a.importONIXHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/imports/epub", a.importEPUBHandler)
+	router.Handler(http.MethodPost, "/v1/imports/goodreads", a.AuthMiddleware(http.HandlerFunc(a.importGoodreadsHandler)))
+	router.Handler(http.MethodGet, "/v1/imports", a.AuthMiddleware(http.HandlerFunc(a.listImportJobsHandler)))
+	router.Handler(http.MethodGet, "/v1/imports/:id", a.AuthMiddleware(http.HandlerFunc(a.displayImportJobHandler)))
+
+	// Routes for Works and their editions
+	router.HandlerFunc(http.MethodPost, "/v1/works", a.createWorkHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/works/:id", a.displayWorkHandler)
+	router.HandlerFunc(http.MethodPatch, "/v1/works/:id", a.updateWorkHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/works/:id", a.deleteWorkHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/works", a.listWorksHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/works/:id/editions", a.listWorkEditionsHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/works/:id/editions", a.attachEditionHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/works/:id/reviews", a.listWorkReviewsHandler)
+
+	// Routes for Series
+	router.HandlerFunc(http.MethodPost, "/v1/series", a.createSeriesHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/series/:id", a.displaySeriesHandler)
+	router.HandlerFunc(http.MethodPatch, "/v1/series/:id", a.updateSeriesHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/series/:id", a.deleteSeriesHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/series", a.listSeriesHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/series/:id/books", a.setSeriesVolumeHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/series/:id/books/:book_id", a.removeSeriesVolumeHandler)
+
+	// Routes for Authors
+	router.HandlerFunc(http.MethodPost, "/v1/authors", a.createAuthorHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/authors/:id", a.displayAuthorHandler)
+	router.HandlerFunc(http.MethodPatch, "/v1/authors/:id", a.updateAuthorHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/authors/:id", a.deleteAuthorHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/authors", a.listAuthorsHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/authors/:id/books", a.listAuthorBooksHandler)
+
+	// Routes for Genres and Tags
+	router.HandlerFunc(http.MethodPost, "/v1/genres", a.createGenreHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/genres/:id", a.displayGenreHandler)
+	router.HandlerFunc(http.MethodPatch, "/v1/genres/:id", a.updateGenreHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/genres/:id", a.deleteGenreHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/genres", a.listGenresHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/genres/:id/books", a.listGenreBooksHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/tags", a.listTagsHandler)
+	router.Handler(http.MethodPost, "/v1/books/:id/tags", a.AuthMiddleware(http.HandlerFunc(a.addBookTagHandler)))
+	router.Handler(http.MethodDelete, "/v1/books/:id/tags/:tag", a.AuthMiddleware(http.HandlerFunc(a.removeBookTagHandler)))
 
 	// Routes for Reviews
-	router.HandlerFunc(http.MethodPost, "/v1/books/:id/reviews", a.createReviewHandler)   
+	router.HandlerFunc(http.MethodPost, "/v1/books/:id/reviews", a.idempotent(a.createReviewHandler))   
 	router.HandlerFunc(http.MethodGet, "/v1/books/:id/reviews/:review_id", a.displayReviewHandler)
 	router.HandlerFunc(http.MethodPatch, "/v1/books/:id/reviews/:review_id", a.updateReviewHandler)  
 	router.HandlerFunc(http.MethodDelete, "/v1/books/:id/reviews/:review_id", a.deleteReviewHandler) 
@@ -28,20 +96,39 @@ func (a *applicationDependencies) routes() http.Handler {
 	router.HandlerFunc(http.MethodGet, "/v1/books/:id/reviews", a.listBookReviewsHandler) 
 
 	// Routes for Reading Lists
-	router.HandlerFunc(http.MethodPost, "/v1/readinglists", a.createReadingListHandler)        
+	router.HandlerFunc(http.MethodPost, "/v1/readinglists", a.idempotent(a.createReadingListHandler))        
 	router.HandlerFunc(http.MethodGet, "/v1/readinglists/:id", a.displayReadingListHandler)   
 	router.HandlerFunc(http.MethodPatch, "/v1/readinglists/:id", a.updateReadingListHandler)  
 	router.HandlerFunc(http.MethodDelete, "/v1/readinglists/:id", a.deleteReadingListHandler) 
 	router.HandlerFunc(http.MethodGet, "/v1/readinglists", a.listReadingListsHandler)        
+	router.HandlerFunc(http.MethodPost, "/v1/readinglists/:id/next-volume", a.addNextSeriesVolumeHandler)
 
 	// Routes for Users
 	router.HandlerFunc(http.MethodPost, "/v1/users", a.createUserHandler)  
+	router.Handler(http.MethodGet, "/v1/users", a.AuthMiddleware(http.HandlerFunc(a.listUsersHandler)))
 	router.HandlerFunc(http.MethodPost, "/v1/login", a.loginUserHandler)  
 	router.HandlerFunc(http.MethodGet, "/v1/users/:id", a.getUserProfileHandler)        
+	router.Handler(http.MethodPatch, "/v1/users/:id", a.AuthMiddleware(http.HandlerFunc(a.updateUserHandler)))
 	router.HandlerFunc(http.MethodGet, "/v1/users/:id/lists", a.getUserReadingListsHandler) 
 	router.HandlerFunc(http.MethodGet, "/v1/users/:id/reviews", a.getUserReviewsHandler)  
 
-	return a.recoverPanic(a.rateLimit(router))
+	// Route for running several requests at once
+	router.HandlerFunc(http.MethodPost, "/v1/batch", a.batchHandler)
+
+	// Route for GraphQL queries
+	router.Handler(http.MethodPost, "/v1/graphql", a.optionalAuth(http.HandlerFunc(a.graphqlHandler)))
+
+	// Route for the OpenAPI description of these routes
+	router.HandlerFunc(http.MethodGet, "/v1/openapi.json", a.openAPIHandler)
+
+	// httprouter can't route POST /v1/books/import next to the /v1/books/:id
+	// wildcard, so that path is matched in front of it. /v1/imports/books
+	// serves the same import.
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/books/import", a.importBooksHandler)
+	mux.Handle("/", router)
+
+	return a.recoverPanic(a.rateLimit(a.negotiateContent(mux)))
 }
 
 
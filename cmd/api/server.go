@@ -5,39 +5,87 @@ import (
     "errors"
     "fmt"
     "log/slog"
+    "net"
     "net/http"
     "os"
     "os/signal"
+    "strconv"
     "syscall"
     "time"
+
+    "google.golang.org/grpc"
 )
 
 func (a *applicationDependencies) serve() error {
     apiServer := &http.Server{
         Addr:         fmt.Sprintf(":%d", a.config.port),
-        Handler:      a.routes(),
+        Handler:      a.handler(),
         IdleTimeout:  time.Minute,
         ReadTimeout:  5 * time.Second,
         WriteTimeout: 10 * time.Second,
         ErrorLog:     slog.NewLogLogger(a.logger.Handler(), slog.LevelError), // Ensure the logger conforms to log.Logger interface
     }
 
+    // The gRPC services listen on a port of their own and are shut down
+    // together with the HTTP server.
+    grpcServer, healthServer := a.grpcServer()
+    grpcListener, err := net.Listen("tcp", net.JoinHostPort(a.config.grpc.host, strconv.Itoa(a.config.grpc.port)))
+    if err != nil {
+        return err
+    }
+    grpcError := make(chan error, 1)
+
     shutdownError := make(chan error)
     go func() {
         quit := make(chan os.Signal, 1)
         signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-        s := <-quit
-        a.logger.Info("shutting down server", "signal", s.String())
+
+        // A gRPC server that fails takes the HTTP server down with it, so
+        // the process exits and can be restarted.
+        var serveErr error
+        select {
+        case s := <-quit:
+            a.logger.Info("shutting down server", "signal", s.String())
+        case serveErr = <-grpcError:
+            a.logger.Error("gRPC server failed, shutting down server", "error", serveErr)
+        }
 
         ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
         defer cancel()
 
-        shutdownError <- apiServer.Shutdown(ctx)
+        // Health checks report the services as not serving while the
+        // calls in flight finish.
+        healthServer.Shutdown()
+        grpcStopped := make(chan struct{})
+        go func() {
+            gracefulStop(ctx, grpcServer)
+            close(grpcStopped)
+        }()
+
+        err := apiServer.Shutdown(ctx)
+        <-grpcStopped
+        if err != nil {
+            shutdownError <- err
+            return
+        }
+
+        // Let background jobs such as imports finish before exiting.
+        a.logger.Info("completing background tasks", "address", apiServer.Addr)
+        a.wg.Wait()
+        shutdownError <- serveErr
+    }()
+
+    a.logger.Info("starting gRPC server", "address", grpcListener.Addr().String())
+    go func() {
+        err := grpcServer.Serve(grpcListener)
+        if err != nil {
+            grpcError <- err
+        }
     }()
 
     a.logger.Info("starting server", "address", apiServer.Addr, "environment", a.config.environment)
 
-    err := apiServer.ListenAndServe()
+    err = apiServer.ListenAndServe()
     if !errors.Is(err, http.ErrServerClosed) {
         return err
     }
@@ -52,3 +100,20 @@ func (a *applicationDependencies) serve() error {
 
     return nil
 }
+
+// gracefulStop waits for the server's calls in flight, such as exports
+// still streaming, to finish until ctx is done, then cancels the rest.
+func gracefulStop(ctx context.Context, srv *grpc.Server) {
+    stopped := make(chan struct{})
+    go func() {
+        srv.GracefulStop()
+        close(stopped)
+    }()
+
+    select {
+    case <-stopped:
+    case <-ctx.Done():
+        srv.Stop()
+        <-stopped
+    }
+}
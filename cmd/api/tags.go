@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/tchenbz/AWTtest_3/internal/data"
+	"github.com/tchenbz/AWTtest_3/internal/validator"
+)
+
+type bookTagInput struct {
+	Tag string `json:"tag"`
+}
+
+func (a *applicationDependencies) addBookTagHandler(w http.ResponseWriter, r *http.Request) {
+	bookID, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	var input bookTagInput
+
+	err = a.readJSON(w, r, &input)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	tag := data.NormalizeTag(input.Tag)
+
+	v := validator.New()
+	data.ValidateTag(v, tag)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	book, err := a.bookModel.Get(bookID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = a.tagModel.AddToBook(book.ID, a.contextGetUserID(r), tag)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	book, err = a.bookModel.Get(book.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{"book": book}
+	err = a.writeResponse(w, r, http.StatusCreated, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) removeBookTagHandler(w http.ResponseWriter, r *http.Request) {
+	bookID, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	tag := httprouter.ParamsFromContext(r.Context()).ByName("tag")
+
+	err = a.tagModel.RemoveFromBook(bookID, a.contextGetUserID(r), tag)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{"message": "tag successfully removed"}
+	err = a.writeResponse(w, r, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) listTagsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filters := data.Filters{
+		Page:         a.getSingleIntegerParameter(query, "page", 1, validator.New()),
+		PageSize:     a.getSingleIntegerParameter(query, "page_size", 20, validator.New()),
+		Sort:         "books",
+		SortSafeList: []string{"books"},
+	}
+
+	v := validator.New()
+	data.ValidateFilters(v, filters)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	tags, metadata, err := a.tagModel.GetAll(filters)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"tags":     tags,
+		"metadata": metadata,
+	}
+	err = a.writeResponse(w, r, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
@@ -36,12 +36,14 @@ func generateJWTToken(user *data.User) (string, error) {
     return signedToken, nil
 }
 
+type createUserInput struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
 func (a *applicationDependencies) createUserHandler(w http.ResponseWriter, r *http.Request) {
-    var input struct {
-        Username string `json:"username"`
-        Email    string `json:"email"`
-        Password string `json:"password"`
-    }
+    var input createUserInput
 
     // Read the incoming JSON request
     err := a.readJSON(w, r, &input)
@@ -82,7 +84,7 @@ func (a *applicationDependencies) createUserHandler(w http.ResponseWriter, r *ht
     headers.Set("Location", fmt.Sprintf("/v1/users/%d", user.ID))
 
     data := envelope{"user": user}
-    err = a.writeJSON(w, http.StatusCreated, data, headers)
+    err = a.writeResponse(w, r, http.StatusCreated, data, headers)
     if err != nil {
         a.serverErrorResponse(w, r, err)
     }
@@ -97,7 +99,14 @@ func (a *applicationDependencies) getUserProfileHandler(w http.ResponseWriter, r
         return
     }
 
-    user, err := a.userModel.Get(id)
+    v := validator.New()
+    projection := a.readProjection(r.URL.Query(), data.UserFieldSafeList, data.UserIncludeSafeList, v)
+    if !v.IsEmpty() {
+        a.failedValidationResponse(w, r, v.Errors)
+        return
+    }
+
+    user, err := a.userModel.GetProjected(id, projection)
     if err != nil {
         switch {
         case errors.Is(err, data.ErrRecordNotFound):
@@ -108,13 +117,101 @@ func (a *applicationDependencies) getUserProfileHandler(w http.ResponseWriter, r
         return
     }
 
-    data := envelope{"user": user}
-    err = a.writeJSON(w, http.StatusOK, data, nil)
+    err = a.userModel.Include([]*data.User{user}, projection)
+    if err != nil {
+        a.serverErrorResponse(w, r, err)
+        return
+    }
+
+    record, err := project(user, projection)
+    if err != nil {
+        a.serverErrorResponse(w, r, err)
+        return
+    }
+
+    data := envelope{"user": record}
+    err = a.writeResponse(w, r, http.StatusOK, data, nil)
     if err != nil {
         a.serverErrorResponse(w, r, err)
     }
 }
 
+// userSortSafeList lists the values a list of users can be sorted by.
+var userSortSafeList = []string{"id", "username", "created_at", "-id", "-username", "-created_at"}
+
+// userListFieldSafeList lists the fields a list of users may show. Email
+// addresses are left out so that the list can't be used to collect or
+// probe for them.
+var userListFieldSafeList = []string{"id", "username", "email_verified", "created_at", "version"}
+
+func (a *applicationDependencies) listUsersHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Username string
+		data.Filters
+	}
+
+	query := r.URL.Query()
+	input.Username = a.getSingleQueryParameter(query, "username", "")
+	input.Filters.Page = a.getSingleIntegerParameter(query, "page", 1, validator.New())
+	input.Filters.PageSize = a.getSingleIntegerParameter(query, "page_size", 10, validator.New())
+	input.Filters.Sort = a.getSingleQueryParameter(query, "sort", "id")
+	input.Filters.SortSafeList = userSortSafeList
+	input.Filters.FilterSafeList = map[string]data.FilterType{
+		"id":             data.FilterNumber,
+		"username":       data.FilterText,
+		"email_verified": data.FilterBool,
+		"created_at":     data.FilterTimestamp,
+	}
+
+	v := validator.New()
+	input.Filters.Conditions = a.getFilterConditions(query, v)
+	input.Filters.Projection = a.readProjection(query, userListFieldSafeList, data.UserIncludeSafeList, v)
+	data.ValidateFilters(v, input.Filters)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Without ?fields= every safe field is listed, which leaves out the
+	// email address and password hash.
+	if len(input.Filters.Projection.Fields) == 0 {
+		input.Filters.Projection.Fields = userListFieldSafeList
+	}
+
+	users, metadata, err := a.userModel.GetAll(input.Username, input.Filters)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = a.userModel.Include(users, input.Filters.Projection)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	records, err := projectAll(users, input.Filters.Projection)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"users":    records,
+		"metadata": metadata,
+	}
+	err = a.writeResponse(w, r, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+type updateUserInput struct {
+	Username *string `json:"username"`
+	Email    *string `json:"email"`
+	Password *string `json:"password"`
+}
+
 func (a *applicationDependencies) updateUserHandler(w http.ResponseWriter, r *http.Request) {
     id, err := a.readIDParam(r)
     if err != nil {
@@ -122,6 +219,11 @@ func (a *applicationDependencies) updateUserHandler(w http.ResponseWriter, r *ht
         return
     }
 
+    if id != a.contextGetUserID(r) {
+        a.errorResponseJSON(w, r, http.StatusForbidden, "you can only update your own account")
+        return
+    }
+
     user, err := a.userModel.Get(id)
     if err != nil {
         switch {
@@ -133,26 +235,52 @@ func (a *applicationDependencies) updateUserHandler(w http.ResponseWriter, r *ht
         return
     }
 
-    var input struct {
-        Username *string `json:"username"`
-        Email    *string `json:"email"`
-        Password *string `json:"password"`
-    }
-
-    err = a.readJSON(w, r, &input)
+    // A merge patch or JSON patch is applied to the user as they are now;
+    // otherwise the body lists the fields to change.
+    doc := newUserDocument(user)
+    patched, err := readPatch(a, w, r, doc)
     if err != nil {
-        a.badRequestResponse(w, r, err)
+        a.patchErrorResponse(w, r, err)
         return
     }
 
-    if input.Username != nil {
-        user.Username = *input.Username
+    var password *string
+    if patched {
+        user.Username = doc.Username
+        user.Email = doc.Email
+        if doc.Password != "" {
+            password = &doc.Password
+        }
+    } else {
+        var input updateUserInput
+
+        err = a.readJSON(w, r, &input)
+        if err != nil {
+            a.badRequestResponse(w, r, err)
+            return
+        }
+
+        if input.Username != nil {
+            user.Username = *input.Username
+        }
+        if input.Email != nil {
+            user.Email = *input.Email
+        }
+        password = input.Password
+    }
+
+    v := validator.New()
+    data.ValidateUser(v, user)
+    if password != nil {
+        v.Check(*password != "", "password", "must be provided")
     }
-    if input.Email != nil {
-        user.Email = *input.Email
+    if !v.IsEmpty() {
+        a.failedValidationResponse(w, r, v.Errors)
+        return
     }
-    if input.Password != nil {
-        hashedPassword, err := hashPassword(*input.Password)
+
+    if password != nil {
+        hashedPassword, err := hashPassword(*password)
         if err != nil {
             a.serverErrorResponse(w, r, err)
             return
@@ -167,7 +295,7 @@ func (a *applicationDependencies) updateUserHandler(w http.ResponseWriter, r *ht
     }
 
     data := envelope{"user": user}
-    err = a.writeJSON(w, http.StatusOK, data, nil)
+    err = a.writeResponse(w, r, http.StatusOK, data, nil)
     if err != nil {
         a.serverErrorResponse(w, r, err)
     }
@@ -192,17 +320,19 @@ func (a *applicationDependencies) deleteUserHandler(w http.ResponseWriter, r *ht
     }
 
     data := envelope{"message": "user successfully deleted"}
-    err = a.writeJSON(w, http.StatusOK, data, nil)
+    err = a.writeResponse(w, r, http.StatusOK, data, nil)
     if err != nil {
         a.serverErrorResponse(w, r, err)
     }
 }
 
+type loginInput struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
 func (a *applicationDependencies) loginUserHandler(w http.ResponseWriter, r *http.Request) {
-	var input struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
-	}
+	var input loginInput
 
 	// Read the login data from the request
 	err := a.readJSON(w, r, &input)
@@ -237,7 +367,7 @@ func (a *applicationDependencies) loginUserHandler(w http.ResponseWriter, r *htt
 
 	// Respond with the generated token
 	data := envelope{"token": token}
-	err = a.writeJSON(w, http.StatusOK, data, nil)
+	err = a.writeResponse(w, r, http.StatusOK, data, nil)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 	}
@@ -265,7 +395,7 @@ func (a *applicationDependencies) activateUserHandler(w http.ResponseWriter, r *
     }
 
     data := envelope{"message": "user activated"}
-    err = a.writeJSON(w, http.StatusOK, data, nil)
+    err = a.writeResponse(w, r, http.StatusOK, data, nil)
     if err != nil {
         a.serverErrorResponse(w, r, err)
     }
@@ -303,13 +433,18 @@ func (a *applicationDependencies) getUserReadingListsHandler(w http.ResponseWrit
         "readinglists": readingLists,
         "metadata":     metadata,
     }
-    err = a.writeJSON(w, http.StatusOK, data, nil)
+    err = a.writeResponse(w, r, http.StatusOK, data, nil)
     if err != nil {
         a.serverErrorResponse(w, r, err)
     }
 }
 
 func (a *applicationDependencies) getUserReviewsHandler(w http.ResponseWriter, r *http.Request) {
+    if format := a.feedFormat(r); format != "" {
+        a.userReviewsFeedHandler(w, r, format)
+        return
+    }
+
     // Get the user ID from the URL
     id, err := a.readIDParam(r)
     if err != nil {
@@ -339,7 +474,7 @@ func (a *applicationDependencies) getUserReviewsHandler(w http.ResponseWriter, r
         "reviews": reviews,
         "metadata": metadata,
     }
-    err = a.writeJSON(w, http.StatusOK, data, nil)
+    err = a.writeResponse(w, r, http.StatusOK, data, nil)
     if err != nil {
         a.serverErrorResponse(w, r, err)
     }
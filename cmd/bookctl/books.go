@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/tchenbz/AWTtest_3/internal/data"
+)
+
+// exportBatchSize is how many books export-books reads at a time.
+const exportBatchSize = 500
+
+// importBooks creates or updates books from NDJSON, one book per line in
+// the form export-books writes, matching existing books by ISBN like the
+// NDJSON import of the API. The ids in a record, of the book and of its
+// authors, genres and work, are ignored so that an export from one database
+// can be imported into another; authors are matched by name instead.
+func importBooks(c *ctl, args []string) error {
+	flags := c.flagSet("import-books")
+	path := flags.String("file", "-", "Path to the NDJSON file, or - for stdin")
+	flags.Parse(args)
+
+	in := io.Reader(os.Stdin)
+	if *path != "-" {
+		file, err := os.Open(*path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		in = file
+	}
+
+	db, err := c.open()
+	if err != nil {
+		return err
+	}
+	books := data.BookModel{DB: db}
+
+	result := &data.ImportResult{DryRun: c.dryRun, Errors: []*data.ImportRowError{}}
+	batch := make([]*data.ImportRow, 0, data.ImportBatchSize)
+
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	line := 0
+	for {
+		more := scanner.Scan()
+		if more {
+			line++
+			row, errs := parseBookRecord(line, scanner.Bytes())
+			switch {
+			case errs != nil:
+				result.Reject(line, "", errs)
+			case row != nil:
+				batch = append(batch, row)
+			}
+		}
+
+		if len(batch) == data.ImportBatchSize || (!more && len(batch) > 0) {
+			err := books.ImportBatch(batch, c.dryRun, result)
+			if err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+		if !more {
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	lines := []string{fmt.Sprintf("created %d, updated %d, skipped %d and failed %d books", result.Created, result.Updated, result.Skipped, result.Failed)}
+	for _, rowErr := range result.Errors {
+		lines = append(lines, fmt.Sprintf("line %d: %s", rowErr.Row, validationError(rowErr.Errors)))
+	}
+	return c.report("import", result, lines...)
+}
+
+// parseBookRecord returns the import row for one line of NDJSON, or nil for
+// a blank line.
+func parseBookRecord(line int, text []byte) (*data.ImportRow, map[string]string) {
+	text = bytes.TrimSpace(text)
+	if len(text) == 0 {
+		return nil, nil
+	}
+
+	var book data.Book
+	dec := json.NewDecoder(bytes.NewReader(text))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&book)
+	if err != nil {
+		return nil, map[string]string{"error": "line contains invalid JSON: " + err.Error()}
+	}
+
+	book.ID, book.Version, book.WorkID = 0, 0, 0
+	book.Genres, book.Tags, book.Series = nil, nil, nil
+	for _, author := range book.Authors {
+		author.ID = 0
+	}
+	return &data.ImportRow{Row: line, Book: &book}, nil
+}
+
+// exportResult reports what export-books wrote.
+type exportResult struct {
+	DryRun bool  `json:"dry_run"`
+	Books  int   `json:"books"`
+	LastID int64 `json:"last_id"`
+}
+
+// exportBooks writes every book as a line of JSON, in id order. A dry run
+// counts the books without writing them.
+func exportBooks(c *ctl, args []string) error {
+	flags := c.flagSet("export-books")
+	path := flags.String("file", "-", "Path to write the NDJSON to, or - for stdout")
+	flags.Parse(args)
+
+	out := io.Writer(os.Stdout)
+	switch {
+	case c.dryRun:
+		out = io.Discard
+	case *path != "-":
+		file, err := os.Create(*path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	default:
+		// The books take up stdout.
+		c.out = os.Stderr
+	}
+
+	db, err := c.open()
+	if err != nil {
+		return err
+	}
+	books := data.BookModel{DB: db}
+
+	w := bufio.NewWriter(out)
+	enc := json.NewEncoder(w)
+	result := exportResult{DryRun: c.dryRun}
+	for {
+		batch, err := books.GetAfter(result.LastID, exportBatchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, book := range batch {
+			err := enc.Encode(book)
+			if err != nil {
+				return err
+			}
+			result.Books++
+			result.LastID = book.ID
+		}
+
+		if len(batch) < exportBatchSize {
+			break
+		}
+	}
+
+	err = w.Flush()
+	if err != nil {
+		return err
+	}
+	return c.report("export", result, fmt.Sprintf("exported %d books", result.Books))
+}
+
+// ratingsResult reports the ratings recompute-ratings changed.
+type ratingsResult struct {
+	DryRun  bool                 `json:"dry_run"`
+	Changes []*data.RatingChange `json:"changes"`
+}
+
+func recomputeRatings(c *ctl, args []string) error {
+	flags := c.flagSet("recompute-ratings")
+	bookID := flags.Int64("book-id", 0, "Only recompute the rating of this book")
+	flags.Parse(args)
+
+	result := ratingsResult{DryRun: c.dryRun}
+	err := c.run(func(m models) error {
+		var err error
+		result.Changes, err = m.books.RecomputeRatings(*bookID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	lines := []string{fmt.Sprintf("changed the rating of %d books", len(result.Changes))}
+	for _, change := range result.Changes {
+		lines = append(lines, fmt.Sprintf("book %d: %.2f -> %.2f", change.BookID, change.Old, change.New))
+	}
+	return c.report("ratings", result, lines...)
+}
+
+// mergeResult reports what merge-books merged.
+type mergeResult struct {
+	DryRun bool `json:"dry_run"`
+	*data.MergeResult
+}
+
+func mergeBooks(c *ctl, args []string) error {
+	flags := c.flagSet("merge-books")
+	into := flags.Int64("into", 0, "Id of the book to keep")
+	duplicates := flags.String("duplicates", "", "Comma-separated ids of the books to merge into it and delete")
+	flags.Parse(args)
+
+	var ids []int64
+	for _, field := range strings.Split(*duplicates, ",") {
+		if strings.TrimSpace(field) == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(strings.TrimSpace(field), 10, 64)
+		if err != nil || id < 1 {
+			return fmt.Errorf("-duplicates must be a comma-separated list of book ids")
+		}
+		ids = append(ids, id)
+	}
+	if *into < 1 || len(ids) == 0 {
+		return errors.New("-into and -duplicates are required")
+	}
+
+	result := mergeResult{DryRun: c.dryRun}
+	err := c.run(func(m models) error {
+		var err error
+		result.MergeResult, err = m.books.Merge(*into, ids)
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return errors.New("the book and its duplicates must all exist")
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.report("merge", result, fmt.Sprintf("merged %d books into book %d, moving %d reviews, %d reading list entries and %d tags",
+		len(result.Merged), result.Into, result.Reviews, result.ReadingLists, result.Tags))
+}
@@ -0,0 +1,31 @@
+package main
+
+import "fmt"
+
+// purgeResult reports how many expired idempotency keys
+// purge-idempotency-keys deleted.
+type purgeResult struct {
+	DryRun  bool  `json:"dry_run"`
+	Deleted int64 `json:"deleted"`
+}
+
+// purgeIdempotencyKeys deletes the idempotency keys whose responses are no
+// longer replayed. There are no auth tokens to purge alongside them: the
+// tokens handed out at login are stateless JWTs that are never stored and
+// expire by themselves.
+func purgeIdempotencyKeys(c *ctl, args []string) error {
+	flags := c.flagSet("purge-idempotency-keys")
+	flags.Parse(args)
+
+	result := purgeResult{DryRun: c.dryRun}
+	err := c.run(func(m models) error {
+		var err error
+		result.Deleted, err = m.idempotency.DeleteExpired()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.report("idempotency_keys", result, fmt.Sprintf("deleted %d expired idempotency keys", result.Deleted))
+}
@@ -0,0 +1,188 @@
+// Command bookctl runs administrative tasks against the database with the
+// same models as the API, so that they don't need raw SQL.
+//
+// Usage:
+//
+//	bookctl [-db-dsn DSN] COMMAND [-dry-run] [-json] [flags]
+//
+// Every command accepts -dry-run, which runs it against the database and
+// reports what it did but rolls it back, and -json, which reports the
+// outcome as JSON on stdout instead of as text. Run a command with -h for
+// its flags.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/tchenbz/AWTtest_3/internal/data"
+)
+
+// command is a subcommand of bookctl.
+type command struct {
+	name    string
+	summary string
+	run     func(c *ctl, args []string) error
+}
+
+var commands = []command{
+	{"create-user", "create a user", createUser},
+	{"verify-email", "mark a user's email address as verified", verifyEmail},
+	{"grant-role", "grant a user a role", grantRole},
+	{"revoke-role", "take a role away from a user", revokeRole},
+	{"import-books", "create or update books from NDJSON", importBooks},
+	{"export-books", "write every book as NDJSON", exportBooks},
+	{"recompute-ratings", "recompute average ratings from reviews", recomputeRatings},
+	{"merge-books", "merge duplicate books into one", mergeBooks},
+	{"purge-idempotency-keys", "delete expired idempotency keys", purgeIdempotencyKeys},
+}
+
+func main() {
+	flags := flag.NewFlagSet("bookctl", flag.ExitOnError)
+	dsn := flags.String("db-dsn", os.Getenv("TEST3_DB_DSN"), "PostgreSQL DSN")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: bookctl [-db-dsn DSN] COMMAND [-dry-run] [-json] [flags]")
+		fmt.Fprintln(flags.Output(), "\ncommands:")
+		for _, cmd := range commands {
+			fmt.Fprintf(flags.Output(), "  %-23s %s\n", cmd.name, cmd.summary)
+		}
+		fmt.Fprintln(flags.Output())
+		flags.PrintDefaults()
+	}
+	flags.Parse(os.Args[1:])
+
+	if flags.NArg() < 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	c := &ctl{dsn: *dsn, out: os.Stdout}
+	defer c.close()
+
+	for _, cmd := range commands {
+		if cmd.name != flags.Arg(0) {
+			continue
+		}
+		err := cmd.run(c, flags.Args()[1:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "bookctl %s: %s\n", cmd.name, err)
+			c.close()
+			os.Exit(1)
+		}
+		return
+	}
+
+	flags.Usage()
+	os.Exit(2)
+}
+
+// ctl holds what the commands share: the database, opened on first use, and
+// the -dry-run and -json flags of the command being run.
+type ctl struct {
+	dsn    string
+	db     *sql.DB
+	dryRun bool
+	json   bool
+	out    io.Writer
+}
+
+// models are the models a command works with.
+type models struct {
+	books       data.BookModel
+	users       data.UserModel
+	idempotency data.IdempotencyModel
+}
+
+func newModels(db data.Queryer) models {
+	return models{
+		books:       data.BookModel{DB: db},
+		users:       data.UserModel{DB: db},
+		idempotency: data.IdempotencyModel{DB: db},
+	}
+}
+
+// flagSet returns the flags of a command, including -dry-run and -json.
+func (c *ctl) flagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.BoolVar(&c.dryRun, "dry-run", false, "Report what would change without writing anything")
+	flags.BoolVar(&c.json, "json", false, "Report the outcome as JSON")
+	return flags
+}
+
+func (c *ctl) open() (*sql.DB, error) {
+	if c.db != nil {
+		return c.db, nil
+	}
+
+	db, err := sql.Open("postgres", c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = db.PingContext(ctx)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	c.db = db
+	return db, nil
+}
+
+func (c *ctl) close() {
+	if c.db != nil {
+		c.db.Close()
+		c.db = nil
+	}
+}
+
+// run calls fn with models whose statements all run in one transaction. The
+// transaction is committed when fn succeeds, unless this is a dry run.
+func (c *ctl) run(fn func(m models) error) error {
+	db, err := c.open()
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.BeginTx(context.Background(), nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = fn(newModels(tx))
+	if err != nil || c.dryRun {
+		return err
+	}
+	return tx.Commit()
+}
+
+// report writes the outcome of a command: as {name: result} with -json,
+// and as lines of text otherwise. The first line of a dry run's text says
+// so.
+func (c *ctl) report(name string, result any, lines ...string) error {
+	if c.json {
+		enc := json.NewEncoder(c.out)
+		enc.SetIndent("", "\t")
+		return enc.Encode(map[string]any{name: result})
+	}
+
+	for i, line := range lines {
+		if i == 0 && c.dryRun {
+			line = "dry run: " + line
+		}
+		_, err := fmt.Fprintln(c.out, line)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/tchenbz/AWTtest_3/internal/data"
+	"github.com/tchenbz/AWTtest_3/internal/validator"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// userResult reports a user a command created or changed. The password
+// hash is blanked.
+type userResult struct {
+	DryRun  bool       `json:"dry_run"`
+	Changed bool       `json:"changed"`
+	User    *data.User `json:"user"`
+}
+
+// roleResult reports the roles of a user after granting or revoking one.
+type roleResult struct {
+	DryRun  bool     `json:"dry_run"`
+	Changed bool     `json:"changed"`
+	UserID  int64    `json:"user_id"`
+	Role    string   `json:"role"`
+	Roles   []string `json:"roles"`
+}
+
+// validationError reports the fields a validator found invalid.
+func validationError(errs map[string]string) error {
+	var msgs []string
+	for _, field := range slices.Sorted(maps.Keys(errs)) {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", field, errs[field]))
+	}
+	return errors.New(strings.Join(msgs, "; "))
+}
+
+func createUser(c *ctl, args []string) error {
+	flags := c.flagSet("create-user")
+	username := flags.String("username", "", "Username")
+	email := flags.String("email", "", "Email address")
+	password := flags.String("password", "", "Password")
+	verified := flags.Bool("verified", false, "Mark the email address as verified")
+	flags.Parse(args)
+
+	user := &data.User{Username: *username, Email: *email, EmailVerified: *verified}
+
+	v := validator.New()
+	data.ValidateUser(v, user)
+	v.Check(*password != "", "password", "must be provided")
+	v.Check(len(*password) <= 72, "password", "must not be more than 72 bytes long")
+	if !v.IsEmpty() {
+		return validationError(v.Errors)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(*password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	user.Password = string(hash)
+
+	err = c.run(func(m models) error {
+		_, err := m.users.GetByEmail(user.Email)
+		switch {
+		case err == nil:
+			return fmt.Errorf("a user with the email address %s already exists", user.Email)
+		case !errors.Is(err, data.ErrRecordNotFound):
+			return err
+		}
+		return m.users.Insert(user)
+	})
+	if err != nil {
+		return err
+	}
+
+	user.Password = ""
+	return c.report("user", userResult{DryRun: c.dryRun, Changed: true, User: user}, fmt.Sprintf("created user %d (%s)", user.ID, user.Email))
+}
+
+// lookupUser finds a user by id or, when id is zero, by email address.
+func lookupUser(m models, id int64, email string) (*data.User, error) {
+	var user *data.User
+	var err error
+	if id != 0 {
+		user, err = m.users.Get(id)
+	} else {
+		user, err = m.users.GetByEmail(email)
+	}
+	if errors.Is(err, data.ErrRecordNotFound) {
+		return nil, errors.New("no such user")
+	}
+	return user, err
+}
+
+func verifyEmail(c *ctl, args []string) error {
+	flags := c.flagSet("verify-email")
+	id := flags.Int64("user-id", 0, "Id of the user")
+	email := flags.String("email", "", "Email address of the user, when -user-id isn't given")
+	flags.Parse(args)
+
+	if (*id == 0) == (*email == "") {
+		return errors.New("one of -user-id or -email is required")
+	}
+
+	var user *data.User
+	changed := false
+	err := c.run(func(m models) error {
+		var err error
+		user, err = lookupUser(m, *id, *email)
+		if err != nil || user.EmailVerified {
+			return err
+		}
+
+		user.EmailVerified = true
+		changed = true
+		return m.users.Update(user)
+	})
+	if err != nil {
+		return err
+	}
+
+	user.Password = ""
+	result := userResult{DryRun: c.dryRun, Changed: changed, User: user}
+	if !changed {
+		return c.report("user", result, fmt.Sprintf("the email address of user %d (%s) is already verified", user.ID, user.Email))
+	}
+	return c.report("user", result, fmt.Sprintf("verified the email address of user %d (%s)", user.ID, user.Email))
+}
+
+func grantRole(c *ctl, args []string) error {
+	return changeRole(c, "grant-role", args, (*data.UserModel).GrantRole)
+}
+
+func revokeRole(c *ctl, args []string) error {
+	return changeRole(c, "revoke-role", args, (*data.UserModel).RevokeRole)
+}
+
+// changeRole runs grant-role and revoke-role, which differ only in the
+// change they make.
+func changeRole(c *ctl, name string, args []string, change func(m *data.UserModel, userID int64, role string) (bool, error)) error {
+	flags := c.flagSet(name)
+	id := flags.Int64("user-id", 0, "Id of the user")
+	email := flags.String("email", "", "Email address of the user, when -user-id isn't given")
+	role := flags.String("role", "", "Role: "+strings.Join(data.Roles, ", "))
+	flags.Parse(args)
+
+	v := validator.New()
+	v.Check((*id == 0) != (*email == ""), "user", "must be given by one of -user-id or -email")
+	data.ValidateRole(v, *role)
+	if !v.IsEmpty() {
+		return validationError(v.Errors)
+	}
+
+	result := roleResult{DryRun: c.dryRun, Role: *role}
+	err := c.run(func(m models) error {
+		user, err := lookupUser(m, *id, *email)
+		if err != nil {
+			return err
+		}
+		result.UserID = user.ID
+
+		result.Changed, err = change(&m.users, user.ID, *role)
+		if err != nil {
+			return err
+		}
+
+		result.Roles, err = m.users.GetRoles(user.ID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case !result.Changed && name == "grant-role":
+		return c.report("roles", result, fmt.Sprintf("user %d already has the %s role", result.UserID, *role))
+	case !result.Changed:
+		return c.report("roles", result, fmt.Sprintf("user %d doesn't have the %s role", result.UserID, *role))
+	}
+	roles := strings.Join(result.Roles, ", ")
+	if roles == "" {
+		roles = "none"
+	}
+	return c.report("roles", result, fmt.Sprintf("user %d now has the roles: %s", result.UserID, roles))
+}
@@ -0,0 +1,188 @@
+// Command import loads books from external catalogs into the database.
+//
+// Usage:
+//
+//	import [-db-dsn DSN] calibre -library PATH [-user-id ID] [-dry-run]
+//	import [-db-dsn DSN] onix -file PATH [-dry-run]
+//
+// The result of the import is written to stdout as JSON.
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/tchenbz/AWTtest_3/internal/calibre"
+	"github.com/tchenbz/AWTtest_3/internal/data"
+	"github.com/tchenbz/AWTtest_3/internal/onix"
+)
+
+func main() {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	dsn := flags.String("db-dsn", os.Getenv("TEST3_DB_DSN"), "PostgreSQL DSN")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: import [-db-dsn DSN] calibre -library PATH [-user-id ID] [-dry-run]")
+		fmt.Fprintln(flags.Output(), "       import [-db-dsn DSN] onix -file PATH [-dry-run]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(os.Args[1:])
+
+	if flags.NArg() < 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	var err error
+	switch flags.Arg(0) {
+	case "calibre":
+		err = importCalibre(*dsn, flags.Args()[1:])
+	case "onix":
+		err = importONIX(*dsn, flags.Args()[1:])
+	default:
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "import:", err)
+		os.Exit(1)
+	}
+}
+
+// importCalibre imports a Calibre library. Books are matched on their
+// Calibre uuid and then on ISBN, so running it again only applies what
+// changed in the library since the last run.
+func importCalibre(dsn string, args []string) error {
+	flags := flag.NewFlagSet("calibre", flag.ExitOnError)
+	library := flags.String("library", "", "Path to the Calibre library directory or its metadata.db")
+	userID := flags.Int64("user-id", 0, "User to attribute Calibre tags to (tags are skipped if unset)")
+	dryRun := flags.Bool("dry-run", false, "Report what would change without writing anything")
+	flags.Parse(args)
+
+	if *library == "" {
+		return fmt.Errorf("-library is required")
+	}
+
+	lib, err := calibre.Open(*library)
+	if err != nil {
+		return err
+	}
+	defer lib.Close()
+
+	rows, err := lib.Books(*userID)
+	if err != nil {
+		return err
+	}
+
+	result := &data.ImportResult{DryRun: *dryRun, Errors: []*data.ImportRowError{}}
+
+	i := 0
+	return importRows(dsn, func() (*data.ImportRow, error) {
+		if i == len(rows) {
+			return nil, io.EOF
+		}
+		i++
+		return rows[i-1], nil
+	}, result)
+}
+
+// importONIX imports the products of an ONIX 3.0 message, reporting the
+// outcome of each one. The file is read one product at a time.
+func importONIX(dsn string, args []string) error {
+	flags := flag.NewFlagSet("onix", flag.ExitOnError)
+	path := flags.String("file", "", "Path to the ONIX 3.0 XML file")
+	dryRun := flags.Bool("dry-run", false, "Report what would change without writing anything")
+	flags.Parse(args)
+
+	if *path == "" {
+		return fmt.Errorf("-file is required")
+	}
+
+	file, err := os.Open(*path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	result := &data.ImportResult{DryRun: *dryRun, Errors: []*data.ImportRowError{}, Report: true}
+	reader := onix.NewReader(bufio.NewReader(file))
+
+	n := 0
+	return importRows(dsn, func() (*data.ImportRow, error) {
+		for {
+			product, err := reader.Next()
+			if err != nil {
+				return nil, err
+			}
+			n++
+
+			row := product.ImportRow(n)
+			if !product.Deleted() {
+				return row, nil
+			}
+			result.Ignore(row, "deletion notices are not applied")
+		}
+	}, result)
+}
+
+// importRows writes the rows returned by next in batches and prints the
+// result. next returns io.EOF after the last row.
+func importRows(dsn string, next func() (*data.ImportRow, error), result *data.ImportResult) error {
+	db, err := openDB(dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	books := data.BookModel{DB: db}
+	batch := make([]*data.ImportRow, 0, data.ImportBatchSize)
+
+	for {
+		row, err := next()
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		if row != nil {
+			batch = append(batch, row)
+		}
+
+		if len(batch) == data.ImportBatchSize || (errors.Is(err, io.EOF) && len(batch) > 0) {
+			importErr := books.ImportBatch(batch, result.DryRun, result)
+			if importErr != nil {
+				return importErr
+			}
+			batch = batch[:0]
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "\t")
+	return enc.Encode(map[string]any{"import": result})
+}
+
+func openDB(dsn string) (*sql.DB, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = db.PingContext(ctx)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
@@ -0,0 +1,190 @@
+// Package calibre reads book metadata from a Calibre library database
+// (metadata.db) and maps it onto the data package's import rows.
+package calibre
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"html"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/tchenbz/AWTtest_3/internal/data"
+	_ "modernc.org/sqlite"
+)
+
+// Source is the book_sources.source value for books imported from Calibre.
+// Books are identified by the uuid Calibre assigns them.
+const Source = "calibre"
+
+var htmlTag = regexp.MustCompile(`<[^>]*>`)
+
+// Library is an open Calibre metadata.db.
+type Library struct {
+	db *sql.DB
+}
+
+// Open opens the metadata.db at path read-only. path may also be the
+// library directory that contains it.
+func Open(path string) (*Library, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		path = strings.TrimSuffix(path, "/") + "/metadata.db"
+	}
+
+	db, err := sql.Open("sqlite", "file:"+path+"?mode=ro&_pragma=query_only(1)")
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Fail early if this isn't a Calibre database.
+	var count int
+	err = db.QueryRowContext(ctx, `SELECT COUNT(*) FROM books`).Scan(&count)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%s is not a Calibre library: %w", path, err)
+	}
+
+	return &Library{db: db}, nil
+}
+
+func (l *Library) Close() error {
+	return l.db.Close()
+}
+
+// Books returns every book in the library as an import row. Tags are
+// attributed to taggedBy; pass 0 to leave them out.
+func (l *Library) Books(taggedBy int64) ([]*data.ImportRow, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	query := `
+		SELECT b.id, b.uuid, b.title, b.pubdate, b.series_index,
+			COALESCE((SELECT val FROM identifiers WHERE book = b.id AND type = 'isbn'), b.isbn, ''),
+			COALESCE((SELECT text FROM comments WHERE book = b.id), ''),
+			COALESCE((SELECT p.name FROM books_publishers_link bp JOIN publishers p ON p.id = bp.publisher WHERE bp.book = b.id), ''),
+			COALESCE((SELECT l.lang_code FROM books_languages_link bl JOIN languages l ON l.id = bl.lang_code WHERE bl.book = b.id ORDER BY bl.item_order LIMIT 1), ''),
+			COALESCE((SELECT s.name FROM books_series_link bs JOIN series s ON s.id = bs.series WHERE bs.book = b.id), '')
+		FROM books b
+		ORDER BY b.id`
+
+	rows, err := l.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var importRows []*data.ImportRow
+	byCalibreID := map[int64]*data.ImportRow{}
+
+	for rows.Next() {
+		var id int64
+		var uuid, title, pubdate, isbn, comments, publisher, language, series string
+		var seriesIndex float64
+
+		err := rows.Scan(&id, &uuid, &title, &pubdate, &seriesIndex, &isbn, &comments, &publisher, &language, &series)
+		if err != nil {
+			return nil, err
+		}
+
+		row := &data.ImportRow{
+			Row:      len(importRows) + 1,
+			Source:   Source,
+			SourceID: uuid,
+			TaggedBy: taggedBy,
+			Book: &data.Book{
+				Title:           title,
+				ISBN:            isbn,
+				PublicationDate: publicationDate(pubdate),
+				Description:     description(comments),
+				Publisher:       publisher,
+				Language:        language,
+				Authors:         []*data.BookAuthor{},
+			},
+		}
+		if series != "" {
+			row.Series = series
+			row.SeriesPosition = seriesIndex
+		}
+
+		importRows = append(importRows, row)
+		byCalibreID[id] = row
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = l.eachLink(ctx, `
+		SELECT ba.book, a.name
+		FROM books_authors_link ba
+		JOIN authors a ON a.id = ba.author
+		ORDER BY ba.book, ba.id`, func(row *data.ImportRow, name string) {
+		row.Book.Authors = append(row.Book.Authors, &data.BookAuthor{Name: name, Role: "author"})
+	}, byCalibreID)
+	if err != nil {
+		return nil, err
+	}
+
+	if taggedBy > 0 {
+		err = l.eachLink(ctx, `
+			SELECT bt.book, t.name
+			FROM books_tags_link bt
+			JOIN tags t ON t.id = bt.tag
+			ORDER BY bt.book, t.name`, func(row *data.ImportRow, name string) {
+			row.Tags = append(row.Tags, name)
+		}, byCalibreID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return importRows, nil
+}
+
+// eachLink runs a query returning (calibre book id, value) pairs and hands
+// each value to fn along with the row for that book.
+func (l *Library) eachLink(ctx context.Context, query string, fn func(*data.ImportRow, string), byCalibreID map[int64]*data.ImportRow) error {
+	rows, err := l.db.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var bookID int64
+		var value string
+		if err := rows.Scan(&bookID, &value); err != nil {
+			return err
+		}
+		if row, ok := byCalibreID[bookID]; ok {
+			fn(row, value)
+		}
+	}
+
+	return rows.Err()
+}
+
+// publicationDate turns Calibre's pubdate into YYYY-MM-DD. Calibre stores
+// an unknown date as the year 101, which becomes an empty date.
+func publicationDate(pubdate string) string {
+	if len(pubdate) < 10 || strings.HasPrefix(pubdate, "0101-") {
+		return ""
+	}
+	return pubdate[:10]
+}
+
+// description converts Calibre's HTML comments to plain text.
+func description(comments string) string {
+	text := strings.NewReplacer("</p>", "\n\n", "<br>", "\n", "<br/>", "\n", "<br />", "\n").Replace(comments)
+	text = html.UnescapeString(htmlTag.ReplaceAllString(text, ""))
+	return strings.TrimSpace(text)
+}
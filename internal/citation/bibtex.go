@@ -0,0 +1,128 @@
+package citation
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/tchenbz/AWTtest_3/internal/data"
+)
+
+func init() {
+	Register("bibtex", bibTeX{})
+}
+
+// bibTeX writes one @book entry per book. Keys are built from the first
+// author's family name, the year and the first word of the title, with a
+// letter appended when two books would share a key.
+type bibTeX struct{}
+
+func (bibTeX) MediaType() string { return "application/x-bibtex" }
+func (bibTeX) Extension() string { return "bib" }
+
+func (bibTeX) Encode(w io.Writer, books []*data.Book) error {
+	bw := bufio.NewWriter(w)
+	keys := map[string]int{}
+
+	for i, book := range books {
+		if i > 0 {
+			bw.WriteString("\n")
+		}
+
+		key := bibTeXKey(book)
+		keys[key]++
+		if n := keys[key]; n > 1 {
+			key += string(rune('a' + n - 2))
+		}
+
+		fmt.Fprintf(bw, "@book{%s,\n", key)
+		field := func(name, value string) {
+			if value != "" {
+				fmt.Fprintf(bw, "  %s = {%s},\n", name, bibTeXEscape(value))
+			}
+		}
+
+		field("title", book.Title)
+		field("author", bibTeXNames(contributors(book, "author")))
+		field("translator", bibTeXNames(contributors(book, "translator")))
+		field("illustrator", bibTeXNames(contributors(book, "illustrator")))
+		if parts := dateParts(book.PublicationDate); len(parts) > 0 {
+			field("year", strconv.Itoa(parts[0]))
+			if len(parts) > 1 {
+				field("month", strconv.Itoa(parts[1]))
+			}
+		}
+		field("publisher", book.Publisher)
+		field("isbn", book.ISBN)
+		field("language", book.Language)
+		if book.PageCount > 0 {
+			field("pagetotal", strconv.Itoa(book.PageCount))
+		}
+		bw.WriteString("}\n")
+	}
+
+	return bw.Flush()
+}
+
+func bibTeXKey(book *data.Book) string {
+	var key strings.Builder
+	if authors := contributors(book, "author"); len(authors) > 0 {
+		key.WriteString(keyWord(authors[0].Family))
+	}
+	if parts := dateParts(book.PublicationDate); len(parts) > 0 {
+		key.WriteString(strconv.Itoa(parts[0]))
+	}
+	for _, word := range strings.Fields(book.Title) {
+		if word = keyWord(word); word != "" {
+			key.WriteString(word)
+			break
+		}
+	}
+	if key.Len() == 0 {
+		return "book" + strconv.FormatInt(book.ID, 10)
+	}
+	return key.String()
+}
+
+// keyWord lower-cases s and drops everything but ASCII letters and digits,
+// which are all a BibTeX key can safely contain.
+func keyWord(s string) string {
+	return strings.Map(func(r rune) rune {
+		r = unicode.ToLower(r)
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return -1
+	}, s)
+}
+
+func bibTeXNames(names []name) string {
+	formatted := make([]string, len(names))
+	for i, n := range names {
+		formatted[i] = n.Family
+		if n.Given != "" {
+			formatted[i] += ", " + n.Given
+		}
+	}
+	return strings.Join(formatted, " and ")
+}
+
+var bibTeXEscaper = strings.NewReplacer(
+	`\`, `\textbackslash{}`,
+	"{", `\{`,
+	"}", `\}`,
+	"&", `\&`,
+	"%", `\%`,
+	"$", `\$`,
+	"#", `\#`,
+	"_", `\_`,
+	"~", `\textasciitilde{}`,
+	"^", `\textasciicircum{}`,
+)
+
+func bibTeXEscape(s string) string {
+	return bibTeXEscaper.Replace(strings.Join(strings.Fields(s), " "))
+}
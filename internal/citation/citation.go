@@ -0,0 +1,119 @@
+// Package citation renders books as bibliographic citations. Each format is
+// an Encoder registered under a short name, so adding a format means adding
+// a file that calls Register from its init function.
+package citation
+
+import (
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/tchenbz/AWTtest_3/internal/data"
+)
+
+// Encoder writes books in one citation format.
+type Encoder interface {
+	// MediaType is the Content-Type of the encoded books.
+	MediaType() string
+	// Extension is the usual file extension for the format, without a dot.
+	Extension() string
+	Encode(w io.Writer, books []*data.Book) error
+}
+
+var (
+	mu       sync.RWMutex
+	encoders = map[string]Encoder{}
+)
+
+// Register makes an encoder available under name. Registering the same name
+// twice replaces the earlier encoder.
+func Register(name string, enc Encoder) {
+	mu.Lock()
+	defer mu.Unlock()
+	encoders[name] = enc
+}
+
+// Lookup returns the encoder registered under name.
+func Lookup(name string) (Encoder, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	enc, ok := encoders[name]
+	return enc, ok
+}
+
+// ForMediaType returns the encoder whose media type is mediaType.
+func ForMediaType(mediaType string) (Encoder, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, enc := range encoders {
+		if strings.EqualFold(enc.MediaType(), mediaType) {
+			return enc, true
+		}
+	}
+	return nil, false
+}
+
+// Formats returns the names of the registered encoders in sorted order.
+func Formats() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(encoders))
+	for name := range encoders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// name is a person's name split into family and given names.
+type name struct {
+	Family string
+	Given  string
+}
+
+// splitName splits a display name. "Le Guin, Ursula K." is taken as family
+// name first; otherwise the last word is the family name. A single word is
+// returned as the family name with no given name.
+func splitName(full string) name {
+	full = strings.TrimSpace(full)
+	if family, given, ok := strings.Cut(full, ","); ok {
+		return name{Family: strings.TrimSpace(family), Given: strings.TrimSpace(given)}
+	}
+	i := strings.LastIndex(full, " ")
+	if i < 0 {
+		return name{Family: full}
+	}
+	return name{Family: full[i+1:], Given: strings.TrimSpace(full[:i])}
+}
+
+// contributors returns the names of the book's authors with the given role.
+func contributors(book *data.Book, role string) []name {
+	names := []name{}
+	for _, author := range book.Authors {
+		if author.Role == role || (role == "author" && author.Role == "") {
+			names = append(names, splitName(author.Name))
+		}
+	}
+	return names
+}
+
+// dateParts splits a YYYY-MM-DD publication date into its numeric parts,
+// dropping any that are missing or malformed.
+func dateParts(date string) []int {
+	parts := []int{}
+	for _, field := range strings.SplitN(date, "-", 3) {
+		n := 0
+		for _, c := range field {
+			if c < '0' || c > '9' {
+				return parts
+			}
+			n = n*10 + int(c-'0')
+		}
+		if field == "" || n == 0 {
+			return parts
+		}
+		parts = append(parts, n)
+	}
+	return parts
+}
@@ -0,0 +1,91 @@
+package citation
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+
+	"github.com/tchenbz/AWTtest_3/internal/data"
+)
+
+func init() {
+	Register("csl-json", cslJSON{})
+}
+
+// cslJSON writes the books as an array of CSL-JSON items, the input format
+// of citeproc processors.
+type cslJSON struct{}
+
+func (cslJSON) MediaType() string { return "application/vnd.citationstyles.csl+json" }
+func (cslJSON) Extension() string { return "json" }
+
+type cslName struct {
+	Family  string `json:"family,omitempty"`
+	Given   string `json:"given,omitempty"`
+	Literal string `json:"literal,omitempty"`
+}
+
+type cslDate struct {
+	DateParts [][]int `json:"date-parts"`
+}
+
+type cslItem struct {
+	ID          string    `json:"id"`
+	Type        string    `json:"type"`
+	Title       string    `json:"title"`
+	Author      []cslName `json:"author,omitempty"`
+	Translator  []cslName `json:"translator,omitempty"`
+	Illustrator []cslName `json:"illustrator,omitempty"`
+	Issued      *cslDate  `json:"issued,omitempty"`
+	Publisher   string    `json:"publisher,omitempty"`
+	ISBN        string    `json:"ISBN,omitempty"`
+	Language    string    `json:"language,omitempty"`
+	Pages       string    `json:"number-of-pages,omitempty"`
+	Abstract    string    `json:"abstract,omitempty"`
+}
+
+func (cslJSON) Encode(w io.Writer, books []*data.Book) error {
+	items := make([]cslItem, len(books))
+
+	for i, book := range books {
+		item := cslItem{
+			ID:          "book-" + strconv.FormatInt(book.ID, 10),
+			Type:        "book",
+			Title:       book.Title,
+			Author:      cslNames(contributors(book, "author")),
+			Translator:  cslNames(contributors(book, "translator")),
+			Illustrator: cslNames(contributors(book, "illustrator")),
+			Publisher:   book.Publisher,
+			ISBN:        book.ISBN,
+			Language:    book.Language,
+			Abstract:    book.Description,
+		}
+		if parts := dateParts(book.PublicationDate); len(parts) > 0 {
+			item.Issued = &cslDate{DateParts: [][]int{parts}}
+		}
+		if book.PageCount > 0 {
+			item.Pages = strconv.Itoa(book.PageCount)
+		}
+		items[i] = item
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(items)
+}
+
+func cslNames(names []name) []cslName {
+	if len(names) == 0 {
+		return nil
+	}
+	converted := make([]cslName, len(names))
+	for i, n := range names {
+		if n.Given == "" {
+			converted[i] = cslName{Literal: n.Family}
+		} else {
+			converted[i] = cslName{Family: n.Family, Given: n.Given}
+		}
+	}
+	return converted
+}
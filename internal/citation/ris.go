@@ -0,0 +1,67 @@
+package citation
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/tchenbz/AWTtest_3/internal/data"
+)
+
+func init() {
+	Register("ris", ris{})
+}
+
+// ris writes one BOOK record per book in the RIS tagged format read by
+// reference managers such as Zotero and EndNote.
+type ris struct{}
+
+func (ris) MediaType() string { return "application/x-research-info-systems" }
+func (ris) Extension() string { return "ris" }
+
+func (ris) Encode(w io.Writer, books []*data.Book) error {
+	bw := bufio.NewWriter(w)
+
+	for _, book := range books {
+		tag := func(tag, value string) {
+			value = strings.Join(strings.Fields(value), " ")
+			if value != "" {
+				fmt.Fprintf(bw, "%s  - %s\r\n", tag, value)
+			}
+		}
+
+		tag("TY", "BOOK")
+		tag("TI", book.Title)
+		for _, author := range contributors(book, "author") {
+			tag("AU", risName(author))
+		}
+		for _, translator := range contributors(book, "translator") {
+			tag("A4", risName(translator))
+		}
+		if parts := dateParts(book.PublicationDate); len(parts) > 0 {
+			tag("PY", strconv.Itoa(parts[0]))
+			if len(parts) == 3 {
+				tag("DA", fmt.Sprintf("%04d/%02d/%02d/", parts[0], parts[1], parts[2]))
+			}
+		}
+		tag("PB", book.Publisher)
+		tag("SN", book.ISBN)
+		tag("LA", book.Language)
+		if book.PageCount > 0 {
+			tag("SP", strconv.Itoa(book.PageCount))
+		}
+		tag("AB", book.Description)
+		bw.WriteString("ER  - \r\n")
+	}
+
+	return bw.Flush()
+}
+
+func risName(n name) string {
+	if n.Given == "" {
+		return n.Family
+	}
+	return n.Family + ", " + n.Given
+}
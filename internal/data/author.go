@@ -0,0 +1,361 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/lib/pq"
+	"github.com/tchenbz/AWTtest_3/internal/validator"
+)
+
+var (
+	ErrDuplicateAuthor = errors.New("an author with this name already exists")
+	ErrUnknownAuthor   = errors.New("unknown author")
+)
+
+// AuthorRoles lists the contributor roles an author can have on a book.
+var AuthorRoles = []string{"author", "translator", "illustrator"}
+
+type Author struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Bio       string    `json:"bio"`
+	CreatedAt time.Time `json:"created_at"`
+	Version   int32     `json:"version"`
+}
+
+// BookAuthor is an author as credited on a particular book.
+type BookAuthor struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+// UnmarshalJSON accepts either a plain name ("Ursula K. Le Guin") or an
+// object with an id and/or name and an optional role, so clients that still
+// send the old array of strings keep working.
+func (ba *BookAuthor) UnmarshalJSON(b []byte) error {
+	var name string
+	if err := json.Unmarshal(b, &name); err == nil {
+		*ba = BookAuthor{Name: name, Role: "author"}
+		return nil
+	}
+
+	var input struct {
+		ID   int64  `json:"id"`
+		Name string `json:"name"`
+		Role string `json:"role"`
+	}
+	if err := json.Unmarshal(b, &input); err != nil {
+		return err
+	}
+	if input.Role == "" {
+		input.Role = "author"
+	}
+	*ba = BookAuthor{ID: input.ID, Name: input.Name, Role: input.Role}
+	return nil
+}
+
+// AuthorNames returns the names of the book's contributors with the given role.
+func (b *Book) AuthorNames(role string) []string {
+	names := []string{}
+	for _, author := range b.Authors {
+		if author.Role == role {
+			names = append(names, author.Name)
+		}
+	}
+	return names
+}
+
+// NormalizeAuthorName reduces a name to lower-case letters and digits. It
+// matches the normalized_name column populated by the authors migration.
+func NormalizeAuthorName(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func ValidateAuthor(v *validator.Validator, author *Author) {
+	v.Check(strings.TrimSpace(author.Name) != "", "name", "must be provided")
+	v.Check(len(author.Name) <= 255, "name", "must not be more than 255 bytes long")
+	v.Check(NormalizeAuthorName(author.Name) != "", "name", "must contain at least one letter or digit")
+}
+
+func ValidateBookAuthors(v *validator.Validator, authors []*BookAuthor) {
+	for _, author := range authors {
+		v.Check(author.ID > 0 || NormalizeAuthorName(author.Name) != "", "authors", "each author must have an id or a name")
+		v.Check(validator.PermittedValue(author.Role, AuthorRoles...), "authors", "role must be one of author, translator or illustrator")
+	}
+}
+
+type AuthorModel struct {
+	DB Queryer
+}
+
+func (m *AuthorModel) Insert(author *Author) error {
+	query := `
+		INSERT INTO authors (name, normalized_name, bio)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at, version`
+
+	args := []interface{}{strings.TrimSpace(author.Name), NormalizeAuthorName(author.Name), author.Bio}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&author.ID, &author.CreatedAt, &author.Version)
+	if err != nil {
+		switch {
+		case isUniqueViolation(err):
+			return ErrDuplicateAuthor
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *AuthorModel) Get(id int64) (*Author, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, name, bio, created_at, version
+		FROM authors
+		WHERE id = $1`
+
+	var author Author
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&author.ID,
+		&author.Name,
+		&author.Bio,
+		&author.CreatedAt,
+		&author.Version,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &author, nil
+}
+
+func (m *AuthorModel) Update(author *Author) error {
+	query := `
+		UPDATE authors
+		SET name = $1, normalized_name = $2, bio = $3, version = version + 1
+		WHERE id = $4
+		RETURNING version`
+
+	args := []interface{}{
+		strings.TrimSpace(author.Name),
+		NormalizeAuthorName(author.Name),
+		author.Bio,
+		author.ID,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&author.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		case isUniqueViolation(err):
+			return ErrDuplicateAuthor
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *AuthorModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM authors
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (m *AuthorModel) GetAll(name string, filters Filters) ([]*Author, Metadata, error) {
+	var qb queryBuilder
+	if name != "" {
+		qb.where("name ILIKE " + qb.arg("%"+name+"%"))
+	}
+	qb.applyFilters(filters)
+
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), id, name, bio, created_at, version
+		FROM authors
+		%s
+		ORDER BY %s %s, id ASC
+		LIMIT %s OFFSET %s`, qb.whereClause(), filters.sortColumn(), filters.sortDirection(), qb.arg(filters.limit()), qb.arg(filters.offset()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, qb.args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	authors := []*Author{}
+
+	for rows.Next() {
+		var author Author
+		err := rows.Scan(
+			&totalRecords,
+			&author.ID,
+			&author.Name,
+			&author.Bio,
+			&author.CreatedAt,
+			&author.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		authors = append(authors, &author)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
+	return authors, metadata, nil
+}
+
+// setBookAuthors replaces the contributors of a book. Authors given by name
+// are matched on their normalized name and created when they don't exist yet;
+// the canonical id and name are written back into book.Authors.
+func setBookAuthors(ctx context.Context, q Queryer, book *Book) error {
+	_, err := q.ExecContext(ctx, `DELETE FROM book_authors WHERE book_id = $1`, book.ID)
+	if err != nil {
+		return err
+	}
+
+	for position, author := range book.Authors {
+		if author.ID > 0 {
+			err = q.QueryRowContext(ctx, `SELECT name FROM authors WHERE id = $1`, author.ID).Scan(&author.Name)
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("%w: %d", ErrUnknownAuthor, author.ID)
+			}
+		} else {
+			query := `
+				INSERT INTO authors (name, normalized_name)
+				VALUES ($1, $2)
+				ON CONFLICT (normalized_name) DO UPDATE SET normalized_name = EXCLUDED.normalized_name
+				RETURNING id, name`
+			name := strings.TrimSpace(author.Name)
+			err = q.QueryRowContext(ctx, query, name, NormalizeAuthorName(name)).Scan(&author.ID, &author.Name)
+		}
+		if err != nil {
+			return err
+		}
+
+		query := `
+			INSERT INTO book_authors (book_id, author_id, role, position)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT DO NOTHING`
+		_, err = q.ExecContext(ctx, query, book.ID, author.ID, author.Role, position)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// loadBookAuthors fills in Authors for every book with a single query.
+func loadBookAuthors(ctx context.Context, q Queryer, books ...*Book) error {
+	if len(books) == 0 {
+		return nil
+	}
+
+	byID := make(map[int64]*Book, len(books))
+	ids := make([]int64, 0, len(books))
+	for _, book := range books {
+		book.Authors = []*BookAuthor{}
+		byID[book.ID] = book
+		ids = append(ids, book.ID)
+	}
+
+	query := `
+		SELECT ba.book_id, a.id, a.name, ba.role
+		FROM book_authors ba
+		JOIN authors a ON a.id = ba.author_id
+		WHERE ba.book_id = ANY($1)
+		ORDER BY ba.book_id, ba.position, a.id`
+
+	rows, err := q.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var bookID int64
+		var author BookAuthor
+		err := rows.Scan(&bookID, &author.ID, &author.Name, &author.Role)
+		if err != nil {
+			return err
+		}
+		if book, ok := byID[bookID]; ok {
+			book.Authors = append(book.Authors, &author)
+		}
+	}
+
+	return rows.Err()
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
@@ -5,54 +5,213 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
+
 	"github.com/lib/pq"
+	"github.com/tchenbz/AWTtest_3/internal/validator"
 )
 
 type Book struct {
 	ID              int64     `json:"id"`
 	Title           string    `json:"title"`
-	Authors         pq.StringArray  `json:"authors"`       
+	Authors         []*BookAuthor `json:"authors"`
 	ISBN            string    `json:"isbn"`
 	PublicationDate string    `json:"publication_date"`
 	Genre           string    `json:"genre"`
+	Genres          []*BookGenre `json:"genres"`
+	Tags            []string  `json:"tags"`
+	Series          []*BookSeries `json:"series"`
 	Description     string    `json:"description"`
 	AverageRating   float64   `json:"average_rating"`
+	WorkID          int64     `json:"work_id"`
+	Format          string    `json:"format"`
+	Language        string    `json:"language"`
+	Publisher       string    `json:"publisher"`
+	PageCount       int       `json:"page_count"`
 	CreatedAt       time.Time `json:"-"`
 	Version         int32     `json:"version"`
+	// Reviews and ReadingListsCount are only loaded when a request includes
+	// them.
+	Reviews           []*Review `json:"reviews,omitempty"`
+	ReadingListsCount *int      `json:"readinglists_count,omitempty"`
+}
+
+// BookFormats lists the edition formats a book can have. The empty string
+// means the format is unknown.
+var BookFormats = []string{"", "hardcover", "paperback", "ebook", "audiobook", "other"}
+
+// bookFields lists the columns of a book by the name of the field they load.
+var bookFields = []fieldColumn{
+	{"id", "id"},
+	{"title", "title"},
+	{"isbn", "isbn"},
+	{"publication_date", "publication_date"},
+	{"genre", "genre"},
+	{"description", "description"},
+	{"average_rating", "average_rating"},
+	{"work_id", "work_id"},
+	{"format", "format"},
+	{"language", "language"},
+	{"publisher", "publisher"},
+	{"page_count", "page_count"},
+	{"created_at", "created_at"},
+	{"version", "version"},
+}
+
+// bookColumns is the column list matching Book.scanDest.
+var bookColumns = columnList(bookFields)
+
+// BookFieldSafeList lists the fields a ?fields= parameter may select on a
+// book, including the relations loaded alongside it.
+var BookFieldSafeList = []string{"id", "title", "authors", "isbn", "publication_date", "genre", "genres", "tags", "series", "description", "average_rating", "work_id", "format", "language", "publisher", "page_count", "version"}
+
+// BookIncludeSafeList lists the related data ?include= may embed in a book.
+var BookIncludeSafeList = []string{"authors", "reviews", "readinglists_count"}
+
+// scanDest returns the scan destinations for the columns in bookColumns.
+func (b *Book) scanDest() []any {
+	return fieldDests(bookFields, b.fieldDest)
+}
+
+func (b *Book) fieldDest(name string) any {
+	switch name {
+	case "id":
+		return &b.ID
+	case "title":
+		return &b.Title
+	case "isbn":
+		return &b.ISBN
+	case "publication_date":
+		return publicationDate{&b.PublicationDate}
+	case "genre":
+		return &b.Genre
+	case "description":
+		return &b.Description
+	case "average_rating":
+		return &b.AverageRating
+	case "work_id":
+		return &b.WorkID
+	case "format":
+		return &b.Format
+	case "language":
+		return &b.Language
+	case "publisher":
+		return &b.Publisher
+	case "page_count":
+		return &b.PageCount
+	case "created_at":
+		return &b.CreatedAt
+	case "version":
+		return &b.Version
+	}
+	panic("unknown book field: " + name)
+}
+
+func ValidateBook(v *validator.Validator, book *Book) {
+	v.Check(strings.TrimSpace(book.Title) != "", "title", "must be provided")
+	v.Check(len(book.Title) <= 255, "title", "must not be more than 255 bytes long")
+	v.Check(len(book.ISBN) <= 20, "isbn", "must not be more than 20 bytes long")
+	v.Check(book.ISBN == "" || ValidISBN(book.ISBN), "isbn", "must be a valid ISBN-10 or ISBN-13")
+	v.Check(book.PublicationDate == "" || validPublicationDate(book.PublicationDate), "publication_date", "must be a date in the form YYYY-MM-DD")
+	v.Check(len(book.Genre) <= 100, "genre", "must not be more than 100 bytes long")
+	v.Check(book.AverageRating >= 0 && book.AverageRating <= 5, "average_rating", "must be between 0 and 5")
+	ValidateBookAuthors(v, book.Authors)
+	ValidateEdition(v, book)
+}
+
+func ValidateEdition(v *validator.Validator, book *Book) {
+	v.Check(validator.PermittedValue(book.Format, BookFormats...), "format", "must be one of hardcover, paperback, ebook, audiobook or other")
+	v.Check(book.PageCount >= 0, "page_count", "must not be negative")
+	v.Check(len(book.Language) <= 35, "language", "must not be more than 35 bytes long")
+	v.Check(len(book.Publisher) <= 255, "publisher", "must not be more than 255 bytes long")
 }
 
 type BookModel struct {
-	DB *sql.DB
+	DB Queryer
 }
 
 func (m *BookModel) Insert(book *Book) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := beginTx(ctx, m.DB)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = insertBook(ctx, tx, book)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// insertBook inserts a book and its authors and genres using q, which is
+// expected to be a transaction.
+func insertBook(ctx context.Context, q Queryer, book *Book) error {
 	query := `
-		INSERT INTO books (title, authors, isbn, publication_date, genre, description, average_rating)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		INSERT INTO books (title, isbn, publication_date, genre, description, average_rating, work_id, format, language, publisher, page_count)
+		VALUES ($1, $2, NULLIF($3, '')::date, $4, $5, $6, $7, $8, $9, $10, $11)
 		RETURNING id, created_at, version`
 
+	// A book that isn't attached to an existing work becomes the first
+	// edition of a new one.
+	if book.WorkID == 0 {
+		err := q.QueryRowContext(ctx, `INSERT INTO works (title, description) VALUES ($1, $2) RETURNING id`, book.Title, book.Description).Scan(&book.WorkID)
+		if err != nil {
+			return err
+		}
+	}
+
 	args := []interface{}{
 		book.Title,
-		pq.StringArray(book.Authors), 
 		book.ISBN,
 		book.PublicationDate,
 		book.Genre,
 		book.Description,
 		book.AverageRating,
+		book.WorkID,
+		book.Format,
+		book.Language,
+		book.Publisher,
+		book.PageCount,
 	}
 
-	return m.DB.QueryRowContext(context.Background(), query, args...).Scan(&book.ID, &book.CreatedAt, &book.Version)
+	err := q.QueryRowContext(ctx, query, args...).Scan(&book.ID, &book.CreatedAt, &book.Version)
+	if err != nil {
+		return workWriteError(err)
+	}
+
+	err = setBookAuthors(ctx, q, book)
+	if err != nil {
+		return err
+	}
+
+	err = setBookGenres(ctx, q, book.ID, book.GenreIDs())
+	if err != nil {
+		return err
+	}
+
+	return loadBookRelations(ctx, q, book)
 }
 
 
 func (m *BookModel) Get(id int64) (*Book, error) {
+	return m.GetProjected(id, Projection{})
+}
+
+// GetProjected returns a book with only the fields p asks for loaded.
+func (m *BookModel) GetProjected(id int64, p Projection) (*Book, error) {
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
 
+	columns := p.columns(bookFields)
 	query := `
-		SELECT id, title, authors, isbn, publication_date, genre, description, average_rating, created_at, version
+		SELECT ` + columnList(columns) + `
 		FROM books
 		WHERE id = $1`
 
@@ -61,18 +220,7 @@ func (m *BookModel) Get(id int64) (*Book, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, id).Scan(
-		&book.ID,
-		&book.Title,
-		(*pq.StringArray)(&book.Authors), 
-		&book.ISBN,
-		&book.PublicationDate,
-		&book.Genre,
-		&book.Description,
-		&book.AverageRating,
-		&book.CreatedAt,
-		&book.Version,
-	)
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(fieldDests(columns, book.fieldDest)...)
 
 	if err != nil {
 		switch {
@@ -83,42 +231,264 @@ func (m *BookModel) Get(id int64) (*Book, error) {
 		}
 	}
 
+	err = loadProjectedRelations(ctx, m.DB, p, &book)
+	if err != nil {
+		return nil, err
+	}
+
 	return &book, nil
 }
 
+// GetMany returns the books with the given ids, in the order the ids are
+// first given. Ids that don't match a book are skipped.
+func (m *BookModel) GetMany(ids []int64) ([]*Book, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return getBooks(ctx, m.DB, ids)
+}
+
+// GetAfter returns up to limit books with an id greater than afterID, in id
+// order, with their relations loaded. Walking the table with it stays as
+// fast on the last batch as on the first, which an offset doesn't.
+func (m *BookModel) GetAfter(afterID int64, limit int) ([]*Book, error) {
+	query := `
+		SELECT ` + bookColumns + `
+		FROM books
+		WHERE id > $1
+		ORDER BY id
+		LIMIT $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	books := []*Book{}
+	for rows.Next() {
+		var book Book
+		err := rows.Scan(book.scanDest()...)
+		if err != nil {
+			return nil, err
+		}
+		books = append(books, &book)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = loadBookRelations(ctx, m.DB, books...)
+	if err != nil {
+		return nil, err
+	}
+
+	return books, nil
+}
+
+func getBooks(ctx context.Context, q Queryer, ids []int64) ([]*Book, error) {
+	books := []*Book{}
+	if len(ids) == 0 {
+		return books, nil
+	}
+
+	query := `
+		SELECT ` + bookColumns + `
+		FROM books
+		WHERE id = ANY($1)`
+
+	rows, err := q.QueryContext(ctx, query, pq.Array(uniqueIDs(ids)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byID := map[int64]*Book{}
+	for rows.Next() {
+		var book Book
+		err := rows.Scan(book.scanDest()...)
+		if err != nil {
+			return nil, err
+		}
+		byID[book.ID] = &book
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, id := range uniqueIDs(ids) {
+		if book, ok := byID[id]; ok {
+			books = append(books, book)
+		}
+	}
+
+	err = loadBookRelations(ctx, q, books...)
+	if err != nil {
+		return nil, err
+	}
+
+	return books, nil
+}
+
+// Include loads the related data p asks for into the books: their reviews
+// and the number of reading lists they are on. Authors are loaded with the
+// other relations.
+func (m *BookModel) Include(books []*Book, p Projection) error {
+	if len(books) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if p.Includes("reviews") {
+		err := loadBookReviews(ctx, m.DB, books...)
+		if err != nil {
+			return err
+		}
+	}
+
+	if p.Includes("readinglists_count") {
+		err := loadBookReadingListCounts(ctx, m.DB, books...)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ReadingListCounts returns the number of reading lists each of the books
+// is on, keyed by book id.
+func (m *BookModel) ReadingListCounts(ids []int64) (map[int64]int, error) {
+	books := make([]*Book, 0, len(ids))
+	for _, id := range uniqueIDs(ids) {
+		books = append(books, &Book{ID: id})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := loadBookReadingListCounts(ctx, m.DB, books...)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[int64]int, len(books))
+	for _, book := range books {
+		counts[book.ID] = *book.ReadingListsCount
+	}
+	return counts, nil
+}
+
+// loadBookReadingListCounts counts the reading lists each book is on with a
+// single grouped query.
+func loadBookReadingListCounts(ctx context.Context, q Queryer, books ...*Book) error {
+	byID := make(map[int64]*Book, len(books))
+	ids := make([]int64, 0, len(books))
+	for _, book := range books {
+		count := 0
+		book.ReadingListsCount = &count
+		byID[book.ID] = book
+		ids = append(ids, book.ID)
+	}
+
+	query := `
+		SELECT book_id, COUNT(*)
+		FROM reading_list_books
+		WHERE book_id = ANY($1)
+		GROUP BY book_id`
+
+	rows, err := q.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var bookID int64
+		var count int
+		err := rows.Scan(&bookID, &count)
+		if err != nil {
+			return err
+		}
+		if book, ok := byID[bookID]; ok {
+			book.ReadingListsCount = &count
+		}
+	}
+
+	return rows.Err()
+}
 
 func (m *BookModel) Update(book *Book) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := beginTx(ctx, m.DB)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = updateBook(ctx, tx, book)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// updateBook saves a book and replaces its authors and genres using q, which
+// is expected to be a transaction.
+func updateBook(ctx context.Context, q Queryer, book *Book) error {
 	query := `
 		UPDATE books
-		SET title = $1, authors = $2, isbn = $3, publication_date = $4, genre = $5, description = $6, average_rating = $7, version = version + 1
-		WHERE id = $8
+		SET title = $1, isbn = $2, publication_date = NULLIF($3, '')::date, genre = $4, description = $5, average_rating = $6,
+			work_id = $7, format = $8, language = $9, publisher = $10, page_count = $11, version = version + 1
+		WHERE id = $12
 		RETURNING version`
 
 	args := []interface{}{
 		book.Title,
-		pq.StringArray(book.Authors), 
 		book.ISBN,
 		book.PublicationDate,
 		book.Genre,
 		book.Description,
 		book.AverageRating,
+		book.WorkID,
+		book.Format,
+		book.Language,
+		book.Publisher,
+		book.PageCount,
 		book.ID,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&book.Version)
+	err := q.QueryRowContext(ctx, query, args...).Scan(&book.Version)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
 			return ErrRecordNotFound
 		default:
-			return err
+			return workWriteError(err)
 		}
 	}
 
-	return nil
+	err = setBookAuthors(ctx, q, book)
+	if err != nil {
+		return err
+	}
+
+	err = setBookGenres(ctx, q, book.ID, book.GenreIDs())
+	if err != nil {
+		return err
+	}
+
+	return loadBookRelations(ctx, q, book)
 }
 
 
@@ -153,25 +523,96 @@ func (m *BookModel) Delete(id int64) error {
 }
 
 func (m *BookModel) GetAll(title, author, genre string, filters Filters) ([]*Book, Metadata, error) {
+	var qb queryBuilder
+	if title != "" {
+		qb.where("title ILIKE " + qb.arg("%"+title+"%"))
+	}
+	if author != "" {
+		qb.where(`EXISTS (
+			SELECT 1 FROM book_authors ba JOIN authors a ON a.id = ba.author_id
+			WHERE ba.book_id = books.id AND a.name ILIKE ` + qb.arg("%"+author+"%") + `)`)
+	}
+	if genre != "" {
+		qb.where(genreParameterCondition(&qb, genre))
+	}
+	qb.renderers = map[string]filterRenderer{"genre": qb.genreFilter}
+	qb.applyFilters(filters)
+
+	return m.list(&qb, filters)
+}
+
+func (m *BookModel) SearchBooks(title, author, genre string, filters Filters) ([]*Book, Metadata, error) {
+	var qb queryBuilder
+	if title != "" {
+		qb.where("title ILIKE " + qb.arg("%"+title+"%"))
+	}
+	if author != "" {
+		qb.where(`EXISTS (
+			SELECT 1 FROM book_authors ba JOIN authors a ON a.id = ba.author_id
+			WHERE ba.book_id = books.id AND a.name ILIKE ` + qb.arg(author) + `)`)
+	}
+	if genre != "" {
+		qb.where(genreParameterCondition(&qb, genre))
+	}
+
+	return m.list(&qb, filters)
+}
+
+// SearchAll returns the books whose title or ISBN, or the name of any of
+// whose authors, contains term.
+func (m *BookModel) SearchAll(term string, filters Filters) ([]*Book, Metadata, error) {
+	var qb queryBuilder
+	if term != "" {
+		pattern := qb.arg("%" + term + "%")
+		qb.where(`(title ILIKE ` + pattern + ` OR isbn ILIKE ` + pattern + ` OR EXISTS (
+			SELECT 1 FROM book_authors ba JOIN authors a ON a.id = ba.author_id
+			WHERE ba.book_id = books.id AND a.name ILIKE ` + pattern + `))`)
+	}
+
+	return m.list(&qb, filters)
+}
+
+// GetAllByAuthor returns the books an author is credited on in any role.
+func (m *BookModel) GetAllByAuthor(authorID int64, filters Filters) ([]*Book, Metadata, error) {
+	var qb queryBuilder
+	qb.where("id IN (SELECT book_id FROM book_authors WHERE author_id = " + qb.arg(authorID) + ")")
+
+	return m.list(&qb, filters)
+}
+
+// GetAllByWork returns the editions of a work.
+func (m *BookModel) GetAllByWork(workID int64, filters Filters) ([]*Book, Metadata, error) {
+	var qb queryBuilder
+	qb.where("work_id = " + qb.arg(workID))
+
+	return m.list(&qb, filters)
+}
+
+// GetAllByGenre returns the books assigned to a genre or any of its
+// descendants.
+func (m *BookModel) GetAllByGenre(genreID int64, filters Filters) ([]*Book, Metadata, error) {
+	var qb queryBuilder
+	qb.where(bookInGenreCondition("id = " + qb.arg(genreID)))
+
+	return m.list(&qb, filters)
+}
+
+// list runs a paginated book query with the conditions collected in qb and
+// loads the related authors, genres and tags for the page. Only the columns
+// and relations in filters.Projection are loaded.
+func (m *BookModel) list(qb *queryBuilder, filters Filters) ([]*Book, Metadata, error) {
+	columns := filters.Projection.columns(bookFields)
 	query := fmt.Sprintf(`
-		SELECT COUNT(*) OVER(), id, title, authors, isbn, publication_date, genre, description, average_rating, created_at, version
+		SELECT COUNT(*) OVER(), %s
 		FROM books
-		WHERE (title ILIKE $1 OR $1 = '')
-		AND (genre ILIKE $2 OR $2 = '')
+		%s
 		ORDER BY %s %s, id ASC
-		LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
-
-	args := []interface{}{
-		"%" + title + "%",
-		"%" + genre + "%",
-		filters.limit(),
-		filters.offset(),
-	}
+		LIMIT %s OFFSET %s`, columnList(columns), qb.whereClause(), filters.sortColumn(), filters.sortDirection(), qb.arg(filters.limit()), qb.arg(filters.offset()))
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	rows, err := m.DB.QueryContext(ctx, query, args...)
+	rows, err := m.DB.QueryContext(ctx, query, qb.args...)
 	if err != nil {
 		return nil, Metadata{}, err
 	}
@@ -182,19 +623,7 @@ func (m *BookModel) GetAll(title, author, genre string, filters Filters) ([]*Boo
 
 	for rows.Next() {
 		var book Book
-		err := rows.Scan(
-			&totalRecords,
-			&book.ID,
-			&book.Title,
-			(*pq.StringArray)(&book.Authors), 
-			&book.ISBN,
-			&book.PublicationDate,
-			&book.Genre,
-			&book.Description,
-			&book.AverageRating,
-			&book.CreatedAt,
-			&book.Version,
-		)
+		err := rows.Scan(append([]any{&totalRecords}, fieldDests(columns, book.fieldDest)...)...)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
@@ -205,65 +634,137 @@ func (m *BookModel) GetAll(title, author, genre string, filters Filters) ([]*Boo
 		return nil, Metadata{}, err
 	}
 
+	err = loadProjectedRelations(ctx, m.DB, filters.Projection, books...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
 	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
 	return books, metadata, nil
 }
 
-func (m *BookModel) SearchBooks(title, author, genre string, filters Filters) ([]*Book, Metadata, error) {
-	query := fmt.Sprintf(`
-		SELECT COUNT(*) OVER(), id, title, authors, isbn, publication_date, genre, description, average_rating, created_at, version
-		FROM books
-		WHERE (title ILIKE $1 OR $1 = '')
-		AND ($2 = '' OR $2 ILIKE ANY(authors))
-		AND (genre ILIKE $3 OR $3 = '')
-		ORDER BY %s %s, id ASC
-		LIMIT $4 OFFSET $5`, filters.sortColumn(), filters.sortDirection())
-
-	args := []interface{}{
-		"%" + title + "%",
-		author,
-		"%" + genre + "%",
-		filters.limit(),
-		filters.offset(),
+// GenreIDs returns the ids of the genres assigned to the book.
+func (b *Book) GenreIDs() []int64 {
+	ids := []int64{}
+	for _, genre := range b.Genres {
+		ids = append(ids, genre.ID)
 	}
+	return ids
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+// genreParameterCondition matches the ?genre= parameter against the legacy
+// genre column as a substring, or against the genre tree by exact name so
+// that descendants of the named genre are included.
+func genreParameterCondition(qb *queryBuilder, genre string) string {
+	direct := "genre ILIKE " + qb.arg("%"+genre+"%")
+	tree := bookInGenreCondition("LOWER(name) = LOWER(" + qb.arg(genre) + ")")
+	return "(" + direct + " OR " + tree + ")"
+}
 
-	rows, err := m.DB.QueryContext(ctx, query, args...)
-	if err != nil {
-		return nil, Metadata{}, err
-	}
-	defer rows.Close()
+// loadBookRelations fills in the authors, genres, tags and series of the
+// books using one query per relation rather than one per book.
+func loadBookRelations(ctx context.Context, q Queryer, books ...*Book) error {
+	return loadProjectedRelations(ctx, q, Projection{}, books...)
+}
 
-	totalRecords := 0
-	books := []*Book{}
+// loadProjectedRelations loads the relations that p asks for, either as a
+// field or as an include.
+func loadProjectedRelations(ctx context.Context, q Queryer, p Projection, books ...*Book) error {
+	if len(books) == 0 {
+		return nil
+	}
 
-	for rows.Next() {
-		var book Book
-		err := rows.Scan(
-			&totalRecords,
-			&book.ID,
-			&book.Title,
-			&book.Authors,
-			&book.ISBN,
-			&book.PublicationDate,
-			&book.Genre,
-			&book.Description,
-			&book.AverageRating,
-			&book.CreatedAt,
-			&book.Version,
-		)
+	loaders := []struct {
+		name string
+		load func(context.Context, Queryer, ...*Book) error
+	}{
+		{"authors", loadBookAuthors},
+		{"genres", loadBookGenres},
+		{"tags", loadBookTags},
+		{"series", loadBookSeries},
+	}
+	for _, loader := range loaders {
+		if !p.Wants(loader.name) && !p.Includes(loader.name) {
+			continue
+		}
+		err := loader.load(ctx, q, books...)
 		if err != nil {
-			return nil, Metadata{}, err
+			return err
 		}
-		books = append(books, &book)
 	}
 
-	if err = rows.Err(); err != nil {
-		return nil, Metadata{}, err
+	return nil
+}
+
+// NormalizeISBN strips the hyphens and spaces commonly used to format ISBNs
+// and upper-cases a trailing ISBN-10 check character.
+func NormalizeISBN(isbn string) string {
+	isbn = strings.NewReplacer("-", "", " ", "").Replace(isbn)
+	return strings.ToUpper(isbn)
+}
+
+// ValidISBN reports whether isbn (after normalization) is a well formed
+// ISBN-10 or ISBN-13 with a correct check digit.
+func ValidISBN(isbn string) bool {
+	isbn = NormalizeISBN(isbn)
+	switch len(isbn) {
+	case 10:
+		sum := 0
+		for i, r := range isbn {
+			digit := int(r - '0')
+			if r == 'X' && i == 9 {
+				digit = 10
+			} else if r < '0' || r > '9' {
+				return false
+			}
+			sum += (10 - i) * digit
+		}
+		return sum%11 == 0
+	case 13:
+		sum := 0
+		for i, r := range isbn {
+			if r < '0' || r > '9' {
+				return false
+			}
+			weight := 1
+			if i%2 == 1 {
+				weight = 3
+			}
+			sum += weight * int(r-'0')
+		}
+		return sum%10 == 0
 	}
+	return false
+}
 
-	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
-	return books, metadata, nil
+// publicationDate scans the nullable publication_date column into a string,
+// which is left empty for a book without a date.
+type publicationDate struct {
+	date *string
+}
+
+func (d publicationDate) Scan(src any) error {
+	switch src := src.(type) {
+	case nil:
+		*d.date = ""
+	case time.Time:
+		*d.date = src.Format(time.RFC3339Nano)
+	case []byte:
+		*d.date = string(src)
+	case string:
+		*d.date = src
+	default:
+		return fmt.Errorf("cannot scan %T into a publication date", src)
+	}
+	return nil
+}
+
+// validPublicationDate accepts a YYYY-MM-DD date. Dates read back from the
+// database carry a time component, which is ignored.
+func validPublicationDate(date string) bool {
+	if len(date) < 10 {
+		return false
+	}
+	_, err := time.Parse("2006-01-02", date[:10])
+	return err == nil
 }
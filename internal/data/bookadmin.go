@@ -0,0 +1,190 @@
+package data
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ErrMergeIntoItself is returned when a book is to be merged into itself.
+var ErrMergeIntoItself = errors.New("a book can't be merged into itself")
+
+// RatingChange is the average rating of a book before and after it was
+// recomputed from its reviews.
+type RatingChange struct {
+	BookID int64   `json:"book_id"`
+	Old    float64 `json:"old"`
+	New    float64 `json:"new"`
+}
+
+// RecomputeRatings sets the average rating of every book with rated
+// reviews, or of just bookID when it isn't zero, to the average of those
+// reviews, rounded to two decimals. Books without rated reviews keep the
+// rating they were imported with. Only the books whose rating changed are
+// returned.
+func (m *BookModel) RecomputeRatings(bookID int64) ([]*RatingChange, error) {
+	query := `
+		UPDATE books
+		SET average_rating = ratings.average, version = books.version + 1
+		FROM (
+			SELECT book_id, ROUND(AVG(rating)::numeric, 2)::float8 AS average
+			FROM reviews
+			WHERE rating IS NOT NULL AND ($1 = 0 OR book_id = $1)
+			GROUP BY book_id
+		) ratings, books old
+		WHERE books.id = ratings.book_id AND old.id = books.id
+			AND books.average_rating IS DISTINCT FROM ratings.average
+		RETURNING books.id, COALESCE(old.average_rating, 0), books.average_rating`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, bookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []*RatingChange{}
+	for rows.Next() {
+		var change RatingChange
+		err := rows.Scan(&change.BookID, &change.Old, &change.New)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, &change)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(changes, func(a, b *RatingChange) int { return cmp.Compare(a.BookID, b.BookID) })
+	return changes, nil
+}
+
+// MergeResult reports what merging duplicates into a book moved over.
+type MergeResult struct {
+	Into         int64   `json:"into"`
+	Merged       []int64 `json:"merged"`
+	Reviews      int64   `json:"reviews"`
+	ReadingLists int64   `json:"reading_lists"`
+	Tags         int64   `json:"tags"`
+}
+
+// Merge folds the duplicates of a book into it and deletes them. Their
+// reviews, places on reading lists, authors, genres, tags, series entries,
+// import sources and cover move to the book wherever it doesn't already
+// have its own; the book's fields are left as they are. A duplicate that
+// doesn't exist is reported as ErrRecordNotFound.
+func (m *BookModel) Merge(intoID int64, duplicateIDs []int64) (*MergeResult, error) {
+	duplicateIDs = uniqueIDs(duplicateIDs)
+	if slices.Contains(duplicateIDs, intoID) {
+		return nil, ErrMergeIntoItself
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	tx, err := beginTx(ctx, m.DB)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var found int
+	err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM books WHERE id = $1 OR id = ANY($2)`, intoID, pq.Array(duplicateIDs)).Scan(&found)
+	if err != nil {
+		return nil, err
+	}
+	if found != len(duplicateIDs)+1 {
+		return nil, ErrRecordNotFound
+	}
+
+	result := &MergeResult{Into: intoID, Merged: duplicateIDs}
+	ids := pq.Array(duplicateIDs)
+
+	// Rows that would clash with one the book already has are left on the
+	// duplicate and deleted with it.
+	statements := []struct {
+		query string
+		count *int64
+	}{
+		{`UPDATE reviews SET book_id = $1 WHERE book_id = ANY($2)`, &result.Reviews},
+		{`INSERT INTO reading_list_books (reading_list_id, book_id, added_at)
+			SELECT reading_list_id, $1, MIN(added_at) FROM reading_list_books WHERE book_id = ANY($2)
+			GROUP BY reading_list_id
+			ON CONFLICT DO NOTHING`, &result.ReadingLists},
+		{`INSERT INTO book_authors (book_id, author_id, role, position)
+			SELECT $1, author_id, role, MIN(position) + 1000 FROM book_authors WHERE book_id = ANY($2)
+			GROUP BY author_id, role
+			ON CONFLICT DO NOTHING`, nil},
+		{`INSERT INTO book_genres (book_id, genre_id)
+			SELECT DISTINCT $1, genre_id FROM book_genres WHERE book_id = ANY($2)
+			ON CONFLICT DO NOTHING`, nil},
+		{`INSERT INTO book_tags (book_id, tag_id, user_id, created_at)
+			SELECT $1, tag_id, user_id, MIN(created_at) FROM book_tags WHERE book_id = ANY($2)
+			GROUP BY tag_id, user_id
+			ON CONFLICT DO NOTHING`, &result.Tags},
+		// A series entry moves rather than being copied, since its position
+		// is unique within the series.
+		{`UPDATE series_entries SET book_id = $1
+			WHERE (series_id, book_id) IN (
+				SELECT DISTINCT ON (series_id) series_id, book_id FROM series_entries
+				WHERE book_id = ANY($2)
+					AND series_id NOT IN (SELECT series_id FROM series_entries WHERE book_id = $1)
+				ORDER BY series_id, position
+			)`, nil},
+		{`UPDATE book_sources SET book_id = $1 WHERE book_id = ANY($2)`, nil},
+		{`INSERT INTO book_covers (book_id, content_type, image, created_at)
+			SELECT $1, content_type, image, created_at FROM book_covers WHERE book_id = ANY($2)
+			ORDER BY created_at DESC
+			LIMIT 1
+			ON CONFLICT DO NOTHING`, nil},
+		{`UPDATE works SET seed_book_id = $1 WHERE seed_book_id = ANY($2)`, nil},
+	}
+	for _, statement := range statements {
+		res, err := tx.ExecContext(ctx, statement.query, intoID, ids)
+		if err != nil {
+			return nil, fmt.Errorf("merging books: %w", err)
+		}
+		if statement.count != nil {
+			*statement.count, err = res.RowsAffected()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Authors moved over are credited after the book's own, in the order
+	// they had.
+	_, err = tx.ExecContext(ctx, `
+		UPDATE book_authors
+		SET position = ranked.position
+		FROM (
+			SELECT author_id, role, ROW_NUMBER() OVER (ORDER BY position) - 1 AS position
+			FROM book_authors
+			WHERE book_id = $1
+		) ranked
+		WHERE book_authors.book_id = $1 AND book_authors.author_id = ranked.author_id AND book_authors.role = ranked.role`, intoID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM books WHERE id = ANY($1)`, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE books SET version = version + 1 WHERE id = $1`, intoID)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, tx.Commit()
+}
@@ -0,0 +1,493 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/tchenbz/AWTtest_3/internal/validator"
+)
+
+// ImportBatchSize is the number of rows written per transaction by bulk
+// imports.
+const ImportBatchSize = 500
+
+// ImportRow is one parsed record of a bulk import. Row is its 1-based
+// position in the input, used for error reporting.
+//
+// Rows from an external catalog set Source and SourceID so that the book is
+// found again on the next import even if its ISBN changed. Tags are added on
+// behalf of the user TaggedBy, and Series places the book in the named
+// series at SeriesPosition. GenrePaths, when set, replace the book's genres;
+// each path names a genre and its ancestors, most general first.
+type ImportRow struct {
+	Row            int
+	Book           *Book
+	Source         string
+	SourceID       string
+	Tags           []string
+	TaggedBy       int64
+	Series         string
+	SeriesPosition float64
+	GenrePaths     [][]string
+}
+
+// ImportRowError reports why a row was rejected.
+type ImportRowError struct {
+	Row    int               `json:"row"`
+	ISBN   string            `json:"isbn,omitempty"`
+	Errors map[string]string `json:"errors"`
+}
+
+// ImportRowReport is the outcome of a single row, included in the result
+// when a per-row report is requested.
+type ImportRowReport struct {
+	Row       int               `json:"row"`
+	Reference string            `json:"reference,omitempty"`
+	ISBN      string            `json:"isbn,omitempty"`
+	Title     string            `json:"title,omitempty"`
+	BookID    int64             `json:"book_id,omitempty"`
+	Outcome   string            `json:"outcome"`
+	Message   string            `json:"message,omitempty"`
+	Errors    map[string]string `json:"errors,omitempty"`
+}
+
+// ImportResult summarizes a bulk import. In a dry run every batch is rolled
+// back, so the counts describe what would have happened. Setting Report
+// adds an entry to Rows for every row imported.
+type ImportResult struct {
+	DryRun  bool               `json:"dry_run"`
+	Created int                `json:"created"`
+	Updated int                `json:"updated"`
+	Skipped int                `json:"skipped"`
+	Failed  int                `json:"failed"`
+	Errors  []*ImportRowError  `json:"errors"`
+	Report  bool               `json:"-"`
+	Rows    []*ImportRowReport `json:"rows,omitempty"`
+	// Logger logs the errors of rows that failed for reasons other than
+	// their data; slog.Default() is used when it is nil.
+	Logger *slog.Logger `json:"-"`
+
+	// written holds, in a dry run, the books earlier batches would have
+	// saved, by importKeys, and batch those of the batch being imported.
+	written map[string]*Book
+	batch   map[string]*Book
+}
+
+// Reject records a row that failed before reaching the database, e.g.
+// because it could not be parsed.
+func (r *ImportResult) Reject(row int, isbn string, errs map[string]string) {
+	r.Failed++
+	r.Errors = append(r.Errors, &ImportRowError{Row: row, ISBN: isbn, Errors: errs})
+	if r.Report {
+		r.Rows = append(r.Rows, &ImportRowReport{Row: row, ISBN: isbn, Outcome: "failed", Errors: errs})
+	}
+}
+
+// reject is Reject for a parsed row, keeping its reference and title in
+// the report.
+func (r *ImportResult) reject(row *ImportRow, errs map[string]string) {
+	r.Reject(row.Row, row.Book.ISBN, errs)
+	if r.Report {
+		report := r.Rows[len(r.Rows)-1]
+		report.Reference = row.SourceID
+		report.Title = row.Book.Title
+	}
+}
+
+// Ignore counts a row that is deliberately not imported as skipped, giving
+// the reason in the report.
+func (r *ImportResult) Ignore(row *ImportRow, reason string) {
+	r.record(row, "skipped")
+	if r.Report {
+		r.Rows[len(r.Rows)-1].Message = reason
+	}
+}
+
+func (r *ImportResult) record(row *ImportRow, outcome string) {
+	switch outcome {
+	case "created":
+		r.Created++
+	case "updated":
+		r.Updated++
+	default:
+		r.Skipped++
+	}
+
+	if r.Report {
+		r.Rows = append(r.Rows, &ImportRowReport{
+			Row:       row.Row,
+			Reference: row.SourceID,
+			ISBN:      row.Book.ISBN,
+			Title:     row.Book.Title,
+			BookID:    row.Book.ID,
+			Outcome:   outcome,
+		})
+	}
+}
+
+// ImportBatch upserts a batch of books keyed on ISBN in one transaction.
+// Each row runs under its own savepoint so a failing row doesn't abort the
+// rest of the batch. Rows whose ISBN matches an existing book with the same
+// data are counted as skipped.
+func (m *BookModel) ImportBatch(rows []*ImportRow, dryRun bool, result *ImportResult) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	tx, err := beginTx(ctx, m.DB)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, row := range rows {
+		book := row.Book
+		book.ISBN = NormalizeISBN(book.ISBN)
+
+		v := validator.New()
+		v.Check(book.ISBN != "" || row.SourceID != "", "isbn", "must be provided")
+		ValidateBook(v, book)
+		if row.Series != "" {
+			ValidateSeriesPosition(v, row.SeriesPosition)
+		}
+		if !v.IsEmpty() {
+			result.reject(row, v.Errors)
+			continue
+		}
+
+		_, err = tx.ExecContext(ctx, "SAVEPOINT import_row")
+		if err != nil {
+			return err
+		}
+
+		outcome, err := upsertImportRow(ctx, tx, row)
+		if err != nil {
+			_, rollbackErr := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT import_row")
+			if rollbackErr != nil {
+				return rollbackErr
+			}
+			result.reject(row, result.importRowErrors(row, err))
+			continue
+		}
+
+		_, err = tx.ExecContext(ctx, "RELEASE SAVEPOINT import_row")
+		if err != nil {
+			return err
+		}
+
+		if dryRun {
+			outcome = result.dryRunOutcome(row, outcome)
+		}
+		result.record(row, outcome)
+	}
+
+	if dryRun {
+		result.endDryRunBatch()
+		return nil
+	}
+
+	return tx.Commit()
+}
+
+// dryRunOutcome corrects the outcome of a row in a dry run. The batches
+// before this one were rolled back, so a row matching a book one of them
+// would have created or updated was compared against what the database
+// holds instead; it is compared against that book here.
+func (r *ImportResult) dryRunOutcome(row *ImportRow, outcome string) string {
+	if r.batch == nil {
+		r.batch = map[string]*Book{}
+	}
+
+	keys := importKeys(row)
+	for _, key := range keys {
+		earlier, ok := r.written[key]
+		if !ok {
+			continue
+		}
+		if sameBookData(earlier, row.Book) {
+			outcome = "skipped"
+		} else {
+			outcome = "updated"
+		}
+		break
+	}
+
+	if outcome != "skipped" {
+		book := *row.Book
+		for _, key := range keys {
+			r.batch[key] = &book
+		}
+	}
+	return outcome
+}
+
+// endDryRunBatch makes the books of the batch just rolled back visible to
+// dryRunOutcome for the batches after it.
+func (r *ImportResult) endDryRunBatch() {
+	if r.written == nil {
+		r.written = map[string]*Book{}
+	}
+	for key, book := range r.batch {
+		r.written[key] = book
+	}
+	clear(r.batch)
+}
+
+// importKeys returns the keys upsertImportRow finds an existing book by.
+func importKeys(row *ImportRow) []string {
+	var keys []string
+	if row.SourceID != "" {
+		keys = append(keys, "source:"+row.Source+":"+row.SourceID)
+	}
+	if row.Book.ISBN != "" {
+		keys = append(keys, "isbn:"+row.Book.ISBN)
+	}
+	return keys
+}
+
+// upsertImportRow inserts the row's book, or updates the existing book it
+// refers to: the book previously imported from the same source record, or
+// else the book with the same ISBN. It reports whether the book was
+// "created", "updated" or "skipped".
+func upsertImportRow(ctx context.Context, q Queryer, row *ImportRow) (string, error) {
+	book := row.Book
+
+	if row.GenrePaths != nil {
+		book.Genres = []*BookGenre{}
+		for _, path := range row.GenrePaths {
+			id, err := genreByPath(ctx, q, path)
+			if err != nil {
+				return "", err
+			}
+			book.Genres = append(book.Genres, &BookGenre{ID: id})
+		}
+	}
+
+	existing, err := getBookBySource(ctx, q, row.Source, row.SourceID)
+	if errors.Is(err, ErrRecordNotFound) && book.ISBN != "" {
+		existing, err = getBookByISBN(ctx, q, book.ISBN)
+	}
+
+	outcome := ""
+	switch {
+	case errors.Is(err, ErrRecordNotFound):
+		outcome = "created"
+		err = insertBook(ctx, q, book)
+	case err != nil:
+		return "", err
+	default:
+		// Keep what the import doesn't say anything about.
+		if book.Authors == nil {
+			book.Authors = existing.Authors
+		}
+		if book.WorkID == 0 {
+			book.WorkID = existing.WorkID
+		}
+		if row.GenrePaths == nil {
+			book.Genres = existing.Genres
+		}
+
+		if sameBookData(existing, book) {
+			outcome = "skipped"
+			*book = *existing
+		} else {
+			outcome = "updated"
+			book.ID = existing.ID
+			err = updateBook(ctx, q, book)
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+
+	changed, err := applyImportExtras(ctx, q, row)
+	if err != nil {
+		return "", err
+	}
+	if changed && outcome == "skipped" {
+		outcome = "updated"
+	}
+
+	return outcome, nil
+}
+
+// applyImportExtras records the row's source and adds its tags and series
+// volume. It reports whether any of them were new.
+func applyImportExtras(ctx context.Context, q Queryer, row *ImportRow) (bool, error) {
+	changed := false
+
+	if row.SourceID != "" {
+		query := `
+			INSERT INTO book_sources (source, source_id, book_id)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (source, source_id) DO UPDATE SET book_id = EXCLUDED.book_id
+			WHERE book_sources.book_id <> EXCLUDED.book_id`
+		_, err := q.ExecContext(ctx, query, row.Source, row.SourceID, row.Book.ID)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	if row.TaggedBy > 0 {
+		for _, tag := range row.Tags {
+			if NormalizeTag(tag) == "" {
+				continue
+			}
+			added, err := addBookTag(ctx, q, row.Book.ID, row.TaggedBy, tag)
+			if err != nil {
+				return false, err
+			}
+			changed = changed || added
+		}
+	}
+
+	if row.Series != "" {
+		seriesID, err := seriesByName(ctx, q, row.Series)
+		if err != nil {
+			return false, err
+		}
+		moved, err := setSeriesVolume(ctx, q, seriesID, row.Book.ID, row.SeriesPosition)
+		if err != nil {
+			return false, err
+		}
+		changed = changed || moved
+	}
+
+	return changed, nil
+}
+
+// getBookBySource returns the book imported from the given source record.
+func getBookBySource(ctx context.Context, q Queryer, source, sourceID string) (*Book, error) {
+	if sourceID == "" {
+		return nil, ErrRecordNotFound
+	}
+
+	var id int64
+	err := q.QueryRowContext(ctx, `SELECT book_id FROM book_sources WHERE source = $1 AND source_id = $2`, source, sourceID).Scan(&id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return getBook(ctx, q, "id = $1", id)
+}
+
+func getBookByISBN(ctx context.Context, q Queryer, isbn string) (*Book, error) {
+	return getBook(ctx, q, "upper(replace(replace(isbn, '-', ''), ' ', '')) = $1", isbn)
+}
+
+// getBook returns the first book matching where, which refers to arg as $1.
+func getBook(ctx context.Context, q Queryer, where string, arg any) (*Book, error) {
+	query := `
+		SELECT ` + bookColumns + `
+		FROM books
+		WHERE ` + where + `
+		ORDER BY id
+		LIMIT 1`
+
+	var book Book
+	err := q.QueryRowContext(ctx, query, arg).Scan(book.scanDest()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	err = loadBookRelations(ctx, q, &book)
+	if err != nil {
+		return nil, err
+	}
+
+	return &book, nil
+}
+
+// sameBookData reports whether saving b over existing would change anything.
+func sameBookData(existing, b *Book) bool {
+	// An author given by id is that author whatever name comes with it, as
+	// in setBookAuthors; one given only by name is matched on the
+	// normalized name.
+	sameAuthor := func(existing, author *BookAuthor) bool {
+		if author.Role != existing.Role {
+			return false
+		}
+		if author.ID > 0 {
+			return author.ID == existing.ID
+		}
+		return NormalizeAuthorName(author.Name) == NormalizeAuthorName(existing.Name)
+	}
+	genreKey := func(book *Book) []int64 {
+		ids := uniqueIDs(book.GenreIDs())
+		slices.Sort(ids)
+		return ids
+	}
+	sameDate := existing.PublicationDate == b.PublicationDate ||
+		len(existing.PublicationDate) >= 10 && len(b.PublicationDate) >= 10 &&
+			existing.PublicationDate[:10] == b.PublicationDate[:10]
+
+	return existing.Title == b.Title &&
+		NormalizeISBN(existing.ISBN) == b.ISBN &&
+		sameDate &&
+		existing.Genre == b.Genre &&
+		existing.Description == b.Description &&
+		existing.AverageRating == b.AverageRating &&
+		existing.WorkID == b.WorkID &&
+		existing.Format == b.Format &&
+		existing.Language == b.Language &&
+		existing.Publisher == b.Publisher &&
+		existing.PageCount == b.PageCount &&
+		slices.EqualFunc(existing.Authors, b.Authors, sameAuthor) &&
+		slices.Equal(genreKey(existing), genreKey(b))
+}
+
+// importRowErrors turns an error saving a row into the errors reported for
+// it. Errors caused by the row's data are described by field; anything else
+// is logged and reported without its cause, as the API does for server
+// errors.
+func (r *ImportResult) importRowErrors(row *ImportRow, err error) map[string]string {
+	var pqErr *pq.Error
+	errors.As(err, &pqErr)
+
+	switch {
+	case errors.Is(err, ErrUnknownAuthor):
+		return map[string]string{"authors": err.Error()}
+	case errors.Is(err, ErrUnknownGenre):
+		return map[string]string{"genres": err.Error()}
+	case errors.Is(err, ErrUnknownWork):
+		return map[string]string{"work_id": err.Error()}
+	case errors.Is(err, ErrDuplicatePosition):
+		return map[string]string{"series": err.Error()}
+	case pqErr != nil && pqErr.Code == "23514":
+		if field, ok := importCheckConstraints[pqErr.Constraint]; ok {
+			return map[string]string{field[0]: field[1]}
+		}
+	case pqErr != nil && pqErr.Code == "22001":
+		return map[string]string{"error": "a value is too long"}
+	}
+
+	logger := r.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	logger.Error(err.Error(), "row", row.Row)
+	return map[string]string{"error": "the row could not be saved"}
+}
+
+// importCheckConstraints maps the check constraints a row can violate to
+// the field and message reported for them.
+var importCheckConstraints = map[string][2]string{
+	"books_format_check":            {"format", "is not a known format"},
+	"books_page_count_check":        {"page_count", "must not be negative"},
+	"book_authors_role_check":       {"authors", "role must be author, translator or illustrator"},
+	"series_entries_position_check": {"series", "position must not be negative"},
+}
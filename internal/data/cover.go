@@ -0,0 +1,154 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Cover is a book's cover image.
+type Cover struct {
+	BookID      int64
+	ContentType string
+	Image       []byte
+	CreatedAt   time.Time
+}
+
+// coverContentTypes are the image types a cover may have. Others, SVG in
+// particular, can carry scripts and aren't accepted.
+var coverContentTypes = []string{"image/jpeg", "image/png", "image/gif", "image/webp"}
+
+// CoverContentType returns the content type of image as sniffed from its
+// bytes, and false unless it is one a cover may have.
+func CoverContentType(image []byte) (string, bool) {
+	contentType := http.DetectContentType(image)
+	return contentType, slices.Contains(coverContentTypes, contentType)
+}
+
+type CoverModel struct {
+	DB Queryer
+}
+
+func (m *CoverModel) Get(bookID int64) (*Cover, error) {
+	query := `
+		SELECT book_id, content_type, image, created_at
+		FROM book_covers
+		WHERE book_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var cover Cover
+	err := m.DB.QueryRowContext(ctx, query, bookID).Scan(&cover.BookID, &cover.ContentType, &cover.Image, &cover.CreatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &cover, nil
+}
+
+// ContentTypes returns the content type of the cover of each of the given
+// books that has one, keyed by book id.
+func (m *CoverModel) ContentTypes(bookIDs []int64) (map[int64]string, error) {
+	query := `
+		SELECT book_id, content_type
+		FROM book_covers
+		WHERE book_id = ANY($1)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(bookIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	contentTypes := map[int64]string{}
+	for rows.Next() {
+		var bookID int64
+		var contentType string
+		err := rows.Scan(&bookID, &contentType)
+		if err != nil {
+			return nil, err
+		}
+		contentTypes[bookID] = contentType
+	}
+
+	return contentTypes, rows.Err()
+}
+
+// setBookCover stores or replaces the cover of a book.
+func setBookCover(ctx context.Context, q Queryer, cover *Cover) error {
+	query := `
+		INSERT INTO book_covers (book_id, content_type, image)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (book_id) DO UPDATE
+		SET content_type = EXCLUDED.content_type, image = EXCLUDED.image, created_at = CURRENT_TIMESTAMP
+		RETURNING created_at`
+
+	return q.QueryRowContext(ctx, query, cover.BookID, cover.ContentType, cover.Image).Scan(&cover.CreatedAt)
+}
+
+// InsertWithCover inserts a book together with its cover image. cover may
+// be nil.
+func (m *BookModel) InsertWithCover(book *Book, cover *Cover) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := beginTx(ctx, m.DB)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = insertBook(ctx, tx, book)
+	if err != nil {
+		return err
+	}
+
+	if cover != nil {
+		cover.BookID = book.ID
+		err = setBookCover(ctx, tx, cover)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// FindDuplicates returns up to ten existing books that look like the same
+// edition as book: those with the same ISBN, or the same title and at least
+// one author in common.
+func (m *BookModel) FindDuplicates(book *Book) ([]*Book, error) {
+	var qb queryBuilder
+
+	names := []string{}
+	for _, author := range book.Authors {
+		names = append(names, NormalizeAuthorName(author.Name))
+	}
+
+	sameTitle := "LOWER(title) = LOWER(" + qb.arg(book.Title) + `) AND EXISTS (
+		SELECT 1 FROM book_authors ba JOIN authors a ON a.id = ba.author_id
+		WHERE ba.book_id = books.id AND a.normalized_name = ANY(` + qb.arg(pq.Array(names)) + `))`
+	if isbn := NormalizeISBN(book.ISBN); isbn != "" {
+		qb.where("(upper(replace(replace(isbn, '-', ''), ' ', '')) = " + qb.arg(isbn) + " OR (" + sameTitle + "))")
+	} else {
+		qb.where(sameTitle)
+	}
+
+	filters := Filters{Page: 1, PageSize: 10, Sort: "id", SortSafeList: []string{"id"}}
+	books, _, err := m.list(&qb, filters)
+	return books, err
+}
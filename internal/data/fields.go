@@ -0,0 +1,93 @@
+package data
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tchenbz/AWTtest_3/internal/validator"
+)
+
+// fieldColumn pairs the JSON name of a field with the column it is loaded
+// from.
+type fieldColumn struct {
+	name   string
+	column string
+}
+
+// Projection is the sparse fieldset (?fields=) and the related data
+// (?include=) a request asks for. An empty Fields loads every field.
+type Projection struct {
+	Fields  []string
+	Include []string
+}
+
+// ValidateProjection checks the requested fields and includes against the
+// safe lists of the resource.
+func ValidateProjection(v *validator.Validator, p Projection, fieldSafeList, includeSafeList []string) {
+	for _, field := range p.Fields {
+		v.Check(validator.PermittedValue(field, fieldSafeList...), "fields", fmt.Sprintf("%q is not a field; must be one of %s", field, strings.Join(fieldSafeList, ", ")))
+	}
+	for _, include := range p.Include {
+		v.Check(validator.PermittedValue(include, includeSafeList...), "include", fmt.Sprintf("%q can't be included; must be one of %s", include, strings.Join(includeSafeList, ", ")))
+	}
+}
+
+// Wants reports whether the field is in the sparse fieldset.
+func (p Projection) Wants(field string) bool {
+	return len(p.Fields) == 0 || validator.PermittedValue(field, p.Fields...)
+}
+
+// Includes reports whether the related data was asked for.
+func (p Projection) Includes(name string) bool {
+	return validator.PermittedValue(name, p.Include...)
+}
+
+// Keys returns the JSON keys a projected record keeps: the requested fields
+// and then the included data, in the order they were asked for. It returns
+// nil when every field is wanted.
+func (p Projection) Keys() []string {
+	if len(p.Fields) == 0 {
+		return nil
+	}
+	keys := append([]string{}, p.Fields...)
+	for _, include := range p.Include {
+		if !validator.PermittedValue(include, keys...) {
+			keys = append(keys, include)
+		}
+	}
+	return keys
+}
+
+// columns returns the columns that load the wanted fields, in table order.
+// The id and any other keys are always loaded since relations and includes
+// are looked up by them.
+func (p Projection) columns(all []fieldColumn, keys ...string) []fieldColumn {
+	if len(p.Fields) == 0 {
+		return all
+	}
+	keys = append(keys, "id")
+	columns := []fieldColumn{}
+	for _, c := range all {
+		if validator.PermittedValue(c.name, keys...) || p.Wants(c.name) {
+			columns = append(columns, c)
+		}
+	}
+	return columns
+}
+
+func columnList(columns []fieldColumn) string {
+	names := make([]string, len(columns))
+	for i, c := range columns {
+		names[i] = c.column
+	}
+	return strings.Join(names, ", ")
+}
+
+// fieldDests returns the scan destinations for columns, as given by dest.
+func fieldDests(columns []fieldColumn, dest func(name string) any) []any {
+	dests := make([]any, len(columns))
+	for i, c := range columns {
+		dests[i] = dest(c.name)
+	}
+	return dests
+}
@@ -1,7 +1,10 @@
 package data
 
 import (
+	"fmt"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/tchenbz/AWTtest_3/internal/validator"
 )
@@ -11,8 +14,34 @@ type Filters struct {
     PageSize     int      `json:"page_size"`
     Sort         string   `json:"sort"`
     SortSafeList []string `json:"sort_safe_list"` 
+    Conditions     []FilterCondition     `json:"conditions"`
+    FilterSafeList map[string]FilterType `json:"filter_safe_list"`
+    Projection     Projection            `json:"projection"`
 }
 
+// FilterType describes how the value of a filter expression is parsed and
+// which operators may be applied to the column it targets.
+type FilterType int
+
+const (
+	FilterText FilterType = iota
+	FilterNumber
+	FilterDate
+	FilterTimestamp
+	FilterBool
+)
+
+// FilterCondition is a single filter expression such as
+// filter[average_rating][gte]=4, where Field is "average_rating", Operator
+// is "gte" and Value is "4".
+type FilterCondition struct {
+	Field    string `json:"field"`
+	Operator string `json:"operator"`
+	Value    string `json:"value"`
+}
+
+const maxFilterConditions = 20
+
 
 type Metadata struct {
 	CurrentPage  int `json:"current_page,omitempty"`
@@ -28,6 +57,95 @@ func ValidateFilters(v *validator.Validator, f Filters) {
 	v.Check(f.PageSize > 0, "page_size", "must be greater than zero")
 	v.Check(f.PageSize <= 100, "page_size", "must be a maximum of 100")
 	v.Check(validator.PermittedValue(f.Sort, f.SortSafeList...), "sort", "invalid sort value")
+	v.Check(len(f.Conditions) <= maxFilterConditions, "filter", fmt.Sprintf("must not contain more than %d expressions", maxFilterConditions))
+
+	for _, c := range f.Conditions {
+		key := fmt.Sprintf("filter[%s]", c.Field)
+		kind, ok := f.FilterSafeList[c.Field]
+		if !ok {
+			v.AddError(key, "invalid filter field")
+			continue
+		}
+		if !validator.PermittedValue(c.Operator, kind.operators()...) {
+			v.AddError(key, fmt.Sprintf("invalid filter operator %q", c.Operator))
+			continue
+		}
+		values := c.values()
+		if c.Operator == "between" && len(values) != 2 {
+			v.AddError(key, "between requires exactly two comma-separated values")
+			continue
+		}
+		for _, value := range values {
+			if _, err := kind.parse(value); err != nil {
+				v.AddError(key, err.Error())
+				break
+			}
+		}
+	}
+}
+
+func (f Filters) filterType(field string) FilterType {
+	kind, ok := f.FilterSafeList[field]
+	if !ok {
+		panic("unsafe filter field: " + field)
+	}
+	return kind
+}
+
+// values splits the value of list operators (in, nin, between) on commas.
+func (c FilterCondition) values() []string {
+	switch c.Operator {
+	case "in", "nin", "between":
+		values := strings.Split(c.Value, ",")
+		for i := range values {
+			values[i] = strings.TrimSpace(values[i])
+		}
+		return values
+	}
+	return []string{c.Value}
+}
+
+func (t FilterType) operators() []string {
+	switch t {
+	case FilterText:
+		return []string{"eq", "ne", "in", "nin", "contains"}
+	case FilterBool:
+		return []string{"eq", "ne"}
+	}
+	return []string{"eq", "ne", "gt", "gte", "lt", "lte", "in", "nin", "between"}
+}
+
+func (t FilterType) parse(value string) (any, error) {
+	switch t {
+	case FilterNumber:
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", value)
+		}
+		return number, nil
+	case FilterDate:
+		date, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a date in the form YYYY-MM-DD", value)
+		}
+		return date, nil
+	case FilterTimestamp:
+		if timestamp, err := time.Parse(time.RFC3339, value); err == nil {
+			return timestamp, nil
+		}
+		date, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a date (YYYY-MM-DD) or an RFC 3339 timestamp", value)
+		}
+		return date, nil
+	case FilterBool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a boolean", value)
+		}
+		return b, nil
+	}
+	return value, nil
 }
 
 func (f Filters) limit() int {
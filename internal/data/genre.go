@@ -0,0 +1,418 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/tchenbz/AWTtest_3/internal/validator"
+)
+
+var (
+	ErrDuplicateGenre = errors.New("a genre with this name already exists")
+	ErrUnknownGenre   = errors.New("unknown genre")
+	ErrGenreCycle     = errors.New("a genre cannot be moved below itself or one of its descendants")
+)
+
+type Genre struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	ParentID  *int64    `json:"parent_id"`
+	Children  []*Genre  `json:"children,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	Version   int32     `json:"version"`
+}
+
+// BookGenre is a genre as assigned to a particular book.
+type BookGenre struct {
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	ParentID *int64 `json:"parent_id"`
+}
+
+func ValidateGenre(v *validator.Validator, genre *Genre) {
+	v.Check(strings.TrimSpace(genre.Name) != "", "name", "must be provided")
+	v.Check(len(genre.Name) <= 100, "name", "must not be more than 100 bytes long")
+	v.Check(genre.ParentID == nil || *genre.ParentID != genre.ID, "parent_id", "must not refer to the genre itself")
+}
+
+// genreSubtreeQuery selects the ids of the genre named by the placeholder and
+// all of its descendants. It is used to make genre filters hierarchical.
+const genreSubtreeQuery = `
+	WITH RECURSIVE subtree AS (
+		SELECT id FROM genres WHERE %s
+		UNION
+		SELECT g.id FROM genres g JOIN subtree s ON g.parent_id = s.id
+	)
+	SELECT id FROM subtree`
+
+// bookInGenreCondition returns a condition matching books assigned to the
+// genre identified by where (or any of its descendants).
+func bookInGenreCondition(where string) string {
+	return "id IN (SELECT book_id FROM book_genres WHERE genre_id IN (" + fmt.Sprintf(genreSubtreeQuery, where) + "))"
+}
+
+// genreFilter renders a filter expression on a book's genre so that it also
+// matches books assigned to a genre with that name or to one of its
+// descendants. ne and nin exclude the whole subtree.
+func (b *queryBuilder) genreFilter(c FilterCondition) string {
+	positive := c
+	switch c.Operator {
+	case "ne":
+		positive.Operator = "eq"
+	case "nin":
+		positive.Operator = "in"
+	}
+
+	direct := b.filterCondition(positive, FilterText)
+	positive.Field = "name"
+	tree := bookInGenreCondition(b.filterCondition(positive, FilterText))
+
+	if positive.Operator != c.Operator {
+		return "NOT COALESCE(" + direct + " OR " + tree + ", FALSE)"
+	}
+	return "(" + direct + " OR " + tree + ")"
+}
+
+type GenreModel struct {
+	DB Queryer
+}
+
+func (m *GenreModel) Insert(genre *Genre) error {
+	query := `
+		INSERT INTO genres (name, parent_id)
+		VALUES ($1, $2)
+		RETURNING id, created_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, strings.TrimSpace(genre.Name), genre.ParentID).Scan(&genre.ID, &genre.CreatedAt, &genre.Version)
+	if err != nil {
+		return genreWriteError(err)
+	}
+
+	return nil
+}
+
+func (m *GenreModel) Get(id int64) (*Genre, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, name, parent_id, created_at, version
+		FROM genres
+		WHERE id = $1`
+
+	var genre Genre
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&genre.ID,
+		&genre.Name,
+		&genre.ParentID,
+		&genre.CreatedAt,
+		&genre.Version,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &genre, nil
+}
+
+func (m *GenreModel) Update(genre *Genre) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if genre.ParentID != nil {
+		var cycle bool
+		query := fmt.Sprintf(`SELECT $2 IN (%s)`, fmt.Sprintf(genreSubtreeQuery, "id = $1"))
+		err := m.DB.QueryRowContext(ctx, query, genre.ID, *genre.ParentID).Scan(&cycle)
+		if err != nil {
+			return err
+		}
+		if cycle {
+			return ErrGenreCycle
+		}
+	}
+
+	query := `
+		UPDATE genres
+		SET name = $1, parent_id = $2, version = version + 1
+		WHERE id = $3
+		RETURNING version`
+
+	err := m.DB.QueryRowContext(ctx, query, strings.TrimSpace(genre.Name), genre.ParentID, genre.ID).Scan(&genre.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return genreWriteError(err)
+		}
+	}
+
+	return nil
+}
+
+func (m *GenreModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM genres
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetAll returns every genre, ordered by name.
+func (m *GenreModel) GetAll() ([]*Genre, error) {
+	query := `
+		SELECT id, name, parent_id, created_at, version
+		FROM genres
+		ORDER BY name, id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	genres := []*Genre{}
+
+	for rows.Next() {
+		var genre Genre
+		err := rows.Scan(
+			&genre.ID,
+			&genre.Name,
+			&genre.ParentID,
+			&genre.CreatedAt,
+			&genre.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		genres = append(genres, &genre)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return genres, nil
+}
+
+// Ancestors returns the path from the root of the tree down to the parent of
+// the given genre.
+func (m *GenreModel) Ancestors(id int64) ([]*Genre, error) {
+	query := `
+		WITH RECURSIVE path AS (
+			SELECT id, name, parent_id, created_at, version, 0 AS depth
+			FROM genres WHERE id = (SELECT parent_id FROM genres WHERE id = $1)
+			UNION ALL
+			SELECT g.id, g.name, g.parent_id, g.created_at, g.version, p.depth + 1
+			FROM genres g JOIN path p ON g.id = p.parent_id
+		)
+		SELECT id, name, parent_id, created_at, version
+		FROM path
+		ORDER BY depth DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ancestors := []*Genre{}
+
+	for rows.Next() {
+		var genre Genre
+		err := rows.Scan(&genre.ID, &genre.Name, &genre.ParentID, &genre.CreatedAt, &genre.Version)
+		if err != nil {
+			return nil, err
+		}
+		ancestors = append(ancestors, &genre)
+	}
+
+	return ancestors, rows.Err()
+}
+
+// BuildGenreTree nests a flat list of genres under their parents and returns
+// the roots. Genres whose parent is not in the list are treated as roots.
+func BuildGenreTree(genres []*Genre) []*Genre {
+	byID := make(map[int64]*Genre, len(genres))
+	for _, genre := range genres {
+		genre.Children = nil
+		byID[genre.ID] = genre
+	}
+
+	roots := []*Genre{}
+	for _, genre := range genres {
+		if genre.ParentID != nil {
+			if parent, ok := byID[*genre.ParentID]; ok {
+				parent.Children = append(parent.Children, genre)
+				continue
+			}
+		}
+		roots = append(roots, genre)
+	}
+
+	return roots
+}
+
+// setBookGenres replaces the genres assigned to a book.
+func setBookGenres(ctx context.Context, q Queryer, bookID int64, genreIDs []int64) error {
+	_, err := q.ExecContext(ctx, `DELETE FROM book_genres WHERE book_id = $1`, bookID)
+	if err != nil {
+		return err
+	}
+
+	if len(genreIDs) == 0 {
+		return nil
+	}
+
+	query := `
+		INSERT INTO book_genres (book_id, genre_id)
+		SELECT $1, id FROM genres WHERE id = ANY($2)
+		ON CONFLICT DO NOTHING`
+
+	result, err := q.ExecContext(ctx, query, bookID, pq.Array(genreIDs))
+	if err != nil {
+		return err
+	}
+
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if int(inserted) != len(uniqueIDs(genreIDs)) {
+		return ErrUnknownGenre
+	}
+
+	return nil
+}
+
+// loadBookGenres fills in Genres for every book with a single query.
+func loadBookGenres(ctx context.Context, q Queryer, books ...*Book) error {
+	byID := make(map[int64]*Book, len(books))
+	ids := make([]int64, 0, len(books))
+	for _, book := range books {
+		book.Genres = []*BookGenre{}
+		byID[book.ID] = book
+		ids = append(ids, book.ID)
+	}
+
+	query := `
+		SELECT bg.book_id, g.id, g.name, g.parent_id
+		FROM book_genres bg
+		JOIN genres g ON g.id = bg.genre_id
+		WHERE bg.book_id = ANY($1)
+		ORDER BY bg.book_id, g.name`
+
+	rows, err := q.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var bookID int64
+		var genre BookGenre
+		err := rows.Scan(&bookID, &genre.ID, &genre.Name, &genre.ParentID)
+		if err != nil {
+			return err
+		}
+		if book, ok := byID[bookID]; ok {
+			book.Genres = append(book.Genres, &genre)
+		}
+	}
+
+	return rows.Err()
+}
+
+func uniqueIDs(ids []int64) []int64 {
+	seen := make(map[int64]bool, len(ids))
+	unique := []int64{}
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
+
+func genreWriteError(err error) error {
+	var pqErr *pq.Error
+	switch {
+	case isUniqueViolation(err):
+		return ErrDuplicateGenre
+	case errors.As(err, &pqErr) && pqErr.Code == "23503":
+		return ErrUnknownGenre
+	default:
+		return err
+	}
+}
+
+// genreByPath returns the id of the last genre in path, such as
+// ["Fiction", "Fantasy"], creating any genre that doesn't exist yet as a
+// child of the one before it. Existing genres keep their current parent.
+func genreByPath(ctx context.Context, q Queryer, path []string) (int64, error) {
+	query := `
+		INSERT INTO genres (name, parent_id)
+		VALUES ($1, $2)
+		ON CONFLICT (lower(name)) DO UPDATE SET name = genres.name
+		RETURNING id`
+
+	var id int64
+	var parentID *int64
+	for _, name := range path {
+		err := q.QueryRowContext(ctx, query, strings.TrimSpace(name), parentID).Scan(&id)
+		if err != nil {
+			return 0, err
+		}
+		parentID = &id
+	}
+
+	return id, nil
+}
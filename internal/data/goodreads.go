@@ -0,0 +1,330 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tchenbz/AWTtest_3/internal/validator"
+)
+
+// GoodreadsEntry is one book from a Goodreads library export.
+type GoodreadsEntry struct {
+	Row            int
+	Title          string
+	Authors        []string
+	ISBN           string
+	ISBN13         string
+	Rating         int
+	Review         string
+	Publisher      string
+	Binding        string
+	PageCount      int
+	Year           int
+	ExclusiveShelf string
+	Shelves        []string
+}
+
+// goodreadsShelfStatus maps Goodreads' built-in shelves to reading list
+// statuses. Every other shelf is a list of books the user wants to read.
+var goodreadsShelfStatus = map[string]string{
+	"read":              "completed",
+	"currently-reading": "currently reading",
+}
+
+// goodreadsBindingFormat maps common Goodreads bindings to edition formats.
+var goodreadsBindingFormat = map[string]string{
+	"hardcover":             "hardcover",
+	"paperback":             "paperback",
+	"mass market paperback": "paperback",
+	"trade paperback":       "paperback",
+	"kindle edition":        "ebook",
+	"ebook":                 "ebook",
+	"nook":                  "ebook",
+	"audiobook":             "audiobook",
+	"audible audio":         "audiobook",
+	"audio cd":              "audiobook",
+}
+
+// ImportGoodreads imports entries into the library of user, recording
+// progress and conflicts on job as it goes. Each entry is written in its own
+// transaction; problems with an entry's data are reported as conflicts and
+// only database failures stop the import.
+func (m *ImportJobModel) ImportGoodreads(job *ImportJob, user *User, entries []*GoodreadsEntry) error {
+	lists := map[string]int64{}
+
+	for i, entry := range entries {
+		err := m.importGoodreadsEntry(job, user, entry, lists)
+		if err != nil {
+			return fmt.Errorf("row %d: %w", entry.Row, err)
+		}
+		job.ProcessedRows++
+
+		if i%25 == 24 {
+			err = m.Update(job)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (m *ImportJobModel) importGoodreadsEntry(job *ImportJob, user *User, entry *GoodreadsEntry, lists map[string]int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := beginTx(ctx, m.DB)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	conflict := func(reason, message string) *ImportConflict {
+		c := &ImportConflict{
+			Row:     entry.Row,
+			Title:   entry.Title,
+			ISBN:    entry.isbn(),
+			Reason:  reason,
+			Message: message,
+		}
+		job.Conflicts = append(job.Conflicts, c)
+		return c
+	}
+
+	book, created, err := matchGoodreadsBook(ctx, tx, entry, conflict)
+	if err != nil || book == nil {
+		return err
+	}
+
+	// Lists created in a transaction that is later rolled back must not be
+	// remembered, so collect them until commit.
+	newLists := map[string]int64{}
+	for _, shelf := range entry.shelves() {
+		listID, ok := lists[shelf]
+		if !ok {
+			listID, err = goodreadsShelfList(ctx, tx, user.ID, shelf)
+			if err != nil {
+				return err
+			}
+			if listID == 0 {
+				listID, err = createGoodreadsShelfList(ctx, tx, user.ID, shelf)
+				if err != nil {
+					return err
+				}
+				job.ListsCreated++
+			}
+			newLists[shelf] = listID
+		}
+
+		_, err = tx.ExecContext(ctx, `INSERT INTO reading_list_books (reading_list_id, book_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`, listID, book.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	reviewed := false
+	switch {
+	case entry.Rating >= 1 && entry.Rating <= 5:
+		var exists bool
+		err = tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM reviews WHERE book_id = $1 AND author_id = $2)`, book.ID, user.ID).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if exists {
+			c := conflict("already_reviewed", "you have already reviewed this book; the Goodreads rating was not imported")
+			c.BookID = book.ID
+			break
+		}
+
+		query := `
+			INSERT INTO reviews (book_id, content, author, author_id, rating)
+			VALUES ($1, $2, $3, $4, $5)`
+		_, err = tx.ExecContext(ctx, query, book.ID, entry.Review, user.Username, user.ID, entry.Rating)
+		if err != nil {
+			return err
+		}
+		reviewed = true
+	case entry.Review != "":
+		c := conflict("unrated_review", "the review has no rating and was not imported")
+		c.BookID = book.ID
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	for shelf, id := range newLists {
+		lists[shelf] = id
+	}
+	if created {
+		job.BooksCreated++
+	} else {
+		job.BooksMatched++
+	}
+	if reviewed {
+		job.ReviewsCreated++
+	}
+
+	return nil
+}
+
+// matchGoodreadsBook finds the book an entry refers to by ISBN-13, ISBN-10
+// and finally title and author, creating it when nothing matches. It returns
+// a nil book when the entry had to be skipped.
+func matchGoodreadsBook(ctx context.Context, q Queryer, entry *GoodreadsEntry, conflict func(reason, message string) *ImportConflict) (*Book, bool, error) {
+	for _, isbn := range []string{entry.ISBN13, entry.ISBN} {
+		isbn = NormalizeISBN(isbn)
+		if isbn == "" {
+			continue
+		}
+
+		book, err := getBookByISBN(ctx, q, isbn)
+		switch {
+		case errors.Is(err, ErrRecordNotFound):
+			continue
+		case err != nil:
+			return nil, false, err
+		}
+
+		if !strings.EqualFold(strings.TrimSpace(book.Title), strings.TrimSpace(entry.Title)) {
+			c := conflict("title_mismatch", fmt.Sprintf("matched by ISBN to %q", book.Title))
+			c.BookID = book.ID
+		}
+		return book, false, nil
+	}
+
+	if len(entry.Authors) > 0 {
+		query := `
+			SELECT b.id
+			FROM books b
+			WHERE LOWER(b.title) = LOWER($1)
+			AND EXISTS (
+				SELECT 1 FROM book_authors ba
+				JOIN authors a ON a.id = ba.author_id
+				WHERE ba.book_id = b.id AND a.normalized_name = $2
+			)
+			ORDER BY b.id`
+
+		rows, err := q.QueryContext(ctx, query, strings.TrimSpace(entry.Title), NormalizeAuthorName(entry.Authors[0]))
+		if err != nil {
+			return nil, false, err
+		}
+		defer rows.Close()
+
+		var ids []int64
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				return nil, false, err
+			}
+			ids = append(ids, id)
+		}
+		if err = rows.Err(); err != nil {
+			return nil, false, err
+		}
+
+		if len(ids) > 0 {
+			if len(ids) > 1 {
+				c := conflict("ambiguous_match", fmt.Sprintf("%d books match this title and author; the oldest was used", len(ids)))
+				c.BookID = ids[0]
+				c.Candidates = ids
+			}
+			return &Book{ID: ids[0]}, false, nil
+		}
+	}
+
+	book := entry.book()
+
+	v := validator.New()
+	ValidateBook(v, book)
+	if !v.IsEmpty() {
+		fields := make([]string, 0, len(v.Errors))
+		for field, message := range v.Errors {
+			fields = append(fields, field+" "+message)
+		}
+		sort.Strings(fields)
+		conflict("invalid_book", "no matching book was found and one could not be created: "+strings.Join(fields, "; "))
+		return nil, false, nil
+	}
+
+	err := insertBook(ctx, q, book)
+	if err != nil {
+		return nil, false, err
+	}
+	return book, true, nil
+}
+
+// book builds a new book from the entry.
+func (e *GoodreadsEntry) book() *Book {
+	book := &Book{
+		Title:     strings.TrimSpace(e.Title),
+		ISBN:      NormalizeISBN(e.isbn()),
+		Publisher: e.Publisher,
+		PageCount: e.PageCount,
+		Format:    goodreadsBindingFormat[strings.ToLower(e.Binding)],
+	}
+	if book.Format == "" && e.Binding != "" {
+		book.Format = "other"
+	}
+	if e.Year > 0 {
+		book.PublicationDate = fmt.Sprintf("%04d-01-01", e.Year)
+	}
+	for _, name := range e.Authors {
+		book.Authors = append(book.Authors, &BookAuthor{Name: name, Role: "author"})
+	}
+	return book
+}
+
+func (e *GoodreadsEntry) isbn() string {
+	if e.ISBN13 != "" {
+		return e.ISBN13
+	}
+	return e.ISBN
+}
+
+// shelves returns the exclusive shelf followed by any other shelves, without
+// duplicates.
+func (e *GoodreadsEntry) shelves() []string {
+	var shelves []string
+	for _, shelf := range append([]string{e.ExclusiveShelf}, e.Shelves...) {
+		shelf = strings.TrimSpace(shelf)
+		if shelf != "" && !validator.PermittedValue(shelf, shelves...) {
+			shelves = append(shelves, shelf)
+		}
+	}
+	return shelves
+}
+
+// goodreadsShelfList returns the id of the user's reading list for shelf, or
+// 0 if there isn't one yet. Re-running an import reuses the same lists.
+func goodreadsShelfList(ctx context.Context, q Queryer, userID int64, shelf string) (int64, error) {
+	var id int64
+	err := q.QueryRowContext(ctx, `SELECT id FROM reading_lists WHERE created_by = $1 AND name = $2 ORDER BY id LIMIT 1`, userID, shelf).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return id, err
+}
+
+func createGoodreadsShelfList(ctx context.Context, q Queryer, userID int64, shelf string) (int64, error) {
+	status, ok := goodreadsShelfStatus[shelf]
+	if !ok {
+		status = "want to read"
+	}
+
+	query := `
+		INSERT INTO reading_lists (name, description, created_by, status)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id`
+
+	var id int64
+	err := q.QueryRowContext(ctx, query, shelf, "Imported from the Goodreads shelf "+shelf, userID, status).Scan(&id)
+	return id, err
+}
@@ -0,0 +1,136 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// IdempotencyKeyTTL is how long the response to a request made with an
+// Idempotency-Key is kept for replaying.
+const IdempotencyKeyTTL = 24 * time.Hour
+
+var (
+	ErrIdempotencyKeyReused     = errors.New("the idempotency key was already used for a different request")
+	ErrIdempotencyKeyInProgress = errors.New("a request with this idempotency key is still being processed")
+)
+
+// IdempotentResponse is the stored response to a request made with an
+// Idempotency-Key.
+type IdempotentResponse struct {
+	Status  int
+	Headers map[string]string
+	Body    []byte
+}
+
+type IdempotencyModel struct {
+	DB Queryer
+}
+
+// Reserve claims key within scope for the request with the given
+// fingerprint. It returns nil when the key is new (or its last use has
+// expired) and the request should go ahead, and the stored response when
+// the request is a retry. A key that was used for a request with another
+// fingerprint, or whose first request hasn't finished yet, is an error.
+func (m *IdempotencyModel) Reserve(scope, key, fingerprint string) (*IdempotentResponse, error) {
+	query := `
+		INSERT INTO idempotency_keys (scope, key, fingerprint)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (scope, key) DO UPDATE
+		SET fingerprint = EXCLUDED.fingerprint, status = NULL, headers = NULL, body = NULL, created_at = CURRENT_TIMESTAMP
+		WHERE idempotency_keys.created_at < $4
+		RETURNING key`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var reserved string
+	err := m.DB.QueryRowContext(ctx, query, scope, key, fingerprint, time.Now().Add(-IdempotencyKeyTTL)).Scan(&reserved)
+	if err == nil {
+		return nil, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	query = `
+		SELECT fingerprint, status, headers, body
+		FROM idempotency_keys
+		WHERE scope = $1 AND key = $2`
+
+	var stored string
+	var status sql.NullInt64
+	var headers, body []byte
+	err = m.DB.QueryRowContext(ctx, query, scope, key).Scan(&stored, &status, &headers, &body)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case stored != fingerprint:
+		return nil, ErrIdempotencyKeyReused
+	case !status.Valid:
+		return nil, ErrIdempotencyKeyInProgress
+	}
+
+	resp := &IdempotentResponse{Status: int(status.Int64), Body: body}
+	if len(headers) > 0 {
+		err = json.Unmarshal(headers, &resp.Headers)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+// Save stores the response to the request that reserved key.
+func (m *IdempotencyModel) Save(scope, key string, resp *IdempotentResponse) error {
+	headers, err := json.Marshal(resp.Headers)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE idempotency_keys
+		SET status = $3, headers = $4, body = $5
+		WHERE scope = $1 AND key = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err = m.DB.ExecContext(ctx, query, scope, key, resp.Status, headers, resp.Body)
+	return err
+}
+
+// Release gives up a reserved key without storing a response, so that the
+// request can be retried.
+func (m *IdempotencyModel) Release(scope, key string) error {
+	query := `
+		DELETE FROM idempotency_keys
+		WHERE scope = $1 AND key = $2 AND status IS NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, scope, key)
+	return err
+}
+
+// DeleteExpired removes the keys whose responses are no longer replayed and
+// returns how many there were.
+func (m *IdempotencyModel) DeleteExpired() (int64, error) {
+	query := `
+		DELETE FROM idempotency_keys
+		WHERE created_at < $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, time.Now().Add(-IdempotencyKeyTTL))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,242 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	ImportQueued    = "queued"
+	ImportRunning   = "running"
+	ImportCompleted = "completed"
+	ImportFailed    = "failed"
+)
+
+// ImportJob tracks a long running import started by a user.
+type ImportJob struct {
+	ID             int64             `json:"id"`
+	UserID         int64             `json:"user_id"`
+	Source         string            `json:"source"`
+	Status         string            `json:"status"`
+	TotalRows      int               `json:"total_rows"`
+	ProcessedRows  int               `json:"processed_rows"`
+	BooksCreated   int               `json:"books_created"`
+	BooksMatched   int               `json:"books_matched"`
+	ListsCreated   int               `json:"lists_created"`
+	ReviewsCreated int               `json:"reviews_created"`
+	Conflicts      []*ImportConflict `json:"conflicts,omitempty"`
+	Error          string            `json:"error,omitempty"`
+	CreatedAt      time.Time         `json:"created_at"`
+	FinishedAt     *time.Time        `json:"finished_at"`
+	Version        int32             `json:"version"`
+}
+
+// ImportConflict describes a row that was imported with a guess, or that
+// could not be imported at all. Reason is a stable code; Message explains it.
+type ImportConflict struct {
+	Row        int     `json:"row"`
+	Title      string  `json:"title"`
+	ISBN       string  `json:"isbn,omitempty"`
+	Reason     string  `json:"reason"`
+	Message    string  `json:"message"`
+	BookID     int64   `json:"book_id,omitempty"`
+	Candidates []int64 `json:"candidates,omitempty"`
+}
+
+// Progress is the percentage of rows processed so far.
+func (j *ImportJob) Progress() float64 {
+	if j.TotalRows == 0 {
+		if j.Status == ImportCompleted {
+			return 100
+		}
+		return 0
+	}
+	return float64(j.ProcessedRows) * 100 / float64(j.TotalRows)
+}
+
+// MarshalJSON adds the computed progress to the job's JSON representation.
+func (j *ImportJob) MarshalJSON() ([]byte, error) {
+	type job ImportJob
+	return json.Marshal(struct {
+		*job
+		Progress float64 `json:"progress"`
+	}{(*job)(j), j.Progress()})
+}
+
+type ImportJobModel struct {
+	DB Queryer
+}
+
+func (m *ImportJobModel) Insert(job *ImportJob) error {
+	query := `
+		INSERT INTO import_jobs (user_id, source, status, total_rows)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, version`
+
+	if job.Status == "" {
+		job.Status = ImportQueued
+	}
+	if job.Conflicts == nil {
+		job.Conflicts = []*ImportConflict{}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, job.UserID, job.Source, job.Status, job.TotalRows).Scan(&job.ID, &job.CreatedAt, &job.Version)
+}
+
+// Get returns the import job with the given id if it belongs to userID.
+func (m *ImportJobModel) Get(id, userID int64) (*ImportJob, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT ` + importJobColumns + `
+		FROM import_jobs
+		WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var job ImportJob
+	var conflicts []byte
+	err := m.DB.QueryRowContext(ctx, query, id, userID).Scan(job.scanDest(&conflicts)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	err = json.Unmarshal(conflicts, &job.Conflicts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+// Update saves the job's status, counters and conflicts. It is called
+// repeatedly while an import runs to publish its progress.
+func (m *ImportJobModel) Update(job *ImportJob) error {
+	conflicts, err := json.Marshal(job.Conflicts)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE import_jobs
+		SET status = $1, total_rows = $2, processed_rows = $3, books_created = $4,
+			books_matched = $5, lists_created = $6, reviews_created = $7,
+			conflicts = $8, error = $9, finished_at = $10, version = version + 1
+		WHERE id = $11
+		RETURNING version`
+
+	args := []any{
+		job.Status, job.TotalRows, job.ProcessedRows, job.BooksCreated,
+		job.BooksMatched, job.ListsCreated, job.ReviewsCreated,
+		conflicts, job.Error, job.FinishedAt, job.ID,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&job.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Finish marks the job as completed, or as failed with err.
+func (m *ImportJobModel) Finish(job *ImportJob, err error) error {
+	now := time.Now()
+	job.FinishedAt = &now
+	job.Status = ImportCompleted
+	if err != nil {
+		job.Status = ImportFailed
+		job.Error = err.Error()
+	}
+	return m.Update(job)
+}
+
+// GetAllForUser lists the user's import jobs. Conflict reports are left out;
+// fetch a single job to see them.
+func (m *ImportJobModel) GetAllForUser(userID int64, filters Filters) ([]*ImportJob, Metadata, error) {
+	var qb queryBuilder
+	qb.where("user_id = " + qb.arg(userID))
+	qb.applyFilters(filters)
+
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), %s
+		FROM import_jobs
+		%s
+		ORDER BY %s %s, id ASC
+		LIMIT %s OFFSET %s`, importJobColumns, qb.whereClause(), filters.sortColumn(), filters.sortDirection(), qb.arg(filters.limit()), qb.arg(filters.offset()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, qb.args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	jobs := []*ImportJob{}
+
+	for rows.Next() {
+		var job ImportJob
+		var conflicts []byte
+		err := rows.Scan(append([]any{&totalRecords}, job.scanDest(&conflicts)...)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		job.Conflicts = nil
+		jobs = append(jobs, &job)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
+	return jobs, metadata, nil
+}
+
+const importJobColumns = `id, user_id, source, status, total_rows, processed_rows, books_created, books_matched, lists_created, reviews_created, conflicts, error, created_at, finished_at, version`
+
+func (j *ImportJob) scanDest(conflicts *[]byte) []any {
+	return []any{
+		&j.ID,
+		&j.UserID,
+		&j.Source,
+		&j.Status,
+		&j.TotalRows,
+		&j.ProcessedRows,
+		&j.BooksCreated,
+		&j.BooksMatched,
+		&j.ListsCreated,
+		&j.ReviewsCreated,
+		conflicts,
+		&j.Error,
+		&j.CreatedAt,
+		&j.FinishedAt,
+		&j.Version,
+	}
+}
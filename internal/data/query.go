@@ -0,0 +1,97 @@
+package data
+
+import (
+	"fmt"
+	"strings"
+)
+
+// queryBuilder collects WHERE conditions and their positional arguments so
+// that list queries can be assembled dynamically without ever interpolating
+// user supplied values into the SQL text.
+type queryBuilder struct {
+	conditions []string
+	args       []any
+	// renderers overrides how filter expressions on particular fields are
+	// turned into SQL, for fields that don't map onto a single column.
+	renderers map[string]filterRenderer
+}
+
+type filterRenderer func(c FilterCondition) string
+
+// arg registers a query argument and returns its placeholder ($1, $2, ...).
+func (b *queryBuilder) arg(value any) string {
+	b.args = append(b.args, value)
+	return fmt.Sprintf("$%d", len(b.args))
+}
+
+func (b *queryBuilder) where(condition string) {
+	b.conditions = append(b.conditions, condition)
+}
+
+func (b *queryBuilder) whereClause() string {
+	if len(b.conditions) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(b.conditions, " AND ")
+}
+
+// applyFilters adds a condition for every filter expression in f. The column
+// names come from the filter safe list, never from the request itself.
+func (b *queryBuilder) applyFilters(f Filters) {
+	for _, c := range f.Conditions {
+		kind := f.filterType(c.Field)
+		if render, ok := b.renderers[c.Field]; ok {
+			b.where(render(c))
+			continue
+		}
+		b.where(b.filterCondition(c, kind))
+	}
+}
+
+func (b *queryBuilder) filterCondition(c FilterCondition, kind FilterType) string {
+	column := c.Field
+	placeholder := func(value string) string {
+		parsed, err := kind.parse(value)
+		if err != nil {
+			panic("unvalidated filter value: " + value)
+		}
+		if kind == FilterText {
+			return "LOWER(" + b.arg(parsed) + ")"
+		}
+		return b.arg(parsed)
+	}
+	if kind == FilterText && c.Operator != "contains" {
+		column = "LOWER(" + column + ")"
+	}
+
+	switch c.Operator {
+	case "eq":
+		return column + " = " + placeholder(c.Value)
+	case "ne":
+		return column + " <> " + placeholder(c.Value)
+	case "gt":
+		return column + " > " + placeholder(c.Value)
+	case "gte":
+		return column + " >= " + placeholder(c.Value)
+	case "lt":
+		return column + " < " + placeholder(c.Value)
+	case "lte":
+		return column + " <= " + placeholder(c.Value)
+	case "in", "nin":
+		placeholders := []string{}
+		for _, value := range c.values() {
+			placeholders = append(placeholders, placeholder(value))
+		}
+		operator := " IN "
+		if c.Operator == "nin" {
+			operator = " NOT IN "
+		}
+		return column + operator + "(" + strings.Join(placeholders, ", ") + ")"
+	case "between":
+		values := c.values()
+		return column + " BETWEEN " + placeholder(values[0]) + " AND " + placeholder(values[1])
+	case "contains":
+		return column + " ILIKE '%' || " + b.arg(c.Value) + " || '%'"
+	}
+	panic("unsafe filter operator: " + c.Operator)
+}
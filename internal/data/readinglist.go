@@ -5,7 +5,11 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
+
+	"github.com/lib/pq"
+	"github.com/tchenbz/AWTtest_3/internal/validator"
 )
 
 type ReadingList struct {
@@ -17,10 +21,69 @@ type ReadingList struct {
 	Status      string    `json:"status"`     
 	CreatedAt   time.Time `json:"created_at"`
 	Version     int32     `json:"version"`
+	// BookDetails is only loaded when a request includes it.
+	BookDetails []*Book `json:"book_details,omitempty"`
+}
+
+// readingListFields lists the columns of a reading list by the name of the
+// field they load.
+var readingListFields = []fieldColumn{
+	{"id", "id"},
+	{"name", "name"},
+	{"description", "description"},
+	{"created_by", "created_by"},
+	{"status", "status"},
+	{"created_at", "created_at"},
+	{"version", "version"},
+}
+
+// ReadingListFieldSafeList lists the fields a ?fields= parameter may select
+// on a reading list. books is the list of book ids on it.
+var ReadingListFieldSafeList = []string{"id", "name", "description", "created_by", "books", "status", "created_at", "version"}
+
+// ReadingListIncludeSafeList lists the related data ?include= may embed in a
+// reading list.
+var ReadingListIncludeSafeList = []string{"book_details"}
+
+func (l *ReadingList) fieldDest(name string) any {
+	switch name {
+	case "id":
+		return &l.ID
+	case "name":
+		return &l.Name
+	case "description":
+		return &l.Description
+	case "created_by":
+		return &l.CreatedBy
+	case "status":
+		return &l.Status
+	case "created_at":
+		return &l.CreatedAt
+	case "version":
+		return &l.Version
+	}
+	panic("unknown reading list field: " + name)
+}
+
+var ErrUnknownBook = errors.New("unknown book")
+
+// ReadingListStatuses lists the statuses a reading list can have.
+var ReadingListStatuses = []string{"want to read", "currently reading", "completed"}
+
+func ValidateReadingList(v *validator.Validator, readingList *ReadingList) {
+	v.Check(strings.TrimSpace(readingList.Name) != "", "name", "must be provided")
+	v.Check(len(readingList.Name) <= 255, "name", "must not be more than 255 bytes long")
+	v.Check(validator.PermittedValue(readingList.Status, ReadingListStatuses...), "status", "must be one of want to read, currently reading or completed")
+	for _, id := range readingList.Books {
+		if id < 1 {
+			v.AddError("books", "must only contain book ids")
+			break
+		}
+	}
 }
 
 type ReadingListModel struct {
-	DB *sql.DB
+	DB Queryer
 }
 
 func (m *ReadingListModel) Insert(readingList *ReadingList) error {
@@ -49,12 +112,19 @@ func (m *ReadingListModel) Insert(readingList *ReadingList) error {
 
 
 func (m *ReadingListModel) Get(id int64) (*ReadingList, error) {
+	return m.GetProjected(id, Projection{})
+}
+
+// GetProjected returns a reading list with only the fields p asks for
+// loaded.
+func (m *ReadingListModel) GetProjected(id int64, p Projection) (*ReadingList, error) {
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
 
+	columns := p.columns(readingListFields)
 	query := `
-		SELECT id, name, description, created_by, status, created_at, version
+		SELECT ` + columnList(columns) + `
 		FROM reading_lists
 		WHERE id = $1`
 
@@ -63,15 +133,7 @@ func (m *ReadingListModel) Get(id int64) (*ReadingList, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, id).Scan(
-		&readingList.ID,
-		&readingList.Name,
-		&readingList.Description,
-		&readingList.CreatedBy,
-		&readingList.Status,
-		&readingList.CreatedAt,
-		&readingList.Version,
-	)
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(fieldDests(columns, readingList.fieldDest)...)
 
 	if err != nil {
 		switch {
@@ -82,9 +144,173 @@ func (m *ReadingListModel) Get(id int64) (*ReadingList, error) {
 		}
 	}
 
+	if p.Wants("books") || p.Includes("book_details") {
+		err = loadReadingListBooks(ctx, m.DB, &readingList)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &readingList, nil
 }
 
+// loadReadingListBooks fills in the ids of the books on the reading lists
+// with one query for all of them.
+func loadReadingListBooks(ctx context.Context, q Queryer, readingLists ...*ReadingList) error {
+	if len(readingLists) == 0 {
+		return nil
+	}
+
+	byID := make(map[int64]*ReadingList, len(readingLists))
+	ids := make([]int64, 0, len(readingLists))
+	for _, readingList := range readingLists {
+		readingList.Books = []int64{}
+		byID[readingList.ID] = readingList
+		ids = append(ids, readingList.ID)
+	}
+
+	query := `
+		SELECT reading_list_id, book_id
+		FROM reading_list_books
+		WHERE reading_list_id = ANY($1)
+		ORDER BY reading_list_id, book_id`
+
+	rows, err := q.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var readingListID, bookID int64
+		if err := rows.Scan(&readingListID, &bookID); err != nil {
+			return err
+		}
+		if readingList, ok := byID[readingListID]; ok {
+			readingList.Books = append(readingList.Books, bookID)
+		}
+	}
+
+	return rows.Err()
+}
+
+// Include loads the related data p asks for into the reading lists: the
+// books on them, fetched together for every list.
+func (m *ReadingListModel) Include(readingLists []*ReadingList, p Projection) error {
+	if !p.Includes("book_details") || len(readingLists) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	ids := []int64{}
+	for _, readingList := range readingLists {
+		ids = append(ids, readingList.Books...)
+	}
+
+	books, err := getBooks(ctx, m.DB, ids)
+	if err != nil {
+		return err
+	}
+
+	byID := make(map[int64]*Book, len(books))
+	for _, book := range books {
+		byID[book.ID] = book
+	}
+	for _, readingList := range readingLists {
+		readingList.BookDetails = []*Book{}
+		for _, id := range readingList.Books {
+			if book, ok := byID[id]; ok {
+				readingList.BookDetails = append(readingList.BookDetails, book)
+			}
+		}
+	}
+
+	return nil
+}
+
+// GetAllForUsers returns the reading lists each of the users created, with
+// the ids of the books on them, keyed by user id. Users without reading
+// lists map to an empty slice.
+func (m *ReadingListModel) GetAllForUsers(userIDs []int64) (map[int64][]*ReadingList, error) {
+	byID := make(map[int64]*User, len(userIDs))
+	ids := uniqueIDs(userIDs)
+	for _, id := range ids {
+		byID[id] = &User{ID: id}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := loadUserReadingLists(ctx, m.DB, byID, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	readingLists := make(map[int64][]*ReadingList, len(byID))
+	for id, user := range byID {
+		readingLists[id] = user.ReadingLists
+	}
+	return readingLists, nil
+}
+
+// AddBook appends a book to a reading list. Adding a book that is already on
+// the list is a no-op.
+func (m *ReadingListModel) AddBook(readingListID, bookID int64) error {
+	query := `
+		INSERT INTO reading_list_books (reading_list_id, book_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, readingListID, bookID)
+	return err
+}
+
+// ReadingListEntry records when a book was added to a reading list.
+type ReadingListEntry struct {
+	BookID  int64     `json:"book_id"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+// RecentBooks returns the last limit books added to a reading list, the most
+// recent first.
+func (m *ReadingListModel) RecentBooks(readingListID int64, limit int) ([]*ReadingListEntry, error) {
+	query := `
+		SELECT book_id, added_at
+		FROM reading_list_books
+		WHERE reading_list_id = $1
+		ORDER BY added_at DESC, book_id DESC
+		LIMIT $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, readingListID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []*ReadingListEntry{}
+	for rows.Next() {
+		var entry ReadingListEntry
+		err := rows.Scan(&entry.BookID, &entry.AddedAt)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, &entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// Update saves a reading list. When its Books are set, the books on the list
+// are made to match them; books that stay on the list keep the time they
+// were added.
 func (m *ReadingListModel) Update(readingList *ReadingList) error {
 	query := `
 		UPDATE reading_lists
@@ -103,7 +329,13 @@ func (m *ReadingListModel) Update(readingList *ReadingList) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&readingList.Version)
+	tx, err := beginTx(ctx, m.DB)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&readingList.Version)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -113,6 +345,38 @@ func (m *ReadingListModel) Update(readingList *ReadingList) error {
 		}
 	}
 
+	if readingList.Books != nil {
+		err = setReadingListBooks(ctx, tx, readingList.ID, readingList.Books)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func setReadingListBooks(ctx context.Context, q Queryer, readingListID int64, bookIDs []int64) error {
+	ids := pq.Array(uniqueIDs(bookIDs))
+
+	_, err := q.ExecContext(ctx, `
+		DELETE FROM reading_list_books
+		WHERE reading_list_id = $1 AND NOT (book_id = ANY($2))`, readingListID, ids)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.ExecContext(ctx, `
+		INSERT INTO reading_list_books (reading_list_id, book_id)
+		SELECT $1, UNNEST($2::bigint[])
+		ON CONFLICT DO NOTHING`, readingListID, ids)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+			return ErrUnknownBook
+		}
+		return err
+	}
+
 	return nil
 }
 
@@ -146,25 +410,40 @@ func (m *ReadingListModel) Delete(id int64) error {
 }
 
 func (m *ReadingListModel) GetAll(name, status string, filters Filters) ([]*ReadingList, Metadata, error) {
+	var qb queryBuilder
+	if name != "" {
+		qb.where("name ILIKE " + qb.arg("%"+name+"%"))
+	}
+	if status != "" {
+		qb.where("status ILIKE " + qb.arg("%"+status+"%"))
+	}
+	qb.applyFilters(filters)
+
+	return m.list(&qb, filters)
+}
+
+func (m *ReadingListModel) GetAllByUser(userID int64, filters Filters) ([]*ReadingList, Metadata, error) {
+	var qb queryBuilder
+	qb.where("created_by = " + qb.arg(userID))
+
+	return m.list(&qb, filters)
+}
+
+// list runs a paginated reading list query with the conditions collected in
+// qb, loading only the columns in filters.Projection.
+func (m *ReadingListModel) list(qb *queryBuilder, filters Filters) ([]*ReadingList, Metadata, error) {
+	columns := filters.Projection.columns(readingListFields)
 	query := fmt.Sprintf(`
-		SELECT COUNT(*) OVER(), id, name, description, created_by, status, created_at, version
+		SELECT COUNT(*) OVER(), %s
 		FROM reading_lists
-		WHERE (name ILIKE $1 OR $1 = '')
-		AND (status ILIKE $2 OR $2 = '')
+		%s
 		ORDER BY %s %s, id ASC
-		LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
-
-	args := []interface{}{
-		"%" + name + "%",
-		"%" + status + "%",
-		filters.limit(),
-		filters.offset(),
-	}
+		LIMIT %s OFFSET %s`, columnList(columns), qb.whereClause(), filters.sortColumn(), filters.sortDirection(), qb.arg(filters.limit()), qb.arg(filters.offset()))
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	rows, err := m.DB.QueryContext(ctx, query, args...)
+	rows, err := m.DB.QueryContext(ctx, query, qb.args...)
 	if err != nil {
 		return nil, Metadata{}, err
 	}
@@ -175,16 +454,7 @@ func (m *ReadingListModel) GetAll(name, status string, filters Filters) ([]*Read
 
 	for rows.Next() {
 		var readingList ReadingList
-		err := rows.Scan(
-			&totalRecords,
-			&readingList.ID,
-			&readingList.Name,
-			&readingList.Description,
-			&readingList.CreatedBy,
-			&readingList.Status,
-			&readingList.CreatedAt,
-			&readingList.Version,
-		)
+		err := rows.Scan(append([]any{&totalRecords}, fieldDests(columns, readingList.fieldDest)...)...)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
@@ -195,61 +465,13 @@ func (m *ReadingListModel) GetAll(name, status string, filters Filters) ([]*Read
 		return nil, Metadata{}, err
 	}
 
+	if filters.Projection.Wants("books") || filters.Projection.Includes("book_details") {
+		err = loadReadingListBooks(ctx, m.DB, readingLists...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+	}
+
 	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
 	return readingLists, metadata, nil
 }
-
-func (m *ReadingListModel) GetAllByUser(userID int64, filters Filters) ([]*ReadingList, Metadata, error) {
-    // Construct the SQL query
-    query := fmt.Sprintf(`
-        SELECT COUNT(*) OVER(), id, name, description, created_by, status, created_at, version
-        FROM reading_lists
-        WHERE created_by = $1
-        ORDER BY %s %s, id ASC
-        LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
-
-    // Arguments for the query
-    args := []interface{}{
-        userID,
-        filters.limit(),
-        filters.offset(),
-    }
-
-    ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-    defer cancel()
-
-    rows, err := m.DB.QueryContext(ctx, query, args...)
-    if err != nil {
-        return nil, Metadata{}, err
-    }
-    defer rows.Close()
-
-    totalRecords := 0
-    readingLists := []*ReadingList{}
-
-    for rows.Next() {
-        var readingList ReadingList
-        err := rows.Scan(
-            &totalRecords,
-            &readingList.ID,
-            &readingList.Name,
-            &readingList.Description,
-            &readingList.CreatedBy,
-            &readingList.Status,
-            &readingList.CreatedAt,
-            &readingList.Version,
-        )
-        if err != nil {
-            return nil, Metadata{}, err
-        }
-        readingLists = append(readingLists, &readingList)
-    }
-
-    if err = rows.Err(); err != nil {
-        return nil, Metadata{}, err
-    }
-
-    metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
-    return readingLists, metadata, nil
-}
-
@@ -6,7 +6,11 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"strings"
 	"time"
+
+	"github.com/lib/pq"
+	"github.com/tchenbz/AWTtest_3/internal/validator"
 )
 
 var ErrRecordNotFound = errors.New("record not found")
@@ -20,10 +24,66 @@ type Review struct {
 	HelpfulCount int       `json:"helpful_count"`  
 	CreatedAt    time.Time `json:"created_at"`
 	Version      int32     `json:"version"`
+	// Book is only loaded when a request includes it.
+	Book *Book `json:"book,omitempty"`
+}
+
+// reviewFields lists the columns of a review by the name of the field they
+// load.
+var reviewFields = []fieldColumn{
+	{"id", "id"},
+	{"book_id", "book_id"},
+	{"content", "content"},
+	{"author", "author"},
+	{"rating", "rating"},
+	{"helpful_count", "helpful_count"},
+	{"created_at", "created_at"},
+	{"version", "version"},
+}
+
+// ReviewFieldSafeList lists the fields a ?fields= parameter may select on a
+// review.
+var ReviewFieldSafeList = []string{"id", "book_id", "content", "author", "rating", "helpful_count", "created_at", "version"}
+
+// ReviewIncludeSafeList lists the related data ?include= may embed in a
+// review.
+var ReviewIncludeSafeList = []string{"book"}
+
+func (r *Review) scanDest() []any {
+	return fieldDests(reviewFields, r.fieldDest)
+}
+
+func (r *Review) fieldDest(name string) any {
+	switch name {
+	case "id":
+		return &r.ID
+	case "book_id":
+		return &r.BookID
+	case "content":
+		return &r.Content
+	case "author":
+		return &r.Author
+	case "rating":
+		return &r.Rating
+	case "helpful_count":
+		return &r.HelpfulCount
+	case "created_at":
+		return &r.CreatedAt
+	case "version":
+		return &r.Version
+	}
+	panic("unknown review field: " + name)
+}
+
+func ValidateReview(v *validator.Validator, review *Review) {
+	v.Check(strings.TrimSpace(review.Content) != "", "content", "must be provided")
+	v.Check(len(review.Author) <= 255, "author", "must not be more than 255 bytes long")
+	v.Check(review.Rating >= 0 && review.Rating <= 5, "rating", "must be between 0 and 5")
+	v.Check(review.HelpfulCount >= 0, "helpful_count", "must not be negative")
 }
 
 type ReviewModel struct {
-	DB *sql.DB
+	DB Queryer
 }
 
 func (m ReviewModel) Insert(review *Review) error {
@@ -41,12 +101,18 @@ func (m ReviewModel) Insert(review *Review) error {
 }
 
 func (m *ReviewModel) Get(bookID, reviewID int64) (*Review, error) {
+    return m.GetProjected(bookID, reviewID, Projection{})
+}
+
+// GetProjected returns a review with only the fields p asks for loaded.
+func (m *ReviewModel) GetProjected(bookID, reviewID int64, p Projection) (*Review, error) {
     if bookID < 1 || reviewID < 1 {
         return nil, ErrRecordNotFound
     }
 
+    columns := p.columns(reviewFields, "book_id")
     query := `
-        SELECT id, book_id, content, author, rating, helpful_count, created_at, version
+        SELECT ` + columnList(columns) + `
         FROM reviews
         WHERE book_id = $1 AND id = $2`
 
@@ -54,16 +120,7 @@ func (m *ReviewModel) Get(bookID, reviewID int64) (*Review, error) {
     ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
     defer cancel()
 
-    err := m.DB.QueryRowContext(ctx, query, bookID, reviewID).Scan(
-        &review.ID,
-        &review.BookID,
-        &review.Content,
-        &review.Author,
-        &review.Rating,
-        &review.HelpfulCount,
-        &review.CreatedAt,
-        &review.Version,
-    )
+    err := m.DB.QueryRowContext(ctx, query, bookID, reviewID).Scan(fieldDests(columns, review.fieldDest)...)
 
 	if err != nil {
         // Log the error message
@@ -136,28 +193,93 @@ func (m ReviewModel) Delete(bookID, reviewID int64) error {
 	return nil
 }
 
+// RatingSummary returns how many reviews of a book carry a rating and
+// their average.
+func (m *ReviewModel) RatingSummary(bookID int64) (int, float64, error) {
+	query := `
+		SELECT COUNT(rating), COALESCE(AVG(rating), 0)
+		FROM reviews
+		WHERE book_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var count int
+	var average float64
+	err := m.DB.QueryRowContext(ctx, query, bookID).Scan(&count, &average)
+	return count, average, err
+}
+
+// reviewConditions adds the fixed content/author/rating filters shared by the
+// review list queries. Empty values and a zero rating match everything.
+func reviewConditions(qb *queryBuilder, content, author string, rating int) {
+	if content != "" {
+		qb.where("content ILIKE " + qb.arg("%"+content+"%"))
+	}
+	if author != "" {
+		qb.where("author ILIKE " + qb.arg("%"+author+"%"))
+	}
+	if rating != 0 {
+		qb.where("rating = " + qb.arg(rating))
+	}
+}
+
 func (m ReviewModel) GetAll(content, author string, rating int, filters Filters) ([]*Review, Metadata, error) {
+	var qb queryBuilder
+	reviewConditions(&qb, content, author, rating)
+	qb.applyFilters(filters)
+
+	return m.list(&qb, filters)
+}
+
+func (m ReviewModel) GetAllForBook(bookID int64, content, author string, rating int, filters Filters) ([]*Review, Metadata, error) {
+	var qb queryBuilder
+	qb.where("book_id = " + qb.arg(bookID))
+	reviewConditions(&qb, content, author, rating)
+	qb.applyFilters(filters)
+
+	return m.list(&qb, filters)
+}
+
+// GetAllForWork returns the reviews of every edition of a work.
+func (m ReviewModel) GetAllForWork(workID int64, content, author string, rating int, filters Filters) ([]*Review, Metadata, error) {
+	var qb queryBuilder
+	qb.where("book_id IN (SELECT id FROM books WHERE work_id = " + qb.arg(workID) + ")")
+	reviewConditions(&qb, content, author, rating)
+	qb.applyFilters(filters)
+
+	return m.list(&qb, filters)
+}
+
+// GetAllByUser returns the reviews written by a user: those linked to the
+// user's account, and older ones whose author is the user's id.
+func (m *ReviewModel) GetAllByUser(userID int64, filters Filters) ([]*Review, Metadata, error) {
+	var qb queryBuilder
+	qb.where(reviewByUserCondition(&qb, userID))
+
+	return m.list(&qb, filters)
+}
+
+func reviewByUserCondition(qb *queryBuilder, userID int64) string {
+	placeholder := qb.arg(userID)
+	return "(author_id = " + placeholder + " OR author = " + placeholder + "::text)"
+}
+
+// list runs a paginated review query with the conditions collected in qb,
+// loading only the columns in filters.Projection.
+func (m ReviewModel) list(qb *queryBuilder, filters Filters) ([]*Review, Metadata, error) {
+	columns := filters.Projection.columns(reviewFields, "book_id")
 	query := fmt.Sprintf(`
-		SELECT COUNT(*) OVER(), id, book_id, content, author, rating, helpful_count, created_at, version
+		SELECT COUNT(*) OVER(), %s
 		FROM reviews
-		WHERE (content ILIKE $1 OR $1 = '')
-		AND (author ILIKE $2 OR $2 = '')
-		AND (rating = $3 OR $3 = 0)
+		%s
 		ORDER BY %s %s, id ASC
-		LIMIT $4 OFFSET $5`, filters.sortColumn(), filters.sortDirection())
-
-	args := []interface{}{
-		"%" + content + "%",
-		"%" + author + "%",
-		rating,
-		filters.limit(),
-		filters.offset(),
-	}
+		LIMIT %s OFFSET %s`, columnList(columns), qb.whereClause(), filters.sortColumn(), filters.sortDirection(), qb.arg(filters.limit()), qb.arg(filters.offset()))
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	rows, err := m.DB.QueryContext(ctx, query, args...)
+	rows, err := m.DB.QueryContext(ctx, query, qb.args...)
 	if err != nil {
 		return nil, Metadata{}, err
 	}
@@ -168,17 +290,7 @@ func (m ReviewModel) GetAll(content, author string, rating int, filters Filters)
 
 	for rows.Next() {
 		var review Review
-		err := rows.Scan(
-			&totalRecords,
-			&review.ID,
-			&review.BookID,
-			&review.Content,
-			&review.Author,
-			&review.Rating,
-			&review.HelpfulCount,
-			&review.CreatedAt,
-			&review.Version,
-		)
+		err := rows.Scan(append([]any{&totalRecords}, fieldDests(columns, review.fieldDest)...)...)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
@@ -193,114 +305,156 @@ func (m ReviewModel) GetAll(content, author string, rating int, filters Filters)
 	return reviews, metadata, nil
 }
 
-func (m ReviewModel) GetAllForBook(bookID int64, content, author string, rating int, filters Filters) ([]*Review, Metadata, error) {
-	query := fmt.Sprintf(`
-		SELECT COUNT(*) OVER(), id, book_id, content, author, rating, helpful_count, created_at, version
-		FROM reviews
-		WHERE book_id = $1
-		AND (content ILIKE $2 OR $2 = '')
-		AND (author ILIKE $3 OR $3 = '')
-		AND (rating = $4 OR $4 = 0)
-		ORDER BY %s %s, id ASC
-		LIMIT $5 OFFSET $6`, filters.sortColumn(), filters.sortDirection())
-
-	args := []interface{}{
-		bookID,
-		"%" + content + "%",
-		"%" + author + "%",
-		rating,
-		filters.limit(),
-		filters.offset(),
+// Include loads the related data p asks for into the reviews.
+func (m ReviewModel) Include(reviews []*Review, p Projection) error {
+	if !p.Includes("book") || len(reviews) == 0 {
+		return nil
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	rows, err := m.DB.QueryContext(ctx, query, args...)
+	ids := make([]int64, len(reviews))
+	for i, review := range reviews {
+		ids[i] = review.BookID
+	}
+
+	books, err := getBooks(ctx, m.DB, ids)
 	if err != nil {
-		return nil, Metadata{}, err
+		return err
 	}
-	defer rows.Close()
 
-	totalRecords := 0
-	reviews := []*Review{}
+	byID := make(map[int64]*Book, len(books))
+	for _, book := range books {
+		byID[book.ID] = book
+	}
+	for _, review := range reviews {
+		review.Book = byID[review.BookID]
+	}
+
+	return nil
+}
+
+// ReviewOrders lists the orders GetTopForBooks can rank reviews by.
+var ReviewOrders = []string{"helpful", "rating", "newest"}
+
+// reviewOrderClauses maps each of ReviewOrders to its ORDER BY clause.
+var reviewOrderClauses = map[string]string{
+	"helpful": "helpful_count DESC, rating DESC, created_at DESC, id DESC",
+	"rating":  "rating DESC, helpful_count DESC, created_at DESC, id DESC",
+	"newest":  "created_at DESC, id DESC",
+}
+
+// GetTopForBooks returns up to perBook reviews of each of the books, ranked
+// by order, with one query for all of them. The reviews are keyed by book
+// id; books without reviews map to an empty slice.
+func (m *ReviewModel) GetTopForBooks(bookIDs []int64, perBook int, order string) (map[int64][]*Review, error) {
+	orderBy, ok := reviewOrderClauses[order]
+	if !ok {
+		return nil, fmt.Errorf("unknown review order %q", order)
+	}
+
+	ids := uniqueIDs(bookIDs)
+	reviews := make(map[int64][]*Review, len(ids))
+	for _, id := range ids {
+		reviews[id] = []*Review{}
+	}
+	if len(ids) == 0 || perBook < 1 {
+		return reviews, nil
+	}
+
+	query := `
+		SELECT ` + columnList(reviewFields) + `
+		FROM (
+			SELECT *, ROW_NUMBER() OVER (PARTITION BY book_id ORDER BY ` + orderBy + `) AS review_rank
+			FROM reviews
+			WHERE book_id = ANY($1)
+		) ranked
+		WHERE review_rank <= $2
+		ORDER BY book_id, review_rank`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(ids), perBook)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
 	for rows.Next() {
 		var review Review
-		err := rows.Scan(
-			&totalRecords,
-			&review.ID,
-			&review.BookID,
-			&review.Content,
-			&review.Author,
-			&review.Rating,
-			&review.HelpfulCount,
-			&review.CreatedAt,
-			&review.Version,
-		)
+		err := rows.Scan(review.scanDest()...)
 		if err != nil {
-			return nil, Metadata{}, err
+			return nil, err
 		}
-		reviews = append(reviews, &review)
+		reviews[review.BookID] = append(reviews[review.BookID], &review)
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, Metadata{}, err
+		return nil, err
 	}
 
-	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
-	return reviews, metadata, nil
+	return reviews, nil
 }
 
-func (m *ReviewModel) GetAllByUser(userID int64, filters Filters) ([]*Review, Metadata, error) {
-	query := fmt.Sprintf(`
-		SELECT COUNT(*) OVER(), id, book_id, content, author, rating, helpful_count, created_at, version
-		FROM reviews
-		WHERE author = $1
-		ORDER BY %s %s, id ASC
-		LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
-
-	args := []interface{}{
-		userID,
-		filters.limit(),
-		filters.offset(),
+// GetAllForUsers returns the reviews each of the users wrote, newest first,
+// keyed by user id. Users without reviews map to an empty slice.
+func (m *ReviewModel) GetAllForUsers(userIDs []int64) (map[int64][]*Review, error) {
+	byID := make(map[int64]*User, len(userIDs))
+	ids := uniqueIDs(userIDs)
+	for _, id := range ids {
+		byID[id] = &User{ID: id}
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	rows, err := m.DB.QueryContext(ctx, query, args...)
+	err := loadUserReviews(ctx, m.DB, byID, ids)
 	if err != nil {
-		return nil, Metadata{}, err
+		return nil, err
 	}
-	defer rows.Close()
 
-	totalRecords := 0
-	reviews := []*Review{}
+	reviews := make(map[int64][]*Review, len(byID))
+	for id, user := range byID {
+		reviews[id] = user.Reviews
+	}
+	return reviews, nil
+}
+
+// loadBookReviews embeds the reviews of the books, newest first, with one
+// query for all of them.
+func loadBookReviews(ctx context.Context, q Queryer, books ...*Book) error {
+	byID := make(map[int64]*Book, len(books))
+	ids := make([]int64, 0, len(books))
+	for _, book := range books {
+		book.Reviews = []*Review{}
+		byID[book.ID] = book
+		ids = append(ids, book.ID)
+	}
+
+	query := `
+		SELECT ` + columnList(reviewFields) + `
+		FROM reviews
+		WHERE book_id = ANY($1)
+		ORDER BY book_id, created_at DESC, id DESC`
+
+	rows, err := q.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
 
 	for rows.Next() {
 		var review Review
-		err := rows.Scan(
-			&totalRecords,
-			&review.ID,
-			&review.BookID,
-			&review.Content,
-			&review.Author,
-			&review.Rating,
-			&review.HelpfulCount,
-			&review.CreatedAt,
-			&review.Version,
-		)
+		err := rows.Scan(review.scanDest()...)
 		if err != nil {
-			return nil, Metadata{}, err
+			return err
+		}
+		if book, ok := byID[review.BookID]; ok {
+			book.Reviews = append(book.Reviews, &review)
 		}
-		reviews = append(reviews, &review)
-	}
-
-	if err = rows.Err(); err != nil {
-		return nil, Metadata{}, err
 	}
 
-	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
-	return reviews, metadata, nil
+	return rows.Err()
 }
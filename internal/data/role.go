@@ -0,0 +1,84 @@
+package data
+
+import (
+	"context"
+	"time"
+
+	"github.com/tchenbz/AWTtest_3/internal/validator"
+)
+
+// Roles lists the roles a user can be granted.
+var Roles = []string{"admin", "editor", "moderator"}
+
+func ValidateRole(v *validator.Validator, role string) {
+	v.Check(validator.PermittedValue(role, Roles...), "role", "must be one of admin, editor or moderator")
+}
+
+// GetRoles returns the roles a user holds, in alphabetical order.
+func (m *UserModel) GetRoles(userID int64) ([]string, error) {
+	query := `
+		SELECT role
+		FROM user_roles
+		WHERE user_id = $1
+		ORDER BY role`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []string{}
+	for rows.Next() {
+		var role string
+		err := rows.Scan(&role)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
+
+// GrantRole gives a user a role and reports whether they didn't already
+// hold it.
+func (m *UserModel) GrantRole(userID int64, role string) (bool, error) {
+	query := `
+		INSERT INTO user_roles (user_id, role)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, role)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	return rowsAffected > 0, err
+}
+
+// RevokeRole takes a role away from a user and reports whether they held
+// it.
+func (m *UserModel) RevokeRole(userID int64, role string) (bool, error) {
+	query := `
+		DELETE FROM user_roles
+		WHERE user_id = $1 AND role = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, role)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	return rowsAffected > 0, err
+}
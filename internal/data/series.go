@@ -0,0 +1,406 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/tchenbz/AWTtest_3/internal/validator"
+)
+
+var ErrDuplicatePosition = errors.New("another book already has this position in the series")
+
+type Series struct {
+	ID          int64           `json:"id"`
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Volumes     []*SeriesVolume `json:"volumes,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	Version     int32           `json:"version"`
+}
+
+// SeriesVolume is a book at a given position in a series.
+type SeriesVolume struct {
+	BookID   int64   `json:"book_id"`
+	Title    string  `json:"title"`
+	Position float64 `json:"position"`
+}
+
+// BookSeries describes where a book sits in one of its series.
+type BookSeries struct {
+	ID       int64         `json:"id"`
+	Name     string        `json:"name"`
+	Position float64       `json:"position"`
+	Previous *SeriesVolume `json:"previous"`
+	Next     *SeriesVolume `json:"next"`
+}
+
+func ValidateSeries(v *validator.Validator, series *Series) {
+	v.Check(strings.TrimSpace(series.Name) != "", "name", "must be provided")
+	v.Check(len(series.Name) <= 255, "name", "must not be more than 255 bytes long")
+}
+
+func ValidateSeriesPosition(v *validator.Validator, position float64) {
+	v.Check(position >= 0, "position", "must not be negative")
+	v.Check(position < 10000, "position", "must be less than 10000")
+	v.Check(math.Abs(position*100-math.Round(position*100)) < 1e-9, "position", "must have at most two decimal places")
+}
+
+type SeriesModel struct {
+	DB Queryer
+}
+
+func (m *SeriesModel) Insert(series *Series) error {
+	query := `
+		INSERT INTO series (name, description)
+		VALUES ($1, $2)
+		RETURNING id, created_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, series.Name, series.Description).Scan(&series.ID, &series.CreatedAt, &series.Version)
+}
+
+// Get returns a series together with its volumes in reading order.
+func (m *SeriesModel) Get(id int64) (*Series, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, name, description, created_at, version
+		FROM series
+		WHERE id = $1`
+
+	var series Series
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&series.ID,
+		&series.Name,
+		&series.Description,
+		&series.CreatedAt,
+		&series.Version,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	query = `
+		SELECT b.id, b.title, se.position
+		FROM series_entries se
+		JOIN books b ON b.id = se.book_id
+		WHERE se.series_id = $1
+		ORDER BY se.position`
+
+	rows, err := m.DB.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	series.Volumes = []*SeriesVolume{}
+	for rows.Next() {
+		var volume SeriesVolume
+		err := rows.Scan(&volume.BookID, &volume.Title, &volume.Position)
+		if err != nil {
+			return nil, err
+		}
+		series.Volumes = append(series.Volumes, &volume)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &series, nil
+}
+
+func (m *SeriesModel) Update(series *Series) error {
+	query := `
+		UPDATE series
+		SET name = $1, description = $2, version = version + 1
+		WHERE id = $3
+		RETURNING version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, series.Name, series.Description, series.ID).Scan(&series.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *SeriesModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM series
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (m *SeriesModel) GetAll(name string, filters Filters) ([]*Series, Metadata, error) {
+	var qb queryBuilder
+	if name != "" {
+		qb.where("name ILIKE " + qb.arg("%"+name+"%"))
+	}
+	qb.applyFilters(filters)
+
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), id, name, description, created_at, version
+		FROM series
+		%s
+		ORDER BY %s %s, id ASC
+		LIMIT %s OFFSET %s`, qb.whereClause(), filters.sortColumn(), filters.sortDirection(), qb.arg(filters.limit()), qb.arg(filters.offset()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, qb.args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	allSeries := []*Series{}
+
+	for rows.Next() {
+		var series Series
+		err := rows.Scan(
+			&totalRecords,
+			&series.ID,
+			&series.Name,
+			&series.Description,
+			&series.CreatedAt,
+			&series.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		allSeries = append(allSeries, &series)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
+	return allSeries, metadata, nil
+}
+
+// SetVolume places a book in a series at the given position, moving it if
+// it is already part of the series.
+func (m *SeriesModel) SetVolume(seriesID, bookID int64, position float64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := setSeriesVolume(ctx, m.DB, seriesID, bookID, position)
+	return err
+}
+
+// setSeriesVolume places a book in a series and reports whether anything
+// changed.
+func setSeriesVolume(ctx context.Context, q Queryer, seriesID, bookID int64, position float64) (bool, error) {
+	query := `
+		INSERT INTO series_entries (series_id, book_id, position)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (series_id, book_id) DO UPDATE SET position = EXCLUDED.position
+		WHERE series_entries.position <> EXCLUDED.position`
+
+	result, err := q.ExecContext(ctx, query, seriesID, bookID, position)
+	if isUniqueViolation(err) {
+		return false, ErrDuplicatePosition
+	}
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	return rowsAffected > 0, err
+}
+
+// seriesByName returns the id of the series called name, creating it if
+// there is none.
+func seriesByName(ctx context.Context, q Queryer, name string) (int64, error) {
+	var id int64
+	err := q.QueryRowContext(ctx, `SELECT id FROM series WHERE LOWER(name) = LOWER($1) ORDER BY id LIMIT 1`, name).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = q.QueryRowContext(ctx, `INSERT INTO series (name) VALUES ($1) RETURNING id`, name).Scan(&id)
+	}
+	return id, err
+}
+
+func (m *SeriesModel) RemoveVolume(seriesID, bookID int64) error {
+	query := `
+		DELETE FROM series_entries
+		WHERE series_id = $1 AND book_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, seriesID, bookID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// NextUnread returns the first volume of the series after the highest
+// volume the user has on a completed reading list, skipping volumes already
+// on the reading list identified by listID. It returns ErrRecordNotFound
+// when there is no such volume.
+func (m *SeriesModel) NextUnread(seriesID, userID, listID int64) (*SeriesVolume, error) {
+	query := `
+		SELECT b.id, b.title, se.position
+		FROM series_entries se
+		JOIN books b ON b.id = se.book_id
+		WHERE se.series_id = $1
+		AND se.position > COALESCE((
+			SELECT MAX(done.position)
+			FROM series_entries done
+			JOIN reading_list_books rlb ON rlb.book_id = done.book_id
+			JOIN reading_lists rl ON rl.id = rlb.reading_list_id
+			WHERE done.series_id = $1 AND rl.created_by = $2 AND rl.status = 'completed'
+		), -1)
+		AND se.book_id NOT IN (SELECT book_id FROM reading_list_books WHERE reading_list_id = $3)
+		ORDER BY se.position
+		LIMIT 1`
+
+	var volume SeriesVolume
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, seriesID, userID, listID).Scan(&volume.BookID, &volume.Title, &volume.Position)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &volume, nil
+}
+
+// loadBookSeries fills in Series for every book, including the previous and
+// next volume of each, with a single query.
+func loadBookSeries(ctx context.Context, q Queryer, books ...*Book) error {
+	byID := make(map[int64]*Book, len(books))
+	ids := make([]int64, 0, len(books))
+	for _, book := range books {
+		book.Series = []*BookSeries{}
+		byID[book.ID] = book
+		ids = append(ids, book.ID)
+	}
+
+	query := `
+		WITH entries AS (
+			SELECT series_id, book_id, position,
+				LAG(book_id) OVER w AS previous_id, LAG(position) OVER w AS previous_position,
+				LEAD(book_id) OVER w AS next_id, LEAD(position) OVER w AS next_position
+			FROM series_entries
+			WHERE series_id IN (SELECT series_id FROM series_entries WHERE book_id = ANY($1))
+			WINDOW w AS (PARTITION BY series_id ORDER BY position)
+		)
+		SELECT e.book_id, s.id, s.name, e.position,
+			e.previous_id, pb.title, e.previous_position,
+			e.next_id, nb.title, e.next_position
+		FROM entries e
+		JOIN series s ON s.id = e.series_id
+		LEFT JOIN books pb ON pb.id = e.previous_id
+		LEFT JOIN books nb ON nb.id = e.next_id
+		WHERE e.book_id = ANY($1)
+		ORDER BY e.book_id, s.name`
+
+	rows, err := q.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var bookID int64
+		var series BookSeries
+		var previousID, nextID sql.NullInt64
+		var previousTitle, nextTitle sql.NullString
+		var previousPosition, nextPosition sql.NullFloat64
+
+		err := rows.Scan(
+			&bookID, &series.ID, &series.Name, &series.Position,
+			&previousID, &previousTitle, &previousPosition,
+			&nextID, &nextTitle, &nextPosition,
+		)
+		if err != nil {
+			return err
+		}
+
+		if previousID.Valid {
+			series.Previous = &SeriesVolume{BookID: previousID.Int64, Title: previousTitle.String, Position: previousPosition.Float64}
+		}
+		if nextID.Valid {
+			series.Next = &SeriesVolume{BookID: nextID.Int64, Title: nextTitle.String, Position: nextPosition.Float64}
+		}
+
+		if book, ok := byID[bookID]; ok {
+			book.Series = append(book.Series, &series)
+		}
+	}
+
+	return rows.Err()
+}
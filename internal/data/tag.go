@@ -0,0 +1,168 @@
+package data
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/tchenbz/AWTtest_3/internal/validator"
+)
+
+// TagCount is a tag together with the number of books it has been applied to.
+type TagCount struct {
+	Name  string `json:"name"`
+	Books int    `json:"books"`
+}
+
+// NormalizeTag lower-cases a tag and collapses internal whitespace so that
+// "Cozy  Mystery" and "cozy mystery" are the same tag.
+func NormalizeTag(tag string) string {
+	return strings.Join(strings.Fields(strings.ToLower(tag)), " ")
+}
+
+func ValidateTag(v *validator.Validator, tag string) {
+	v.Check(tag != "", "tag", "must be provided")
+	v.Check(len(tag) <= 50, "tag", "must not be more than 50 bytes long")
+}
+
+type TagModel struct {
+	DB Queryer
+}
+
+// AddToBook applies a tag to a book on behalf of a user, creating the tag if
+// it hasn't been used before. Applying the same tag twice is a no-op.
+func (m *TagModel) AddToBook(bookID, userID int64, tag string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := addBookTag(ctx, m.DB, bookID, userID, tag)
+	return err
+}
+
+// addBookTag tags a book on behalf of a user and reports whether the tag is
+// new.
+func addBookTag(ctx context.Context, q Queryer, bookID, userID int64, tag string) (bool, error) {
+	query := `
+		WITH tag AS (
+			INSERT INTO tags (name) VALUES ($1)
+			ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name
+			RETURNING id
+		)
+		INSERT INTO book_tags (book_id, tag_id, user_id)
+		SELECT $2, id, $3 FROM tag
+		ON CONFLICT DO NOTHING`
+
+	result, err := q.ExecContext(ctx, query, NormalizeTag(tag), bookID, userID)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	return rowsAffected > 0, err
+}
+
+// RemoveFromBook removes a user's tag from a book.
+func (m *TagModel) RemoveFromBook(bookID, userID int64, tag string) error {
+	query := `
+		DELETE FROM book_tags
+		WHERE book_id = $1 AND user_id = $2
+		AND tag_id = (SELECT id FROM tags WHERE name = $3)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, bookID, userID, NormalizeTag(tag))
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetAll returns the tags in use, most popular first.
+func (m *TagModel) GetAll(filters Filters) ([]*TagCount, Metadata, error) {
+	query := `
+		SELECT COUNT(*) OVER(), t.name, COUNT(DISTINCT bt.book_id)
+		FROM tags t
+		JOIN book_tags bt ON bt.tag_id = t.id
+		GROUP BY t.id, t.name
+		ORDER BY 3 DESC, t.name ASC
+		LIMIT $1 OFFSET $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	tags := []*TagCount{}
+
+	for rows.Next() {
+		var tag TagCount
+		err := rows.Scan(&totalRecords, &tag.Name, &tag.Books)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		tags = append(tags, &tag)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
+	return tags, metadata, nil
+}
+
+// loadBookTags fills in Tags for every book with a single query.
+func loadBookTags(ctx context.Context, q Queryer, books ...*Book) error {
+	byID := make(map[int64]*Book, len(books))
+	ids := make([]int64, 0, len(books))
+	for _, book := range books {
+		book.Tags = []string{}
+		byID[book.ID] = book
+		ids = append(ids, book.ID)
+	}
+
+	query := `
+		SELECT bt.book_id, t.name
+		FROM book_tags bt
+		JOIN tags t ON t.id = bt.tag_id
+		WHERE bt.book_id = ANY($1)
+		GROUP BY bt.book_id, t.name
+		ORDER BY bt.book_id, COUNT(*) DESC, t.name`
+
+	rows, err := q.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var bookID int64
+		var tag string
+		err := rows.Scan(&bookID, &tag)
+		if err != nil {
+			return err
+		}
+		if book, ok := byID[bookID]; ok {
+			book.Tags = append(book.Tags, tag)
+		}
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,72 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Queryer is what models run their statements on. It is satisfied by both
+// *sql.DB and *sql.Tx; models built on a *sql.Tx take part in that
+// transaction, so several of them can commit or roll back together.
+type Queryer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// txn is a transaction begun by a model.
+type txn interface {
+	Queryer
+	Commit() error
+	Rollback() error
+}
+
+// beginTx begins a transaction on db. When db is already a transaction, a
+// savepoint is set instead, so that the model's changes can still be
+// rolled back on their own while the outer transaction decides whether
+// they are kept.
+func beginTx(ctx context.Context, db Queryer) (txn, error) {
+	switch db := db.(type) {
+	case *sql.DB:
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		return tx, nil
+	case *sql.Tx:
+		_, err := db.ExecContext(ctx, "SAVEPOINT model")
+		if err != nil {
+			return nil, err
+		}
+		return &savepoint{Tx: db}, nil
+	}
+	return nil, fmt.Errorf("can't begin a transaction on %T", db)
+}
+
+// savepoint is a transaction nested in a *sql.Tx. Savepoints are only ever
+// nested, never interleaved, so they can all share one name: Postgres
+// releases or rolls back to the most recent savepoint of that name.
+type savepoint struct {
+	*sql.Tx
+	done bool
+}
+
+func (sp *savepoint) Commit() error {
+	return sp.end("RELEASE SAVEPOINT model")
+}
+
+// Rollback after Commit does nothing, as with *sql.Tx, so that it can be
+// deferred.
+func (sp *savepoint) Rollback() error {
+	return sp.end("ROLLBACK TO SAVEPOINT model")
+}
+
+func (sp *savepoint) end(stmt string) error {
+	if sp.done {
+		return sql.ErrTxDone
+	}
+	sp.done = true
+	_, err := sp.ExecContext(context.Background(), stmt)
+	return err
+}
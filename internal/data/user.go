@@ -5,7 +5,12 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/lib/pq"
+	"github.com/tchenbz/AWTtest_3/internal/validator"
 )
 
 type User struct {
@@ -16,10 +21,60 @@ type User struct {
 	EmailVerified bool      `json:"email_verified"`
 	CreatedAt     time.Time `json:"created_at"`
 	Version       int32     `json:"version"`
+	// Reviews, ReadingLists and ReadingListsCount are only loaded when a
+	// request includes them.
+	Reviews           []*Review      `json:"reviews,omitempty"`
+	ReadingLists      []*ReadingList `json:"readinglists,omitempty"`
+	ReadingListsCount *int           `json:"readinglists_count,omitempty"`
+}
+
+// userFields lists the columns of a user by the name of the field they load.
+var userFields = []fieldColumn{
+	{"id", "id"},
+	{"username", "username"},
+	{"email", "email"},
+	{"password", "password"},
+	{"email_verified", "email_verified"},
+	{"created_at", "created_at"},
+	{"version", "version"},
+}
+
+// UserFieldSafeList lists the fields a ?fields= parameter may select on a
+// user.
+var UserFieldSafeList = []string{"id", "username", "email", "email_verified", "created_at", "version"}
+
+// UserIncludeSafeList lists the related data ?include= may embed in a user.
+var UserIncludeSafeList = []string{"reviews", "readinglists", "readinglists_count"}
+
+func (u *User) fieldDest(name string) any {
+	switch name {
+	case "id":
+		return &u.ID
+	case "username":
+		return &u.Username
+	case "email":
+		return &u.Email
+	case "password":
+		return &u.Password
+	case "email_verified":
+		return &u.EmailVerified
+	case "created_at":
+		return &u.CreatedAt
+	case "version":
+		return &u.Version
+	}
+	panic("unknown user field: " + name)
+}
+
+func ValidateUser(v *validator.Validator, user *User) {
+	v.Check(strings.TrimSpace(user.Username) != "", "username", "must be provided")
+	v.Check(len(user.Username) <= 255, "username", "must not be more than 255 bytes long")
+	v.Check(strings.Contains(user.Email, "@"), "email", "must be a valid email address")
+	v.Check(len(user.Email) <= 255, "email", "must not be more than 255 bytes long")
 }
 
 type UserModel struct {
-	DB *sql.DB
+	DB Queryer
 }
 
 func (m *UserModel) Insert(user *User) error {
@@ -34,19 +89,23 @@ func (m *UserModel) Insert(user *User) error {
 }
 
 func (m *UserModel) Get(id int64) (*User, error) {
+	return m.GetProjected(id, Projection{})
+}
+
+// GetProjected returns a user with only the fields p asks for loaded.
+func (m *UserModel) GetProjected(id int64, p Projection) (*User, error) {
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
 
+	columns := p.columns(userFields)
 	query := `
-		SELECT id, username, email, password, email_verified, created_at, version
+		SELECT ` + columnList(columns) + `
 		FROM users
 		WHERE id = $1`
 
 	var user User
-	err := m.DB.QueryRowContext(context.Background(), query, id).Scan(
-		&user.ID, &user.Username, &user.Email, &user.Password, &user.EmailVerified, &user.CreatedAt, &user.Version,
-	)
+	err := m.DB.QueryRowContext(context.Background(), query, id).Scan(fieldDests(columns, user.fieldDest)...)
 
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -58,6 +117,205 @@ func (m *UserModel) Get(id int64) (*User, error) {
 	return &user, nil
 }
 
+// GetMany returns the users with the given ids, in the order the ids are
+// first given. Ids that don't match a user are skipped.
+func (m *UserModel) GetMany(ids []int64) ([]*User, error) {
+	users := []*User{}
+	if len(ids) == 0 {
+		return users, nil
+	}
+
+	query := `
+		SELECT ` + columnList(userFields) + `
+		FROM users
+		WHERE id = ANY($1)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(uniqueIDs(ids)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byID := map[int64]*User{}
+	for rows.Next() {
+		var user User
+		err := rows.Scan(fieldDests(userFields, user.fieldDest)...)
+		if err != nil {
+			return nil, err
+		}
+		byID[user.ID] = &user
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, id := range uniqueIDs(ids) {
+		if user, ok := byID[id]; ok {
+			users = append(users, user)
+		}
+	}
+
+	return users, nil
+}
+
+// Include loads the related data p asks for into the users: their reviews,
+// their reading lists and how many reading lists they have. Each is loaded
+// with one query for all the users.
+func (m *UserModel) Include(users []*User, p Projection) error {
+	if len(users) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	byID := make(map[int64]*User, len(users))
+	ids := make([]int64, 0, len(users))
+	for _, user := range users {
+		byID[user.ID] = user
+		ids = append(ids, user.ID)
+	}
+
+	if p.Includes("reviews") {
+		err := loadUserReviews(ctx, m.DB, byID, ids)
+		if err != nil {
+			return err
+		}
+	}
+
+	if p.Includes("readinglists") {
+		err := loadUserReadingLists(ctx, m.DB, byID, ids)
+		if err != nil {
+			return err
+		}
+	}
+
+	if p.Includes("readinglists_count") {
+		err := loadUserReadingListCounts(ctx, m.DB, byID, ids)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// loadUserReviews embeds the reviews written by the users, newest first.
+// Like ReviewModel.GetAllByUser it matches older reviews whose author is the
+// user's id.
+func loadUserReviews(ctx context.Context, q Queryer, byID map[int64]*User, ids []int64) error {
+	texts := make([]string, len(ids))
+	for i, id := range ids {
+		byID[id].Reviews = []*Review{}
+		texts[i] = strconv.FormatInt(id, 10)
+	}
+
+	query := `
+		SELECT COALESCE(author_id::text, author), ` + columnList(reviewFields) + `
+		FROM reviews
+		WHERE author_id = ANY($1) OR (author_id IS NULL AND author = ANY($2))
+		ORDER BY created_at DESC, id DESC`
+
+	rows, err := q.QueryContext(ctx, query, pq.Array(ids), pq.Array(texts))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key string
+		var review Review
+		err := rows.Scan(append([]any{&key}, review.scanDest()...)...)
+		if err != nil {
+			return err
+		}
+		id, _ := strconv.ParseInt(key, 10, 64)
+		if user, ok := byID[id]; ok {
+			user.Reviews = append(user.Reviews, &review)
+		}
+	}
+
+	return rows.Err()
+}
+
+// loadUserReadingLists embeds the reading lists the users created, with the
+// ids of the books on them.
+func loadUserReadingLists(ctx context.Context, q Queryer, byID map[int64]*User, ids []int64) error {
+	for _, id := range ids {
+		byID[id].ReadingLists = []*ReadingList{}
+	}
+
+	query := `
+		SELECT ` + columnList(readingListFields) + `
+		FROM reading_lists
+		WHERE created_by = ANY($1)
+		ORDER BY id`
+
+	rows, err := q.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	readingLists := []*ReadingList{}
+	for rows.Next() {
+		var readingList ReadingList
+		err := rows.Scan(fieldDests(readingListFields, readingList.fieldDest)...)
+		if err != nil {
+			return err
+		}
+		if user, ok := byID[readingList.CreatedBy]; ok {
+			user.ReadingLists = append(user.ReadingLists, &readingList)
+			readingLists = append(readingLists, &readingList)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	return loadReadingListBooks(ctx, q, readingLists...)
+}
+
+// loadUserReadingListCounts counts the reading lists each user created with a
+// single grouped query.
+func loadUserReadingListCounts(ctx context.Context, q Queryer, byID map[int64]*User, ids []int64) error {
+	for _, id := range ids {
+		count := 0
+		byID[id].ReadingListsCount = &count
+	}
+
+	query := `
+		SELECT created_by, COUNT(*)
+		FROM reading_lists
+		WHERE created_by = ANY($1)
+		GROUP BY created_by`
+
+	rows, err := q.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var count int
+		err := rows.Scan(&id, &count)
+		if err != nil {
+			return err
+		}
+		if user, ok := byID[id]; ok {
+			user.ReadingListsCount = &count
+		}
+	}
+
+	return rows.Err()
+}
+
 func (m *UserModel) GetByEmail(email string) (*User, error) {
 	query := `
 		SELECT id, username, email, password, email_verified, created_at, version
@@ -125,23 +383,27 @@ func (m *UserModel) Delete(id int64) error {
 	return nil
 }
 
-func (m *UserModel) GetAll(username, email string, filters Filters) ([]*User, Metadata, error) {
+// GetAll returns a page of users whose username contains the given text.
+// Only the columns in filters.Projection are loaded.
+func (m *UserModel) GetAll(username string, filters Filters) ([]*User, Metadata, error) {
+	var qb queryBuilder
+	if username != "" {
+		qb.where("username ILIKE " + qb.arg("%"+username+"%"))
+	}
+	qb.applyFilters(filters)
+
+	columns := filters.Projection.columns(userFields)
 	query := fmt.Sprintf(`
-		SELECT COUNT(*) OVER(), id, username, email, password, email_verified, created_at, version
+		SELECT COUNT(*) OVER(), %s
 		FROM users
-		WHERE (username ILIKE $1 OR $1 = '')
-		AND (email ILIKE $2 OR $2 = '')
+		%s
 		ORDER BY %s %s, id ASC
-		LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+		LIMIT %s OFFSET %s`, columnList(columns), qb.whereClause(), filters.sortColumn(), filters.sortDirection(), qb.arg(filters.limit()), qb.arg(filters.offset()))
 
-	args := []interface{}{
-		"%" + username + "%",
-		"%" + email + "%",
-		filters.limit(),
-		filters.offset(),
-	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
 
-	rows, err := m.DB.QueryContext(context.Background(), query, args...)
+	rows, err := m.DB.QueryContext(ctx, query, qb.args...)
 	if err != nil {
 		return nil, Metadata{}, err
 	}
@@ -152,16 +414,7 @@ func (m *UserModel) GetAll(username, email string, filters Filters) ([]*User, Me
 
 	for rows.Next() {
 		var user User
-		err := rows.Scan(
-			&totalRecords,
-			&user.ID,
-			&user.Username,
-			&user.Email,
-			&user.Password,
-			&user.EmailVerified,
-			&user.CreatedAt,
-			&user.Version,
-		)
+		err := rows.Scan(append([]any{&totalRecords}, fieldDests(columns, user.fieldDest)...)...)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
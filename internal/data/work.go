@@ -0,0 +1,217 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/tchenbz/AWTtest_3/internal/validator"
+)
+
+var (
+	ErrUnknownWork     = errors.New("unknown work")
+	ErrWorkHasEditions = errors.New("the work still has editions attached")
+)
+
+// Work groups the editions of the same book (hardcover, paperback,
+// translations, ...). Ratings and review counts are aggregated over all of
+// its editions.
+type Work struct {
+	ID            int64     `json:"id"`
+	Title         string    `json:"title"`
+	Description   string    `json:"description"`
+	EditionCount  int       `json:"edition_count"`
+	ReviewCount   int       `json:"review_count"`
+	AverageRating float64   `json:"average_rating"`
+	CreatedAt     time.Time `json:"created_at"`
+	Version       int32     `json:"version"`
+}
+
+func ValidateWork(v *validator.Validator, work *Work) {
+	v.Check(strings.TrimSpace(work.Title) != "", "title", "must be provided")
+	v.Check(len(work.Title) <= 255, "title", "must not be more than 255 bytes long")
+}
+
+// workAggregates computes the edition and review statistics of works.w.
+const workAggregates = `
+	(SELECT COUNT(*) FROM books b WHERE b.work_id = w.id),
+	(SELECT COUNT(*) FROM reviews r JOIN books b ON b.id = r.book_id WHERE b.work_id = w.id),
+	(SELECT COALESCE(AVG(r.rating), 0) FROM reviews r JOIN books b ON b.id = r.book_id WHERE b.work_id = w.id)`
+
+type WorkModel struct {
+	DB Queryer
+}
+
+func (m *WorkModel) Insert(work *Work) error {
+	query := `
+		INSERT INTO works (title, description)
+		VALUES ($1, $2)
+		RETURNING id, created_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, work.Title, work.Description).Scan(&work.ID, &work.CreatedAt, &work.Version)
+}
+
+func (m *WorkModel) Get(id int64) (*Work, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT w.id, w.title, w.description, ` + workAggregates + `, w.created_at, w.version
+		FROM works w
+		WHERE w.id = $1`
+
+	var work Work
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&work.ID,
+		&work.Title,
+		&work.Description,
+		&work.EditionCount,
+		&work.ReviewCount,
+		&work.AverageRating,
+		&work.CreatedAt,
+		&work.Version,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &work, nil
+}
+
+func (m *WorkModel) Update(work *Work) error {
+	query := `
+		UPDATE works
+		SET title = $1, description = $2, version = version + 1
+		WHERE id = $3
+		RETURNING version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, work.Title, work.Description, work.ID).Scan(&work.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Delete removes a work. Works can only be deleted once all of their
+// editions have been deleted or attached to another work.
+func (m *WorkModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM works
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		if errors.Is(workWriteError(err), ErrUnknownWork) {
+			return ErrWorkHasEditions
+		}
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (m *WorkModel) GetAll(title string, filters Filters) ([]*Work, Metadata, error) {
+	var qb queryBuilder
+	if title != "" {
+		qb.where("w.title ILIKE " + qb.arg("%"+title+"%"))
+	}
+	qb.applyFilters(filters)
+
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), w.id, w.title, w.description, %s, w.created_at, w.version
+		FROM works w
+		%s
+		ORDER BY %s %s, w.id ASC
+		LIMIT %s OFFSET %s`, workAggregates, qb.whereClause(), filters.sortColumn(), filters.sortDirection(), qb.arg(filters.limit()), qb.arg(filters.offset()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, qb.args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	works := []*Work{}
+
+	for rows.Next() {
+		var work Work
+		err := rows.Scan(
+			&totalRecords,
+			&work.ID,
+			&work.Title,
+			&work.Description,
+			&work.EditionCount,
+			&work.ReviewCount,
+			&work.AverageRating,
+			&work.CreatedAt,
+			&work.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		works = append(works, &work)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
+	return works, metadata, nil
+}
+
+// workWriteError maps a foreign key violation on books.work_id to
+// ErrUnknownWork.
+func workWriteError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23503" && strings.Contains(pqErr.Constraint, "work_id") {
+		return ErrUnknownWork
+	}
+	return err
+}
@@ -0,0 +1,303 @@
+// Package epub extracts book metadata and the cover image from an EPUB
+// file's OPF package document. Both EPUB 2 and EPUB 3 packages are read.
+package epub
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/tchenbz/AWTtest_3/internal/data"
+)
+
+// maxCoverBytes caps the size of a cover image read from an EPUB.
+const maxCoverBytes = 10 << 20
+
+var ErrNotEPUB = errors.New("the file is not a valid EPUB")
+
+// Metadata is what an EPUB says about itself.
+type Metadata struct {
+	Title       string     `json:"title"`
+	Creators    []*Creator `json:"creators"`
+	ISBN        string     `json:"isbn"`
+	Date        string     `json:"date"`
+	Subjects    []string   `json:"subjects"`
+	Description string     `json:"description"`
+	Language    string     `json:"language"`
+	Publisher   string     `json:"publisher"`
+	Cover       *Cover     `json:"-"`
+}
+
+// Creator is a dc:creator with its MARC relator role, e.g. "aut".
+type Creator struct {
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+// Cover is the cover image of an EPUB.
+type Cover struct {
+	ContentType string
+	Image       []byte
+}
+
+type container struct {
+	Rootfiles []struct {
+		FullPath  string `xml:"full-path,attr"`
+		MediaType string `xml:"media-type,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+type packageDocument struct {
+	Metadata struct {
+		Titles   []string `xml:"title"`
+		Creators []struct {
+			ID   string `xml:"id,attr"`
+			Role string `xml:"role,attr"`
+			Name string `xml:",chardata"`
+		} `xml:"creator"`
+		Identifiers []struct {
+			Scheme string `xml:"scheme,attr"`
+			Value  string `xml:",chardata"`
+		} `xml:"identifier"`
+		Dates        []string `xml:"date"`
+		Subjects     []string `xml:"subject"`
+		Descriptions []string `xml:"description"`
+		Languages    []string `xml:"language"`
+		Publishers   []string `xml:"publisher"`
+		Metas        []struct {
+			Name     string `xml:"name,attr"`
+			Content  string `xml:"content,attr"`
+			Refines  string `xml:"refines,attr"`
+			Property string `xml:"property,attr"`
+			Value    string `xml:",chardata"`
+		} `xml:"meta"`
+	} `xml:"metadata"`
+	Manifest []struct {
+		ID         string `xml:"id,attr"`
+		Href       string `xml:"href,attr"`
+		MediaType  string `xml:"media-type,attr"`
+		Properties string `xml:"properties,attr"`
+	} `xml:"manifest>item"`
+}
+
+// Read parses the EPUB in r, which is size bytes long.
+func Read(r io.ReaderAt, size int64) (*Metadata, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, ErrNotEPUB
+	}
+
+	var c container
+	err = decodeFile(archive, "META-INF/container.xml", &c)
+	if err != nil {
+		return nil, err
+	}
+
+	opfPath := ""
+	for _, rootfile := range c.Rootfiles {
+		if rootfile.MediaType == "" || rootfile.MediaType == "application/oebps-package+xml" {
+			opfPath = rootfile.FullPath
+			break
+		}
+	}
+	if opfPath == "" {
+		return nil, fmt.Errorf("%w: container.xml names no package document", ErrNotEPUB)
+	}
+
+	var pkg packageDocument
+	err = decodeFile(archive, opfPath, &pkg)
+	if err != nil {
+		return nil, err
+	}
+
+	m := pkg.Metadata
+	metadata := &Metadata{
+		Title:       first(m.Titles),
+		Date:        first(m.Dates),
+		Description: plainText(first(m.Descriptions)),
+		Language:    first(m.Languages),
+		Publisher:   first(m.Publishers),
+		Creators:    []*Creator{},
+		Subjects:    []string{},
+	}
+
+	// EPUB 3 gives creator roles in <meta refines="#id" property="role">.
+	roles := map[string]string{}
+	coverID := ""
+	for _, meta := range m.Metas {
+		switch {
+		case meta.Property == "role" && strings.HasPrefix(meta.Refines, "#"):
+			roles[strings.TrimPrefix(meta.Refines, "#")] = strings.TrimSpace(meta.Value)
+		case meta.Name == "cover":
+			coverID = meta.Content
+		}
+	}
+
+	for _, creator := range m.Creators {
+		name := strings.TrimSpace(creator.Name)
+		if name == "" {
+			continue
+		}
+		role := creator.Role
+		if role == "" {
+			role = roles[creator.ID]
+		}
+		if role == "" {
+			role = "aut"
+		}
+		metadata.Creators = append(metadata.Creators, &Creator{Name: name, Role: role})
+	}
+
+	for _, identifier := range m.Identifiers {
+		value := strings.TrimSpace(identifier.Value)
+		value = strings.TrimPrefix(strings.TrimPrefix(value, "urn:isbn:"), "isbn:")
+		if strings.EqualFold(identifier.Scheme, "isbn") || data.ValidISBN(value) {
+			metadata.ISBN = data.NormalizeISBN(value)
+			break
+		}
+	}
+
+	for _, subject := range m.Subjects {
+		if subject = strings.TrimSpace(subject); subject != "" {
+			metadata.Subjects = append(metadata.Subjects, subject)
+		}
+	}
+
+	for _, item := range pkg.Manifest {
+		isCover := item.ID == coverID && coverID != ""
+		for _, property := range strings.Fields(item.Properties) {
+			isCover = isCover || property == "cover-image"
+		}
+		if !isCover || !strings.HasPrefix(item.MediaType, "image/") {
+			continue
+		}
+
+		href, err := url.PathUnescape(item.Href)
+		if err != nil {
+			href = item.Href
+		}
+		image, err := readFile(archive, path.Join(path.Dir(opfPath), href), maxCoverBytes)
+		if err != nil {
+			return nil, err
+		}
+		// The type the package claims for the image isn't trusted.
+		contentType, ok := data.CoverContentType(image)
+		if ok {
+			metadata.Cover = &Cover{ContentType: contentType, Image: image}
+		}
+		break
+	}
+
+	return metadata, nil
+}
+
+// Book maps the metadata onto a new book.
+func (m *Metadata) Book() *data.Book {
+	book := &data.Book{
+		Title:           m.Title,
+		ISBN:            m.ISBN,
+		PublicationDate: publicationDate(m.Date),
+		Description:     m.Description,
+		Language:        m.Language,
+		Publisher:       m.Publisher,
+		Format:          "ebook",
+		Authors:         []*data.BookAuthor{},
+	}
+
+	for _, creator := range m.Creators {
+		if role, ok := creatorRoles[creator.Role]; ok {
+			book.Authors = append(book.Authors, &data.BookAuthor{Name: creator.Name, Role: role})
+		}
+	}
+
+	if len(m.Subjects) > 0 && len(m.Subjects[0]) <= 100 {
+		book.Genre = m.Subjects[0]
+	}
+
+	return book
+}
+
+// creatorRoles maps MARC relator codes onto book author roles.
+var creatorRoles = map[string]string{
+	"aut": "author",
+	"trl": "translator",
+	"ill": "illustrator",
+}
+
+// publicationDate turns a dc:date, which may be just a year or a full
+// timestamp, into YYYY-MM-DD.
+func publicationDate(date string) string {
+	date = strings.TrimSpace(date)
+	switch {
+	case len(date) >= 10:
+		return date[:10]
+	case len(date) == 7:
+		return date + "-01"
+	case len(date) == 4:
+		return date + "-01-01"
+	default:
+		return date
+	}
+}
+
+func decodeFile(archive *zip.Reader, name string, v any) error {
+	content, err := readFile(archive, name, 1<<20)
+	if err != nil {
+		return err
+	}
+
+	dec := xml.NewDecoder(strings.NewReader(string(content)))
+	dec.Strict = false
+	dec.Entity = xml.HTMLEntity
+	dec.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		// Package documents are required to be UTF-8 or UTF-16; accept
+		// mislabelled UTF-8 rather than rejecting the file.
+		return input, nil
+	}
+
+	err = dec.Decode(v)
+	if err != nil {
+		return fmt.Errorf("%w: %s is malformed", ErrNotEPUB, name)
+	}
+	return nil
+}
+
+func readFile(archive *zip.Reader, name string, limit int64) ([]byte, error) {
+	file, err := archive.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s is missing", ErrNotEPUB, name)
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(io.LimitReader(file, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s could not be read", ErrNotEPUB, name)
+	}
+	if int64(len(content)) > limit {
+		return nil, fmt.Errorf("%s is larger than %d bytes", name, limit)
+	}
+	return content, nil
+}
+
+var htmlTag = regexp.MustCompile(`<[^>]*>`)
+
+func plainText(s string) string {
+	s = strings.NewReplacer("</p>", "\n\n", "<br>", "\n", "<br/>", "\n", "<br />", "\n").Replace(s)
+	return strings.TrimSpace(html.UnescapeString(htmlTag.ReplaceAllString(s, "")))
+}
+
+func first(values []string) string {
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			return value
+		}
+	}
+	return ""
+}
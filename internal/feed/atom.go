@@ -0,0 +1,119 @@
+// Package feed defines the XML documents the API publishes for feed readers
+// and e-reader apps: Atom feeds, including the OPDS catalog profile, RSS 2.0
+// feeds and OpenSearch descriptions.
+package feed
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+// Media types of Atom documents and of the two kinds of OPDS catalog feed.
+const (
+	AtomMediaType        = "application/atom+xml"
+	NavigationMediaType  = "application/atom+xml;profile=opds-catalog;kind=navigation"
+	AcquisitionMediaType = "application/atom+xml;profile=opds-catalog;kind=acquisition"
+	OpenSearchMediaType  = "application/opensearchdescription+xml"
+)
+
+// Link relations defined by OPDS.
+const (
+	RelImage      = "http://opds-spec.org/image"
+	RelThumbnail  = "http://opds-spec.org/image/thumbnail"
+	RelSortNew    = "http://opds-spec.org/sort/new"
+	RelSubsection = "subsection"
+)
+
+// Feed is an Atom feed. The Dublin Core and OpenSearch namespaces are
+// declared on every feed so that entries and paginated feeds can use them.
+type Feed struct {
+	XMLName      xml.Name `xml:"http://www.w3.org/2005/Atom feed"`
+	XMLNSDC      string   `xml:"xmlns:dc,attr"`
+	XMLNSSearch  string   `xml:"xmlns:opensearch,attr"`
+	ID           string   `xml:"id"`
+	Title        string   `xml:"title"`
+	Subtitle     string   `xml:"subtitle,omitempty"`
+	Updated      Time     `xml:"updated"`
+	Authors      []Person `xml:"author"`
+	Links        []Link   `xml:"link"`
+	TotalResults int      `xml:"opensearch:totalResults,omitempty"`
+	ItemsPerPage int      `xml:"opensearch:itemsPerPage,omitempty"`
+	StartIndex   int      `xml:"opensearch:startIndex,omitempty"`
+	Entries      []*Entry `xml:"entry"`
+}
+
+// NewFeed returns an empty feed with the namespaces declared.
+func NewFeed(id, title string) *Feed {
+	return &Feed{
+		XMLNSDC:     "http://purl.org/dc/terms/",
+		XMLNSSearch: "http://a9.com/-/spec/opensearch/1.1/",
+		ID:          id,
+		Title:       title,
+		Links:       []Link{},
+		Entries:     []*Entry{},
+	}
+}
+
+// Entry is an Atom entry. The dc: elements describe books in OPDS
+// acquisition feeds and are left out elsewhere.
+type Entry struct {
+	ID         string     `xml:"id"`
+	Title      string     `xml:"title"`
+	Updated    Time       `xml:"updated"`
+	Published  *Time      `xml:"published,omitempty"`
+	Authors    []Person   `xml:"author"`
+	Categories []Category `xml:"category"`
+	Summary    *Text      `xml:"summary,omitempty"`
+	Content    *Text      `xml:"content,omitempty"`
+	Links      []Link     `xml:"link"`
+	Identifier string     `xml:"dc:identifier,omitempty"`
+	Issued     string     `xml:"dc:issued,omitempty"`
+	Language   string     `xml:"dc:language,omitempty"`
+	Publisher  string     `xml:"dc:publisher,omitempty"`
+}
+
+type Person struct {
+	Name string `xml:"name"`
+	URI  string `xml:"uri,omitempty"`
+}
+
+type Link struct {
+	Rel   string `xml:"rel,attr,omitempty"`
+	Href  string `xml:"href,attr"`
+	Type  string `xml:"type,attr,omitempty"`
+	Title string `xml:"title,attr,omitempty"`
+}
+
+type Category struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr,omitempty"`
+}
+
+// Text is an Atom text construct. Type is "text" or "html".
+type Text struct {
+	Type string `xml:"type,attr,omitempty"`
+	Body string `xml:",chardata"`
+}
+
+// Time marshals as an RFC 3339 timestamp, as Atom requires.
+type Time time.Time
+
+func (t Time) MarshalText() ([]byte, error) {
+	return []byte(time.Time(t).UTC().Format(time.RFC3339)), nil
+}
+
+// OpenSearchDescription describes how to search a catalog.
+type OpenSearchDescription struct {
+	XMLName       xml.Name        `xml:"http://a9.com/-/spec/opensearch/1.1/ OpenSearchDescription"`
+	ShortName     string          `xml:"ShortName"`
+	Description   string          `xml:"Description"`
+	InputEncoding string          `xml:"InputEncoding"`
+	URLs          []OpenSearchURL `xml:"Url"`
+}
+
+// OpenSearchURL is a search URL template, with {searchTerms} standing for
+// the query and {startPage?} for the optional page number.
+type OpenSearchURL struct {
+	Type     string `xml:"type,attr"`
+	Template string `xml:"template,attr"`
+}
@@ -0,0 +1,108 @@
+package feed
+
+import (
+	"encoding/xml"
+	"strings"
+	"time"
+)
+
+const RSSMediaType = "application/rss+xml"
+
+// RSS is an RSS 2.0 document.
+type RSS struct {
+	XMLName   xml.Name   `xml:"rss"`
+	Version   string     `xml:"version,attr"`
+	XMLNSAtom string     `xml:"xmlns:atom,attr"`
+	XMLNSDC   string     `xml:"xmlns:dc,attr"`
+	Channel   RSSChannel `xml:"channel"`
+}
+
+type RSSChannel struct {
+	Title         string     `xml:"title"`
+	Link          string     `xml:"link"`
+	Description   string     `xml:"description"`
+	LastBuildDate string     `xml:"lastBuildDate"`
+	Self          *Link      `xml:"atom:link,omitempty"`
+	Items         []*RSSItem `xml:"item"`
+}
+
+type RSSItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link,omitempty"`
+	Description string   `xml:"description,omitempty"`
+	Creator     string   `xml:"dc:creator,omitempty"`
+	Categories  []string `xml:"category"`
+	GUID        RSSGUID  `xml:"guid"`
+	PubDate     string   `xml:"pubDate"`
+}
+
+type RSSGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// NewRSS converts an Atom feed to RSS 2.0, so that a feed is built once and
+// served in either format. The channel and item links are the alternate
+// links of the feed and its entries.
+func NewRSS(f *Feed) *RSS {
+	channel := RSSChannel{
+		Title:         f.Title,
+		Link:          alternate(f.Links, f.ID),
+		Description:   f.Subtitle,
+		LastBuildDate: rssTime(f.Updated),
+		Items:         []*RSSItem{},
+	}
+	if channel.Description == "" {
+		channel.Description = f.Title
+	}
+	for _, link := range f.Links {
+		if link.Rel == "self" {
+			channel.Self = &Link{Rel: "self", Href: link.Href, Type: RSSMediaType}
+			break
+		}
+	}
+
+	for _, entry := range f.Entries {
+		item := &RSSItem{
+			Title:   entry.Title,
+			Link:    alternate(entry.Links, ""),
+			GUID:    RSSGUID{Value: entry.ID},
+			PubDate: rssTime(entry.Updated),
+		}
+		if entry.Content != nil {
+			item.Description = entry.Content.Body
+		} else if entry.Summary != nil {
+			item.Description = entry.Summary.Body
+		}
+		names := make([]string, len(entry.Authors))
+		for i, author := range entry.Authors {
+			names[i] = author.Name
+		}
+		item.Creator = strings.Join(names, ", ")
+		for _, category := range entry.Categories {
+			item.Categories = append(item.Categories, category.Label)
+		}
+		channel.Items = append(channel.Items, item)
+	}
+
+	return &RSS{
+		Version:   "2.0",
+		XMLNSAtom: "http://www.w3.org/2005/Atom",
+		XMLNSDC:   "http://purl.org/dc/elements/1.1/",
+		Channel:   channel,
+	}
+}
+
+// alternate returns the href of the first alternate link, or fallback.
+func alternate(links []Link, fallback string) string {
+	for _, link := range links {
+		if link.Rel == "alternate" || link.Rel == "" {
+			return link.Href
+		}
+	}
+	return fallback
+}
+
+func rssTime(t Time) string {
+	return time.Time(t).UTC().Format(time.RFC1123Z)
+}
@@ -0,0 +1,166 @@
+// Package jsonld maps books and reviews onto their schema.org types, for
+// the application/ld+json representations that search engines read.
+package jsonld
+
+import (
+	"math"
+
+	"github.com/tchenbz/AWTtest_3/internal/data"
+)
+
+const (
+	MediaType     = "application/ld+json"
+	schemaContext = "https://schema.org"
+)
+
+type Person struct {
+	Type string `json:"@type"`
+	Name string `json:"name"`
+}
+
+type Organization struct {
+	Type string `json:"@type"`
+	Name string `json:"name"`
+}
+
+type Rating struct {
+	Type        string  `json:"@type"`
+	RatingValue float64 `json:"ratingValue"`
+	BestRating  int     `json:"bestRating"`
+	WorstRating int     `json:"worstRating"`
+	RatingCount int     `json:"ratingCount,omitempty"`
+}
+
+// Book is a schema:Book. Context is only set on the top-level object.
+type Book struct {
+	Context         string        `json:"@context,omitempty"`
+	Type            string        `json:"@type"`
+	ID              string        `json:"@id"`
+	URL             string        `json:"url,omitempty"`
+	Name            string        `json:"name"`
+	Author          []Person      `json:"author,omitempty"`
+	Translator      []Person      `json:"translator,omitempty"`
+	Illustrator     []Person      `json:"illustrator,omitempty"`
+	ISBN            string        `json:"isbn,omitempty"`
+	DatePublished   string        `json:"datePublished,omitempty"`
+	Genre           []string      `json:"genre,omitempty"`
+	Description     string        `json:"description,omitempty"`
+	InLanguage      string        `json:"inLanguage,omitempty"`
+	Publisher       *Organization `json:"publisher,omitempty"`
+	NumberOfPages   int           `json:"numberOfPages,omitempty"`
+	BookFormat      string        `json:"bookFormat,omitempty"`
+	Image           string        `json:"image,omitempty"`
+	AggregateRating *Rating       `json:"aggregateRating,omitempty"`
+}
+
+// Review is a schema:Review of a book.
+type Review struct {
+	Context       string  `json:"@context"`
+	Type          string  `json:"@type"`
+	ID            string  `json:"@id"`
+	URL           string  `json:"url"`
+	Author        *Person `json:"author,omitempty"`
+	ReviewBody    string  `json:"reviewBody,omitempty"`
+	DatePublished string  `json:"datePublished"`
+	ReviewRating  *Rating `json:"reviewRating,omitempty"`
+	ItemReviewed  *Book   `json:"itemReviewed"`
+}
+
+// bookFormats maps book formats onto schema:BookFormatType values.
+var bookFormats = map[string]string{
+	"hardcover": "https://schema.org/Hardcover",
+	"paperback": "https://schema.org/Paperback",
+	"ebook":     "https://schema.org/EBook",
+	"audiobook": "https://schema.org/AudiobookFormat",
+}
+
+// NewBook maps a book found at url. image is the URL of its cover, or empty.
+// ratingCount and ratingAverage summarize the ratings of its reviews; the
+// aggregate rating is left out when there are none.
+func NewBook(book *data.Book, url, image string, ratingCount int, ratingAverage float64) *Book {
+	b := &Book{
+		Context:       schemaContext,
+		Type:          "Book",
+		ID:            url,
+		URL:           url,
+		Name:          book.Title,
+		Author:        people(book.AuthorNames("author")),
+		Translator:    people(book.AuthorNames("translator")),
+		Illustrator:   people(book.AuthorNames("illustrator")),
+		ISBN:          book.ISBN,
+		DatePublished: book.PublicationDate,
+		Description:   book.Description,
+		InLanguage:    book.Language,
+		NumberOfPages: book.PageCount,
+		BookFormat:    bookFormats[book.Format],
+		Image:         image,
+	}
+
+	for _, genre := range book.Genres {
+		b.Genre = append(b.Genre, genre.Name)
+	}
+	if len(b.Genre) == 0 && book.Genre != "" {
+		b.Genre = []string{book.Genre}
+	}
+
+	if book.Publisher != "" {
+		b.Publisher = &Organization{Type: "Organization", Name: book.Publisher}
+	}
+
+	if ratingCount > 0 {
+		b.AggregateRating = &Rating{
+			Type:        "AggregateRating",
+			RatingValue: math.Round(ratingAverage*100) / 100,
+			BestRating:  5,
+			WorstRating: 1,
+			RatingCount: ratingCount,
+		}
+	}
+
+	return b
+}
+
+// NewReview maps a review found at url of the book found at bookURL.
+func NewReview(review *data.Review, url string, book *data.Book, bookURL string) *Review {
+	r := &Review{
+		Context:       schemaContext,
+		Type:          "Review",
+		ID:            url,
+		URL:           url,
+		ReviewBody:    review.Content,
+		DatePublished: review.CreatedAt.Format("2006-01-02"),
+		ItemReviewed: &Book{
+			Type:   "Book",
+			ID:     bookURL,
+			Name:   book.Title,
+			Author: people(book.AuthorNames("author")),
+			ISBN:   book.ISBN,
+		},
+	}
+
+	if review.Author != "" {
+		r.Author = &Person{Type: "Person", Name: review.Author}
+	}
+
+	if review.Rating > 0 {
+		r.ReviewRating = &Rating{
+			Type:        "Rating",
+			RatingValue: float64(review.Rating),
+			BestRating:  5,
+			WorstRating: 1,
+		}
+	}
+
+	return r
+}
+
+func people(names []string) []Person {
+	if len(names) == 0 {
+		return nil
+	}
+	persons := make([]Person, len(names))
+	for i, name := range names {
+		persons[i] = Person{Type: "Person", Name: name}
+	}
+	return persons
+}
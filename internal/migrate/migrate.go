@@ -0,0 +1,318 @@
+// Package migrate applies SQL migrations laid out the way the migrate CLI
+// expects them, NNNNNN_name.up.sql and NNNNNN_name.down.sql, and records the
+// schema version in the same schema_migrations table, so that either can be
+// used on a database.
+//
+// Every operation runs in one transaction holding an advisory lock, so two
+// instances starting at once don't both migrate, and a migration that fails
+// leaves the schema as it was rather than half applied.
+package migrate
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"slices"
+	"strconv"
+)
+
+// lockID is the key of the advisory lock held while migrating.
+const lockID = 4125209307
+
+var (
+	// ErrDirty is returned when the migrate CLI left the database marked
+	// dirty after a migration failed part way.
+	ErrDirty = errors.New("the database is marked dirty by a failed migration")
+	// ErrVersionMismatch is returned by Check when the schema isn't at the
+	// latest migration.
+	ErrVersionMismatch = errors.New("schema version mismatch")
+)
+
+var filenameRX = regexp.MustCompile(`^([0-9]+)_(.+)\.(up|down)\.sql$`)
+
+// Migration is one version of the schema.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+func (m *Migration) String() string {
+	return fmt.Sprintf("%06d_%s", m.Version, m.Name)
+}
+
+// Load reads the migrations in the root of fsys, in version order. Two
+// migrations with the same version, or a version with only a down
+// migration, are an error.
+func Load(fsys fs.FS) ([]*Migration, error) {
+	names, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, name := range names {
+		match := filenameRX.FindStringSubmatch(name)
+		if match == nil {
+			return nil, fmt.Errorf("migration %s isn't named NNNNNN_name.up.sql or NNNNNN_name.down.sql", name)
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("migration %s has an invalid version", name)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migrations %s and %s share version %d", m, name, version)
+		}
+
+		content, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		if match[3] == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %s has no up migration", m)
+		}
+		migrations = append(migrations, m)
+	}
+	slices.SortFunc(migrations, func(a, b *Migration) int { return cmp.Compare(a.Version, b.Version) })
+	return migrations, nil
+}
+
+// Migrator applies Migrations, which are in version order, to DB.
+type Migrator struct {
+	DB         *sql.DB
+	Migrations []*Migration
+}
+
+// New returns a Migrator for the migrations in fsys.
+func New(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{DB: db, Migrations: migrations}, nil
+}
+
+// Latest returns the version of the last migration, which is the version
+// the schema is expected to be at.
+func (m *Migrator) Latest() int64 {
+	if len(m.Migrations) == 0 {
+		return 0
+	}
+	return m.Migrations[len(m.Migrations)-1].Version
+}
+
+// Status is the schema version of a database and the migrations that are
+// and aren't applied to it.
+type Status struct {
+	Version int64
+	Dirty   bool
+	Applied []*Migration
+	Pending []*Migration
+}
+
+// Status reports the schema version of the database.
+func (m *Migrator) Status(ctx context.Context) (*Status, error) {
+	var status *Status
+	err := m.withLock(ctx, func(tx *sql.Tx) error {
+		version, dirty, err := currentVersion(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		status = &Status{Version: version, Dirty: dirty, Applied: []*Migration{}, Pending: []*Migration{}}
+		for _, migration := range m.Migrations {
+			if migration.Version <= version {
+				status.Applied = append(status.Applied, migration)
+			} else {
+				status.Pending = append(status.Pending, migration)
+			}
+		}
+		return nil
+	})
+	return status, err
+}
+
+// Check returns an error wrapping ErrVersionMismatch unless the database
+// is at the latest version.
+func (m *Migrator) Check(ctx context.Context) error {
+	return m.withLock(ctx, func(tx *sql.Tx) error {
+		version, dirty, err := currentVersion(ctx, tx)
+		switch {
+		case err != nil:
+			return err
+		case dirty:
+			return ErrDirty
+		case version != m.Latest():
+			return fmt.Errorf("%w: the database is at version %d but version %d is expected", ErrVersionMismatch, version, m.Latest())
+		}
+		return nil
+	})
+}
+
+// Up applies every pending migration and returns them.
+func (m *Migrator) Up(ctx context.Context) ([]*Migration, error) {
+	applied := []*Migration{}
+	err := m.withLock(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `
+			CREATE TABLE IF NOT EXISTS schema_migrations (
+				version bigint NOT NULL PRIMARY KEY,
+				dirty boolean NOT NULL
+			)`)
+		if err != nil {
+			return err
+		}
+
+		version, err := m.knownVersion(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.Migrations {
+			if migration.Version <= version {
+				continue
+			}
+			_, err := tx.ExecContext(ctx, migration.Up)
+			if err != nil {
+				return fmt.Errorf("migration %s: %w", migration, err)
+			}
+			applied = append(applied, migration)
+		}
+
+		if len(applied) == 0 {
+			return nil
+		}
+		return setVersion(ctx, tx, applied[len(applied)-1].Version)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return applied, nil
+}
+
+// Down reverts the last steps applied migrations, or as many as are
+// applied, and returns them in the order they were reverted.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]*Migration, error) {
+	reverted := []*Migration{}
+	err := m.withLock(ctx, func(tx *sql.Tx) error {
+		version, err := m.knownVersion(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		i := slices.IndexFunc(m.Migrations, func(migration *Migration) bool { return migration.Version == version })
+		for ; i >= 0 && len(reverted) < steps; i-- {
+			migration := m.Migrations[i]
+			if migration.Down == "" {
+				return fmt.Errorf("migration %s has no down migration", migration)
+			}
+			_, err := tx.ExecContext(ctx, migration.Down)
+			if err != nil {
+				return fmt.Errorf("migration %s: %w", migration, err)
+			}
+			reverted = append(reverted, migration)
+		}
+
+		if len(reverted) == 0 {
+			return nil
+		}
+		version = 0
+		if i >= 0 {
+			version = m.Migrations[i].Version
+		}
+		return setVersion(ctx, tx, version)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reverted, nil
+}
+
+// withLock calls fn in a transaction holding the migration lock, which is
+// released when the transaction ends. The transaction is committed when fn
+// succeeds.
+func (m *Migrator) withLock(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, lockID)
+	if err != nil {
+		return err
+	}
+
+	err = fn(tx)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// knownVersion returns the version of the database, which must be clean and
+// the version of one of the migrations, or 0.
+func (m *Migrator) knownVersion(ctx context.Context, tx *sql.Tx) (int64, error) {
+	version, dirty, err := currentVersion(ctx, tx)
+	switch {
+	case err != nil:
+		return 0, err
+	case dirty:
+		return 0, ErrDirty
+	}
+
+	known := slices.ContainsFunc(m.Migrations, func(migration *Migration) bool { return migration.Version == version })
+	if version != 0 && !known {
+		return 0, fmt.Errorf("the database is at version %d, which isn't one of the migrations", version)
+	}
+	return version, nil
+}
+
+// currentVersion returns the version recorded in schema_migrations, which
+// is 0 when no migration has been applied.
+func currentVersion(ctx context.Context, tx *sql.Tx) (int64, bool, error) {
+	var exists bool
+	err := tx.QueryRowContext(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists)
+	if err != nil || !exists {
+		return 0, false, err
+	}
+
+	var version int64
+	var dirty bool
+	err = tx.QueryRowContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	return version, dirty, err
+}
+
+// setVersion records version as the version of the database, leaving
+// schema_migrations empty for 0 like the migrate CLI does.
+func setVersion(ctx context.Context, tx *sql.Tx, version int64) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations`)
+	if err != nil || version == 0 {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, dirty) VALUES ($1, false)`, version)
+	return err
+}
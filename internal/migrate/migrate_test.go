@@ -0,0 +1,147 @@
+package migrate_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/tchenbz/AWTtest_3/internal/migrate"
+	"github.com/tchenbz/AWTtest_3/migrations"
+)
+
+// openSchema returns a database handle whose search_path is a new, empty
+// schema, dropped again when the test ends. The test is skipped unless
+// TEST3_TEST_DB_DSN names a PostgreSQL database it may create schemas in.
+func openSchema(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST3_TEST_DB_DSN")
+	if dsn == "" {
+		t.Skip("TEST3_TEST_DB_DSN is not set")
+	}
+
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	schema := fmt.Sprintf("migrate_test_%d", time.Now().UnixNano())
+	_, err = admin.Exec("CREATE SCHEMA " + schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_, err := admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+		if err != nil {
+			t.Error(err)
+		}
+	})
+
+	// lib/pq sends settings it doesn't know itself to the server, in both
+	// forms of DSN.
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		query := u.Query()
+		query.Set("search_path", schema)
+		u.RawQuery = query.Encode()
+		dsn = u.String()
+	} else {
+		dsn += " search_path=" + schema
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// tables returns the tables in the schema of db other than
+// schema_migrations.
+func tables(t *testing.T, db *sql.DB) []string {
+	t.Helper()
+
+	rows, err := db.Query(`
+		SELECT table_name FROM information_schema.tables
+		WHERE table_schema = current_schema() AND table_name <> 'schema_migrations'
+		ORDER BY table_name`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		err := rows.Scan(&name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return names
+}
+
+// TestUpDownUp applies every migration to an empty schema, reverts them
+// all and applies them again, so that each down migration has to undo
+// exactly what its up migration did.
+func TestUpDownUp(t *testing.T) {
+	db := openSchema(t)
+	ctx := context.Background()
+
+	m, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	up := func() {
+		t.Helper()
+		applied, err := m.Up(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(applied) != len(m.Migrations) {
+			t.Fatalf("applied %d migrations; want %d", len(applied), len(m.Migrations))
+		}
+		err = m.Check(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	up()
+
+	reverted, err := m.Down(ctx, len(m.Migrations))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reverted) != len(m.Migrations) {
+		t.Fatalf("reverted %d migrations; want %d", len(reverted), len(m.Migrations))
+	}
+	status, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Version != 0 {
+		t.Fatalf("got version %d after reverting every migration; want 0", status.Version)
+	}
+	if left := tables(t, db); len(left) > 0 {
+		t.Fatalf("tables left after reverting every migration: %s", strings.Join(left, ", "))
+	}
+
+	up()
+}
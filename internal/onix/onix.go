@@ -0,0 +1,323 @@
+// Package onix reads ONIX for Books 3.0 product records, as sent by
+// publishers, and maps them onto the data package's import rows. Files are
+// read one <Product> at a time, so their size doesn't matter. Only the
+// reference tag names are supported, not the short tags.
+package onix
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/tchenbz/AWTtest_3/internal/data"
+)
+
+// Source is the book_sources.source value for books imported from ONIX.
+// Products are identified by their RecordReference.
+const Source = "onix"
+
+// Product holds the parts of an ONIX <Product> that map onto a book.
+type Product struct {
+	RecordReference  string `xml:"RecordReference"`
+	NotificationType string `xml:"NotificationType"`
+	Identifiers      []struct {
+		Type  string `xml:"ProductIDType"`
+		Value string `xml:"IDValue"`
+	} `xml:"ProductIdentifier"`
+	Descriptive struct {
+		ProductForm string `xml:"ProductForm"`
+		Titles      []struct {
+			Type     string `xml:"TitleType"`
+			Elements []struct {
+				Level         string `xml:"TitleElementLevel"`
+				Text          string `xml:"TitleText"`
+				Prefix        string `xml:"TitlePrefix"`
+				WithoutPrefix string `xml:"TitleWithoutPrefix"`
+				Subtitle      string `xml:"Subtitle"`
+			} `xml:"TitleElement"`
+		} `xml:"TitleDetail"`
+		Contributors []struct {
+			Roles          []string `xml:"ContributorRole"`
+			PersonName     string   `xml:"PersonName"`
+			NamesBeforeKey string   `xml:"NamesBeforeKey"`
+			KeyNames       string   `xml:"KeyNames"`
+			CorporateName  string   `xml:"CorporateName"`
+		} `xml:"Contributor"`
+		Languages []struct {
+			Role string `xml:"LanguageRole"`
+			Code string `xml:"LanguageCode"`
+		} `xml:"Language"`
+		Extents []struct {
+			Type  string `xml:"ExtentType"`
+			Value string `xml:"ExtentValue"`
+			Unit  string `xml:"ExtentUnit"`
+		} `xml:"Extent"`
+		Subjects []struct {
+			Scheme string `xml:"SubjectSchemeIdentifier"`
+			Code   string `xml:"SubjectCode"`
+		} `xml:"Subject"`
+	} `xml:"DescriptiveDetail"`
+	Collateral struct {
+		Texts []struct {
+			Type string `xml:"TextType"`
+			Text struct {
+				Inner string `xml:",innerxml"`
+			} `xml:"Text"`
+		} `xml:"TextContent"`
+	} `xml:"CollateralDetail"`
+	Publishing struct {
+		Publishers []struct {
+			Role string `xml:"PublishingRole"`
+			Name string `xml:"PublisherName"`
+		} `xml:"Publisher"`
+		Dates []struct {
+			Role string `xml:"PublishingDateRole"`
+			Date string `xml:"Date"`
+		} `xml:"PublishingDate"`
+	} `xml:"PublishingDetail"`
+}
+
+// Reader reads products from an ONIX message.
+type Reader struct {
+	dec   *xml.Decoder
+	count int
+}
+
+func NewReader(r io.Reader) *Reader {
+	dec := xml.NewDecoder(r)
+	dec.Strict = false
+	dec.Entity = xml.HTMLEntity
+	return &Reader{dec: dec}
+}
+
+// Next returns the next product in the message, or io.EOF after the last.
+func (r *Reader) Next() (*Product, error) {
+	for {
+		token, err := r.dec.Token()
+		if err != nil {
+			if errors.Is(err, io.EOF) && r.count == 0 {
+				return nil, errors.New("the document contains no ONIX products")
+			}
+			return nil, err
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if r.count == 0 && start.Name.Local != "ONIXMessage" && start.Name.Local != "Header" && start.Name.Local != "Product" {
+			return nil, fmt.Errorf("expected an ONIXMessage document, found <%s>", start.Name.Local)
+		}
+		if start.Name.Local != "Product" {
+			if start.Name.Local != "ONIXMessage" {
+				err = r.dec.Skip()
+				if err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+
+		var product Product
+		err = r.dec.DecodeElement(&product, &start)
+		if err != nil {
+			return nil, err
+		}
+		r.count++
+		return &product, nil
+	}
+}
+
+// Deleted reports whether the product is a deletion notice.
+func (p *Product) Deleted() bool {
+	return strings.TrimSpace(p.NotificationType) == "05"
+}
+
+// ISBN returns the product's ISBN-13.
+func (p *Product) ISBN() string {
+	for _, id := range p.Identifiers {
+		value := strings.TrimSpace(id.Value)
+		switch strings.TrimSpace(id.Type) {
+		case "15":
+			return value
+		case "03":
+			if strings.HasPrefix(value, "978") || strings.HasPrefix(value, "979") {
+				return value
+			}
+		}
+	}
+	return ""
+}
+
+// ImportRow maps the product onto a book. row is the product's position in
+// the message.
+func (p *Product) ImportRow(row int) *data.ImportRow {
+	d := &p.Descriptive
+
+	book := &data.Book{
+		Title:           p.title(),
+		ISBN:            p.ISBN(),
+		PublicationDate: p.publicationDate(),
+		Description:     p.description(),
+		Format:          productFormat(d.ProductForm),
+		Authors:         []*data.BookAuthor{},
+	}
+
+	for _, contributor := range d.Contributors {
+		name := strings.TrimSpace(contributor.PersonName)
+		if name == "" {
+			name = strings.TrimSpace(contributor.NamesBeforeKey + " " + contributor.KeyNames)
+		}
+		if name == "" {
+			name = strings.TrimSpace(contributor.CorporateName)
+		}
+		for _, code := range contributor.Roles {
+			if role, ok := contributorRoles[strings.TrimSpace(code)]; ok && name != "" {
+				book.Authors = append(book.Authors, &data.BookAuthor{Name: name, Role: role})
+			}
+		}
+	}
+
+	for _, language := range d.Languages {
+		if strings.TrimSpace(language.Role) == "01" {
+			book.Language = strings.TrimSpace(language.Code)
+			break
+		}
+	}
+
+	for _, extent := range d.Extents {
+		if extentPageTypes[strings.TrimSpace(extent.Type)] && strings.TrimSpace(extent.Unit) == "03" {
+			fmt.Sscan(extent.Value, &book.PageCount)
+			break
+		}
+	}
+
+	for _, publisher := range p.Publishing.Publishers {
+		if role := strings.TrimSpace(publisher.Role); role == "01" || role == "" {
+			book.Publisher = strings.TrimSpace(publisher.Name)
+			break
+		}
+	}
+
+	importRow := &data.ImportRow{
+		Row:      row,
+		Book:     book,
+		Source:   Source,
+		SourceID: strings.TrimSpace(p.RecordReference),
+	}
+
+	seen := map[string]bool{}
+	for _, subject := range d.Subjects {
+		path := subjectGenre(strings.TrimSpace(subject.Scheme), strings.TrimSpace(subject.Code))
+		if path == nil {
+			continue
+		}
+		key := strings.Join(path, "/")
+		if !seen[key] {
+			seen[key] = true
+			importRow.GenrePaths = append(importRow.GenrePaths, path)
+		}
+	}
+	if len(importRow.GenrePaths) > 0 {
+		path := importRow.GenrePaths[0]
+		book.Genre = path[len(path)-1]
+	}
+
+	return importRow
+}
+
+// title returns the distinctive title of the product, with its subtitle.
+func (p *Product) title() string {
+	for _, detail := range p.Descriptive.Titles {
+		if strings.TrimSpace(detail.Type) != "01" {
+			continue
+		}
+		for _, element := range detail.Elements {
+			if level := strings.TrimSpace(element.Level); level != "01" && level != "" {
+				continue
+			}
+			title := strings.TrimSpace(element.Text)
+			if title == "" {
+				title = strings.TrimSpace(element.Prefix + " " + element.WithoutPrefix)
+			}
+			if subtitle := strings.TrimSpace(element.Subtitle); subtitle != "" {
+				title += ": " + subtitle
+			}
+			return title
+		}
+	}
+	return ""
+}
+
+// publicationDate returns the publication date as YYYY-MM-DD. ONIX dates
+// default to YYYYMMDD; year-only and year-month dates fall on the first.
+func (p *Product) publicationDate() string {
+	for _, date := range p.Publishing.Dates {
+		if role := strings.TrimSpace(date.Role); role != "01" && role != "11" {
+			continue
+		}
+		value := strings.ReplaceAll(strings.TrimSpace(date.Date), "-", "")
+		switch len(value) {
+		case 8:
+			return value[:4] + "-" + value[4:6] + "-" + value[6:]
+		case 6:
+			return value[:4] + "-" + value[4:6] + "-01"
+		case 4:
+			return value + "-01-01"
+		}
+	}
+	return ""
+}
+
+var htmlTag = regexp.MustCompile(`<[^>]*>`)
+
+// description returns the main description as plain text, falling back to
+// the short description.
+func (p *Product) description() string {
+	for _, textType := range []string{"03", "02"} {
+		for _, text := range p.Collateral.Texts {
+			if strings.TrimSpace(text.Type) != textType {
+				continue
+			}
+			inner := text.Text.Inner
+			inner = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(inner), "<![CDATA["), "]]>")
+			inner = strings.NewReplacer("</p>", "\n\n", "<br/>", "\n", "<br />", "\n").Replace(inner)
+			return strings.TrimSpace(html.UnescapeString(htmlTag.ReplaceAllString(inner, "")))
+		}
+	}
+	return ""
+}
+
+// contributorRoles maps ONIX contributor role codes (list 17) onto book
+// author roles.
+var contributorRoles = map[string]string{
+	"A01": "author",
+	"B06": "translator",
+	"A12": "illustrator",
+}
+
+// extentPageTypes are the ONIX extent types (list 23) that give a page count.
+var extentPageTypes = map[string]bool{"00": true, "07": true, "11": true}
+
+// productFormat maps an ONIX product form code (list 150) to a book format.
+func productFormat(code string) string {
+	code = strings.TrimSpace(code)
+	switch {
+	case code == "":
+		return ""
+	case code == "BB":
+		return "hardcover"
+	case code == "BC":
+		return "paperback"
+	case strings.HasPrefix(code, "E"), code == "DG":
+		return "ebook"
+	case strings.HasPrefix(code, "A"):
+		return "audiobook"
+	default:
+		return "other"
+	}
+}
@@ -0,0 +1,129 @@
+package onix
+
+import "strings"
+
+// Subject scheme identifiers (ONIX list 26) that are mapped onto genres.
+const (
+	schemeBISAC = "10"
+	schemeThema = "93"
+)
+
+// bisacSections maps the three-letter BISAC section prefixes to genres.
+var bisacSections = map[string]string{
+	"ANT": "Antiques & Collectibles",
+	"ARC": "Architecture",
+	"ART": "Art",
+	"BIO": "Biography & Autobiography",
+	"BUS": "Business & Economics",
+	"CGN": "Comics & Graphic Novels",
+	"COM": "Computers",
+	"CKB": "Cooking",
+	"DRA": "Drama",
+	"EDU": "Education",
+	"FAM": "Family & Relationships",
+	"FIC": "Fiction",
+	"HEA": "Health & Fitness",
+	"HIS": "History",
+	"HUM": "Humor",
+	"JUV": "Juvenile Fiction",
+	"JNF": "Juvenile Nonfiction",
+	"LAN": "Language Arts & Disciplines",
+	"LAW": "Law",
+	"LIT": "Literary Criticism",
+	"MAT": "Mathematics",
+	"MED": "Medical",
+	"MUS": "Music",
+	"NAT": "Nature",
+	"PHI": "Philosophy",
+	"POE": "Poetry",
+	"POL": "Political Science",
+	"PSY": "Psychology",
+	"REL": "Religion",
+	"SCI": "Science",
+	"SEL": "Self-Help",
+	"SOC": "Social Science",
+	"SPO": "Sports & Recreation",
+	"TEC": "Technology & Engineering",
+	"TRU": "True Crime",
+	"TRV": "Travel",
+	"YAF": "Young Adult Fiction",
+	"YAN": "Young Adult Nonfiction",
+}
+
+// bisacFiction maps the main BISAC fiction categories to subgenres of
+// Fiction.
+var bisacFiction = map[string]string{
+	"FIC002": "Action & Adventure",
+	"FIC009": "Fantasy",
+	"FIC010": "Fairy Tales, Folk Tales, Legends & Mythology",
+	"FIC014": "Historical",
+	"FIC015": "Horror",
+	"FIC019": "Literary",
+	"FIC022": "Mystery & Detective",
+	"FIC027": "Romance",
+	"FIC028": "Science Fiction",
+	"FIC030": "Thrillers",
+	"FIC031": "Thrillers",
+}
+
+// themaSubjects maps Thema subject codes, longest prefix first, to genres.
+var themaSubjects = []struct {
+	prefix string
+	path   []string
+}{
+	{"FMB", []string{"Fiction", "Fantasy"}},
+	{"FM", []string{"Fiction", "Fantasy"}},
+	{"FL", []string{"Fiction", "Science Fiction"}},
+	{"FF", []string{"Fiction", "Mystery & Detective"}},
+	{"FH", []string{"Fiction", "Thrillers"}},
+	{"FK", []string{"Fiction", "Horror"}},
+	{"FR", []string{"Fiction", "Romance"}},
+	{"FV", []string{"Fiction", "Historical"}},
+	{"F", []string{"Fiction"}},
+	{"DN", []string{"Biography & Autobiography"}},
+	{"DC", []string{"Poetry"}},
+	{"DD", []string{"Drama"}},
+	{"D", []string{"Literary Criticism"}},
+	{"N", []string{"History"}},
+	{"P", []string{"Science"}},
+	{"Q", []string{"Philosophy"}},
+	{"U", []string{"Computers"}},
+	{"V", []string{"Health & Fitness"}},
+	{"WB", []string{"Cooking"}},
+	{"WT", []string{"Travel"}},
+	{"X", []string{"Comics & Graphic Novels"}},
+	{"YF", []string{"Juvenile Fiction"}},
+	{"Y", []string{"Juvenile Nonfiction"}},
+}
+
+// subjectGenre maps a subject to a genre path, most general genre first,
+// or returns nil if the subject isn't one we file books under.
+func subjectGenre(scheme, code string) []string {
+	code = strings.ToUpper(code)
+
+	switch scheme {
+	case schemeBISAC:
+		if len(code) < 3 {
+			return nil
+		}
+		section, ok := bisacSections[code[:3]]
+		if !ok {
+			return nil
+		}
+		if len(code) >= 6 {
+			if genre, ok := bisacFiction[code[:6]]; ok {
+				return []string{section, genre}
+			}
+		}
+		return []string{section}
+	case schemeThema:
+		for _, subject := range themaSubjects {
+			if strings.HasPrefix(code, subject.prefix) {
+				return subject.path
+			}
+		}
+		return nil
+	default:
+		return nil
+	}
+}
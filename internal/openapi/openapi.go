@@ -0,0 +1,203 @@
+// Package openapi builds OpenAPI 3.1 documents. Operations are declared in
+// Go, and the schemas of their bodies are reflected from the Go types the
+// handlers read and write, so the document follows the code it describes.
+package openapi
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Version is the version of the OpenAPI Specification documents follow.
+const Version = "3.1.0"
+
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       Info                 `json:"info"`
+	Servers    []Server             `json:"servers,omitempty"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components Components           `json:"components"`
+
+	schemas *Schemas
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+type Server struct {
+	URL         string `json:"url"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem maps the lower-case methods of a path to their operations.
+type PathItem map[string]*Operation
+
+type Operation struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []*Parameter          `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+	Security    []SecurityRequirement `json:"security,omitempty"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Style       string  `json:"style,omitempty"`
+	Explode     *bool   `json:"explode,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Description string                `json:"description,omitempty"`
+	Required    bool                  `json:"required,omitempty"`
+	Content     map[string]*MediaType `json:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+type Response struct {
+	Description string                `json:"description"`
+	Headers     map[string]*Header    `json:"headers,omitempty"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+type Header struct {
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas,omitempty"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type        string `json:"type"`
+	Description string `json:"description,omitempty"`
+	Name        string `json:"name,omitempty"`
+	In          string `json:"in,omitempty"`
+	Scheme      string `json:"scheme,omitempty"`
+}
+
+// SecurityRequirement maps the names of security schemes to the scopes an
+// operation needs from them.
+type SecurityRequirement map[string][]string
+
+// New returns an empty document.
+func New(info Info) *Document {
+	schemas := NewSchemas()
+	return &Document{
+		OpenAPI: Version,
+		Info:    info,
+		Paths:   map[string]*PathItem{},
+		Components: Components{
+			Schemas:         schemas.Components,
+			SecuritySchemes: map[string]*SecurityScheme{},
+		},
+		schemas: schemas,
+	}
+}
+
+// Schema returns the schema of the Go value v, adding the named types it
+// uses to the document's components.
+func (d *Document) Schema(v any) *Schema {
+	return d.schemas.For(v)
+}
+
+// Define adds the schema of v to the document's components as name and
+// returns a reference to it, for shapes such as envelopes that aren't a Go
+// type of their own but are used by many operations.
+func (d *Document) Define(name string, v any) *Schema {
+	d.Components.Schemas[name] = d.schemas.For(v)
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+// Component returns the component schema called name, or nil if there is
+// none. It lets a caller describe what reflection can't see, such as a
+// member a custom MarshalJSON method adds.
+func (d *Document) Component(name string) *Schema {
+	return d.Components.Schemas[name]
+}
+
+// Add adds op to the document as the operation for method on path. The path
+// is written the way httprouter routes it: its :name segments become
+// {name} templates, and a required path parameter is declared for each
+// unless op already declares it. Parameters called id or ending in _id are
+// integers; any other is a string.
+func (d *Document) Add(method, path string, op *Operation) {
+	// The parameters may be shared with other operations; path parameters
+	// are added to a copy.
+	op.Parameters = slices.Clip(op.Parameters)
+
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		name, ok := strings.CutPrefix(segment, ":")
+		if !ok {
+			continue
+		}
+		segments[i] = "{" + name + "}"
+		if op.parameter(name, "path") != nil {
+			continue
+		}
+
+		schema := &Schema{Type: "string"}
+		if name == "id" || strings.HasSuffix(name, "_id") {
+			schema = &Schema{Type: "integer", Format: "int64", Minimum: ptr(1.0)}
+		}
+		op.Parameters = append(op.Parameters, &Parameter{Name: name, In: "path", Required: true, Schema: schema})
+	}
+	path = strings.Join(segments, "/")
+
+	item, ok := d.Paths[path]
+	if !ok {
+		item = &PathItem{}
+		d.Paths[path] = item
+	}
+	method = strings.ToLower(method)
+	if _, ok := (*item)[method]; ok {
+		panic(fmt.Sprintf("openapi: %s %s is declared twice", strings.ToUpper(method), path))
+	}
+	(*item)[method] = op
+}
+
+// Lookup returns the operation for method on path, written as in Add, or
+// nil if the document has none.
+func (d *Document) Lookup(method, path string) *Operation {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if name, ok := strings.CutPrefix(segment, ":"); ok {
+			segments[i] = "{" + name + "}"
+		}
+	}
+
+	item, ok := d.Paths[strings.Join(segments, "/")]
+	if !ok {
+		return nil
+	}
+	return (*item)[strings.ToLower(method)]
+}
+
+func (op *Operation) parameter(name, in string) *Parameter {
+	for _, p := range op.Parameters {
+		if p.Name == name && p.In == in {
+			return p
+		}
+	}
+	return nil
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,207 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Schema is a JSON Schema (draft 2020-12), the dialect of OpenAPI 3.1.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 any                `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AnyOf                []*Schema          `json:"anyOf,omitempty"`
+	ReadOnly             bool               `json:"readOnly,omitempty"`
+	WriteOnly            bool               `json:"writeOnly,omitempty"`
+}
+
+// Nullable returns a schema that also allows null.
+func Nullable(s *Schema) *Schema {
+	if t, ok := s.Type.(string); ok && s.Ref == "" {
+		n := *s
+		n.Type = []string{t, "null"}
+		return &n
+	}
+	return &Schema{AnyOf: []*Schema{s, {Type: "null"}}}
+}
+
+// Enum returns a string schema that allows only values.
+func Enum(values ...string) *Schema {
+	s := &Schema{Type: "string"}
+	for _, v := range values {
+		s.Enum = append(s.Enum, v)
+	}
+	return s
+}
+
+// Schemas reflects the schemas of Go types. Named struct types become
+// components, referred to by $ref; everything else is described inline.
+type Schemas struct {
+	Components map[string]*Schema
+
+	names map[reflect.Type]string
+}
+
+func NewSchemas() *Schemas {
+	return &Schemas{
+		Components: map[string]*Schema{},
+		names:      map[reflect.Type]string{},
+	}
+}
+
+var (
+	timeType       = reflect.TypeFor[time.Time]()
+	rawMessageType = reflect.TypeFor[json.RawMessage]()
+)
+
+// For returns the schema of the Go value v as encoding/json writes it. A
+// map of strings to interface values, such as the API's envelopes, is
+// described member by member from the values it holds, all of them
+// required.
+func (s *Schemas) For(v any) *Schema {
+	if v == nil {
+		return &Schema{}
+	}
+
+	rv := reflect.ValueOf(v)
+	t := rv.Type()
+	if t.Kind() == reflect.Map && t.Key().Kind() == reflect.String && t.Elem().Kind() == reflect.Interface {
+		schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+		for _, key := range rv.MapKeys() {
+			name := key.String()
+			schema.Properties[name] = s.For(rv.MapIndex(key).Interface())
+			schema.Required = append(schema.Required, name)
+		}
+		slices.Sort(schema.Required)
+		return schema
+	}
+
+	return s.forType(t)
+}
+
+func (s *Schemas) forType(t reflect.Type) *Schema {
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case rawMessageType:
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return s.forType(t.Elem())
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: s.forType(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: s.forType(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.structSchema(t)
+		}
+		return s.component(t)
+	default:
+		// Interfaces can hold anything.
+		return &Schema{}
+	}
+}
+
+// component returns a reference to the component for the named struct type
+// t, reflecting it the first time it is seen. A name already taken by a
+// type from another package is prefixed with the package's name.
+func (s *Schemas) component(t reflect.Type) *Schema {
+	name, ok := s.names[t]
+	if !ok {
+		name = exported(t.Name())
+		if _, taken := s.Components[name]; taken {
+			pkg := t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:]
+			name = exported(pkg) + name
+		}
+		s.names[t] = name
+
+		// The placeholder lets recursive types refer to themselves.
+		s.Components[name] = &Schema{}
+		*s.Components[name] = *s.structSchema(t)
+	}
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+func (s *Schemas) structSchema(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	s.addFields(schema, t)
+	return schema
+}
+
+// addFields adds the fields of struct type t to schema, following the rules
+// of encoding/json: unexported and "-" fields are left out, and the fields
+// of embedded structs without a name of their own are promoted.
+func (s *Schemas) addFields(schema *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		if field.Anonymous && name == "" {
+			ft := field.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				s.addFields(schema, ft)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		fs := s.forType(field.Type)
+		if strings.Contains(","+opts+",", ",string,") && fs.Type != nil {
+			fs = &Schema{Type: "string"}
+		}
+		// A nil pointer is written as null unless omitempty leaves it out.
+		if field.Type.Kind() == reflect.Pointer && !strings.Contains(","+opts+",", ",omitempty,") {
+			fs = Nullable(fs)
+		}
+		schema.Properties[name] = fs
+	}
+}
+
+func exported(name string) string {
+	if name == "" {
+		return name
+	}
+	r := []rune(name)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
@@ -0,0 +1,443 @@
+// Package patch applies JSON Merge Patch (RFC 7396) and JSON Patch
+// (RFC 6902) documents to JSON documents.
+package patch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	MergePatchMediaType = "application/merge-patch+json"
+	JSONPatchMediaType  = "application/json-patch+json"
+)
+
+var (
+	// ErrInvalid is returned for a patch document that is malformed.
+	ErrInvalid = errors.New("invalid patch document")
+	// ErrTestFailed is returned when a JSON Patch test operation doesn't
+	// match the document.
+	ErrTestFailed = errors.New("test operation failed")
+	// ErrPath is wrapped by the errors returned when a JSON Patch path
+	// doesn't fit the document: it names a member that doesn't exist, an
+	// array index that is out of range, or goes through a value that is
+	// neither an object nor an array.
+	ErrPath = errors.New("path doesn't fit the document")
+)
+
+// pathError is an error that wraps ErrPath while keeping its own message.
+type pathError string
+
+func pathErrorf(format string, args ...any) error {
+	return pathError(fmt.Sprintf(format, args...))
+}
+
+func (e pathError) Error() string {
+	return string(e)
+}
+
+func (e pathError) Is(target error) bool {
+	return target == ErrPath
+}
+
+// MergePatch applies a JSON Merge Patch to doc: members of the patch replace
+// those of doc, objects are merged recursively and null removes a member.
+func MergePatch(doc, patch []byte) ([]byte, error) {
+	target, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := decode(patch)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+
+	return json.Marshal(merge(target, p))
+}
+
+func merge(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = map[string]any{}
+	}
+	for key, value := range p {
+		if value == nil {
+			delete(t, key)
+			continue
+		}
+		t[key] = merge(t[key], value)
+	}
+	return t
+}
+
+// Operation is a single JSON Patch operation. Value is nil when the
+// operation has no value member, and holds null when it is null.
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+func (op *Operation) UnmarshalJSON(b []byte) error {
+	var members map[string]json.RawMessage
+	err := json.Unmarshal(b, &members)
+	if err != nil {
+		return err
+	}
+
+	*op = Operation{Value: members["value"]}
+	for name, dest := range map[string]*string{"op": &op.Op, "path": &op.Path, "from": &op.From} {
+		if raw, ok := members[name]; ok {
+			err := json.Unmarshal(raw, dest)
+			if err != nil {
+				return fmt.Errorf("%s must be a string", name)
+			}
+		}
+	}
+	if _, ok := members["path"]; !ok {
+		return errors.New("path is required")
+	}
+	return nil
+}
+
+// Apply applies a JSON Patch to doc. The operations are applied in order and
+// the patch fails as a whole if any of them does.
+func Apply(doc, patch []byte) ([]byte, error) {
+	var ops []Operation
+	err := json.Unmarshal(patch, &ops)
+	if err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, fmt.Errorf("%w: must be an array of operations", ErrInvalid)
+		}
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+
+	target, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, op := range ops {
+		target, err = op.apply(target)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d (%s %s): %w", i, op.Op, op.Path, err)
+		}
+	}
+
+	return json.Marshal(target)
+}
+
+func (op Operation) apply(doc any) (any, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	value := func() (any, error) {
+		if op.Value == nil {
+			return nil, fmt.Errorf("%w: %s requires a value", ErrInvalid, op.Op)
+		}
+		v, err := decode(op.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+		return v, nil
+	}
+
+	switch op.Op {
+	case "add":
+		v, err := value()
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, v)
+	case "remove":
+		doc, _, err := remove(doc, path)
+		return doc, err
+	case "replace":
+		v, err := value()
+		if err != nil {
+			return nil, err
+		}
+		// Unlike removing it, replacing the whole document is allowed.
+		if len(path) == 0 {
+			return v, nil
+		}
+		doc, _, err := remove(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, v)
+	case "move":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		if op.Path != op.From && strings.HasPrefix(op.Path, op.From+"/") {
+			return nil, fmt.Errorf("%w: can't move a value into one of its children", ErrInvalid)
+		}
+		doc, v, err := remove(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, v)
+	case "copy":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		v, err := get(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		v, err = deepCopy(v)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, v)
+	case "test":
+		want, err := value()
+		if err != nil {
+			return nil, err
+		}
+		got, err := get(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !equal(got, want) {
+			return nil, ErrTestFailed
+		}
+		return doc, nil
+	}
+
+	return nil, fmt.Errorf("%w: unknown operation %q", ErrInvalid, op.Op)
+}
+
+// parsePointer splits a JSON Pointer (RFC 6901) into its reference tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("%w: path %q must start with /", ErrInvalid, pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	unescape := strings.NewReplacer("~1", "/", "~0", "~")
+	for i, token := range tokens {
+		tokens[i] = unescape.Replace(token)
+	}
+	return tokens, nil
+}
+
+func get(doc any, path []string) (any, error) {
+	for _, token := range path {
+		switch node := doc.(type) {
+		case map[string]any:
+			value, ok := node[token]
+			if !ok {
+				return nil, pathErrorf("%q does not exist", token)
+			}
+			doc = value
+		case []any:
+			i, err := index(token, len(node))
+			if err != nil {
+				return nil, err
+			}
+			doc = node[i]
+		default:
+			return nil, pathErrorf("%q does not exist", token)
+		}
+	}
+	return doc, nil
+}
+
+// add sets the value at path and returns the new document. Adding to an
+// array inserts before the index, or appends for "-".
+func add(doc any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	parent, err := get(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+
+	switch node := parent.(type) {
+	case map[string]any:
+		node[last] = value
+		return doc, nil
+	case []any:
+		i := len(node)
+		if last != "-" {
+			i, err = index(last, len(node)+1)
+			if err != nil {
+				return nil, err
+			}
+		}
+		node = append(node, nil)
+		copy(node[i+1:], node[i:])
+		node[i] = value
+		return set(doc, path[:len(path)-1], node)
+	}
+
+	return nil, pathErrorf("can't add %q to a value that is neither an object nor an array", last)
+}
+
+// remove deletes the value at path and returns the new document along with
+// the value removed.
+func remove(doc any, path []string) (any, any, error) {
+	if len(path) == 0 {
+		return nil, nil, fmt.Errorf("%w: can't remove the whole document", ErrInvalid)
+	}
+
+	parent, err := get(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, nil, err
+	}
+	last := path[len(path)-1]
+
+	switch node := parent.(type) {
+	case map[string]any:
+		value, ok := node[last]
+		if !ok {
+			return nil, nil, pathErrorf("%q does not exist", last)
+		}
+		delete(node, last)
+		return doc, value, nil
+	case []any:
+		i, err := index(last, len(node))
+		if err != nil {
+			return nil, nil, err
+		}
+		value := node[i]
+		node = append(node[:i:i], node[i+1:]...)
+		doc, err = set(doc, path[:len(path)-1], node)
+		return doc, value, err
+	}
+
+	return nil, nil, pathErrorf("%q does not exist", last)
+}
+
+// set replaces the value at path, which must already exist. It is used to
+// store arrays that have grown or shrunk.
+func set(doc any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	parent, err := get(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+
+	switch node := parent.(type) {
+	case map[string]any:
+		node[last] = value
+	case []any:
+		i, err := index(last, len(node))
+		if err != nil {
+			return nil, err
+		}
+		node[i] = value
+	}
+	return doc, nil
+}
+
+func index(token string, length int) (int, error) {
+	if token == "-" {
+		return 0, pathErrorf("%q can only be used to add to the end of an array", token)
+	}
+	if len(token) > 1 && token[0] == '0' {
+		return 0, fmt.Errorf("%w: array index %q has a leading zero", ErrInvalid, token)
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 {
+		return 0, fmt.Errorf("%w: %q is not an array index", ErrInvalid, token)
+	}
+	if i >= length {
+		return 0, pathErrorf("array index %d is out of range", i)
+	}
+	return i, nil
+}
+
+// equal compares two decoded JSON values, treating numbers as equal when
+// they have the same value however they are written.
+func equal(a, b any) bool {
+	switch a := a.(type) {
+	case map[string]any:
+		b, ok := b.(map[string]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for key, value := range a {
+			other, ok := b[key]
+			if !ok || !equal(value, other) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		b, ok := b.([]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !equal(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case json.Number:
+		b, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		x, errA := a.Float64()
+		y, errB := b.Float64()
+		if errA != nil || errB != nil {
+			return a == b
+		}
+		return x == y
+	}
+	return a == b
+}
+
+func deepCopy(v any) (any, error) {
+	js, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return decode(js)
+}
+
+func decode(js []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.UseNumber()
+
+	var v any
+	err := dec.Decode(&v)
+	if err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errors.New("body must only contain a single JSON value")
+	}
+	return v, nil
+}
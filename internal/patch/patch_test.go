@@ -0,0 +1,376 @@
+package patch_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/tchenbz/AWTtest_3/internal/patch"
+)
+
+// canonical re-encodes a JSON document so that documents can be compared
+// whatever their member order and spacing.
+func canonical(t *testing.T, js string) string {
+	t.Helper()
+
+	var v any
+	err := json.Unmarshal([]byte(js), &v)
+	if err != nil {
+		t.Fatalf("%s: %v", js, err)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string
+		err   error
+	}{
+		{
+			name:  "add an object member",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/baz", "value": "qux"}]`,
+			want:  `{"baz": "qux", "foo": "bar"}`,
+		},
+		{
+			name:  "add replaces an existing member",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/foo", "value": null}]`,
+			want:  `{"foo": null}`,
+		},
+		{
+			name:  "add inserts into an array",
+			doc:   `{"foo": ["bar", "baz"]}`,
+			patch: `[{"op": "add", "path": "/foo/1", "value": "qux"}]`,
+			want:  `{"foo": ["bar", "qux", "baz"]}`,
+		},
+		{
+			name:  "add appends with -",
+			doc:   `{"foo": ["bar"]}`,
+			patch: `[{"op": "add", "path": "/foo/-", "value": ["baz"]}]`,
+			want:  `{"foo": ["bar", ["baz"]]}`,
+		},
+		{
+			name:  "add at the length of an array appends",
+			doc:   `{"foo": ["bar"]}`,
+			patch: `[{"op": "add", "path": "/foo/1", "value": "baz"}]`,
+			want:  `{"foo": ["bar", "baz"]}`,
+		},
+		{
+			name:  "add past the end of an array",
+			doc:   `{"foo": ["bar"]}`,
+			patch: `[{"op": "add", "path": "/foo/2", "value": "baz"}]`,
+			err:   patch.ErrPath,
+		},
+		{
+			name:  "add with a leading zero index",
+			doc:   `{"foo": ["bar"]}`,
+			patch: `[{"op": "add", "path": "/foo/01", "value": "baz"}]`,
+			err:   patch.ErrInvalid,
+		},
+		{
+			name:  "add with a negative index",
+			doc:   `{"foo": ["bar"]}`,
+			patch: `[{"op": "add", "path": "/foo/-1", "value": "baz"}]`,
+			err:   patch.ErrInvalid,
+		},
+		{
+			name:  "add under a missing member",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/baz/bat", "value": "qux"}]`,
+			err:   patch.ErrPath,
+		},
+		{
+			name:  "add under a value that isn't a container",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/foo/baz", "value": "qux"}]`,
+			err:   patch.ErrPath,
+		},
+		{
+			name:  "add the whole document",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "", "value": {"baz": "qux"}}]`,
+			want:  `{"baz": "qux"}`,
+		},
+		{
+			name:  "add without a value",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/baz"}]`,
+			err:   patch.ErrInvalid,
+		},
+		{
+			name:  "remove an object member",
+			doc:   `{"baz": "qux", "foo": "bar"}`,
+			patch: `[{"op": "remove", "path": "/baz"}]`,
+			want:  `{"foo": "bar"}`,
+		},
+		{
+			name:  "remove an array element",
+			doc:   `{"foo": ["bar", "qux", "baz"]}`,
+			patch: `[{"op": "remove", "path": "/foo/1"}]`,
+			want:  `{"foo": ["bar", "baz"]}`,
+		},
+		{
+			name:  "remove a missing member",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "remove", "path": "/baz"}]`,
+			err:   patch.ErrPath,
+		},
+		{
+			name:  "remove past the end of an array",
+			doc:   `{"foo": ["bar"]}`,
+			patch: `[{"op": "remove", "path": "/foo/1"}]`,
+			err:   patch.ErrPath,
+		},
+		{
+			name:  "remove with -",
+			doc:   `{"foo": ["bar"]}`,
+			patch: `[{"op": "remove", "path": "/foo/-"}]`,
+			err:   patch.ErrPath,
+		},
+		{
+			name:  "remove the whole document",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "remove", "path": ""}]`,
+			err:   patch.ErrInvalid,
+		},
+		{
+			name:  "replace an object member",
+			doc:   `{"baz": "qux", "foo": "bar"}`,
+			patch: `[{"op": "replace", "path": "/baz", "value": "boo"}]`,
+			want:  `{"baz": "boo", "foo": "bar"}`,
+		},
+		{
+			name:  "replace an array element",
+			doc:   `{"foo": ["bar", "baz"]}`,
+			patch: `[{"op": "replace", "path": "/foo/0", "value": "qux"}]`,
+			want:  `{"foo": ["qux", "baz"]}`,
+		},
+		{
+			name:  "replace a missing member",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "replace", "path": "/baz", "value": "qux"}]`,
+			err:   patch.ErrPath,
+		},
+		{
+			name:  "replace the whole document",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "replace", "path": "", "value": ["baz"]}]`,
+			want:  `["baz"]`,
+		},
+		{
+			name:  "move an object member",
+			doc:   `{"foo": {"bar": "baz", "waldo": "fred"}, "qux": {"corge": "grault"}}`,
+			patch: `[{"op": "move", "from": "/foo/waldo", "path": "/qux/thud"}]`,
+			want:  `{"foo": {"bar": "baz"}, "qux": {"corge": "grault", "thud": "fred"}}`,
+		},
+		{
+			name:  "move an array element",
+			doc:   `{"foo": ["all", "grass", "cows", "eat"]}`,
+			patch: `[{"op": "move", "from": "/foo/1", "path": "/foo/3"}]`,
+			want:  `{"foo": ["all", "cows", "eat", "grass"]}`,
+		},
+		{
+			name:  "move a value to where it is",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "move", "from": "/foo", "path": "/foo"}]`,
+			want:  `{"foo": "bar"}`,
+		},
+		{
+			name:  "move a value into one of its children",
+			doc:   `{"foo": {"bar": "baz"}}`,
+			patch: `[{"op": "move", "from": "/foo", "path": "/foo/bar/qux"}]`,
+			err:   patch.ErrInvalid,
+		},
+		{
+			name:  "move a missing member",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "move", "from": "/baz", "path": "/qux"}]`,
+			err:   patch.ErrPath,
+		},
+		{
+			name: "copy makes a value of its own",
+			doc:  `{"foo": {"bar": 1}}`,
+			patch: `[
+				{"op": "copy", "from": "/foo", "path": "/baz"},
+				{"op": "replace", "path": "/baz/bar", "value": 2}
+			]`,
+			want: `{"baz": {"bar": 2}, "foo": {"bar": 1}}`,
+		},
+		{
+			name:  "copy into an array",
+			doc:   `{"foo": ["bar"], "baz": "qux"}`,
+			patch: `[{"op": "copy", "from": "/baz", "path": "/foo/0"}]`,
+			want:  `{"foo": ["qux", "bar"], "baz": "qux"}`,
+		},
+		{
+			name:  "copy a missing member",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "copy", "from": "/baz", "path": "/qux"}]`,
+			err:   patch.ErrPath,
+		},
+		{
+			name: "test values that match",
+			doc:  `{"baz": "qux", "foo": ["a", 2, "c"], "obj": {"x": [1, {"y": null}]}}`,
+			patch: `[
+				{"op": "test", "path": "/baz", "value": "qux"},
+				{"op": "test", "path": "/foo/1", "value": 2},
+				{"op": "test", "path": "/obj", "value": {"x": [1, {"y": null}]}}
+			]`,
+			want: `{"baz": "qux", "foo": ["a", 2, "c"], "obj": {"x": [1, {"y": null}]}}`,
+		},
+		{
+			name:  "test numbers written differently",
+			doc:   `{"foo": 10}`,
+			patch: `[{"op": "test", "path": "/foo", "value": 1e1}]`,
+			want:  `{"foo": 10}`,
+		},
+		{
+			name:  "test a value that doesn't match",
+			doc:   `{"baz": "qux"}`,
+			patch: `[{"op": "test", "path": "/baz", "value": "bar"}]`,
+			err:   patch.ErrTestFailed,
+		},
+		{
+			name:  "test a string against a number",
+			doc:   `{"baz": "1"}`,
+			patch: `[{"op": "test", "path": "/baz", "value": 1}]`,
+			err:   patch.ErrTestFailed,
+		},
+		{
+			name:  "test a missing member",
+			doc:   `{"baz": "qux"}`,
+			patch: `[{"op": "test", "path": "/foo", "value": "bar"}]`,
+			err:   patch.ErrPath,
+		},
+		{
+			name: "escaped ~ and / in paths",
+			doc:  `{"a/b": 1, "m~n": 2}`,
+			patch: `[
+				{"op": "test", "path": "/a~1b", "value": 1},
+				{"op": "test", "path": "/m~0n", "value": 2},
+				{"op": "add", "path": "/~01", "value": 3}
+			]`,
+			want: `{"a/b": 1, "m~n": 2, "~1": 3}`,
+		},
+		{
+			name:  "the empty member name",
+			doc:   `{"": 1}`,
+			patch: `[{"op": "replace", "path": "/", "value": 2}]`,
+			want:  `{"": 2}`,
+		},
+		{
+			name:  "a path without a leading /",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "remove", "path": "foo"}]`,
+			err:   patch.ErrInvalid,
+		},
+		{
+			name: "a failing operation fails the whole patch",
+			doc:  `{"foo": "bar"}`,
+			patch: `[
+				{"op": "replace", "path": "/foo", "value": "baz"},
+				{"op": "remove", "path": "/qux"}
+			]`,
+			err: patch.ErrPath,
+		},
+		{
+			name:  "an unknown operation",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "frobnicate", "path": "/foo"}]`,
+			err:   patch.ErrInvalid,
+		},
+		{
+			name:  "an operation without a path",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "remove"}]`,
+			err:   patch.ErrInvalid,
+		},
+		{
+			name:  "a patch that isn't an array",
+			doc:   `{"foo": "bar"}`,
+			patch: `{"op": "remove", "path": "/foo"}`,
+			err:   patch.ErrInvalid,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := patch.Apply([]byte(tt.doc), []byte(tt.patch))
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("got error %v; want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := canonical(t, string(got)), canonical(t, tt.want); got != want {
+				t.Errorf("got %s; want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	// The examples of RFC 7396, appendix A.
+	tests := []struct {
+		doc, patch, want string
+	}{
+		{`{"a": "b"}`, `{"a": "c"}`, `{"a": "c"}`},
+		{`{"a": "b"}`, `{"b": "c"}`, `{"a": "b", "b": "c"}`},
+		{`{"a": "b"}`, `{"a": null}`, `{}`},
+		{`{"a": "b", "b": "c"}`, `{"a": null}`, `{"b": "c"}`},
+		{`{"a": ["b"]}`, `{"a": "c"}`, `{"a": "c"}`},
+		{`{"a": "c"}`, `{"a": ["b"]}`, `{"a": ["b"]}`},
+		{`{"a": {"b": "c"}}`, `{"a": {"b": "d", "c": null}}`, `{"a": {"b": "d"}}`},
+		{`{"a": [{"b": "c"}]}`, `{"a": [1]}`, `{"a": [1]}`},
+		{`["a", "b"]`, `["c", "d"]`, `["c", "d"]`},
+		{`{"a": "b"}`, `["c"]`, `["c"]`},
+		{`{"a": "foo"}`, `null`, `null`},
+		{`{"a": "foo"}`, `"bar"`, `"bar"`},
+		{`{"e": null}`, `{"a": 1}`, `{"e": null, "a": 1}`},
+		{`[1, 2]`, `{"a": "b", "c": null}`, `{"a": "b"}`},
+		{`{}`, `{"a": {"bb": {"ccc": null}}}`, `{"a": {"bb": {}}}`},
+	}
+
+	for _, tt := range tests {
+		got, err := patch.MergePatch([]byte(tt.doc), []byte(tt.patch))
+		if err != nil {
+			t.Errorf("%s + %s: %v", tt.doc, tt.patch, err)
+			continue
+		}
+		if got, want := canonical(t, string(got)), canonical(t, tt.want); got != want {
+			t.Errorf("%s + %s: got %s; want %s", tt.doc, tt.patch, got, want)
+		}
+	}
+
+	_, err := patch.MergePatch([]byte(`{"a": "b"}`), []byte(`{"a": `))
+	if !errors.Is(err, patch.ErrInvalid) {
+		t.Errorf("got error %v for a malformed patch; want %v", err, patch.ErrInvalid)
+	}
+}
+
+// TestDocumentErrors checks that a document that can't be decoded, which
+// the caller is responsible for, isn't blamed on the patch.
+func TestDocumentErrors(t *testing.T) {
+	doc := []byte(`{"foo": `)
+
+	_, err := patch.Apply(doc, []byte(`[]`))
+	if err == nil || errors.Is(err, patch.ErrInvalid) || errors.Is(err, patch.ErrPath) {
+		t.Errorf("Apply: got error %v; want an error that isn't the patch's", err)
+	}
+
+	_, err = patch.MergePatch(doc, []byte(`{}`))
+	if err == nil || errors.Is(err, patch.ErrInvalid) || errors.Is(err, patch.ErrPath) {
+		t.Errorf("MergePatch: got error %v; want an error that isn't the patch's", err)
+	}
+}
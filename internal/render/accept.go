@@ -0,0 +1,66 @@
+package render
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MediaRange is one media range of an Accept header, such as
+// "application/json; pretty=true; q=0.8".
+type MediaRange struct {
+	Type    string
+	Params  map[string]string
+	Quality float64
+}
+
+// ParseAccept parses the values of an Accept header into media ranges, most
+// preferred first. Ranges with q=0 are left out, and ranges of equal quality
+// keep the order they were given in.
+func ParseAccept(values []string) []MediaRange {
+	ranges := []MediaRange{}
+	for _, header := range values {
+		for _, part := range strings.Split(header, ",") {
+			fields := strings.Split(part, ";")
+			mediaType := strings.ToLower(strings.TrimSpace(fields[0]))
+			if mediaType == "" {
+				continue
+			}
+
+			mr := MediaRange{Type: mediaType, Params: map[string]string{}, Quality: 1}
+			for _, param := range fields[1:] {
+				key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+				key = strings.ToLower(strings.TrimSpace(key))
+				value = strings.Trim(strings.TrimSpace(value), `"`)
+				if key == "q" {
+					if q, err := strconv.ParseFloat(value, 64); err == nil {
+						mr.Quality = q
+					}
+					continue
+				}
+				if key != "" {
+					mr.Params[key] = value
+				}
+			}
+
+			if mr.Quality > 0 {
+				ranges = append(ranges, mr)
+			}
+		}
+	}
+
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].Quality > ranges[j].Quality
+	})
+	return ranges
+}
+
+// Matches reports whether the range covers mediaType, which must not have
+// parameters.
+func (mr MediaRange) Matches(mediaType string) bool {
+	if mr.Type == "*/*" || mr.Type == mediaType {
+		return true
+	}
+	prefix, ok := strings.CutSuffix(mr.Type, "/*")
+	return ok && strings.HasPrefix(mediaType, prefix+"/")
+}
@@ -0,0 +1,251 @@
+package render
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// csvEncoder writes the records of a response as CSV with a header row.
+// The records are the response's one collection, such as the books of a
+// book list, or its one object. Nested values are flattened: lists of
+// plain values and of named objects, such as authors, become "; "-separated
+// lists, and anything else is written as JSON. Text cells that a
+// spreadsheet would run as a formula are prefixed with a single quote.
+type csvEncoder struct{}
+
+func (csvEncoder) ContentType() string { return "text/csv; charset=utf-8" }
+
+func (csvEncoder) Encode(w io.Writer, v any) error {
+	js, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.UseNumber()
+	value, err := decodeOrdered(dec)
+	if err != nil {
+		return err
+	}
+
+	records := csvRecords(value)
+
+	columns := []string{}
+	seen := map[string]bool{}
+	for _, record := range records {
+		for _, key := range record.keys {
+			if !seen[key] {
+				seen[key] = true
+				columns = append(columns, key)
+			}
+		}
+	}
+
+	cw := csv.NewWriter(w)
+	err = cw.Write(columns)
+	if err != nil {
+		return err
+	}
+
+	row := make([]string, len(columns))
+	for _, record := range records {
+		for i, column := range columns {
+			value := record.values[column]
+			row[i] = csvCell(value)
+			if _, ok := value.(json.Number); !ok {
+				row[i] = escapeFormula(row[i])
+			}
+		}
+		err = cw.Write(row)
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvRecords picks the records out of a response envelope: the value of its
+// only key, or else of its first key holding a list. Pagination metadata is
+// not a record.
+func csvRecords(value any) []*object {
+	if envelope, ok := value.(*object); ok {
+		keys := []string{}
+		for _, key := range envelope.keys {
+			if key != "metadata" {
+				keys = append(keys, key)
+			}
+		}
+
+		var main string
+		if len(keys) == 1 {
+			main = keys[0]
+		} else {
+			for _, key := range keys {
+				if _, ok := envelope.values[key].([]any); ok {
+					main = key
+					break
+				}
+			}
+		}
+
+		if main == "" {
+			return []*object{envelope}
+		}
+		switch inner := envelope.values[main].(type) {
+		case *object, []any:
+			value = inner
+		default:
+			return []*object{{keys: []string{main}, values: map[string]any{main: inner}}}
+		}
+	}
+
+	switch value := value.(type) {
+	case *object:
+		return []*object{value}
+	case []any:
+		records := make([]*object, len(value))
+		for i, item := range value {
+			if record, ok := item.(*object); ok {
+				records[i] = record
+			} else {
+				records[i] = &object{keys: []string{"value"}, values: map[string]any{"value": item}}
+			}
+		}
+		return records
+	default:
+		return []*object{{keys: []string{"value"}, values: map[string]any{"value": value}}}
+	}
+}
+
+func csvCell(value any) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case json.Number:
+		return value.String()
+	case bool:
+		if value {
+			return "true"
+		}
+		return "false"
+	case []any:
+		items := make([]string, 0, len(value))
+		for _, item := range value {
+			switch item := item.(type) {
+			case *object:
+				name, ok := item.values["name"].(string)
+				if !ok {
+					return compactJSON(value)
+				}
+				items = append(items, name)
+			case []any:
+				return compactJSON(value)
+			default:
+				items = append(items, csvCell(item))
+			}
+		}
+		return strings.Join(items, "; ")
+	default:
+		return compactJSON(value)
+	}
+}
+
+// escapeFormula keeps a spreadsheet from running cell, which holds text
+// clients wrote such as a title or a review, as a formula.
+func escapeFormula(cell string) string {
+	if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
+
+func compactJSON(value any) string {
+	js, err := json.Marshal(value)
+	if err != nil {
+		return ""
+	}
+	return string(js)
+}
+
+// object is a decoded JSON object that remembers the order of its keys, so
+// that CSV columns follow the order of the fields in the JSON.
+type object struct {
+	keys   []string
+	values map[string]any
+}
+
+func (o *object) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(o.values[key])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// decodeOrdered decodes the next JSON value from dec, with objects decoded
+// as *object.
+func decodeOrdered(dec *json.Decoder) (any, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	delim, ok := token.(json.Delim)
+	if !ok {
+		return token, nil
+	}
+
+	switch delim {
+	case '{':
+		obj := &object{values: map[string]any{}}
+		for dec.More() {
+			keyToken, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			key := keyToken.(string)
+			value, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			if _, exists := obj.values[key]; !exists {
+				obj.keys = append(obj.keys, key)
+			}
+			obj.values[key] = value
+		}
+		_, err = dec.Token()
+		return obj, err
+	default:
+		arr := []any{}
+		for dec.More() {
+			value, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, value)
+		}
+		_, err = dec.Token()
+		return arr, err
+	}
+}
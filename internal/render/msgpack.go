@@ -0,0 +1,50 @@
+package render
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// msgpackEncoder writes the JSON representation of a response as
+// MessagePack. Whole numbers are encoded as integers and others as floats.
+type msgpackEncoder struct{}
+
+func (msgpackEncoder) ContentType() string { return "application/msgpack" }
+
+func (msgpackEncoder) Encode(w io.Writer, v any) error {
+	value, err := generic(v)
+	if err != nil {
+		return err
+	}
+
+	enc := msgpack.NewEncoder(w)
+	enc.SetSortMapKeys(true)
+	return enc.Encode(msgpackNumbers(value))
+}
+
+// msgpackNumbers replaces the json.Numbers in a generic value with int64 or
+// float64.
+func msgpackNumbers(value any) any {
+	switch value := value.(type) {
+	case json.Number:
+		if n, err := value.Int64(); err == nil {
+			return n
+		}
+		f, _ := value.Float64()
+		return f
+	case map[string]any:
+		for key, item := range value {
+			value[key] = msgpackNumbers(item)
+		}
+		return value
+	case []any:
+		for i, item := range value {
+			value[i] = msgpackNumbers(item)
+		}
+		return value
+	default:
+		return value
+	}
+}
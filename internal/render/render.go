@@ -0,0 +1,107 @@
+// Package render encodes API responses in the representation a client asks
+// for in its Accept header: JSON, either compact or indented, CSV or
+// MessagePack.
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strconv"
+)
+
+// Encoder writes a response body in one representation.
+type Encoder interface {
+	// ContentType is the Content-Type header of the encoded body.
+	ContentType() string
+	Encode(w io.Writer, v any) error
+}
+
+var (
+	// PrettyJSON is the representation used when the client doesn't say
+	// what it wants, so that responses stay readable from a terminal.
+	PrettyJSON Encoder = jsonEncoder{indent: true}
+	JSON       Encoder = jsonEncoder{}
+	CSV        Encoder = csvEncoder{}
+	MsgPack    Encoder = msgpackEncoder{}
+)
+
+// MediaTypes lists the media types Negotiate can satisfy, for telling
+// clients what they may ask for.
+var MediaTypes = []string{"application/json", "text/csv", "application/msgpack"}
+
+// msgpackMediaTypes are the names MessagePack goes by.
+var msgpackMediaTypes = []string{"application/msgpack", "application/x-msgpack", "application/vnd.msgpack"}
+
+// Negotiate returns the encoder for the most preferred media range that one
+// is available for. No Accept header, or a wildcard, gets indented JSON;
+// application/json gets compact JSON unless it has a pretty=true parameter.
+// It returns false when nothing acceptable is available.
+func Negotiate(accept []string) (Encoder, bool) {
+	ranges := ParseAccept(accept)
+	if len(ranges) == 0 {
+		return PrettyJSON, true
+	}
+
+	for _, mr := range ranges {
+		switch {
+		case mr.Type == "application/json":
+			if pretty, _ := strconv.ParseBool(mr.Params["pretty"]); pretty {
+				return PrettyJSON, true
+			}
+			return JSON, true
+		case mr.Type == "*/*", mr.Type == "application/*":
+			return PrettyJSON, true
+		case mr.Matches("text/csv"):
+			return CSV, true
+		}
+		for _, mediaType := range msgpackMediaTypes {
+			if mr.Type == mediaType {
+				return MsgPack, true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+type jsonEncoder struct {
+	indent bool
+}
+
+func (jsonEncoder) ContentType() string { return "application/json" }
+
+func (e jsonEncoder) Encode(w io.Writer, v any) error {
+	var js []byte
+	var err error
+	if e.indent {
+		js, err = json.MarshalIndent(v, "", "\t")
+	} else {
+		js, err = json.Marshal(v)
+	}
+	if err != nil {
+		return err
+	}
+
+	js = append(js, '\n')
+	_, err = w.Write(js)
+	return err
+}
+
+// generic turns v into the values encoding/json decodes into: maps, slices,
+// strings, numbers, booleans and nil. Going through JSON means the other
+// encoders see exactly the fields, names and custom marshalling the JSON
+// representation has. Numbers are kept as json.Number.
+func generic(v any) (any, error) {
+	js, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.UseNumber()
+
+	var value any
+	err = dec.Decode(&value)
+	return value, err
+}
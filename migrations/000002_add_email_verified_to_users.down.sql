@@ -1,2 +0,0 @@
-ALTER TABLE users
-DROP COLUMN email_verified;
@@ -1,2 +0,0 @@
-ALTER TABLE users
-ADD COLUMN email_verified BOOLEAN DEFAULT FALSE;
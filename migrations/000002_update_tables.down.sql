@@ -1,6 +1,4 @@
--- Dropping the `created_by` column from the reading_lists table
-ALTER TABLE reading_lists
-DROP COLUMN created_by;
+-- reading_lists.created_by belongs to 000001_migrations, so it stays
 
 -- Dropping the `author_id` column from the reviews table
 ALTER TABLE reviews
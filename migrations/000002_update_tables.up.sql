@@ -1,6 +1,7 @@
--- Adding the `created_by` field to the reading_lists table to associate reading lists with users
+-- reading_lists.created_by already comes with 000001_migrations, so this
+-- only adds it to databases that predate it
 ALTER TABLE reading_lists
-ADD COLUMN created_by INT REFERENCES users(id) ON DELETE CASCADE;
+ADD COLUMN IF NOT EXISTS created_by INT REFERENCES users(id) ON DELETE CASCADE;
 
 -- Adding the `author_id` field to the reviews table to associate reviews with users
 ALTER TABLE reviews
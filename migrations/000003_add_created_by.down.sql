@@ -1,3 +1,2 @@
--- Remove the 'created_by' field from the 'reading_lists' table
-ALTER TABLE reading_lists
-DROP COLUMN created_by;
+-- Nothing to undo: reading_lists.created_by belongs to 000001_migrations,
+-- whose down migration drops it with the table.
@@ -1,3 +1,4 @@
--- Add the 'created_by' field to the 'reading_lists' table to associate it with a user
+-- 000001_migrations already creates reading_lists.created_by, so this only
+-- adds it to databases that somehow lack it.
 ALTER TABLE reading_lists
-ADD COLUMN created_by INT REFERENCES users(id) ON DELETE CASCADE;
+ADD COLUMN IF NOT EXISTS created_by INT REFERENCES users(id) ON DELETE CASCADE;
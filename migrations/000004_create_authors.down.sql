@@ -0,0 +1,19 @@
+-- Restore the authors array on books from the join table
+ALTER TABLE books ADD COLUMN IF NOT EXISTS authors TEXT[] NOT NULL DEFAULT '{}';
+
+UPDATE books b
+SET authors = names.authors
+FROM (
+    SELECT ba.book_id, array_agg(a.name ORDER BY ba.position) AS authors
+    FROM book_authors ba
+    JOIN authors a ON a.id = ba.author_id
+    WHERE ba.role = 'author'
+    GROUP BY ba.book_id
+) AS names
+WHERE b.id = names.book_id;
+
+CREATE INDEX IF NOT EXISTS idx_books_author ON books(authors);
+
+DROP INDEX IF EXISTS idx_book_authors_author_id;
+DROP TABLE IF EXISTS book_authors CASCADE;
+DROP TABLE IF EXISTS authors CASCADE;
@@ -0,0 +1,48 @@
+-- Create the 'authors' table. normalized_name is the lower-cased name with
+-- punctuation and whitespace removed so that "J.R.R. Tolkien" and
+-- "J. R. R. Tolkien" resolve to the same author.
+CREATE TABLE IF NOT EXISTS authors (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    normalized_name VARCHAR(255) NOT NULL UNIQUE,
+    bio TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    version INT DEFAULT 1
+);
+
+-- Create the 'book_authors' table to associate authors with books, with the
+-- contributor's role and their position in the credits
+CREATE TABLE IF NOT EXISTS book_authors (
+    book_id INT NOT NULL,
+    author_id INT NOT NULL,
+    role VARCHAR(20) NOT NULL DEFAULT 'author' CHECK (role IN ('author', 'translator', 'illustrator')),
+    position INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (book_id, author_id, role),
+    FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE,
+    FOREIGN KEY (author_id) REFERENCES authors(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_book_authors_author_id ON book_authors(author_id);
+
+-- Move the existing authors arrays into the new tables. The first spelling
+-- seen for a normalized name becomes the author's display name.
+INSERT INTO authors (name, normalized_name)
+SELECT DISTINCT ON (normalized_name) name, normalized_name
+FROM (
+    SELECT trim(a.name) AS name, regexp_replace(lower(a.name), '[^[:alnum:]]', '', 'g') AS normalized_name, b.id, a.position
+    FROM books b, unnest(b.authors) WITH ORDINALITY AS a(name, position)
+) AS names
+WHERE normalized_name <> ''
+ORDER BY normalized_name, id, position
+ON CONFLICT (normalized_name) DO NOTHING;
+
+INSERT INTO book_authors (book_id, author_id, role, position)
+SELECT b.id, au.id, 'author', MIN(a.position) - 1
+FROM books b
+CROSS JOIN LATERAL unnest(b.authors) WITH ORDINALITY AS a(name, position)
+JOIN authors au ON au.normalized_name = regexp_replace(lower(a.name), '[^[:alnum:]]', '', 'g')
+GROUP BY b.id, au.id
+ON CONFLICT DO NOTHING;
+
+DROP INDEX IF EXISTS idx_books_author;
+ALTER TABLE books DROP COLUMN IF EXISTS authors;
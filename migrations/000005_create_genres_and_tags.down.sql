@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS idx_book_tags_tag_id;
+DROP TABLE IF EXISTS book_tags CASCADE;
+DROP TABLE IF EXISTS tags CASCADE;
+
+DROP INDEX IF EXISTS idx_book_genres_genre_id;
+DROP TABLE IF EXISTS book_genres CASCADE;
+
+DROP INDEX IF EXISTS idx_genres_parent_id;
+DROP INDEX IF EXISTS idx_genres_name;
+DROP TABLE IF EXISTS genres CASCADE;
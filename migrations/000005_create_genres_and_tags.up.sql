@@ -0,0 +1,59 @@
+-- Create the 'genres' table. Genres form a tree through parent_id, e.g.
+-- Fiction > Fantasy > Epic Fantasy.
+CREATE TABLE IF NOT EXISTS genres (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    parent_id INT REFERENCES genres(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    version INT DEFAULT 1,
+    CHECK (parent_id IS NULL OR parent_id <> id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_genres_name ON genres(lower(name));
+CREATE INDEX IF NOT EXISTS idx_genres_parent_id ON genres(parent_id);
+
+-- Create the 'book_genres' table to associate books with any number of genres
+CREATE TABLE IF NOT EXISTS book_genres (
+    book_id INT NOT NULL,
+    genre_id INT NOT NULL,
+    PRIMARY KEY (book_id, genre_id),
+    FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE,
+    FOREIGN KEY (genre_id) REFERENCES genres(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_book_genres_genre_id ON book_genres(genre_id);
+
+-- Create the 'tags' table for free-form, user contributed labels
+CREATE TABLE IF NOT EXISTS tags (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(50) NOT NULL UNIQUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create the 'book_tags' table. Each user can apply a tag to a book once.
+CREATE TABLE IF NOT EXISTS book_tags (
+    book_id INT NOT NULL,
+    tag_id INT NOT NULL,
+    user_id INT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (book_id, tag_id, user_id),
+    FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE,
+    FOREIGN KEY (tag_id) REFERENCES tags(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_book_tags_tag_id ON book_tags(tag_id);
+
+-- Turn the existing single genre values into top-level genres
+INSERT INTO genres (name)
+SELECT DISTINCT ON (lower(trim(genre))) trim(genre)
+FROM books
+WHERE genre IS NOT NULL AND trim(genre) <> ''
+ORDER BY lower(trim(genre)), id
+ON CONFLICT DO NOTHING;
+
+INSERT INTO book_genres (book_id, genre_id)
+SELECT b.id, g.id
+FROM books b
+JOIN genres g ON lower(g.name) = lower(trim(b.genre))
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS idx_books_work_id;
+
+ALTER TABLE books
+DROP COLUMN IF EXISTS work_id,
+DROP COLUMN IF EXISTS format,
+DROP COLUMN IF EXISTS language,
+DROP COLUMN IF EXISTS publisher,
+DROP COLUMN IF EXISTS page_count;
+
+DROP TABLE IF EXISTS works CASCADE;
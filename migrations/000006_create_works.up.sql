@@ -0,0 +1,33 @@
+-- Create the 'works' table. A work is the abstract book (e.g. "The Hobbit");
+-- each row in 'books' is one edition of a work.
+CREATE TABLE IF NOT EXISTS works (
+    id SERIAL PRIMARY KEY,
+    title VARCHAR(255) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    version INT DEFAULT 1,
+    seed_book_id INT
+);
+
+-- Edition details on books
+ALTER TABLE books
+ADD COLUMN work_id INT REFERENCES works(id),
+ADD COLUMN format VARCHAR(20) NOT NULL DEFAULT '' CHECK (format IN ('', 'hardcover', 'paperback', 'ebook', 'audiobook', 'other')),
+ADD COLUMN language VARCHAR(35) NOT NULL DEFAULT '',
+ADD COLUMN publisher VARCHAR(255) NOT NULL DEFAULT '',
+ADD COLUMN page_count INT NOT NULL DEFAULT 0 CHECK (page_count >= 0);
+
+-- Every existing book becomes the single edition of a new work
+INSERT INTO works (title, description, seed_book_id)
+SELECT title, COALESCE(description, ''), id
+FROM books;
+
+UPDATE books b
+SET work_id = w.id
+FROM works w
+WHERE w.seed_book_id = b.id;
+
+ALTER TABLE works DROP COLUMN seed_book_id;
+ALTER TABLE books ALTER COLUMN work_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_books_work_id ON books(work_id);
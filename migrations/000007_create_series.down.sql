@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_series_entries_book_id;
+DROP TABLE IF EXISTS series_entries CASCADE;
+DROP TABLE IF EXISTS series CASCADE;
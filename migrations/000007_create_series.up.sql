@@ -0,0 +1,22 @@
+-- Create the 'series' table
+CREATE TABLE IF NOT EXISTS series (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    version INT DEFAULT 1
+);
+
+-- Create the 'series_entries' table. position is the reading order within
+-- the series and may be fractional for novellas (e.g. 2.5).
+CREATE TABLE IF NOT EXISTS series_entries (
+    series_id INT NOT NULL,
+    book_id INT NOT NULL,
+    position NUMERIC(6, 2) NOT NULL CHECK (position >= 0),
+    PRIMARY KEY (series_id, book_id),
+    UNIQUE (series_id, position),
+    FOREIGN KEY (series_id) REFERENCES series(id) ON DELETE CASCADE,
+    FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_series_entries_book_id ON series_entries(book_id);
@@ -0,0 +1,23 @@
+-- Create the 'import_jobs' table. Long running imports record their
+-- progress here so clients can poll for it; conflicts holds the rows that
+-- needed a decision or could not be imported.
+CREATE TABLE IF NOT EXISTS import_jobs (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL,
+    source VARCHAR(50) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'queued' CHECK (status IN ('queued', 'running', 'completed', 'failed')),
+    total_rows INT NOT NULL DEFAULT 0,
+    processed_rows INT NOT NULL DEFAULT 0,
+    books_created INT NOT NULL DEFAULT 0,
+    books_matched INT NOT NULL DEFAULT 0,
+    lists_created INT NOT NULL DEFAULT 0,
+    reviews_created INT NOT NULL DEFAULT 0,
+    conflicts JSONB NOT NULL DEFAULT '[]',
+    error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMP,
+    version INT DEFAULT 1,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_import_jobs_user_id ON import_jobs(user_id);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_book_sources_book_id;
+DROP TABLE IF EXISTS book_sources CASCADE;
@@ -0,0 +1,12 @@
+-- Create the 'book_sources' table. It remembers which record in an
+-- external catalog (a Calibre library, an ONIX feed, ...) each imported book
+-- came from, so re-running an import updates the same books.
+CREATE TABLE IF NOT EXISTS book_sources (
+    source VARCHAR(50) NOT NULL,
+    source_id VARCHAR(255) NOT NULL,
+    book_id INT NOT NULL,
+    PRIMARY KEY (source, source_id),
+    FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_book_sources_book_id ON book_sources(book_id);
@@ -0,0 +1,8 @@
+-- Create the 'book_covers' table holding one cover image per book
+CREATE TABLE IF NOT EXISTS book_covers (
+    book_id INT PRIMARY KEY,
+    content_type VARCHAR(100) NOT NULL,
+    image BYTEA NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE
+);
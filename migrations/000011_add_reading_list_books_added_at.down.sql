@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_reading_list_books_added_at;
+
+ALTER TABLE reading_list_books
+DROP COLUMN IF EXISTS added_at;
@@ -0,0 +1,6 @@
+-- Record when each book was added to a reading list, so that the list's
+-- feed can show its changes in order
+ALTER TABLE reading_list_books
+ADD COLUMN IF NOT EXISTS added_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_reading_list_books_added_at ON reading_list_books(reading_list_id, added_at);
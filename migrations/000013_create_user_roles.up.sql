@@ -0,0 +1,8 @@
+-- Create the 'user_roles' table. A user holds each role at most once.
+CREATE TABLE IF NOT EXISTS user_roles (
+    user_id INT NOT NULL,
+    role VARCHAR(20) NOT NULL CHECK (role IN ('admin', 'editor', 'moderator')),
+    granted_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, role),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
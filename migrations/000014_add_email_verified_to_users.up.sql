@@ -0,0 +1,5 @@
+-- This was numbered 000002 alongside 000002_update_tables, which migrate
+-- rejects. IF NOT EXISTS keeps it harmless on databases that already have
+-- the column.
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS email_verified BOOLEAN DEFAULT FALSE;
@@ -0,0 +1,4 @@
+UPDATE reading_lists SET status = 'currently reading' WHERE status = 'want to read';
+ALTER TABLE reading_lists DROP CONSTRAINT reading_lists_status_check;
+ALTER TABLE reading_lists ADD CONSTRAINT reading_lists_status_check
+    CHECK (status IN ('currently reading', 'completed'));
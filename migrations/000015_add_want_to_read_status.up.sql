@@ -0,0 +1,5 @@
+-- Goodreads 'to-read' and custom shelves become lists of books the user
+-- wants to read. The status check comes from 000001_migrations.
+ALTER TABLE reading_lists DROP CONSTRAINT reading_lists_status_check;
+ALTER TABLE reading_lists ADD CONSTRAINT reading_lists_status_check
+    CHECK (status IN ('currently reading', 'completed', 'want to read'));
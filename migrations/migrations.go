@@ -0,0 +1,10 @@
+// Package migrations embeds the SQL migrations, so that the API binary can
+// apply them itself and knows which schema version it expects.
+package migrations
+
+import "embed"
+
+// FS holds the NNNNNN_name.up.sql and NNNNNN_name.down.sql files.
+//
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,74 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"net/http"
+)
+
+// BookQuery narrows a list of books. Title and Author match books whose
+// title or author name contains the text.
+type BookQuery struct {
+	Title  string
+	Author string
+	Genre  string
+	ListOptions
+}
+
+// CreateBook creates a book. The request carries an idempotency key, so
+// retrying it can't create the book twice.
+func (c *Client) CreateBook(ctx context.Context, input BookInput) (*Book, error) {
+	var resp struct {
+		Book *Book `json:"book"`
+	}
+	err := c.do(ctx, &request{method: http.MethodPost, path: "/v1/books", body: input, idempotent: true}, &resp)
+	return resp.Book, err
+}
+
+// GetBook returns the book with the given id.
+func (c *Client) GetBook(ctx context.Context, id int64) (*Book, error) {
+	var resp struct {
+		Book *Book `json:"book"`
+	}
+	err := c.do(ctx, &request{method: http.MethodGet, path: fmt.Sprintf("/v1/books/%d", id)}, &resp)
+	return resp.Book, err
+}
+
+// UpdateBook changes the fields of a book set in update and returns the
+// updated book.
+func (c *Client) UpdateBook(ctx context.Context, id int64, update BookUpdate) (*Book, error) {
+	var resp struct {
+		Book *Book `json:"book"`
+	}
+	err := c.do(ctx, &request{method: http.MethodPatch, path: fmt.Sprintf("/v1/books/%d", id), body: update}, &resp)
+	return resp.Book, err
+}
+
+// DeleteBook deletes a book.
+func (c *Client) DeleteBook(ctx context.Context, id int64) error {
+	return c.do(ctx, &request{method: http.MethodDelete, path: fmt.Sprintf("/v1/books/%d", id)}, nil)
+}
+
+// ListBooks returns one page of the books matching query.
+func (c *Client) ListBooks(ctx context.Context, query BookQuery) ([]*Book, Metadata, error) {
+	q := query.values()
+	setIf(q, "title", query.Title)
+	setIf(q, "author", query.Author)
+	setIf(q, "genre", query.Genre)
+
+	var resp struct {
+		Books    []*Book  `json:"books"`
+		Metadata Metadata `json:"metadata"`
+	}
+	err := c.do(ctx, &request{method: http.MethodGet, path: "/v1/books", query: q}, &resp)
+	return resp.Books, resp.Metadata, err
+}
+
+// Books iterates over the books matching query, page by page.
+func (c *Client) Books(ctx context.Context, query BookQuery) iter.Seq2[*Book, error] {
+	return paginate(query.ListOptions, func(opts ListOptions) ([]*Book, Metadata, error) {
+		query.ListOptions = opts
+		return c.ListBooks(ctx, query)
+	})
+}
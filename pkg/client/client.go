@@ -0,0 +1,326 @@
+// Package client is a Go client for the books API. It logs in on demand
+// and logs in again before its token expires, retries requests the API
+// turns away with 429 Too Many Requests, walks paginated lists with
+// iterators and reports error responses as *Error values.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config configures a Client. Only BaseURL is required.
+type Config struct {
+	// BaseURL is the URL of the API, without the /v1 prefix, such as
+	// "https://books.example.com".
+	BaseURL string
+	// HTTPClient sends the requests; http.DefaultClient when nil.
+	HTTPClient *http.Client
+	// Email and Password, when set, are used to log in before the first
+	// request that needs a token and again whenever the token is about to
+	// expire or is rejected.
+	Email    string
+	Password string
+	// Token is a token from an earlier login, used until it expires.
+	Token string
+	// MaxRetries is how many times a request turned away with 429 is
+	// retried; 3 when zero, none when negative.
+	MaxRetries int
+	// RetryBackoff is the wait before the first retry, doubled before each
+	// one after it; 500ms when zero. A Retry-After header overrides it.
+	RetryBackoff time.Duration
+}
+
+// tokenLeeway is how long before its expiry a token is renewed.
+const tokenLeeway = time.Minute
+
+// Client calls the API. It is safe for concurrent use.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	email      string
+	password   string
+	maxRetries int
+	backoff    time.Duration
+
+	mu          sync.Mutex
+	token       string
+	tokenExpiry time.Time
+
+	// sleep waits between retries; tests replace it.
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// New returns a client for the API described by cfg.
+func New(cfg Config) (*Client, error) {
+	base, err := url.Parse(cfg.BaseURL)
+	if err != nil || base.Scheme == "" || base.Host == "" {
+		return nil, fmt.Errorf("client: invalid base URL %q", cfg.BaseURL)
+	}
+
+	c := &Client{
+		baseURL:    strings.TrimRight(base.String(), "/"),
+		httpClient: cfg.HTTPClient,
+		email:      cfg.Email,
+		password:   cfg.Password,
+		maxRetries: cfg.MaxRetries,
+		backoff:    cfg.RetryBackoff,
+		sleep:      sleep,
+	}
+	if c.httpClient == nil {
+		c.httpClient = http.DefaultClient
+	}
+	switch {
+	case c.maxRetries == 0:
+		c.maxRetries = 3
+	case c.maxRetries < 0:
+		c.maxRetries = 0
+	}
+	if c.backoff <= 0 {
+		c.backoff = 500 * time.Millisecond
+	}
+	if cfg.Token != "" {
+		c.setToken(cfg.Token)
+	}
+
+	return c, nil
+}
+
+// Login logs in with email and password and uses the token it gets for the
+// requests that follow. The credentials are not kept; set them in Config
+// for the client to log in again by itself.
+func (c *Client) Login(ctx context.Context, email, password string) (string, error) {
+	input := map[string]string{"email": email, "password": password}
+	var resp struct {
+		Token string `json:"token"`
+	}
+	err := c.do(ctx, &request{method: http.MethodPost, path: "/v1/login", body: input, anonymous: true}, &resp)
+	if err != nil {
+		return "", err
+	}
+
+	c.setToken(resp.Token)
+	return resp.Token, nil
+}
+
+// Token returns the token the client is using, if any.
+func (c *Client) Token() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.token
+}
+
+func (c *Client) setToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = token
+	c.tokenExpiry = tokenExpiry(token)
+}
+
+// tokenExpiry reads the expiry time from the claims of a JWT. The client
+// can't verify the token, and doesn't need to: the time only decides when
+// to renew it. A token without one is taken not to expire.
+func tokenExpiry(token string) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if json.Unmarshal(payload, &claims) != nil || claims.Exp == 0 {
+		return time.Time{}
+	}
+	return time.Unix(claims.Exp, 0)
+}
+
+// authToken returns a token for a request, logging in first when there is
+// none or it is about to expire and the client has credentials.
+func (c *Client) authToken(ctx context.Context, required bool) (string, error) {
+	c.mu.Lock()
+	token, expiry := c.token, c.tokenExpiry
+	c.mu.Unlock()
+
+	expiring := token != "" && !expiry.IsZero() && time.Until(expiry) < tokenLeeway
+	if c.email != "" && (expiring || (token == "" && required)) {
+		return c.Login(ctx, c.email, c.password)
+	}
+	if token == "" && required {
+		return "", ErrNoCredentials
+	}
+	return token, nil
+}
+
+// request describes a call to the API.
+type request struct {
+	method string
+	path   string
+	query  url.Values
+	body   any
+	// auth marks requests that need a token; others send one only if the
+	// client already has it. anonymous requests, such as logging in, never
+	// send one.
+	auth      bool
+	anonymous bool
+	// idempotent adds an Idempotency-Key, which stays the same across
+	// retries, so that a retried create can't create twice.
+	idempotent bool
+}
+
+// do sends req and decodes the JSON body of a successful response into
+// dst, which may be nil. Requests turned away with 429 are retried, and a
+// request whose token is rejected is sent once more with a new one.
+func (c *Client) do(ctx context.Context, req *request, dst any) error {
+	var body []byte
+	if req.body != nil {
+		var err error
+		body, err = json.Marshal(req.body)
+		if err != nil {
+			return err
+		}
+	}
+
+	var key string
+	if req.idempotent {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return err
+		}
+		key = hex.EncodeToString(b)
+	}
+
+	var token string
+	if !req.anonymous {
+		var err error
+		token, err = c.authToken(ctx, req.auth)
+		if err != nil {
+			return err
+		}
+	}
+
+	relogged := false
+	for attempt := 0; ; attempt++ {
+		resp, err := c.send(ctx, req, body, token, key)
+		if err != nil {
+			return err
+		}
+
+		if resp.StatusCode < 300 {
+			defer resp.Body.Close()
+			if dst == nil {
+				_, err = io.Copy(io.Discard, resp.Body)
+				return err
+			}
+			return json.NewDecoder(resp.Body).Decode(dst)
+		}
+
+		apiErr := readError(resp)
+		switch {
+		case apiErr.StatusCode == http.StatusTooManyRequests && attempt < c.maxRetries:
+			err = c.sleep(ctx, c.retryDelay(resp, attempt))
+			if err != nil {
+				return err
+			}
+		case apiErr.tokenRejected() && !req.anonymous && c.email != "" && !relogged:
+			relogged = true
+			token, err = c.Login(ctx, c.email, c.password)
+			if err != nil {
+				return err
+			}
+		default:
+			return apiErr
+		}
+	}
+}
+
+func (c *Client) send(ctx context.Context, req *request, body []byte, token, key string) (*http.Response, error) {
+	u := c.baseURL + req.path
+	if len(req.query) > 0 {
+		u += "?" + req.query.Encode()
+	}
+
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, u, r)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Accept", "application/json")
+	if body != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		httpReq.Header.Set("Authorization", token)
+	}
+	if key != "" {
+		httpReq.Header.Set("Idempotency-Key", key)
+	}
+
+	return c.httpClient.Do(httpReq)
+}
+
+// retryDelay is how long to wait before retrying a request for the
+// attempt'th time: what the Retry-After header asks for, or else the
+// backoff doubled for each earlier attempt.
+func (c *Client) retryDelay(resp *http.Response, attempt int) time.Duration {
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return c.backoff << attempt
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// readError turns an error response into an *Error.
+func readError(resp *http.Response) *Error {
+	defer resp.Body.Close()
+
+	apiErr := &Error{StatusCode: resp.StatusCode}
+	var body struct {
+		Error json.RawMessage `json:"error"`
+	}
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if json.Unmarshal(b, &body) != nil || len(body.Error) == 0 {
+		apiErr.Message = strings.TrimSpace(string(b))
+		if apiErr.Message == "" {
+			apiErr.Message = http.StatusText(resp.StatusCode)
+		}
+		return apiErr
+	}
+
+	if json.Unmarshal(body.Error, &apiErr.Message) == nil {
+		return apiErr
+	}
+	apiErr.Message = ""
+	if json.Unmarshal(body.Error, &apiErr.Fields) != nil {
+		apiErr.Message = string(body.Error)
+	}
+	return apiErr
+}
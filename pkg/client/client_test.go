@@ -0,0 +1,271 @@
+package client
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeToken returns an unsigned JWT that expires at exp.
+func fakeToken(exp time.Time) string {
+	enc := base64.RawURLEncoding
+	payload := fmt.Sprintf(`{"user_id":1,"exp":%d}`, exp.Unix())
+	return enc.EncodeToString([]byte(`{"alg":"HS256"}`)) + "." + enc.EncodeToString([]byte(payload)) + ".sig"
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func newTestClient(t *testing.T, handler http.Handler, cfg Config) *Client {
+	t.Helper()
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	cfg.BaseURL = srv.URL
+	c, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.sleep = func(ctx context.Context, d time.Duration) error { return nil }
+	return c
+}
+
+func TestTokenRefresh(t *testing.T) {
+	var mu sync.Mutex
+	logins := 0
+	valid := ""
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/login", func(w http.ResponseWriter, r *http.Request) {
+		var input map[string]string
+		json.NewDecoder(r.Body).Decode(&input)
+		if input["email"] != "reader@example.com" || input["password"] != "secret" {
+			writeJSON(w, http.StatusNotFound, map[string]any{"error": "the requested resource could not be found"})
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		logins++
+		// The first token is about to expire.
+		exp := time.Now().Add(time.Hour)
+		if logins == 1 {
+			exp = time.Now().Add(10 * time.Second)
+		}
+		valid = fakeToken(exp)
+		writeJSON(w, http.StatusOK, map[string]any{"token": valid})
+	})
+	mux.HandleFunc("PATCH /v1/users/1", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ok := r.Header.Get("Authorization") == valid
+		mu.Unlock()
+		if !ok {
+			writeJSON(w, http.StatusUnprocessableEntity, map[string]any{"error": map[string]string{"error": "invalid token"}})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"user": map[string]any{"id": 1, "username": "reader"}})
+	})
+
+	c := newTestClient(t, mux, Config{Email: "reader@example.com", Password: "secret"})
+	ctx := context.Background()
+	username := "reader"
+
+	// The first request logs in; the token it gets is about to expire, so
+	// the second logs in again before it is sent.
+	for i := 0; i < 2; i++ {
+		user, err := c.UpdateUser(ctx, 1, UserUpdate{Username: &username})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.Username != "reader" {
+			t.Errorf("got username %q; want reader", user.Username)
+		}
+	}
+	if logins != 2 {
+		t.Errorf("got %d logins; want 2", logins)
+	}
+
+	// A token the server no longer accepts is replaced once.
+	mu.Lock()
+	valid = "revoked"
+	mu.Unlock()
+	_, err := c.UpdateUser(ctx, 1, UserUpdate{Username: &username})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if logins != 3 {
+		t.Errorf("got %d logins; want 3", logins)
+	}
+}
+
+func TestAuthWithoutCredentials(t *testing.T) {
+	c := newTestClient(t, http.NotFoundHandler(), Config{})
+
+	_, err := c.UpdateUser(context.Background(), 1, UserUpdate{})
+	if !errors.Is(err, ErrNoCredentials) {
+		t.Errorf("got error %v; want ErrNoCredentials", err)
+	}
+}
+
+func TestRetryOnRateLimit(t *testing.T) {
+	attempts := 0
+	keys := map[string]bool{}
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		keys[r.Header.Get("Idempotency-Key")] = true
+		if attempts <= 2 {
+			if attempts == 2 {
+				w.Header().Set("Retry-After", "7")
+			}
+			writeJSON(w, http.StatusTooManyRequests, map[string]any{"error": "rate limit exceeded"})
+			return
+		}
+		writeJSON(w, http.StatusCreated, map[string]any{"book": map[string]any{"id": 42, "title": "Dune"}})
+	})
+
+	c := newTestClient(t, handler, Config{RetryBackoff: time.Second})
+	var delays []time.Duration
+	c.sleep = func(ctx context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return nil
+	}
+
+	book, err := c.CreateBook(context.Background(), BookInput{Title: "Dune"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if book.ID != 42 {
+		t.Errorf("got book %d; want 42", book.ID)
+	}
+	if attempts != 3 {
+		t.Errorf("got %d attempts; want 3", attempts)
+	}
+	if len(keys) != 1 || keys[""] {
+		t.Errorf("got idempotency keys %v; want the same key on every attempt", keys)
+	}
+	want := []time.Duration{time.Second, 7 * time.Second}
+	if fmt.Sprint(delays) != fmt.Sprint(want) {
+		t.Errorf("got delays %v; want %v", delays, want)
+	}
+}
+
+func TestRetriesExhausted(t *testing.T) {
+	attempts := 0
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		writeJSON(w, http.StatusTooManyRequests, map[string]any{"error": "rate limit exceeded"})
+	})
+
+	c := newTestClient(t, handler, Config{MaxRetries: 2})
+
+	_, err := c.GetBook(context.Background(), 1)
+	if !errors.Is(err, ErrRateLimited) {
+		t.Errorf("got error %v; want ErrRateLimited", err)
+	}
+	if attempts != 3 {
+		t.Errorf("got %d attempts; want 3", attempts)
+	}
+}
+
+func TestPagination(t *testing.T) {
+	const total, pageSize = 7, 3
+	var pages []int
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/books" || r.URL.Query().Get("genre") != "sf" {
+			writeJSON(w, http.StatusNotFound, map[string]any{"error": "the requested resource could not be found"})
+			return
+		}
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		pages = append(pages, page)
+
+		var books []map[string]any
+		for id := (page-1)*pageSize + 1; id <= min(page*pageSize, total); id++ {
+			books = append(books, map[string]any{"id": id})
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"books": books,
+			"metadata": map[string]any{
+				"current_page":  page,
+				"page_size":     pageSize,
+				"first_page":    1,
+				"last_page":     (total + pageSize - 1) / pageSize,
+				"total_records": total,
+			},
+		})
+	})
+
+	c := newTestClient(t, handler, Config{})
+	query := BookQuery{Genre: "sf", ListOptions: ListOptions{PageSize: pageSize}}
+
+	var ids []int64
+	for book, err := range c.Books(context.Background(), query) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, book.ID)
+	}
+	if fmt.Sprint(ids) != "[1 2 3 4 5 6 7]" {
+		t.Errorf("got books %v; want 1 to 7", ids)
+	}
+	if fmt.Sprint(pages) != "[1 2 3]" {
+		t.Errorf("fetched pages %v; want 1, 2 and 3", pages)
+	}
+
+	// Stopping early doesn't fetch the pages after the current one.
+	pages = nil
+	for book := range c.Books(context.Background(), query) {
+		if book.ID == 2 {
+			break
+		}
+	}
+	if fmt.Sprint(pages) != "[1]" {
+		t.Errorf("fetched pages %v; want only 1", pages)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/books/1", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusNotFound, map[string]any{"error": "the requested resource could not be found"})
+	})
+	mux.HandleFunc("POST /v1/books/1/reviews", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]any{"error": map[string]string{"rating": "must be between 1 and 5"}})
+	})
+
+	c := newTestClient(t, mux, Config{})
+	ctx := context.Background()
+
+	_, err := c.GetBook(ctx, 1)
+	var apiErr *Error
+	if !errors.Is(err, ErrNotFound) || !errors.As(err, &apiErr) {
+		t.Fatalf("got error %v; want an *Error matching ErrNotFound", err)
+	}
+	if apiErr.Message != "the requested resource could not be found" {
+		t.Errorf("got message %q", apiErr.Message)
+	}
+
+	_, err = c.CreateReview(ctx, 1, ReviewInput{Rating: 9})
+	if !errors.Is(err, ErrValidation) || !errors.As(err, &apiErr) {
+		t.Fatalf("got error %v; want an *Error matching ErrValidation", err)
+	}
+	if apiErr.Fields["rating"] != "must be between 1 and 5" {
+		t.Errorf("got fields %v", apiErr.Fields)
+	}
+	if errors.Is(err, ErrNotFound) {
+		t.Error("a validation error matches ErrNotFound")
+	}
+}
@@ -0,0 +1,68 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Error is an error response from the API. The API answers most errors
+// with a message; a request that fails validation gets a message for each
+// invalid field in Fields instead.
+type Error struct {
+	StatusCode int
+	Message    string
+	Fields     map[string]string
+}
+
+func (e *Error) Error() string {
+	if len(e.Fields) == 0 {
+		return fmt.Sprintf("api: %d %s", e.StatusCode, e.Message)
+	}
+
+	fields := make([]string, 0, len(e.Fields))
+	for field, message := range e.Fields {
+		fields = append(fields, field+": "+message)
+	}
+	sort.Strings(fields)
+	return fmt.Sprintf("api: %d %s", e.StatusCode, strings.Join(fields, "; "))
+}
+
+// Is reports whether target is the sentinel error for e's status code, so
+// that callers can write errors.Is(err, client.ErrNotFound).
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Message == "" && t.Fields == nil && t.StatusCode == e.StatusCode
+}
+
+// tokenRejected reports whether the API turned the request away because
+// of its token, which it answers with 422 and an "error" field.
+func (e *Error) tokenRejected() bool {
+	if e.StatusCode != http.StatusUnprocessableEntity {
+		return false
+	}
+	switch e.Fields["error"] {
+	case "invalid token", "invalid token claims", "missing authorization token":
+		return true
+	}
+	return false
+}
+
+// Sentinel errors for the status codes the API answers with. Match them
+// with errors.Is; use errors.As with *Error for the details.
+var (
+	ErrBadRequest  = &Error{StatusCode: http.StatusBadRequest}
+	ErrForbidden   = &Error{StatusCode: http.StatusForbidden}
+	ErrNotFound    = &Error{StatusCode: http.StatusNotFound}
+	ErrConflict    = &Error{StatusCode: http.StatusConflict}
+	ErrTooLarge    = &Error{StatusCode: http.StatusRequestEntityTooLarge}
+	ErrValidation  = &Error{StatusCode: http.StatusUnprocessableEntity}
+	ErrRateLimited = &Error{StatusCode: http.StatusTooManyRequests}
+	ErrServer      = &Error{StatusCode: http.StatusInternalServerError}
+)
+
+// ErrNoCredentials is returned for a request that needs a token when the
+// client has neither a token nor credentials to log in with.
+var ErrNoCredentials = errors.New("client: the request needs a token; log in or configure credentials")
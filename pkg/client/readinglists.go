@@ -0,0 +1,73 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"net/http"
+)
+
+// ReadingListQuery narrows a list of reading lists. Name matches lists
+// whose name contains the text.
+type ReadingListQuery struct {
+	Name   string
+	Status string
+	ListOptions
+}
+
+// CreateReadingList creates a reading list. The request carries an
+// idempotency key, so retrying it can't create the list twice.
+func (c *Client) CreateReadingList(ctx context.Context, input ReadingListInput) (*ReadingList, error) {
+	var resp struct {
+		ReadingList *ReadingList `json:"readinglist"`
+	}
+	err := c.do(ctx, &request{method: http.MethodPost, path: "/v1/readinglists", body: input, idempotent: true}, &resp)
+	return resp.ReadingList, err
+}
+
+// GetReadingList returns the reading list with the given id.
+func (c *Client) GetReadingList(ctx context.Context, id int64) (*ReadingList, error) {
+	var resp struct {
+		ReadingList *ReadingList `json:"readinglist"`
+	}
+	err := c.do(ctx, &request{method: http.MethodGet, path: fmt.Sprintf("/v1/readinglists/%d", id)}, &resp)
+	return resp.ReadingList, err
+}
+
+// UpdateReadingList changes the fields of a reading list set in update and
+// returns the updated list.
+func (c *Client) UpdateReadingList(ctx context.Context, id int64, update ReadingListUpdate) (*ReadingList, error) {
+	var resp struct {
+		ReadingList *ReadingList `json:"readinglist"`
+	}
+	err := c.do(ctx, &request{method: http.MethodPatch, path: fmt.Sprintf("/v1/readinglists/%d", id), body: update}, &resp)
+	return resp.ReadingList, err
+}
+
+// DeleteReadingList deletes a reading list.
+func (c *Client) DeleteReadingList(ctx context.Context, id int64) error {
+	return c.do(ctx, &request{method: http.MethodDelete, path: fmt.Sprintf("/v1/readinglists/%d", id)}, nil)
+}
+
+// ListReadingLists returns one page of the reading lists matching query.
+func (c *Client) ListReadingLists(ctx context.Context, query ReadingListQuery) ([]*ReadingList, Metadata, error) {
+	q := query.values()
+	setIf(q, "name", query.Name)
+	setIf(q, "status", query.Status)
+
+	var resp struct {
+		ReadingLists []*ReadingList `json:"readinglists"`
+		Metadata     Metadata       `json:"metadata"`
+	}
+	err := c.do(ctx, &request{method: http.MethodGet, path: "/v1/readinglists", query: q}, &resp)
+	return resp.ReadingLists, resp.Metadata, err
+}
+
+// ReadingLists iterates over the reading lists matching query, page by
+// page.
+func (c *Client) ReadingLists(ctx context.Context, query ReadingListQuery) iter.Seq2[*ReadingList, error] {
+	return paginate(query.ListOptions, func(opts ListOptions) ([]*ReadingList, Metadata, error) {
+		query.ListOptions = opts
+		return c.ListReadingLists(ctx, query)
+	})
+}
@@ -0,0 +1,97 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"net/http"
+	"strconv"
+)
+
+// ReviewQuery narrows a list of reviews. Content matches reviews whose text
+// contains it; Rating, when not zero, matches that rating.
+type ReviewQuery struct {
+	Content string
+	Author  string
+	Rating  int
+	ListOptions
+}
+
+// CreateReview reviews a book. The request carries an idempotency key, so
+// retrying it can't post the review twice.
+func (c *Client) CreateReview(ctx context.Context, bookID int64, input ReviewInput) (*Review, error) {
+	var resp struct {
+		Review *Review `json:"review"`
+	}
+	err := c.do(ctx, &request{method: http.MethodPost, path: fmt.Sprintf("/v1/books/%d/reviews", bookID), body: input, idempotent: true}, &resp)
+	return resp.Review, err
+}
+
+// GetReview returns a review of a book.
+func (c *Client) GetReview(ctx context.Context, bookID, reviewID int64) (*Review, error) {
+	var resp struct {
+		Review *Review `json:"review"`
+	}
+	err := c.do(ctx, &request{method: http.MethodGet, path: fmt.Sprintf("/v1/books/%d/reviews/%d", bookID, reviewID)}, &resp)
+	return resp.Review, err
+}
+
+// UpdateReview changes the fields of a review set in update and returns
+// the updated review.
+func (c *Client) UpdateReview(ctx context.Context, bookID, reviewID int64, update ReviewUpdate) (*Review, error) {
+	var resp struct {
+		Review *Review `json:"review"`
+	}
+	err := c.do(ctx, &request{method: http.MethodPatch, path: fmt.Sprintf("/v1/books/%d/reviews/%d", bookID, reviewID), body: update}, &resp)
+	return resp.Review, err
+}
+
+// DeleteReview deletes a review of a book.
+func (c *Client) DeleteReview(ctx context.Context, bookID, reviewID int64) error {
+	return c.do(ctx, &request{method: http.MethodDelete, path: fmt.Sprintf("/v1/books/%d/reviews/%d", bookID, reviewID)}, nil)
+}
+
+// ListReviews returns one page of the reviews matching query.
+func (c *Client) ListReviews(ctx context.Context, query ReviewQuery) ([]*Review, Metadata, error) {
+	return c.listReviews(ctx, "/v1/reviews", query)
+}
+
+// Reviews iterates over the reviews matching query, page by page.
+func (c *Client) Reviews(ctx context.Context, query ReviewQuery) iter.Seq2[*Review, error] {
+	return c.reviewPages(ctx, "/v1/reviews", query)
+}
+
+// ListBookReviews returns one page of the reviews of a book that match
+// query.
+func (c *Client) ListBookReviews(ctx context.Context, bookID int64, query ReviewQuery) ([]*Review, Metadata, error) {
+	return c.listReviews(ctx, fmt.Sprintf("/v1/books/%d/reviews", bookID), query)
+}
+
+// BookReviews iterates over the reviews of a book that match query, page
+// by page.
+func (c *Client) BookReviews(ctx context.Context, bookID int64, query ReviewQuery) iter.Seq2[*Review, error] {
+	return c.reviewPages(ctx, fmt.Sprintf("/v1/books/%d/reviews", bookID), query)
+}
+
+func (c *Client) listReviews(ctx context.Context, path string, query ReviewQuery) ([]*Review, Metadata, error) {
+	q := query.values()
+	setIf(q, "content", query.Content)
+	setIf(q, "author", query.Author)
+	if query.Rating != 0 {
+		q.Set("rating", strconv.Itoa(query.Rating))
+	}
+
+	var resp struct {
+		Reviews  []*Review `json:"reviews"`
+		Metadata Metadata  `json:"metadata"`
+	}
+	err := c.do(ctx, &request{method: http.MethodGet, path: path, query: q}, &resp)
+	return resp.Reviews, resp.Metadata, err
+}
+
+func (c *Client) reviewPages(ctx context.Context, path string, query ReviewQuery) iter.Seq2[*Review, error] {
+	return paginate(query.ListOptions, func(opts ListOptions) ([]*Review, Metadata, error) {
+		query.ListOptions = opts
+		return c.listReviews(ctx, path, query)
+	})
+}
@@ -0,0 +1,186 @@
+package client
+
+import (
+	"iter"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/tchenbz/AWTtest_3/internal/data"
+)
+
+// The records the API returns are the server's own types, made available
+// here under public names.
+type (
+	Book        = data.Book
+	BookAuthor  = data.BookAuthor
+	BookGenre   = data.BookGenre
+	BookSeries  = data.BookSeries
+	Review      = data.Review
+	ReadingList = data.ReadingList
+	User        = data.User
+	Metadata    = data.Metadata
+)
+
+// BookInput holds the fields of a new book. Genres are given by id.
+type BookInput struct {
+	Title           string        `json:"title"`
+	Authors         []*BookAuthor `json:"authors"`
+	ISBN            string        `json:"isbn"`
+	PublicationDate string        `json:"publication_date"`
+	Genre           string        `json:"genre"`
+	GenreIDs        []int64       `json:"genre_ids,omitempty"`
+	Description     string        `json:"description"`
+	AverageRating   float64       `json:"average_rating"`
+	WorkID          int64         `json:"work_id,omitempty"`
+	Format          string        `json:"format,omitempty"`
+	Language        string        `json:"language,omitempty"`
+	Publisher       string        `json:"publisher,omitempty"`
+	PageCount       int           `json:"page_count,omitempty"`
+}
+
+// BookUpdate holds the fields of a book to change; nil fields are left as
+// they are.
+type BookUpdate struct {
+	Title           *string       `json:"title,omitempty"`
+	Authors         []*BookAuthor `json:"authors,omitempty"`
+	ISBN            *string       `json:"isbn,omitempty"`
+	PublicationDate *string       `json:"publication_date,omitempty"`
+	Genre           *string       `json:"genre,omitempty"`
+	GenreIDs        *[]int64      `json:"genre_ids,omitempty"`
+	Description     *string       `json:"description,omitempty"`
+	AverageRating   *float64      `json:"average_rating,omitempty"`
+	WorkID          *int64        `json:"work_id,omitempty"`
+	Format          *string       `json:"format,omitempty"`
+	Language        *string       `json:"language,omitempty"`
+	Publisher       *string       `json:"publisher,omitempty"`
+	PageCount       *int          `json:"page_count,omitempty"`
+}
+
+// ReviewInput holds the fields of a new review.
+type ReviewInput struct {
+	Content string `json:"content"`
+	Author  string `json:"author"`
+	Rating  int    `json:"rating"`
+}
+
+// ReviewUpdate holds the fields of a review to change; nil fields are left
+// as they are.
+type ReviewUpdate struct {
+	Content      *string `json:"content,omitempty"`
+	Author       *string `json:"author,omitempty"`
+	Rating       *int    `json:"rating,omitempty"`
+	HelpfulCount *int    `json:"helpful_count,omitempty"`
+}
+
+// ReadingListInput holds the fields of a new reading list.
+type ReadingListInput struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	CreatedBy   int64  `json:"created_by"`
+	Status      string `json:"status"`
+}
+
+// ReadingListUpdate holds the fields of a reading list to change; nil
+// fields are left as they are. Books replaces the books on the list.
+type ReadingListUpdate struct {
+	Name        *string  `json:"name,omitempty"`
+	Description *string  `json:"description,omitempty"`
+	Status      *string  `json:"status,omitempty"`
+	Books       *[]int64 `json:"books,omitempty"`
+}
+
+// UserInput holds the fields of a new user.
+type UserInput struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// UserUpdate holds the fields of a user to change; nil fields are left as
+// they are.
+type UserUpdate struct {
+	Username *string `json:"username,omitempty"`
+	Email    *string `json:"email,omitempty"`
+	Password *string `json:"password,omitempty"`
+}
+
+// Filter is a filter expression such as filter[average_rating][gte]=4.
+type Filter struct {
+	Field    string
+	Operator string
+	Value    string
+}
+
+// ListOptions selects a page of a list and how it is sorted and filtered.
+// Zero values leave the API's defaults in place. Iterators start at Page
+// and go on to the last page.
+type ListOptions struct {
+	Page     int
+	PageSize int
+	// Sort is a field to sort by, prefixed with - for descending order.
+	Sort    string
+	Filters []Filter
+	// Fields and Include limit the fields of each record and embed related
+	// records, where the list supports them.
+	Fields  []string
+	Include []string
+}
+
+func (o ListOptions) values() url.Values {
+	q := url.Values{}
+	if o.Page > 0 {
+		q.Set("page", strconv.Itoa(o.Page))
+	}
+	if o.PageSize > 0 {
+		q.Set("page_size", strconv.Itoa(o.PageSize))
+	}
+	if o.Sort != "" {
+		q.Set("sort", o.Sort)
+	}
+	for _, f := range o.Filters {
+		q.Add("filter["+f.Field+"]["+f.Operator+"]", f.Value)
+	}
+	if len(o.Fields) > 0 {
+		q.Set("fields", strings.Join(o.Fields, ","))
+	}
+	if len(o.Include) > 0 {
+		q.Set("include", strings.Join(o.Include, ","))
+	}
+	return q
+}
+
+// setIf sets key in q when value isn't empty.
+func setIf(q url.Values, key, value string) {
+	if value != "" {
+		q.Set(key, value)
+	}
+}
+
+// paginate returns an iterator over the records of every page from
+// opts.Page on, fetching each page as the iteration reaches it. An error
+// ends the iteration after it is yielded.
+func paginate[T any](opts ListOptions, fetch func(opts ListOptions) ([]T, Metadata, error)) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		if opts.Page < 1 {
+			opts.Page = 1
+		}
+		for {
+			records, metadata, err := fetch(opts)
+			if err != nil {
+				var zero T
+				yield(zero, err)
+				return
+			}
+			for _, record := range records {
+				if !yield(record, nil) {
+					return
+				}
+			}
+			if len(records) == 0 || metadata.CurrentPage >= metadata.LastPage {
+				return
+			}
+			opts.Page = metadata.CurrentPage + 1
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"net/http"
+)
+
+// CreateUser registers a user.
+func (c *Client) CreateUser(ctx context.Context, input UserInput) (*User, error) {
+	var resp struct {
+		User *User `json:"user"`
+	}
+	err := c.do(ctx, &request{method: http.MethodPost, path: "/v1/users", body: input}, &resp)
+	return resp.User, err
+}
+
+// GetUser returns the user with the given id.
+func (c *Client) GetUser(ctx context.Context, id int64) (*User, error) {
+	var resp struct {
+		User *User `json:"user"`
+	}
+	err := c.do(ctx, &request{method: http.MethodGet, path: fmt.Sprintf("/v1/users/%d", id)}, &resp)
+	return resp.User, err
+}
+
+// UpdateUser changes the fields of the logged-in user set in update and
+// returns the updated user. It needs a token; users can only update
+// themselves.
+func (c *Client) UpdateUser(ctx context.Context, id int64, update UserUpdate) (*User, error) {
+	var resp struct {
+		User *User `json:"user"`
+	}
+	err := c.do(ctx, &request{method: http.MethodPatch, path: fmt.Sprintf("/v1/users/%d", id), body: update, auth: true}, &resp)
+	return resp.User, err
+}
+
+// ListUserReadingLists returns one page of a user's reading lists.
+func (c *Client) ListUserReadingLists(ctx context.Context, id int64, opts ListOptions) ([]*ReadingList, Metadata, error) {
+	var resp struct {
+		ReadingLists []*ReadingList `json:"readinglists"`
+		Metadata     Metadata       `json:"metadata"`
+	}
+	err := c.do(ctx, &request{method: http.MethodGet, path: fmt.Sprintf("/v1/users/%d/lists", id), query: opts.values()}, &resp)
+	return resp.ReadingLists, resp.Metadata, err
+}
+
+// UserReadingLists iterates over a user's reading lists, page by page.
+func (c *Client) UserReadingLists(ctx context.Context, id int64, opts ListOptions) iter.Seq2[*ReadingList, error] {
+	return paginate(opts, func(opts ListOptions) ([]*ReadingList, Metadata, error) {
+		return c.ListUserReadingLists(ctx, id, opts)
+	})
+}
+
+// ListUserReviews returns one page of a user's reviews.
+func (c *Client) ListUserReviews(ctx context.Context, id int64, opts ListOptions) ([]*Review, Metadata, error) {
+	var resp struct {
+		Reviews  []*Review `json:"reviews"`
+		Metadata Metadata  `json:"metadata"`
+	}
+	err := c.do(ctx, &request{method: http.MethodGet, path: fmt.Sprintf("/v1/users/%d/reviews", id), query: opts.values()}, &resp)
+	return resp.Reviews, resp.Metadata, err
+}
+
+// UserReviews iterates over a user's reviews, page by page.
+func (c *Client) UserReviews(ctx context.Context, id int64, opts ListOptions) iter.Seq2[*Review, error] {
+	return paginate(opts, func(opts ListOptions) ([]*Review, Metadata, error) {
+		return c.ListUserReviews(ctx, id, opts)
+	})
+}